@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// AppConfig 是单个应用的音量配置
+type AppConfig struct {
+	Volume   float64 // 为 0 时不恢复音量
+	Mute     bool
+	SinkName string // 偏好的输出设备，为空时使用默认输出设备
+}
+
+// AppConfigKeeper 保存每个应用的音量、静音和输出设备
+type AppConfigKeeper struct {
+	mu   sync.Mutex
+	Apps map[string]*AppConfig // 应用标识 => AppConfig
+	file string                // 配置文件路径
+}
+
+// 创建单例
+func createAppConfigKeeperSingleton(path string) func() *AppConfigKeeper {
+	var ak *AppConfigKeeper = nil
+	return func() *AppConfigKeeper {
+		if ak == nil {
+			ak = NewAppConfigKeeper(path)
+		}
+		return ak
+	}
+}
+
+// 获取单例
+var globalAppConfigKeeperFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/audio-app-config-keeper.json")
+var GetAppConfigKeeper = createAppConfigKeeperSingleton(globalAppConfigKeeperFile)
+
+func NewAppConfigKeeper(path string) *AppConfigKeeper {
+	return &AppConfigKeeper{
+		Apps: make(map[string]*AppConfig),
+		file: path,
+	}
+}
+
+// 调用者需要持有 ak.mu
+func (ak *AppConfigKeeper) save() error {
+	data, err := json.MarshalIndent(ak.Apps, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(ak.file), 0755)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = ioutil.WriteFile(ak.file, data, 0644)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	return nil
+}
+
+func (ak *AppConfigKeeper) Save() error {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	return ak.save()
+}
+
+func (ak *AppConfigKeeper) Load() error {
+	data, err := ioutil.ReadFile(ak.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return err
+	}
+
+	apps := make(map[string]*AppConfig)
+	err = json.Unmarshal(data, &apps)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	for appId, app := range apps {
+		if app == nil {
+			delete(apps, appId)
+		}
+	}
+
+	ak.mu.Lock()
+	ak.Apps = apps
+	ak.mu.Unlock()
+	return nil
+}
+
+// GetAppConfig 返回应用配置的副本，没有配置时返回 nil
+func (ak *AppConfigKeeper) GetAppConfig(appId string) *AppConfig {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	app, ok := ak.Apps[appId]
+	if !ok {
+		return nil
+	}
+	appCopy := *app
+	return &appCopy
+}
+
+// GetAppConfigs 返回所有应用配置的副本
+func (ak *AppConfigKeeper) GetAppConfigs() map[string]AppConfig {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	result := make(map[string]AppConfig, len(ak.Apps))
+	for appId, app := range ak.Apps {
+		result[appId] = *app
+	}
+	return result
+}
+
+// 调用者需要持有 ak.mu，返回的 created 表示是否新建了配置
+func (ak *AppConfigKeeper) getOrNewAppConfig(appId string) (app *AppConfig, created bool) {
+	app, ok := ak.Apps[appId]
+	if !ok {
+		app = &AppConfig{}
+		ak.Apps[appId] = app
+	}
+	return app, !ok
+}
+
+func (ak *AppConfigKeeper) SetAppConfig(appId string, config AppConfig) {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	ak.Apps[appId] = &config
+	ak.save()
+}
+
+// RemoveAppConfig 删除应用配置，返回配置是否存在
+func (ak *AppConfigKeeper) RemoveAppConfig(appId string) bool {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	if _, ok := ak.Apps[appId]; !ok {
+		return false
+	}
+	delete(ak.Apps, appId)
+	ak.save()
+	return true
+}
+
+func (ak *AppConfigKeeper) SetVolume(appId string, volume float64) {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	app, created := ak.getOrNewAppConfig(appId)
+	if !created && app.Volume == volume {
+		return
+	}
+	app.Volume = volume
+	ak.save()
+}
+
+func (ak *AppConfigKeeper) SetMute(appId string, mute bool) {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	app, created := ak.getOrNewAppConfig(appId)
+	if !created && app.Mute == mute {
+		return
+	}
+	app.Mute = mute
+	ak.save()
+}
+
+func (ak *AppConfigKeeper) SetSinkName(appId string, sinkName string) {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	app, created := ak.getOrNewAppConfig(appId)
+	if !created && app.SinkName == sinkName {
+		return
+	}
+	app.SinkName = sinkName
+	ak.save()
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppConfigKeeper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-app-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sub/audio-app-config-keeper.json")
+
+	ak := NewAppConfigKeeper(file)
+	assert.Error(t, ak.Load())
+	assert.Nil(t, ak.GetAppConfig("deepin-music"))
+
+	ak.SetVolume("deepin-music", 0.6)
+	ak.SetMute("deepin-music", true)
+	ak.SetSinkName("firefox", "alsa_output.usb")
+	ak.SetMute("mpv", false)
+
+	ak2 := NewAppConfigKeeper(file)
+	require.NoError(t, ak2.Load())
+	assert.Equal(t, map[string]AppConfig{
+		"deepin-music": {Volume: 0.6, Mute: true},
+		"firefox":      {SinkName: "alsa_output.usb"},
+		"mpv":          {},
+	}, ak2.GetAppConfigs())
+
+	// 返回的是副本
+	app := ak2.GetAppConfig("deepin-music")
+	require.NotNil(t, app)
+	app.Volume = 1
+	assert.Equal(t, 0.6, ak2.GetAppConfig("deepin-music").Volume)
+
+	ak2.SetAppConfig("firefox", AppConfig{Volume: 0.3})
+	assert.Equal(t, &AppConfig{Volume: 0.3}, ak2.GetAppConfig("firefox"))
+	assert.True(t, ak2.RemoveAppConfig("mpv"))
+	assert.False(t, ak2.RemoveAppConfig("mpv"))
+
+	ak3 := NewAppConfigKeeper(file)
+	require.NoError(t, ak3.Load())
+	assert.Equal(t, map[string]AppConfig{
+		"deepin-music": {Volume: 0.6, Mute: true},
+		"firefox":      {Volume: 0.3},
+	}, ak3.GetAppConfigs())
+}
+
+func TestGetSinkInputAppId(t *testing.T) {
+	newInfo := func(props map[string]string) *pulse.SinkInput {
+		return &pulse.SinkInput{PropList: props}
+	}
+
+	assert.Equal(t, "smplayer", getSinkInputAppId(newInfo(map[string]string{
+		PropAppProcessBinary: "mpv",
+		PropAppName:          "SMPlayer",
+	}), "smplayer"))
+	assert.Equal(t, "deepin-music", getSinkInputAppId(newInfo(map[string]string{
+		PropAppProcessBinary: "deepin-music",
+		PropAppName:          "Music",
+	}), ""))
+	assert.Equal(t, "Music", getSinkInputAppId(newInfo(map[string]string{
+		PropAppName: "Music",
+	}), ""))
+}
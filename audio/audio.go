@@ -17,9 +17,11 @@ import (
 
 	dbus "github.com/godbus/dbus"
 	"github.com/linuxdeepin/dde-daemon/common/dsync"
+	ofdbus "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.dbus"
 	gio "github.com/linuxdeepin/go-gir/gio-2.0"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/dbusutil/gsprop"
+	"github.com/linuxdeepin/go-lib/dbusutil/proxy"
 	"github.com/linuxdeepin/go-lib/pulse"
 	"golang.org/x/xerrors"
 )
@@ -61,8 +63,8 @@ var (
 	gMaxUIVolume                 float64
 )
 
-//go:generate dbusutil-gen -type Audio,Sink,SinkInput,Source,Meter -import github.com/godbus/dbus audio.go sink.go sinkinput.go source.go meter.go
-//go:generate dbusutil-gen em -type Audio,Sink,SinkInput,Source,Meter
+//go:generate dbusutil-gen -type Audio,Sink,SinkInput,Source,SourceOutput,Meter,ChannelMeter -import github.com/godbus/dbus audio.go sink.go sinkinput.go source.go sourceoutput.go meter.go channel_meter.go
+//go:generate dbusutil-gen em -type Audio,Sink,SinkInput,Source,SourceOutput,Meter,ChannelMeter
 
 func objectPathSliceEqual(v1, v2 []dbus.ObjectPath) bool {
 	if len(v1) != len(v2) {
@@ -99,7 +101,9 @@ type Audio struct {
 	// dbusutil-gen: equal=objectPathSliceEqual
 	Sinks []dbus.ObjectPath
 	// dbusutil-gen: equal=objectPathSliceEqual
-	Sources                 []dbus.ObjectPath
+	Sources []dbus.ObjectPath
+	// dbusutil-gen: equal=objectPathSliceEqual
+	SourceOutputs           []dbus.ObjectPath
 	DefaultSink             dbus.ObjectPath
 	DefaultSource           dbus.ObjectPath
 	Cards                   string
@@ -111,21 +115,35 @@ type Audio struct {
 	// dbusutil-gen: ignore
 	IncreaseVolume gsprop.Bool `prop:"access:rw"`
 
-	ReduceNoise  bool `prop:"access:rw"`
-	defaultPaCfg defaultPaConfig
+	ReduceNoise bool `prop:"access:rw"`
+	// 降噪使用的预设，保存在当前输入端口的配置中
+	ReduceNoisePreset string `prop:"access:rw"`
+	// dbusutil-gen: equal=isStrvEqual
+	ReduceNoisePresets []string // 可用的降噪预设
+	defaultPaCfg       defaultPaConfig
 
 	// 最大音量
 	MaxUIVolume float64 // readonly
 
+	// 通信类的流存在时是否降低其他流的音量
+	DuckingEnabled bool `prop:"access:rw"`
+	// 降低音量的比例，范围 0 ~ 1
+	DuckingAttenuation float64 `prop:"access:rw"`
+	// dbusutil-gen: equal=isStrvEqual
+	DuckingRoles []string `prop:"access:rw"` // 触发降低音量的 media.role
+	// dbusutil-gen: equal=isStrvEqual
+	DuckingApps []string `prop:"access:rw"` // 触发降低音量的应用，和 SinkInput 的 AppId 相同
+
 	headphoneUnplugAutoPause bool
 
 	settings  *gio.Settings
-	ctx       *pulse.Context
+	ctx       audioBackend
 	eventChan chan *pulse.Event
 	stateChan chan int
 
 	// 正常输出声音的程序列表
 	sinkInputs        map[uint32]*SinkInput
+	sourceOutputs     map[uint32]*SourceOutput
 	defaultSink       *Sink
 	defaultSource     *Source
 	sinks             map[uint32]*Sink
@@ -133,8 +151,15 @@ type Audio struct {
 	defaultSinkName   string
 	defaultSourceName string
 	meters            map[string]*Meter
+	channelMeters     map[string]*ChannelMeter
+	channelMetersMu   sync.Mutex
+	ducking           *duckingPolicy
+	echoCancel        *echoCancelManager
 	mu                sync.Mutex
 	quit              chan struct{}
+	eventLoopRunning  bool // init 成功后为 true，由 mu 保护
+
+	virtualSinks *virtualSinkManager
 
 	oldCards CardList // cards在上次更新前的状态，用于判断Port是否是新插入的
 	cards    CardList
@@ -146,8 +171,9 @@ type Audio struct {
 
 	portLocker sync.Mutex
 
-	syncConfig     *dsync.Config
-	sessionSigLoop *dbusutil.SignalLoop
+	syncConfig        *dsync.Config
+	sessionSigLoop    *dbusutil.SignalLoop
+	sessionDBusDaemon ofdbus.DBus
 
 	noRestartPulseAudio bool
 
@@ -165,6 +191,7 @@ type Audio struct {
 	// 自动端口切换
 	enableAutoSwitchPort bool
 	systemSigLoop        *dbusutil.SignalLoop
+	dsgConfigManager     dbus.BusObject
 	// 用来进一步断是否需要暂停播放的信息
 	misc uint32
 
@@ -175,6 +202,26 @@ type Audio struct {
 			portName string
 			enabled  bool
 		}
+
+		// 用户的端口优先级列表改变
+		PortPrioritiesChanged struct {
+			direction int32
+			ports     []PortPriority
+		}
+
+		// 有程序开始录音
+		RecordingStarted struct {
+			sourceOutput dbus.ObjectPath
+			name         string
+			pid          uint32
+		}
+
+		// 程序停止录音
+		RecordingStopped struct {
+			sourceOutput dbus.ObjectPath
+			name         string
+			pid          uint32
+		}
 	}
 }
 
@@ -184,7 +231,17 @@ func newAudio(service *dbusutil.Service) *Audio {
 		meters:       make(map[string]*Meter),
 		MaxUIVolume:  pulse.VolumeUIMax,
 		enableSource: true,
+
+		channelMeters: make(map[string]*ChannelMeter),
+
+		ReduceNoisePreset:  defaultReduceNoisePreset,
+		ReduceNoisePresets: getEchoCancelPresetNames(),
+
+		DuckingEnabled:     defaultDuckingEnabled,
+		DuckingAttenuation: defaultDuckingAttenuation,
+		DuckingRoles:       append([]string(nil), defaultDuckingRoles...),
 	}
+	a.ducking = newDuckingPolicy(a.getDuckingConfig(), a.setDuckingVolume)
 
 	a.settings = gio.NewSettings(gsSchemaAudio)
 	a.settings.Reset(gsKeyInputVolume)
@@ -206,6 +263,14 @@ func newAudio(service *dbusutil.Service) *Audio {
 		a.sessionSigLoop, dbusPath, logger)
 	a.sessionSigLoop.Start()
 
+	// 订阅电平表的程序退出时取消订阅
+	a.sessionDBusDaemon = ofdbus.NewDBus(service.Conn())
+	a.sessionDBusDaemon.InitSignalExt(a.sessionSigLoop, true)
+	_, err := a.sessionDBusDaemon.ConnectNameOwnerChanged(a.handleNameOwnerChanged)
+	if err != nil {
+		logger.Warning(err)
+	}
+
 	return a
 }
 
@@ -234,12 +299,13 @@ func startPulseaudio(count int) error {
 	return nil
 }
 
-func getCtx() (ctx *pulse.Context, err error) {
-	ctx = pulse.GetContextForced()
-	if ctx == nil {
+func getCtx() (ctx audioBackend, err error) {
+	pulseCtx := pulse.GetContextForced()
+	if pulseCtx == nil {
 		err = errors.New("failed to get pulse context")
 		return
 	}
+	ctx = newPulseBackend(pulseCtx)
 	return
 }
 
@@ -259,6 +325,7 @@ func (a *Audio) addSink(sinkInfo *pulse.Sink) {
 		logger.Warning(err)
 	}
 	a.updatePropSinks()
+	a.moveSinkInputsToPreferredSink(sinkInfo.Name, sinkInfo.Index)
 }
 
 // 添加一个新的source,参数是pulse的Source
@@ -287,6 +354,33 @@ func (a *Audio) addSinkInput(sinkInputInfo *pulse.SinkInput) {
 	logger.Debug("updatePropSinkInputs")
 	a.updatePropSinkInputs()
 	logger.Debug("updatePropSinkInputs done")
+	a.resumeSinkInputConfig(sinkInput)
+}
+
+// 添加一个新的source-output,参数是pulse的SourceOutput
+func (a *Audio) addSourceOutput(sourceOutputInfo *pulse.SourceOutput) {
+	sourceOutput := newSourceOutput(sourceOutputInfo, a)
+	a.sourceOutputs[sourceOutputInfo.Index] = sourceOutput
+	err := a.service.Export(sourceOutput.getPath(), sourceOutput)
+	if err != nil {
+		logger.Warning(err)
+	}
+	a.updatePropSourceOutputs()
+	a.emitRecordingSignal("RecordingStarted", sourceOutput)
+}
+
+// 发送录音开始或停止的信号，不可见的source-output不发送
+func (a *Audio) emitRecordingSignal(name string, sourceOutput *SourceOutput) {
+	if !sourceOutput.visible {
+		return
+	}
+	appName := sourceOutput.getPropName()
+	pid := sourceOutput.getPropProcessId()
+	logger.Debugf("%s: source-output #%d, app %q, pid %d", name, sourceOutput.index, appName, pid)
+	err := a.service.Emit(a, name, sourceOutput.getPath(), appName, pid)
+	if err != nil {
+		logger.Warning(err)
+	}
 }
 
 func (a *Audio) refreshSinks() {
@@ -391,6 +485,44 @@ func (a *Audio) refershSinkInputs() {
 	}
 }
 
+func (a *Audio) refreshSourceOutputs() {
+	if a.sourceOutputs == nil {
+		a.sourceOutputs = make(map[uint32]*SourceOutput)
+	}
+
+	// 获取当前的source-outputs
+	sourceOutputInfoMap := make(map[uint32]*pulse.SourceOutput)
+	sourceOutputInfoList := a.ctx.GetSourceOutputList()
+
+	for _, sourceOutputInfo := range sourceOutputInfoList {
+		sourceOutputInfoMap[sourceOutputInfo.Index] = sourceOutputInfo
+		sourceOutput, exist := a.sourceOutputs[sourceOutputInfo.Index]
+		if exist {
+			logger.Debugf("update source-output #%d", sourceOutputInfo.Index)
+			sourceOutput.update(sourceOutputInfo)
+		} else {
+			logger.Debugf("add source-output #%d", sourceOutputInfo.Index)
+			a.addSourceOutput(sourceOutputInfo)
+		}
+	}
+
+	// 删除不存在的旧source-outputs
+	changed := false
+	for key, sourceOutput := range a.sourceOutputs {
+		_, exist := sourceOutputInfoMap[key]
+		if !exist {
+			logger.Debugf("delete source-output #%d", key)
+			a.service.StopExport(sourceOutput)
+			delete(a.sourceOutputs, key)
+			changed = true
+			a.emitRecordingSignal("RecordingStopped", sourceOutput)
+		}
+	}
+	if changed {
+		a.updatePropSourceOutputs()
+	}
+}
+
 func (a *Audio) shouldAutoPause() bool {
 	if a.defaultSink == nil {
 		logger.Debug("default sink is nil")
@@ -514,6 +646,8 @@ func (a *Audio) refresh() {
 	a.refreshSources()
 	logger.Debug("refresh sinkinputs")
 	a.refershSinkInputs()
+	logger.Debug("refresh sourceoutputs")
+	a.refreshSourceOutputs()
 	logger.Debug("refresh default")
 	a.refreshDefaultSinkSource()
 	logger.Debug("refresh bluetooth mode opts")
@@ -538,6 +672,9 @@ func (a *Audio) init() error {
 	logger.Debugf("defaultPaConfig: %+v", a.defaultPaCfg)
 
 	a.ctx = ctx
+	a.echoCancel = newEchoCancelManager(ctx)
+	a.echoCancel.unloadStale()
+	a.virtualSinks = newVirtualSinkManager(ctx)
 
 	err = a.initDsgProp()
 	if err != nil {
@@ -549,7 +686,7 @@ func (a *Audio) init() error {
 	a.oldCards = a.cards
 	for _, card := range a.cards {
 		if isBluezAudio(card.core.Name) {
-			card.AutoSetBluezMode()
+			card.AutoSetBluezMode(a.ctx)
 		}
 	}
 
@@ -583,6 +720,9 @@ func (a *Audio) init() error {
 
 	GetBluezAudioManager().Load()
 	GetConfigKeeper().Load()
+	GetAppConfigKeeper().Load()
+	GetSceneKeeper().Load()
+	GetVirtualSinkKeeper().Load()
 
 	logger.Debug("init cards")
 	a.PropsMu.Lock()
@@ -595,6 +735,9 @@ func (a *Audio) init() error {
 	a.quit = make(chan struct{})
 	a.ctx.AddEventChan(a.eventChan)
 	a.ctx.AddStateChan(a.stateChan)
+	a.mu.Lock()
+	a.eventLoopRunning = true
+	a.mu.Unlock()
 	a.inputAutoSwitchCount = 0
 	a.outputAutoSwitchCount = 0
 
@@ -606,6 +749,9 @@ func (a *Audio) init() error {
 	go a.handleStateChanged()
 	logger.Debug("init done")
 
+	// 在事件处理开始后加载，新增的 sink 会通过事件更新
+	a.syncVirtualSinks()
+
 	firstRun := a.settings.GetBoolean(gsKeyFirstRun)
 	if firstRun {
 		logger.Info("first run, Will remove old audio config")
@@ -627,6 +773,17 @@ func (a *Audio) init() error {
 	a.fixActivePortNotAvailable()
 	a.moveSinkInputsToDefaultSink()
 
+	// 已经存在的sink-input没有添加事件，在这里加入ducking策略
+	a.mu.Lock()
+	sinkInputs := make([]*SinkInput, 0, len(a.sinkInputs))
+	for _, sinkInput := range a.sinkInputs {
+		sinkInputs = append(sinkInputs, sinkInput)
+	}
+	a.mu.Unlock()
+	for _, sinkInput := range sinkInputs {
+		a.addSinkInputToDucking(sinkInput)
+	}
+
 	// 蓝牙支持的模式
 	a.setPropBluetoothAudioModeOpts([]string{"a2dp", "headset"})
 
@@ -635,6 +792,13 @@ func (a *Audio) init() error {
 
 func (a *Audio) destroyCtxRelated() {
 	a.mu.Lock()
+	if !a.eventLoopRunning {
+		// init 失败了，事件处理没有开始，也没有导出 sink 等对象
+		a.ctx = nil
+		a.mu.Unlock()
+		return
+	}
+	a.eventLoopRunning = false
 	a.ctx.RemoveEventChan(a.eventChan)
 	a.ctx.RemoveStateChan(a.stateChan)
 	close(a.quit)
@@ -664,6 +828,14 @@ func (a *Audio) destroyCtxRelated() {
 	}
 	a.sinkInputs = nil
 
+	for _, sourceOutput := range a.sourceOutputs {
+		err := a.service.StopExportByPath(sourceOutput.getPath())
+		if err != nil {
+			logger.Warningf("failed to stop export source output #%d: %v", sourceOutput.index, err)
+		}
+	}
+	a.sourceOutputs = nil
+
 	for _, meter := range a.meters {
 		err := a.service.StopExport(meter)
 		if err != nil {
@@ -671,12 +843,17 @@ func (a *Audio) destroyCtxRelated() {
 		}
 	}
 	a.mu.Unlock()
+	a.stopChannelMeters()
+	a.ducking.clear()
 }
 
 func (a *Audio) destroy() {
 	a.settings.Unref()
+	a.sessionDBusDaemon.RemoveHandler(proxy.RemoveAllHandlers)
 	a.sessionSigLoop.Stop()
-	a.systemSigLoop.Stop()
+	if a.systemSigLoop != nil {
+		a.systemSigLoop.Stop()
+	}
 	a.syncConfig.Destroy()
 	a.destroyCtxRelated()
 }
@@ -833,6 +1010,7 @@ func (a *Audio) SetPort(cardId uint32, portName string, direction int32) *dbus.E
 		// priorities.Print()
 		GetPriorityManager().SetFirstInputPort(card.core.Name, portName)
 	}
+	a.notifyUserPortPriorities(int(direction))
 
 	return dbusutil.ToError(err)
 }
@@ -969,7 +1147,7 @@ func (a *Audio) setPort(cardId uint32, portName string, direction int) error {
 	if direction == pulse.DirectionSink && targetPortInfo.Profiles.Exists("a2dp_sink") {
 		targetProfile = "a2dp_sink"
 	}
-	card.core.SetProfile(targetProfile)
+	a.ctx.SetCardProfile(card.Id, targetProfile)
 	logger.Debug("set profile", targetProfile)
 	return setDefaultPort()
 }
@@ -1034,6 +1212,10 @@ func (a *Audio) moveSinkInputsToSink(sinkId uint32) {
 		if sinkInput.getPropSinkIndex() == sinkId {
 			continue
 		}
+		// 偏好其他输出设备的应用不跟随移动
+		if _, ok := a.getPreferredSinkIndex(sinkInput); ok {
+			continue
+		}
 
 		list = append(list, sinkInput.index)
 	}
@@ -1058,20 +1240,26 @@ func (*Audio) GetInterfaceName() string {
 	return dbusInterface
 }
 
+// 设置 IncreaseVolume 并写入 gsettings，测试时替换为不使用 gsettings 的实现
+var setIncreaseVolume = func(a *Audio, enabled bool) {
+	a.IncreaseVolume.Set(enabled)
+}
+
 func (a *Audio) resumeSinkConfig(s *Sink) {
 	if s == nil {
 		logger.Warning("nil sink")
 		return
 	}
-	if s.ActivePort.Name == "" {
+	cardName, portName := a.getSinkConfigKey(s)
+	if portName == "" {
 		logger.Debug("no active port")
 		return
 	}
 
-	logger.Debugf("resume sink %s %s", a.getCardNameById(s.Card), s.ActivePort.Name)
-	_, portConfig := GetConfigKeeper().GetCardAndPortConfig(a.getCardNameById(s.Card), s.ActivePort.Name)
+	logger.Debugf("resume sink %s %s", cardName, portName)
+	_, portConfig := GetConfigKeeper().GetCardAndPortConfig(cardName, portName)
 
-	a.IncreaseVolume.Set(portConfig.IncreaseVolume)
+	setIncreaseVolume(a, portConfig.IncreaseVolume)
 	if portConfig.IncreaseVolume {
 		a.MaxUIVolume = increaseMaxVolume
 	} else {
@@ -1114,6 +1302,13 @@ func (a *Audio) resumeSourceConfig(s *Source, isPhyDev bool) {
 	// 不要在降噪通道上重复开启降噪
 	if isPhyDev {
 		logger.Debugf("physical source, set reduce noise %v", portConfig.ReduceNoise)
+		preset := portConfig.ReduceNoisePreset
+		if preset == "" {
+			preset = defaultReduceNoisePreset
+		}
+		a.PropsMu.Lock()
+		a.setPropReduceNoisePreset(preset)
+		a.PropsMu.Unlock()
 		err := a.setReduceNoise(portConfig.ReduceNoise)
 		if err != nil {
 			logger.Warning(err)
@@ -1279,7 +1474,7 @@ func (a *Audio) updateDefaultSource(sourceName string) {
 	logger.Debug("set prop default source:", defaultSourcePath)
 }
 
-func (a *Audio) context() *pulse.Context {
+func (a *Audio) context() audioBackend {
 	a.mu.Lock()
 	c := a.ctx
 	a.mu.Unlock()
@@ -1316,6 +1511,28 @@ func (a *Audio) getDefaultSourceName() string {
 	return v
 }
 
+func (a *Audio) getSinkByPath(path dbus.ObjectPath) *Sink {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, sink := range a.sinks {
+		if sink.getPath() == path {
+			return sink
+		}
+	}
+	return nil
+}
+
+func (a *Audio) getSourceByPath(path dbus.ObjectPath) *Source {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, source := range a.sources {
+		if source.getPath() == path {
+			return source
+		}
+	}
+	return nil
+}
+
 func (a *Audio) getDefaultSink() *Sink {
 	a.mu.Lock()
 	v := a.defaultSink
@@ -1455,7 +1672,7 @@ func (a *Audio) SetBluetoothAudioMode(mode string) *dbus.Error {
 
 			GetBluezAudioManager().SetMode(card.core.Name, mode)
 			logger.Debugf("set profile %s", profile.Name)
-			card.core.SetProfile(profile.Name)
+			a.ctx.SetCardProfile(card.Id, profile.Name)
 
 			// 手动切换蓝牙模式为headset，
 			if mode == bluezModeHeadset {
@@ -1497,6 +1714,7 @@ func (a *Audio) initDsgProp() error {
 
 	var val bool
 	systemConnObj = systemBus.Object("org.desktopspec.ConfigManager", configManagerPath)
+	a.dsgConfigManager = systemConnObj
 	err = systemConnObj.Call("org.desktopspec.ConfigManager.Manager.value", 0, dsgKeyAutoSwitchPort).Store(&val)
 	if err != nil {
 		logger.Warning(err)
@@ -1534,6 +1752,11 @@ func (a *Audio) initDsgProp() error {
 		logger.Info("port filter list", portFilterList)
 	}
 
+	for _, key := range []string{dsgKeyDuckingEnabled, dsgKeyDuckingAttenuation, dsgKeyDuckingRoles, dsgKeyDuckingApps} {
+		a.loadDuckingDsgValue(key)
+	}
+	a.ducking.setConfig(a.getDuckingConfig())
+
 	// 监听dsg配置变化
 	a.systemSigLoop.AddHandler(&dbusutil.SignalRule{
 		Name: "org.desktopspec.ConfigManager.Manager.valueChanged",
@@ -1551,6 +1774,10 @@ func (a *Audio) initDsgProp() error {
 					a.enableAutoSwitchPort = val
 					a.PropsMu.Unlock()
 				}
+			} else if ok && isDuckingDsgKey(key) {
+				if a.loadDuckingDsgValue(key) {
+					a.ducking.setConfig(a.getDuckingConfig())
+				}
 			}
 
 		}
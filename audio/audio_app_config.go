@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+// 恢复sink-input所属应用保存的音量、静音和输出设备，在添加sink-input时调用
+func (a *Audio) resumeSinkInputConfig(s *SinkInput) {
+	appId := s.getPropAppId()
+	if appId == "" {
+		return
+	}
+	app := GetAppConfigKeeper().GetAppConfig(appId)
+	if app == nil {
+		return
+	}
+	logger.Debugf("resume config of sink-input #%d for app %q: %+v", s.index, appId, *app)
+	a.applyAppConfig(s, app)
+}
+
+func (a *Audio) applyAppConfig(s *SinkInput, app *AppConfig) {
+	ctx := a.context()
+	if ctx == nil {
+		return
+	}
+
+	s.PropsMu.RLock()
+	cv := s.cVolume
+	mute := s.Mute
+	sinkIndex := s.SinkIndex
+	s.PropsMu.RUnlock()
+
+	if app.Volume > 0 && math.Abs(cv.Avg()-app.Volume) > 0.001 {
+		ctx.SetSinkInputVolume(s.index, cv.SetAvg(app.Volume))
+	}
+	if app.Mute != mute {
+		ctx.SetSinkInputMute(s.index, app.Mute)
+	}
+	if app.SinkName != "" {
+		sinkInfo := a.getSinkInfoByName(app.SinkName)
+		if sinkInfo != nil && sinkInfo.Index != sinkIndex {
+			logger.Debugf("move sink-input #%d to preferred sink %s", s.index, app.SinkName)
+			ctx.MoveSinkInputsByIndex([]uint32{s.index}, sinkInfo.Index)
+		}
+	}
+}
+
+// 获取应用偏好的输出设备的索引，没有偏好或者设备不存在时返回false，调用者需要持有 a.mu
+func (a *Audio) getPreferredSinkIndex(s *SinkInput) (uint32, bool) {
+	appId := s.getPropAppId()
+	if appId == "" {
+		return 0, false
+	}
+	app := GetAppConfigKeeper().GetAppConfig(appId)
+	if app == nil || app.SinkName == "" {
+		return 0, false
+	}
+	for _, sink := range a.sinks {
+		if sink.Name == app.SinkName {
+			return sink.index, true
+		}
+	}
+	return 0, false
+}
+
+// 输出设备出现后，把偏好此设备的应用的sink-input移动过去
+func (a *Audio) moveSinkInputsToPreferredSink(sinkName string, sinkIndex uint32) {
+	a.mu.Lock()
+	var list []uint32
+	for _, sinkInput := range a.sinkInputs {
+		appId := sinkInput.getPropAppId()
+		if appId == "" || sinkInput.getPropSinkIndex() == sinkIndex {
+			continue
+		}
+		app := GetAppConfigKeeper().GetAppConfig(appId)
+		if app != nil && app.SinkName == sinkName {
+			list = append(list, sinkInput.index)
+		}
+	}
+	a.mu.Unlock()
+	if len(list) == 0 {
+		return
+	}
+	logger.Debugf("move sink inputs %v to preferred sink #%d", list, sinkIndex)
+	a.context().MoveSinkInputsByIndex(list, sinkIndex)
+}
+
+// GetAppConfigs 返回所有应用保存的音量配置，格式为应用标识到 AppConfig 的 JSON 对象，
+// 应用标识和 SinkInput 的 AppId 属性相同
+func (a *Audio) GetAppConfigs() (configsJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(GetAppConfigKeeper().GetAppConfigs())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SetAppConfig 修改应用的音量配置，并应用到此应用正在播放的sink-input上。
+// volume 为 0 时不恢复音量，sinkName 为空时使用默认输出设备
+func (a *Audio) SetAppConfig(appId string, volume float64, mute bool, sinkName string) *dbus.Error {
+	if appId == "" {
+		return dbusutil.ToError(fmt.Errorf("empty app id"))
+	}
+	if volume != 0 && !isVolumeValid(volume) {
+		return dbusutil.ToError(fmt.Errorf("invalid volume value: %v", volume))
+	}
+
+	app := AppConfig{
+		Volume:   volume,
+		Mute:     mute,
+		SinkName: sinkName,
+	}
+	GetAppConfigKeeper().SetAppConfig(appId, app)
+
+	a.mu.Lock()
+	var sinkInputs []*SinkInput
+	for _, sinkInput := range a.sinkInputs {
+		if sinkInput.getPropAppId() == appId {
+			sinkInputs = append(sinkInputs, sinkInput)
+		}
+	}
+	a.mu.Unlock()
+	for _, sinkInput := range sinkInputs {
+		a.applyAppConfig(sinkInput, &app)
+	}
+	return nil
+}
+
+// RemoveAppConfig 删除应用保存的音量配置，正在播放的sink-input不受影响
+func (a *Audio) RemoveAppConfig(appId string) *dbus.Error {
+	if !GetAppConfigKeeper().RemoveAppConfig(appId) {
+		return dbusutil.ToError(fmt.Errorf("app config %q not found", appId))
+	}
+	return nil
+}
@@ -5,8 +5,8 @@
 package audio
 
 import (
+	"errors"
 	"os"
-	"os/exec"
 	"time"
 
 	dbus "github.com/godbus/dbus"
@@ -122,22 +122,51 @@ func (a *Audio) doSaveConfig() {
 
 }
 
+// 获取降噪绑定的物理输入设备，默认输入设备是降噪通道时返回降噪模块绑定的设备
+func (a *Audio) getReduceNoiseMasterSource() *Source {
+	source := a.getDefaultSource()
+	if source == nil {
+		return nil
+	}
+	if isPhysicalDevice(source.Name) {
+		return source
+	}
+	master := a.echoCancel.getMaster()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, s := range a.sources {
+		if s.Name == master {
+			return s
+		}
+	}
+	return nil
+}
+
+// 开启降噪时在当前的物理输入设备上加载 module-echo-cancel，并把降噪通道设为默认输入设备，
+// 使用的预设从端口配置中读取；关闭降噪时卸载模块，把默认输入设备恢复为绑定的物理设备
 func (a *Audio) setReduceNoise(enable bool) error {
 	logger.Debug("set reduce noise :", enable)
-	var err error
-	var out []byte
-	if enable {
-		out, err = exec.Command("/bin/sh", "/usr/share/dde-daemon/audio/echoCancelEnable.sh").CombinedOutput()
-		if err != nil {
-			logger.Warningf("failed to enable reduce noise %v %s", err, out)
-		}
-	} else {
-		out, err = exec.Command("pactl", "unload-module", "module-echo-cancel").CombinedOutput()
-		if err != nil {
-			logger.Warningf("failed to disable reduce noise %v %s", err, out)
+	if !enable {
+		master := a.echoCancel.disable()
+		if master != "" && a.getDefaultSourceName() == echoCancelSourceName {
+			a.context().SetDefaultSource(master)
 		}
+		return nil
 	}
-	return err
+
+	source := a.getReduceNoiseMasterSource()
+	if source == nil {
+		return errors.New("no physical source for reduce noise")
+	}
+	_, portConfig := GetConfigKeeper().GetCardAndPortConfig(a.getCardNameById(source.Card), source.ActivePort.Name)
+	err := a.echoCancel.enable(source.Name, portConfig.ReduceNoisePreset)
+	if err != nil {
+		logger.Warning("failed to enable reduce noise:", err)
+		return err
+	}
+	// 重新加载模块后降噪通道是新创建的，缓存的默认输入设备名称可能还是旧的，所以总是设置一次
+	a.context().SetDefaultSource(echoCancelSourceName)
+	return nil
 }
 
 func (a *Audio) saveAudioState() error {
@@ -1,4 +1,4 @@
-// Code generated by "dbusutil-gen -type Audio,Sink,SinkInput,Source,Meter -import github.com/godbus/dbus audio.go sink.go sinkinput.go source.go meter.go"; DO NOT EDIT.
+// Code generated by "dbusutil-gen -type Audio,Sink,SinkInput,Source,SourceOutput,Meter,ChannelMeter -import github.com/godbus/dbus audio.go sink.go sinkinput.go source.go sourceoutput.go meter.go channel_meter.go"; DO NOT EDIT.
 
 package audio
 
@@ -45,6 +45,19 @@ func (v *Audio) emitPropChangedSources(value []dbus.ObjectPath) error {
 	return v.service.EmitPropertyChanged(v, "Sources", value)
 }
 
+func (v *Audio) setPropSourceOutputs(value []dbus.ObjectPath) (changed bool) {
+	if !objectPathSliceEqual(v.SourceOutputs, value) {
+		v.SourceOutputs = value
+		v.emitPropChangedSourceOutputs(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedSourceOutputs(value []dbus.ObjectPath) error {
+	return v.service.EmitPropertyChanged(v, "SourceOutputs", value)
+}
+
 func (v *Audio) setPropDefaultSink(value dbus.ObjectPath) (changed bool) {
 	if v.DefaultSink != value {
 		v.DefaultSink = value
@@ -136,6 +149,32 @@ func (v *Audio) emitPropChangedReduceNoise(value bool) error {
 	return v.service.EmitPropertyChanged(v, "ReduceNoise", value)
 }
 
+func (v *Audio) setPropReduceNoisePreset(value string) (changed bool) {
+	if v.ReduceNoisePreset != value {
+		v.ReduceNoisePreset = value
+		v.emitPropChangedReduceNoisePreset(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedReduceNoisePreset(value string) error {
+	return v.service.EmitPropertyChanged(v, "ReduceNoisePreset", value)
+}
+
+func (v *Audio) setPropReduceNoisePresets(value []string) (changed bool) {
+	if !isStrvEqual(v.ReduceNoisePresets, value) {
+		v.ReduceNoisePresets = value
+		v.emitPropChangedReduceNoisePresets(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedReduceNoisePresets(value []string) error {
+	return v.service.EmitPropertyChanged(v, "ReduceNoisePresets", value)
+}
+
 func (v *Audio) setPropMaxUIVolume(value float64) (changed bool) {
 	if v.MaxUIVolume != value {
 		v.MaxUIVolume = value
@@ -149,6 +188,58 @@ func (v *Audio) emitPropChangedMaxUIVolume(value float64) error {
 	return v.service.EmitPropertyChanged(v, "MaxUIVolume", value)
 }
 
+func (v *Audio) setPropDuckingEnabled(value bool) (changed bool) {
+	if v.DuckingEnabled != value {
+		v.DuckingEnabled = value
+		v.emitPropChangedDuckingEnabled(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedDuckingEnabled(value bool) error {
+	return v.service.EmitPropertyChanged(v, "DuckingEnabled", value)
+}
+
+func (v *Audio) setPropDuckingAttenuation(value float64) (changed bool) {
+	if v.DuckingAttenuation != value {
+		v.DuckingAttenuation = value
+		v.emitPropChangedDuckingAttenuation(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedDuckingAttenuation(value float64) error {
+	return v.service.EmitPropertyChanged(v, "DuckingAttenuation", value)
+}
+
+func (v *Audio) setPropDuckingRoles(value []string) (changed bool) {
+	if !isStrvEqual(v.DuckingRoles, value) {
+		v.DuckingRoles = value
+		v.emitPropChangedDuckingRoles(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedDuckingRoles(value []string) error {
+	return v.service.EmitPropertyChanged(v, "DuckingRoles", value)
+}
+
+func (v *Audio) setPropDuckingApps(value []string) (changed bool) {
+	if !isStrvEqual(v.DuckingApps, value) {
+		v.DuckingApps = value
+		v.emitPropChangedDuckingApps(value)
+		return true
+	}
+	return false
+}
+
+func (v *Audio) emitPropChangedDuckingApps(value []string) error {
+	return v.service.EmitPropertyChanged(v, "DuckingApps", value)
+}
+
 func (v *Sink) setPropName(value string) (changed bool) {
 	if v.Name != value {
 		v.Name = value
@@ -422,6 +513,32 @@ func (v *SinkInput) emitPropChangedSinkIndex(value uint32) error {
 	return v.service.EmitPropertyChanged(v, "SinkIndex", value)
 }
 
+func (v *SinkInput) setPropSink(value dbus.ObjectPath) (changed bool) {
+	if v.Sink != value {
+		v.Sink = value
+		v.emitPropChangedSink(value)
+		return true
+	}
+	return false
+}
+
+func (v *SinkInput) emitPropChangedSink(value dbus.ObjectPath) error {
+	return v.service.EmitPropertyChanged(v, "Sink", value)
+}
+
+func (v *SinkInput) setPropAppId(value string) (changed bool) {
+	if v.AppId != value {
+		v.AppId = value
+		v.emitPropChangedAppId(value)
+		return true
+	}
+	return false
+}
+
+func (v *SinkInput) emitPropChangedAppId(value string) error {
+	return v.service.EmitPropertyChanged(v, "AppId", value)
+}
+
 func (v *Source) setPropName(value string) (changed bool) {
 	if v.Name != value {
 		v.Name = value
@@ -578,6 +695,97 @@ func (v *Source) emitPropChangedCard(value uint32) error {
 	return v.service.EmitPropertyChanged(v, "Card", value)
 }
 
+func (v *SourceOutput) setPropName(value string) (changed bool) {
+	if v.Name != value {
+		v.Name = value
+		v.emitPropChangedName(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedName(value string) error {
+	return v.service.EmitPropertyChanged(v, "Name", value)
+}
+
+func (v *SourceOutput) setPropIcon(value string) (changed bool) {
+	if v.Icon != value {
+		v.Icon = value
+		v.emitPropChangedIcon(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedIcon(value string) error {
+	return v.service.EmitPropertyChanged(v, "Icon", value)
+}
+
+func (v *SourceOutput) setPropProcessId(value uint32) (changed bool) {
+	if v.ProcessId != value {
+		v.ProcessId = value
+		v.emitPropChangedProcessId(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedProcessId(value uint32) error {
+	return v.service.EmitPropertyChanged(v, "ProcessId", value)
+}
+
+func (v *SourceOutput) setPropMute(value bool) (changed bool) {
+	if v.Mute != value {
+		v.Mute = value
+		v.emitPropChangedMute(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedMute(value bool) error {
+	return v.service.EmitPropertyChanged(v, "Mute", value)
+}
+
+func (v *SourceOutput) setPropVolume(value float64) (changed bool) {
+	if v.Volume != value {
+		v.Volume = value
+		v.emitPropChangedVolume(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedVolume(value float64) error {
+	return v.service.EmitPropertyChanged(v, "Volume", value)
+}
+
+func (v *SourceOutput) setPropSourceIndex(value uint32) (changed bool) {
+	if v.SourceIndex != value {
+		v.SourceIndex = value
+		v.emitPropChangedSourceIndex(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedSourceIndex(value uint32) error {
+	return v.service.EmitPropertyChanged(v, "SourceIndex", value)
+}
+
+func (v *SourceOutput) setPropSource(value dbus.ObjectPath) (changed bool) {
+	if v.Source != value {
+		v.Source = value
+		v.emitPropChangedSource(value)
+		return true
+	}
+	return false
+}
+
+func (v *SourceOutput) emitPropChangedSource(value dbus.ObjectPath) error {
+	return v.service.EmitPropertyChanged(v, "Source", value)
+}
+
 func (v *Meter) setPropVolume(value float64) (changed bool) {
 	if v.Volume != value {
 		v.Volume = value
@@ -590,3 +798,29 @@ func (v *Meter) setPropVolume(value float64) (changed bool) {
 func (v *Meter) emitPropChangedVolume(value float64) error {
 	return v.service.EmitPropertyChanged(v, "Volume", value)
 }
+
+func (v *ChannelMeter) setPropChannels(value int32) (changed bool) {
+	if v.Channels != value {
+		v.Channels = value
+		v.emitPropChangedChannels(value)
+		return true
+	}
+	return false
+}
+
+func (v *ChannelMeter) emitPropChangedChannels(value int32) error {
+	return v.service.EmitPropertyChanged(v, "Channels", value)
+}
+
+func (v *ChannelMeter) setPropRate(value uint32) (changed bool) {
+	if v.Rate != value {
+		v.Rate = value
+		v.emitPropChangedRate(value)
+		return true
+	}
+	return false
+}
+
+func (v *ChannelMeter) emitPropChangedRate(value uint32) error {
+	return v.service.EmitPropertyChanged(v, "Rate", value)
+}
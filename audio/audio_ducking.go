@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"errors"
+	"fmt"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+const (
+	dsgKeyDuckingEnabled     = "duckingEnabled"
+	dsgKeyDuckingAttenuation = "duckingAttenuation"
+	dsgKeyDuckingRoles       = "duckingRoles"
+	dsgKeyDuckingApps        = "duckingApps"
+)
+
+func isDuckingDsgKey(key string) bool {
+	switch key {
+	case dsgKeyDuckingEnabled, dsgKeyDuckingAttenuation, dsgKeyDuckingRoles, dsgKeyDuckingApps:
+		return true
+	}
+	return false
+}
+
+// 被 duckingPolicy 调用，保持左右声道平衡设置音量
+func (a *Audio) setDuckingVolume(index uint32, volume float64) {
+	a.mu.Lock()
+	sinkInput := a.sinkInputs[index]
+	a.mu.Unlock()
+	if sinkInput == nil {
+		return
+	}
+	ctx := a.context()
+	if ctx == nil {
+		return
+	}
+	if volume < 0.001 {
+		volume = 0.001
+	}
+
+	sinkInput.PropsMu.RLock()
+	cv := sinkInput.cVolume.SetAvg(volume)
+	sinkInput.PropsMu.RUnlock()
+	ctx.SetSinkInputVolume(index, cv)
+}
+
+// 把sink-input加入到ducking策略中，在恢复应用的音量配置之后调用，使用恢复后的音量
+func (a *Audio) addSinkInputToDucking(s *SinkInput) {
+	if !s.visible {
+		return
+	}
+	s.PropsMu.RLock()
+	stream := duckingStream{
+		index:  s.index,
+		role:   s.role,
+		appId:  s.AppId,
+		volume: s.Volume,
+	}
+	s.PropsMu.RUnlock()
+
+	if stream.appId != "" {
+		app := GetAppConfigKeeper().GetAppConfig(stream.appId)
+		if app != nil && app.Volume > 0 {
+			stream.volume = app.Volume
+		}
+	}
+	a.ducking.addStream(stream)
+}
+
+func (a *Audio) getDuckingConfig() duckingConfig {
+	a.PropsMu.RLock()
+	defer a.PropsMu.RUnlock()
+	return duckingConfig{
+		enabled:     a.DuckingEnabled,
+		attenuation: a.DuckingAttenuation,
+		roles:       append([]string(nil), a.DuckingRoles...),
+		apps:        append([]string(nil), a.DuckingApps...),
+	}
+}
+
+// 从 dconfig 中读取 ducking 的配置，更新属性，返回属性是否改变
+func (a *Audio) loadDuckingDsgValue(key string) (changed bool) {
+	if a.dsgConfigManager == nil {
+		return false
+	}
+	method := "org.desktopspec.ConfigManager.Manager.value"
+	var err error
+	switch key {
+	case dsgKeyDuckingEnabled:
+		var val bool
+		err = a.dsgConfigManager.Call(method, 0, key).Store(&val)
+		if err == nil {
+			a.PropsMu.Lock()
+			changed = a.setPropDuckingEnabled(val)
+			a.PropsMu.Unlock()
+		}
+	case dsgKeyDuckingAttenuation:
+		var val float64
+		err = a.dsgConfigManager.Call(method, 0, key).Store(&val)
+		if err == nil {
+			if val < 0 || val > 1 {
+				err = fmt.Errorf("invalid %s value: %v", key, val)
+				break
+			}
+			a.PropsMu.Lock()
+			changed = a.setPropDuckingAttenuation(val)
+			a.PropsMu.Unlock()
+		}
+	case dsgKeyDuckingRoles, dsgKeyDuckingApps:
+		var ret []dbus.Variant
+		err = a.dsgConfigManager.Call(method, 0, key).Store(&ret)
+		if err == nil {
+			list := make([]string, 0, len(ret))
+			for i := range ret {
+				if v, ok := ret[i].Value().(string); ok {
+					list = append(list, v)
+				}
+			}
+			a.PropsMu.Lock()
+			if key == dsgKeyDuckingRoles {
+				changed = a.setPropDuckingRoles(list)
+			} else {
+				changed = a.setPropDuckingApps(list)
+			}
+			a.PropsMu.Unlock()
+		}
+	}
+	if err != nil {
+		logger.Warning(err)
+	}
+	return changed
+}
+
+func (a *Audio) saveDuckingDsgValue(key string, value interface{}) {
+	if a.dsgConfigManager == nil {
+		return
+	}
+	err := a.dsgConfigManager.Call("org.desktopspec.ConfigManager.Manager.setValue", 0,
+		key, dbus.MakeVariant(value)).Err
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+func (a *Audio) writeDuckingEnabled(write *dbusutil.PropertyWrite) *dbus.Error {
+	enabled, ok := write.Value.(bool)
+	if !ok {
+		return dbusutil.ToError(errors.New("type is not bool"))
+	}
+	cfg := a.getDuckingConfig()
+	cfg.enabled = enabled
+	a.ducking.setConfig(cfg)
+	a.saveDuckingDsgValue(dsgKeyDuckingEnabled, enabled)
+	return nil
+}
+
+func (a *Audio) writeDuckingAttenuation(write *dbusutil.PropertyWrite) *dbus.Error {
+	attenuation, ok := write.Value.(float64)
+	if !ok {
+		return dbusutil.ToError(errors.New("type is not float64"))
+	}
+	if attenuation < 0 || attenuation > 1 {
+		return dbusutil.ToError(fmt.Errorf("invalid attenuation value: %v", attenuation))
+	}
+	cfg := a.getDuckingConfig()
+	cfg.attenuation = attenuation
+	a.ducking.setConfig(cfg)
+	a.saveDuckingDsgValue(dsgKeyDuckingAttenuation, attenuation)
+	return nil
+}
+
+func (a *Audio) writeDuckingRoles(write *dbusutil.PropertyWrite) *dbus.Error {
+	roles, ok := write.Value.([]string)
+	if !ok {
+		return dbusutil.ToError(errors.New("type is not []string"))
+	}
+	cfg := a.getDuckingConfig()
+	cfg.roles = roles
+	a.ducking.setConfig(cfg)
+	a.saveDuckingDsgValue(dsgKeyDuckingRoles, roles)
+	return nil
+}
+
+func (a *Audio) writeDuckingApps(write *dbusutil.PropertyWrite) *dbus.Error {
+	apps, ok := write.Value.([]string)
+	if !ok {
+		return dbusutil.ToError(errors.New("type is not []string"))
+	}
+	cfg := a.getDuckingConfig()
+	cfg.apps = apps
+	a.ducking.setConfig(cfg)
+	a.saveDuckingDsgValue(dsgKeyDuckingApps, apps)
+	return nil
+}
@@ -57,6 +57,8 @@ func (a *Audio) dispatchEvents(events []*pulse.Event) {
 			a.saveConfig()
 		case pulse.FacilitySinkInput:
 			a.handleSinkInputEvent(event.Type, event.Index)
+		case pulse.FacilitySourceOutput:
+			a.handleSourceOutputEvent(event.Type, event.Index)
 		}
 	}
 	logger.Debug("dispatch events done")
@@ -126,7 +128,7 @@ func (a *Audio) needAutoSwitchInputPort() bool {
 	}
 
 	inputs := GetPriorityManager().Input
-	firstPort := inputs.GetTheFirstPort()
+	firstPort := inputs.GetTheAutoSwitchPort()
 
 	// 没有可用端口
 	if firstPort.PortType == PortTypeInvalid {
@@ -156,6 +158,14 @@ func (a *Audio) needAutoSwitchInputPort() bool {
 		return false
 	}
 
+	// 当前端口不在用户的端口优先级列表中，但是是用户手动选择的端口，不自动切换
+	topPort := inputs.GetTheFirstPort()
+	if currentCardName == topPort.CardName && currentPortName == topPort.PortName &&
+		!inputs.IsAutoSwitchPort(currentCardName, currentPortName) {
+		logger.Debugf("current input<%s,%s> is selected by user", currentCardName, currentPortName)
+		return false
+	}
+
 	logger.Debugf("will auto switch from input<%s,%s> to input<%s,%s>",
 		currentCardName, currentPortName, firstPort.CardName, firstPort.PortName)
 	return true
@@ -168,7 +178,7 @@ func (a *Audio) needAutoSwitchOutputPort() bool {
 	}
 
 	outputs := GetPriorityManager().Output
-	firstPort := outputs.GetTheFirstPort()
+	firstPort := outputs.GetTheAutoSwitchPort()
 
 	// 没有可用端口
 	if firstPort.PortType == PortTypeInvalid {
@@ -182,6 +192,12 @@ func (a *Audio) needAutoSwitchOutputPort() bool {
 		return true
 	}
 
+	// 虚拟输出设备没有端口，不在优先级列表中，是用户手动选择的
+	if isVirtualSinkName(a.defaultSink.Name) {
+		logger.Debugf("current output is virtual sink %s", a.defaultSink.Name)
+		return false
+	}
+
 	// 同端口切换次数超出限制(切换失败时反复切换同一端口)
 	if a.outputAutoSwitchCount >= a.outputAutoSwitchCountMax &&
 		(a.outputCardName == firstPort.CardName && a.outputPortName == firstPort.PortName) {
@@ -198,6 +214,14 @@ func (a *Audio) needAutoSwitchOutputPort() bool {
 		return false
 	}
 
+	// 当前端口不在用户的端口优先级列表中，但是是用户手动选择的端口，不自动切换
+	topPort := outputs.GetTheFirstPort()
+	if currentCardName == topPort.CardName && currentPortName == topPort.PortName &&
+		!outputs.IsAutoSwitchPort(currentCardName, currentPortName) {
+		logger.Debugf("current output<%s,%s> is selected by user", currentCardName, currentPortName)
+		return false
+	}
+
 	logger.Debugf("will auto switch from output<%s,%s> to output<%s,%s>",
 		currentCardName, currentPortName, firstPort.CardName, firstPort.PortName)
 	return true
@@ -206,7 +230,7 @@ func (a *Audio) needAutoSwitchOutputPort() bool {
 func (a *Audio) autoSwitchPort() {
 	if a.needAutoSwitchOutputPort() {
 		outputs := GetPriorityManager().Output
-		firstOutput := outputs.GetTheFirstPort()
+		firstOutput := outputs.GetTheAutoSwitchPort()
 		card, err := a.cards.getByName(firstOutput.CardName)
 
 		if err == nil {
@@ -228,7 +252,7 @@ func (a *Audio) autoSwitchPort() {
 
 	if a.needAutoSwitchInputPort() {
 		inputs := GetPriorityManager().Input
-		firstInput := inputs.GetTheFirstPort()
+		firstInput := inputs.GetTheAutoSwitchPort()
 		card, err := a.cards.getByName(firstInput.CardName)
 
 		if err == nil {
@@ -281,6 +305,11 @@ func (a *Audio) handleCardEvent(eventType int, idx uint32) {
 
 	// 触发自动切换
 	a.autoSwitchPort()
+
+	// 新增的声卡关联了场景时，在自动切换之后应用场景
+	if eventType == pulse.EventTypeNew && card != nil {
+		a.autoApplyScene(card)
+	}
 }
 
 func (a *Audio) handleCardAdded(idx uint32) {
@@ -294,7 +323,7 @@ func (a *Audio) handleCardAdded(idx uint32) {
 	}
 
 	if isBluezAudio(card.core.Name) {
-		card.AutoSetBluezMode()
+		card.AutoSetBluezMode(a.ctx)
 	}
 }
 
@@ -345,6 +374,9 @@ func (a *Audio) handleSinkEvent(eventType int, idx uint32) {
 func (a *Audio) handleSinkAdded(idx uint32) {
 	// 数据更新在refreshSinks中统一处理，这里只做业务逻辑上的响应
 	logger.Debugf("sink %d added", idx)
+
+	// 虚拟输出设备依赖的设备出现后补充加载
+	a.syncVirtualSinks()
 }
 
 func (a *Audio) handleSinkRemoved(idx uint32) {
@@ -395,6 +427,21 @@ func (a *Audio) handleSourceRemoved(idx uint32) {
 	// 数据更新在refreshSources中统一处理，这里只做业务逻辑上的响应
 	// 注意，此时idx已经失效了，无法获取已经失去的数据，如果业务需要，应当在refresh前进行数据备份
 	logger.Debugf("source %d removed", idx)
+	// 降噪绑定的物理设备被移除时，pulseaudio 会卸载降噪模块
+	if a.echoCancel.checkMaster(a.isSourceNameExist) {
+		logger.Info("master source of reduce noise removed")
+	}
+}
+
+func (a *Audio) isSourceNameExist(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, source := range a.sources {
+		if source.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (a *Audio) handleSourceChanged(idx uint32) {
@@ -417,20 +464,53 @@ func (a *Audio) handleSinkInputEvent(eventType int, idx uint32) {
 	// 这里写所有类型的sink-input事件都需要触发的逻辑
 }
 
+func (a *Audio) getSinkInput(idx uint32) *SinkInput {
+	a.mu.Lock()
+	v := a.sinkInputs[idx]
+	a.mu.Unlock()
+	return v
+}
+
 func (a *Audio) handleSinkInputAdded(idx uint32) {
 	// 数据更新在refreshSinkInputs中统一处理，这里只做业务逻辑上的响应
 	logger.Debugf("sink-input %d added", idx)
+	sinkInput := a.getSinkInput(idx)
+	if sinkInput != nil {
+		a.addSinkInputToDucking(sinkInput)
+	}
 }
 
 func (a *Audio) handleSinkInputRemoved(idx uint32) {
 	// 数据更新在refreshSinkInputs中统一处理，这里只做业务逻辑上的响应
 	// 注意，此时idx已经失效了，无法获取已经失去的数据，如果业务需要，应当在refresh前进行数据备份
 	logger.Debugf("sink-input %d removed", idx)
+	a.ducking.removeStream(idx)
 }
 
 func (a *Audio) handleSinkInputChanged(idx uint32) {
 	// 数据更新在refreshSinkInputs中统一处理，这里只做业务逻辑上的响应
 	logger.Debugf("sink-input %d changed", idx)
+	sinkInput := a.getSinkInput(idx)
+	if sinkInput != nil {
+		sinkInput.PropsMu.RLock()
+		volume := sinkInput.Volume
+		sinkInput.PropsMu.RUnlock()
+		a.ducking.syncVolume(idx, volume)
+	}
+}
+
+func (a *Audio) handleSourceOutputEvent(eventType int, idx uint32) {
+	// 数据更新在refreshSourceOutputs中统一处理，这里只做业务逻辑上的响应
+	switch eventType {
+	case pulse.EventTypeNew:
+		logger.Debugf("source-output %d added", idx)
+	case pulse.EventTypeRemove:
+		logger.Debugf("source-output %d removed", idx)
+	case pulse.EventTypeChange:
+		logger.Debugf("source-output %d changed", idx)
+	default:
+		logger.Warningf("unhandled source-output event, source-output=%d, type=%d", idx, eventType)
+	}
 }
 
 /* 创建开启端口的命令，提供给notification调用 */
@@ -442,8 +522,11 @@ func makeNotifyCmdEnablePort(cardId uint32, portName string) string {
 		dest, path, method, cardId, portName)
 }
 
+// 横幅提示端口被禁用，测试时替换为记录调用
+var notifyPortDisabled = sendPortDisabledNotify
+
 /* 横幅提示端口被禁用,并提供开启的按钮 */
-func (a *Audio) notifyPortDisabled(cardId uint32, port pulse.CardPortInfo) {
+func sendPortDisabledNotify(cardId uint32, port pulse.CardPortInfo) {
 	session, err := dbus.SessionBus()
 	if err != nil {
 		logger.Warning(err)
@@ -520,6 +603,18 @@ func (a *Audio) updatePropSinkInputs() {
 	a.updateObjPathsProp("SinkInput", ids, a.setPropSinkInputs)
 }
 
+func (a *Audio) updatePropSourceOutputs() {
+	var ids []int
+	a.mu.Lock()
+	for _, sourceOutput := range a.sourceOutputs {
+		if sourceOutput.visible {
+			ids = append(ids, int(sourceOutput.index))
+		}
+	}
+	a.mu.Unlock()
+	a.updateObjPathsProp("SourceOutput", ids, a.setPropSourceOutputs)
+}
+
 func isPhysicalDevice(deviceName string) bool {
 	for _, virtualDeviceKey := range []string{
 		"echoCancelSource", "echo-cancel", "Echo-Cancel", // virtual key
@@ -563,8 +658,8 @@ func (a *Audio) listenGSettingVolumeIncreaseChanged() {
 		if err != nil {
 			logger.Warning("changed Max UI Volume failed: ", err)
 		} else {
-			sink := a.defaultSink
-			GetConfigKeeper().SetIncreaseVolume(a.getCardNameById(sink.Card), sink.ActivePort.Name, volInc)
+			cardName, portName := a.getSinkConfigKey(a.defaultSink)
+			GetConfigKeeper().SetIncreaseVolume(cardName, portName, volInc)
 		}
 	})
 }
@@ -587,7 +682,10 @@ func (a *Audio) writeReduceNoise(write *dbusutil.PropertyWrite) *dbus.Error {
 	// 但是在开启降噪，切换到降噪的虚拟通道时，需要用对应主设备的配置进行配置恢复
 	// 如果不放在前面，配置恢复时，主设备的配置里降噪还处于关闭状态
 	// 配置恢复会自动关闭降噪
-	source := a.defaultSource
+	source := a.getReduceNoiseMasterSource()
+	if source == nil {
+		return dbusutil.ToError(errors.New("no physical source for reduce noise"))
+	}
 	GetConfigKeeper().SetReduceNoise(a.getCardNameById(source.Card), source.ActivePort.Name, reduce)
 	err := a.setReduceNoise(reduce)
 	if err != nil {
@@ -597,6 +695,35 @@ func (a *Audio) writeReduceNoise(write *dbusutil.PropertyWrite) *dbus.Error {
 	return nil
 }
 
+// 外部修改ReduceNoisePreset时触发回调，保存到当前端口的配置中，降噪开启时重新加载降噪模块
+func (a *Audio) writeReduceNoisePreset(write *dbusutil.PropertyWrite) *dbus.Error {
+	presetName, ok := write.Value.(string)
+	if !ok {
+		return dbusutil.ToError(errors.New("type is not string"))
+	}
+	_, err := getEchoCancelPreset(presetName)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+
+	source := a.getReduceNoiseMasterSource()
+	if source == nil {
+		return dbusutil.ToError(errors.New("no physical source for reduce noise"))
+	}
+	GetConfigKeeper().SetReduceNoisePreset(a.getCardNameById(source.Card), source.ActivePort.Name, presetName)
+
+	a.PropsMu.RLock()
+	reduce := a.ReduceNoise
+	a.PropsMu.RUnlock()
+	if reduce {
+		err = a.setReduceNoise(true)
+		if err != nil {
+			logger.Warning("set reduce noise preset failed: ", err)
+		}
+	}
+	return nil
+}
+
 func (a *Audio) notifyBluezCardPortInsert(card *Card) {
 	logger.Debugf("notify bluez card %d:%s", card.Id, card.core.Name)
 	oldCard, err := a.oldCards.getByName(card.core.Name)
@@ -641,7 +768,7 @@ func (a *Audio) notifyBluezCardPortInsert(card *Card) {
 			_, portConfig := GetConfigKeeper().GetCardAndPortConfig(card.core.Name, port.Name)
 			if !portConfig.Enabled {
 				logger.Debugf("port<%s,%s> notify", card.core.Name, port.Name)
-				a.notifyPortDisabled(card.Id, port)
+				notifyPortDisabled(card.Id, port)
 			}
 		}
 	}
@@ -689,7 +816,7 @@ func (a *Audio) notifyCardPortInsert(card *Card) {
 			_, portConfig := GetConfigKeeper().GetCardAndPortConfig(card.core.Name, port.Name)
 			if !portConfig.Enabled {
 				logger.Debugf("port<%s,%s> notify", card.core.Name, port.Name)
-				a.notifyPortDisabled(card.Id, port)
+				notifyPortDisabled(card.Id, port)
 			}
 		}
 	}
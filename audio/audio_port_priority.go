@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"fmt"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// PortPriority 是用户的端口优先级列表中的端口，DBus 签名为 (ss)，
+// 使用 pulse.Card.Name 和 pulse.CardPortInfo.Name
+type PortPriority struct {
+	CardName string
+	PortName string
+}
+
+func toPortPriorities(ports PriorityPortList) []PortPriority {
+	result := make([]PortPriority, len(ports))
+	for i, port := range ports {
+		result[i] = PortPriority{
+			CardName: port.CardName,
+			PortName: port.PortName,
+		}
+	}
+	return result
+}
+
+func checkPortDirection(direction int32) error {
+	if int(direction) != pulse.DirectionSink && int(direction) != pulse.DirectionSource {
+		return fmt.Errorf("invalid port direction: %d", direction)
+	}
+	return nil
+}
+
+func (a *Audio) emitPortPrioritiesChanged(direction int) {
+	ports := toPortPriorities(GetPriorityManager().GetUserPorts(direction))
+	err := a.service.Emit(a, "PortPrioritiesChanged", int32(direction), ports)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// 手动选择端口后，端口在用户的优先级列表中的位置可能发生了变化
+func (a *Audio) notifyUserPortPriorities(direction int) {
+	if len(GetPriorityManager().GetUserPorts(direction)) > 0 {
+		a.emitPortPrioritiesChanged(direction)
+	}
+}
+
+// GetPortPriorities 返回用户设置的端口优先级列表，为空时表示按端口类型的优先级自动切换
+func (a *Audio) GetPortPriorities(direction int32) (ports []PortPriority, busErr *dbus.Error) {
+	err := checkPortDirection(direction)
+	if err != nil {
+		return nil, dbusutil.ToError(err)
+	}
+	return toPortPriorities(GetPriorityManager().GetUserPorts(int(direction))), nil
+}
+
+// SetPortPriorities 设置用户的端口优先级列表，自动切换端口时按列表的顺序选择，
+// 不会自动切换到不在列表中的端口，但是仍然可以手动选择；列表为空时恢复按端口类型的优先级自动切换
+func (a *Audio) SetPortPriorities(direction int32, ports []PortPriority) *dbus.Error {
+	err := checkPortDirection(direction)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+
+	policy := GetPriorityManager().Input
+	if int(direction) == pulse.DirectionSink {
+		policy = GetPriorityManager().Output
+	}
+	userPorts := make(PriorityPortList, 0, len(ports))
+	for _, port := range ports {
+		if port.CardName == "" || port.PortName == "" {
+			return dbusutil.ToError(fmt.Errorf("invalid port <%s:%s>", port.CardName, port.PortName))
+		}
+		p := &PriorityPort{
+			CardName: port.CardName,
+			PortName: port.PortName,
+			PortType: PortTypeUnknown,
+		}
+		if userPorts.hasElement(p) {
+			return dbusutil.ToError(fmt.Errorf("duplicate port <%s:%s>", port.CardName, port.PortName))
+		}
+		// 当前有效的端口使用已经识别的类型
+		index := policy.FindPortIndex(port.CardName, port.PortName)
+		if index >= 0 {
+			p.PortType = policy.Ports[index].PortType
+		}
+		userPorts = append(userPorts, p)
+	}
+
+	logger.Debugf("set port priorities of direction %d: %v", direction, ports)
+	GetPriorityManager().SetUserPorts(int(direction), userPorts)
+	a.emitPortPrioritiesChanged(int(direction))
+	a.autoSwitchPort()
+	return nil
+}
@@ -0,0 +1,440 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPciCardName   = "alsa_card.pci-0000_00_1f.3"
+	testPciSinkName   = "alsa_output.pci-0000_00_1f.3.analog-stereo"
+	testPciSourceName = "alsa_input.pci-0000_00_1f.3.analog-stereo"
+	testPciProfile    = "output:analog-stereo+input:analog-stereo"
+	testSpeakerPort   = "analog-output-speaker"
+	testHeadphonePort = "analog-output-headphones"
+	testInternalMic   = "analog-input-internal-mic"
+
+	testUsbCardName = "alsa_card.usb-C-Media_Electronics_Inc._USB_Audio_Device-00"
+	testUsbSinkName = "alsa_output.usb-C-Media_Electronics_Inc._USB_Audio_Device-00.analog-stereo"
+	testUsbProfile  = "output:analog-stereo"
+	testUsbPort     = "analog-output"
+
+	testBluezCardName          = "bluez_card.00_11_22_33_44_55"
+	testBluezA2dpSinkName      = "bluez_sink.00_11_22_33_44_55.a2dp_sink"
+	testBluezHeadsetSinkName   = "bluez_sink.00_11_22_33_44_55.headset_head_unit"
+	testBluezHeadsetSourceName = "bluez_source.00_11_22_33_44_55.headset_head_unit"
+	testBluezOutputPort        = "headset-output"
+	testBluezInputPort         = "headset-input"
+)
+
+// audioScenario 使用 fakeBackend 运行 Audio 的事件循环，验证自动暂停和自动切换端口等策略，
+// 不连接 pulseaudio，配置文件保存在临时目录
+type audioScenario struct {
+	t        *testing.T
+	backend  *fakeBackend
+	audio    *Audio
+	paused   int32
+	notified int32
+	started  bool
+	done     chan struct{} // 事件循环退出时关闭
+}
+
+func newAudioScenario(t *testing.T) *audioScenario {
+	// sink 和 source 等对象会导出到 DBus 上
+	service, err := dbusutil.NewSessionService()
+	if err != nil {
+		t.Skip("session service is not initialized")
+	}
+
+	dir, err := ioutil.TempDir("", "audio-scenario")
+	require.NoError(t, err)
+
+	configKeeper := NewConfigKeeper(filepath.Join(dir, "audio-config-keeper.json"),
+		filepath.Join(dir, "audio-config-keeper-mute.json"))
+	priorityManager := NewPriorityManager(filepath.Join(dir, "priorities.json"))
+	bluezAudioManager := NewBluezAudioManager(filepath.Join(dir, "bluezAudio.json"))
+	appConfigKeeper := NewAppConfigKeeper(filepath.Join(dir, "audio-app-config-keeper.json"))
+	sceneKeeper := NewSceneKeeper(filepath.Join(dir, "audio-scenes.json"))
+	virtualSinkKeeper := NewVirtualSinkKeeper(filepath.Join(dir, "audio-virtual-sinks.json"))
+
+	oldGetConfigKeeper := GetConfigKeeper
+	oldGetPriorityManager := GetPriorityManager
+	oldGetBluezAudioManager := GetBluezAudioManager
+	oldGetAppConfigKeeper := GetAppConfigKeeper
+	oldGetSceneKeeper := GetSceneKeeper
+	oldGetVirtualSinkKeeper := GetVirtualSinkKeeper
+	oldPauseAllPlayers := pauseAllPlayers
+	oldNotifyPortDisabled := notifyPortDisabled
+	oldSetIncreaseVolume := setIncreaseVolume
+	GetConfigKeeper = func() *ConfigKeeper { return configKeeper }
+	GetPriorityManager = func() *PriorityManager { return priorityManager }
+	GetBluezAudioManager = func() *BluezAudioManager { return bluezAudioManager }
+	GetAppConfigKeeper = func() *AppConfigKeeper { return appConfigKeeper }
+	GetSceneKeeper = func() *SceneKeeper { return sceneKeeper }
+	GetVirtualSinkKeeper = func() *VirtualSinkKeeper { return virtualSinkKeeper }
+
+	s := &audioScenario{
+		t:       t,
+		backend: newFakeBackend(),
+		done:    make(chan struct{}),
+	}
+	pauseAllPlayers = func() {
+		atomic.AddInt32(&s.paused, 1)
+	}
+	notifyPortDisabled = func(cardId uint32, port pulse.CardPortInfo) {
+		atomic.AddInt32(&s.notified, 1)
+	}
+	// 没有绑定 gsettings
+	setIncreaseVolume = func(a *Audio, enabled bool) {}
+	t.Cleanup(func() {
+		GetConfigKeeper = oldGetConfigKeeper
+		GetPriorityManager = oldGetPriorityManager
+		GetBluezAudioManager = oldGetBluezAudioManager
+		GetAppConfigKeeper = oldGetAppConfigKeeper
+		GetSceneKeeper = oldGetSceneKeeper
+		GetVirtualSinkKeeper = oldGetVirtualSinkKeeper
+		pauseAllPlayers = oldPauseAllPlayers
+		notifyPortDisabled = oldNotifyPortDisabled
+		setIncreaseVolume = oldSetIncreaseVolume
+		os.RemoveAll(dir)
+	})
+
+	a := &Audio{
+		service:       service,
+		ctx:           s.backend,
+		meters:        make(map[string]*Meter),
+		channelMeters: make(map[string]*ChannelMeter),
+		MaxUIVolume:   normalMaxVolume,
+		enableSource:  true,
+
+		eventChan: make(chan *pulse.Event, 100),
+		stateChan: make(chan int, 10),
+		quit:      make(chan struct{}),
+
+		echoCancel:   newEchoCancelManager(s.backend),
+		virtualSinks: newVirtualSinkManager(s.backend),
+
+		enableAutoSwitchPort:     true,
+		outputAutoSwitchCountMax: 10,
+
+		// 不保存配置文件，也不通过系统总线保存音频状态
+		isSaving: true,
+	}
+	a.ducking = newDuckingPolicy(a.getDuckingConfig(), a.setDuckingVolume)
+	s.audio = a
+	// start 之前插入声卡产生的事件，由事件循环启动后处理
+	s.backend.AddEventChan(a.eventChan)
+	t.Cleanup(s.stop)
+	return s
+}
+
+// start 和 Audio.init 一样更新数据、设置默认设备并初始化端口优先级，然后启动事件循环
+func (s *audioScenario) start() {
+	a := s.audio
+	a.refresh()
+	a.oldCards = a.cards
+	a.updateDefaultSink(s.backend.GetDefaultSink())
+	a.updateDefaultSource(s.backend.GetDefaultSource())
+	GetPriorityManager().Init(a.cards)
+
+	a.mu.Lock()
+	a.eventLoopRunning = true
+	a.mu.Unlock()
+	s.started = true
+	go func() {
+		a.handleEvent()
+		close(s.done)
+	}()
+	s.handleEvents()
+}
+
+// stop 等待事件循环处理完事件后停止，并取消导出的对象
+func (s *audioScenario) stop() {
+	if s.started {
+		s.settle()
+	}
+	s.audio.destroyCtxRelated()
+	if s.started {
+		<-s.done
+	}
+}
+
+// settle 等待事件循环处理完积累的事件，并且切换端口等操作不再产生新的事件，
+// 事件循环处理一批事件的时间远小于检查的间隔
+func (s *audioScenario) settle() bool {
+	count := s.backend.getEventCount()
+	for i := 0; i < 50; i++ {
+		time.Sleep(100 * time.Millisecond)
+		newCount := s.backend.getEventCount()
+		if newCount == count && len(s.audio.eventChan) == 0 {
+			return true
+		}
+		count = newCount
+	}
+	return false
+}
+
+func (s *audioScenario) handleEvents() {
+	if !s.settle() {
+		s.t.Fatal("audio events do not settle")
+	}
+}
+
+func (s *audioScenario) notifiedCount() int {
+	return int(atomic.LoadInt32(&s.notified))
+}
+
+// takePaused 返回上次调用之后是否暂停过播放器，同一次拔出可能会暂停多次
+func (s *audioScenario) takePaused() bool {
+	return atomic.SwapInt32(&s.paused, 0) > 0
+}
+
+func (s *audioScenario) defaultSinkPort() string {
+	sink := s.backend.getSinkByName(s.backend.GetDefaultSink())
+	if sink == nil {
+		return ""
+	}
+	return sink.ActivePort.Name
+}
+
+func newTestPortInfo(name string, priority uint32, available int) pulse.PortInfo {
+	return pulse.PortInfo{
+		Name:        name,
+		Description: name,
+		Priority:    priority,
+		Available:   available,
+	}
+}
+
+func newTestCardPort(port pulse.PortInfo, direction int, profiles ...pulse.ProfileInfo2) pulse.CardPortInfo {
+	return pulse.CardPortInfo{
+		PortInfo:  port,
+		Direction: direction,
+		Profiles:  pulse.ProfileInfos2(profiles),
+	}
+}
+
+// 内置声卡，有扬声器、耳机和内置话筒三个端口
+func plugTestPciCard(backend *fakeBackend, headphoneAvailable int) {
+	profile := pulse.ProfileInfo2{Name: testPciProfile, Priority: 6565, Available: 1}
+	speaker := newTestPortInfo(testSpeakerPort, 10000, pulse.AvailableTypeUnknow)
+	headphone := newTestPortInfo(testHeadphonePort, 9900, headphoneAvailable)
+	mic := newTestPortInfo(testInternalMic, 8900, pulse.AvailableTypeUnknow)
+
+	activePort := speaker
+	if headphoneAvailable == pulse.AvailableTypeYes {
+		activePort = headphone
+	}
+	backend.plugCard(pulse.Card{
+		Name:          testPciCardName,
+		PropList:      map[string]string{"alsa.card_name": "HDA Intel PCH", "device.form_factor": "internal"},
+		Profiles:      pulse.ProfileInfos2{profile},
+		ActiveProfile: profile,
+		Ports: pulse.CardPortInfos{
+			newTestCardPort(speaker, pulse.DirectionSink, profile),
+			newTestCardPort(headphone, pulse.DirectionSink, profile),
+			newTestCardPort(mic, pulse.DirectionSource, profile),
+		},
+	}, map[string]fakeCardDevices{
+		testPciProfile: {
+			sinks: []pulse.Sink{{
+				Name:       testPciSinkName,
+				Ports:      []pulse.PortInfo{speaker, headphone},
+				ActivePort: activePort,
+			}},
+			sources: []pulse.Source{{
+				Name:       testPciSourceName,
+				Ports:      []pulse.PortInfo{mic},
+				ActivePort: mic,
+			}},
+		},
+	})
+}
+
+// USB 声卡，只有一个输出端口
+func plugTestUsbCard(backend *fakeBackend) {
+	profile := pulse.ProfileInfo2{Name: testUsbProfile, Priority: 6500, Available: 1}
+	port := newTestPortInfo(testUsbPort, 9900, pulse.AvailableTypeUnknow)
+	backend.plugCard(pulse.Card{
+		Name:          testUsbCardName,
+		PropList:      map[string]string{"alsa.card_name": "USB Audio Device", "device.bus": "usb"},
+		Profiles:      pulse.ProfileInfos2{profile},
+		ActiveProfile: profile,
+		Ports: pulse.CardPortInfos{
+			newTestCardPort(port, pulse.DirectionSink, profile),
+		},
+	}, map[string]fakeCardDevices{
+		testUsbProfile: {
+			sinks: []pulse.Sink{{
+				Name:       testUsbSinkName,
+				Ports:      []pulse.PortInfo{port},
+				ActivePort: port,
+			}},
+		},
+	})
+}
+
+// 蓝牙耳机，a2dp 只能输出，headset 可以输出和输入
+func plugTestBluezCard(backend *fakeBackend, activeProfile string) {
+	a2dp := pulse.ProfileInfo2{Name: "a2dp_sink", Description: "High Fidelity Playback (A2DP Sink)", Priority: 40, Available: 1}
+	headset := pulse.ProfileInfo2{Name: "headset_head_unit", Description: "Headset Head Unit (HSP/HFP)", Priority: 30, Available: 1}
+	off := pulse.ProfileInfo2{Name: "off", Description: "Off", Available: 1}
+	output := newTestPortInfo(testBluezOutputPort, 0, pulse.AvailableTypeUnknow)
+	input := newTestPortInfo(testBluezInputPort, 0, pulse.AvailableTypeUnknow)
+
+	card := pulse.Card{
+		Name: testBluezCardName,
+		PropList: map[string]string{
+			"device.api":         "bluez",
+			"device.bus":         "bluetooth",
+			"device.description": "Headphones",
+			"bluez.path":         "/org/bluez/hci0/dev_00_11_22_33_44_55",
+		},
+		Profiles: pulse.ProfileInfos2{a2dp, headset, off},
+		Ports: pulse.CardPortInfos{
+			newTestCardPort(output, pulse.DirectionSink, a2dp, headset),
+			newTestCardPort(input, pulse.DirectionSource, headset),
+		},
+	}
+	for _, profile := range card.Profiles {
+		if profile.Name == activeProfile {
+			card.ActiveProfile = profile
+		}
+	}
+	backend.plugCard(card, map[string]fakeCardDevices{
+		a2dp.Name: {
+			sinks: []pulse.Sink{{
+				Name:       testBluezA2dpSinkName,
+				Ports:      []pulse.PortInfo{output},
+				ActivePort: output,
+			}},
+		},
+		headset.Name: {
+			sinks: []pulse.Sink{{
+				Name:       testBluezHeadsetSinkName,
+				Ports:      []pulse.PortInfo{output},
+				ActivePort: output,
+			}},
+			sources: []pulse.Source{{
+				Name:       testBluezHeadsetSourceName,
+				Ports:      []pulse.PortInfo{input},
+				ActivePort: input,
+			}},
+		},
+	})
+}
+
+func TestScenarioHeadphoneUnplugPause(t *testing.T) {
+	s := newAudioScenario(t)
+	plugTestPciCard(s.backend, pulse.AvailableTypeYes)
+	s.start()
+	assert.Equal(t, testPciSinkName, s.backend.GetDefaultSink())
+	assert.Equal(t, testHeadphonePort, s.defaultSinkPort())
+	assert.False(t, s.takePaused())
+
+	// 拔出耳机时暂停播放，并切换到扬声器
+	s.backend.setPortAvailable(testPciCardName, testHeadphonePort, pulse.AvailableTypeNo)
+	s.handleEvents()
+	assert.True(t, s.takePaused())
+	assert.Equal(t, testSpeakerPort, s.defaultSinkPort())
+
+	// 插入耳机时切换回耳机，不暂停
+	s.backend.setPortAvailable(testPciCardName, testHeadphonePort, pulse.AvailableTypeYes)
+	s.handleEvents()
+	assert.False(t, s.takePaused())
+	assert.Equal(t, testHeadphonePort, s.defaultSinkPort())
+}
+
+func TestScenarioBluetoothModeSwitch(t *testing.T) {
+	s := newAudioScenario(t)
+	plugTestPciCard(s.backend, pulse.AvailableTypeNo)
+	s.start()
+	assert.Equal(t, testSpeakerPort, s.defaultSinkPort())
+
+	// 连接蓝牙耳机，默认使用 a2dp 并切换到蓝牙输出，输入仍然使用内置话筒
+	plugTestBluezCard(s.backend, "a2dp_sink")
+	s.handleEvents()
+	assert.Equal(t, "a2dp_sink", s.backend.getCardProfile(testBluezCardName))
+	assert.Equal(t, testBluezA2dpSinkName, s.backend.GetDefaultSink())
+	assert.Equal(t, testPciSourceName, s.backend.GetDefaultSource())
+
+	// 切换到 headset 模式后，输出和输入都使用蓝牙耳机，不暂停播放
+	assert.Nil(t, s.audio.SetBluetoothAudioMode(bluezModeHeadset))
+	s.handleEvents()
+	assert.Equal(t, "headset_head_unit", s.backend.getCardProfile(testBluezCardName))
+	assert.Equal(t, testBluezHeadsetSinkName, s.backend.GetDefaultSink())
+	assert.Equal(t, testBluezHeadsetSourceName, s.backend.GetDefaultSource())
+	assert.Equal(t, bluezModeHeadset, GetBluezAudioManager().GetMode(testBluezCardName))
+	assert.False(t, s.takePaused())
+
+	// 断开蓝牙耳机时暂停播放，回到内置声卡
+	s.backend.unplugCard(testBluezCardName)
+	s.handleEvents()
+	assert.True(t, s.takePaused())
+	assert.Equal(t, testPciSinkName, s.backend.GetDefaultSink())
+	assert.Equal(t, testPciSourceName, s.backend.GetDefaultSource())
+
+	// 重新连接时恢复上次选择的 headset 模式
+	plugTestBluezCard(s.backend, "a2dp_sink")
+	s.handleEvents()
+	assert.Equal(t, "headset_head_unit", s.backend.getCardProfile(testBluezCardName))
+	assert.Equal(t, testBluezHeadsetSinkName, s.backend.GetDefaultSink())
+
+	// 不是蓝牙声卡时不能设置蓝牙模式
+	s.backend.unplugCard(testBluezCardName)
+	s.handleEvents()
+	assert.NotNil(t, s.audio.SetBluetoothAudioMode(bluezModeA2dp))
+}
+
+func TestScenarioDefaultSinkSelection(t *testing.T) {
+	s := newAudioScenario(t)
+	plugTestPciCard(s.backend, pulse.AvailableTypeNo)
+	s.start()
+	assert.Equal(t, testPciSinkName, s.backend.GetDefaultSink())
+
+	// USB 声卡的优先级高于内置扬声器
+	plugTestUsbCard(s.backend)
+	s.handleEvents()
+	assert.Equal(t, testUsbSinkName, s.backend.GetDefaultSink())
+
+	// 拔出后暂停播放，回到内置扬声器
+	s.backend.unplugCard(testUsbCardName)
+	s.handleEvents()
+	assert.True(t, s.takePaused())
+	assert.Equal(t, testPciSinkName, s.backend.GetDefaultSink())
+	assert.Equal(t, testSpeakerPort, s.defaultSinkPort())
+
+	// 禁用的端口不会被自动选择
+	GetConfigKeeper().SetEnabled(testUsbCardName, testUsbPort, false)
+	plugTestUsbCard(s.backend)
+	s.handleEvents()
+	assert.Equal(t, testPciSinkName, s.backend.GetDefaultSink())
+	assert.Equal(t, 1, s.notifiedCount())
+	s.backend.unplugCard(testUsbCardName)
+	s.handleEvents()
+	GetConfigKeeper().SetEnabled(testUsbCardName, testUsbPort, true)
+
+	// 用户选择的虚拟输出设备不会被热插拔的设备替换
+	virtualSinkName := getVirtualSinkName("rec")
+	s.backend.addSink(pulse.Sink{Name: virtualSinkName, Card: math.MaxUint32})
+	s.backend.SetDefaultSink(virtualSinkName)
+	s.handleEvents()
+	assert.Equal(t, virtualSinkName, s.backend.GetDefaultSink())
+	plugTestUsbCard(s.backend)
+	s.handleEvents()
+	assert.Equal(t, virtualSinkName, s.backend.GetDefaultSink())
+	assert.False(t, s.takePaused())
+}
@@ -0,0 +1,403 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// sceneStep 是应用场景的一个步骤，rollback 撤销 apply 的修改，为 nil 时不需要撤销
+type sceneStep struct {
+	name     string
+	apply    func() error
+	rollback func()
+}
+
+// runSceneSteps 依次执行步骤，某个步骤失败时按相反的顺序回滚已经完成的步骤
+func runSceneSteps(steps []sceneStep) error {
+	for i, step := range steps {
+		logger.Debug("scene step:", step.name)
+		err := step.apply()
+		if err == nil {
+			continue
+		}
+		logger.Warningf("scene step %q failed: %v, rollback", step.name, err)
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].rollback != nil {
+				logger.Debug("rollback scene step:", steps[j].name)
+				steps[j].rollback()
+			}
+		}
+		return fmt.Errorf("%s: %v", step.name, err)
+	}
+	return nil
+}
+
+func (a *Audio) getCards() CardList {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cards
+}
+
+// captureScene 记录当前的输出端口、输入端口、声卡 profile、音量和降噪状态
+func (a *Audio) captureScene(name string) (*AudioScene, error) {
+	cards := a.getCards()
+	scene := &AudioScene{
+		Name:         name,
+		CardProfiles: make(map[string]string),
+	}
+	newScenePort := func(cardId uint32, portName string, volume float64) *ScenePort {
+		card, err := cards.get(cardId)
+		if err != nil || portName == "" {
+			return nil
+		}
+		scene.CardProfiles[card.core.Name] = card.ActiveProfile.Name
+		return &ScenePort{
+			CardName: card.core.Name,
+			PortName: portName,
+			Volume:   volume,
+		}
+	}
+
+	sink := a.getDefaultSink()
+	if sink != nil {
+		sink.PropsMu.RLock()
+		scene.Output = newScenePort(sink.Card, sink.ActivePort.Name, sink.Volume)
+		sink.PropsMu.RUnlock()
+	}
+	// 开启降噪时默认输入设备是降噪通道，记录绑定的物理输入设备
+	source := a.getReduceNoiseMasterSource()
+	if source != nil {
+		source.PropsMu.RLock()
+		scene.Input = newScenePort(source.Card, source.ActivePort.Name, source.Volume)
+		source.PropsMu.RUnlock()
+	}
+	if scene.Output == nil && scene.Input == nil {
+		return nil, errors.New("no output or input port")
+	}
+
+	a.PropsMu.RLock()
+	scene.ReduceNoise = a.ReduceNoise
+	a.PropsMu.RUnlock()
+	return scene, nil
+}
+
+// checkScene 在修改之前检查场景中的声卡、profile 和端口是否可用
+func (a *Audio) checkScene(scene *AudioScene, cards CardList) error {
+	for cardName, profileName := range scene.CardProfiles {
+		card, err := cards.getByName(cardName)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, profile := range card.Profiles {
+			if profile.Name == profileName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("card %s has no profile %s", cardName, profileName)
+		}
+	}
+
+	checkPort := func(port *ScenePort, direction int) error {
+		if port == nil {
+			return nil
+		}
+		card, err := cards.getByName(port.CardName)
+		if err != nil {
+			return err
+		}
+		if !a.isPortEnabled(card.Id, port.PortName, int32(direction)) {
+			return fmt.Errorf("card %s port %s is not available", port.CardName, port.PortName)
+		}
+		if !isVolumeValid(port.Volume) {
+			return fmt.Errorf("invalid volume value: %v", port.Volume)
+		}
+		return nil
+	}
+	err := checkPort(scene.Output, pulse.DirectionSink)
+	if err != nil {
+		return err
+	}
+	err = checkPort(scene.Input, pulse.DirectionSource)
+	if err != nil {
+		return err
+	}
+	if scene.ReduceNoise && scene.Input != nil && isBluezAudio(scene.Input.CardName) {
+		return errors.New("bluetooth audio device cannot open reduce-noise")
+	}
+	return nil
+}
+
+// 设置声卡的 profile，蓝牙声卡同时记录蓝牙模式，避免重新连接时被改回去
+func (a *Audio) setSceneCardProfile(card *Card, profile string) {
+	logger.Debugf("set card %s profile %s", card.core.Name, profile)
+	a.ctx.SetCardProfile(card.Id, profile)
+	if !isBluezAudio(card.core.Name) {
+		return
+	}
+	for _, mode := range []string{bluezModeA2dp, bluezModeHeadset} {
+		if strings.Contains(strings.ToLower(profile), mode) {
+			GetBluezAudioManager().SetMode(card.core.Name, mode)
+			break
+		}
+	}
+}
+
+// 获取当前的输出或输入端口，输入使用降噪绑定的物理输入设备
+func (a *Audio) getSceneCurrentPort(direction int) (cardId uint32, portName string, ok bool) {
+	if direction == pulse.DirectionSink {
+		sink := a.getDefaultSink()
+		if sink == nil {
+			return 0, "", false
+		}
+		sink.PropsMu.RLock()
+		defer sink.PropsMu.RUnlock()
+		return sink.Card, sink.ActivePort.Name, sink.ActivePort.Name != ""
+	}
+	source := a.getReduceNoiseMasterSource()
+	if source == nil {
+		return 0, "", false
+	}
+	source.PropsMu.RLock()
+	defer source.PropsMu.RUnlock()
+	return source.Card, source.ActivePort.Name, source.ActivePort.Name != ""
+}
+
+// 切换到场景中的端口，场景设置了这个声卡的 profile 时不再自动选择 profile
+func (a *Audio) setScenePort(port *ScenePort, direction int, keepProfile bool) error {
+	card, err := a.getCards().getByName(port.CardName)
+	if err != nil {
+		return err
+	}
+	if !keepProfile {
+		return a.setPort(card.Id, port.PortName, direction)
+	}
+
+	a.portLocker.Lock()
+	defer a.portLocker.Unlock()
+	if direction == pulse.DirectionSink {
+		return a.setDefaultSinkWithPort(card.Id, port.PortName)
+	}
+	return a.setDefaultSourceWithPort(card.Id, port.PortName)
+}
+
+func (a *Audio) getScenePortStep(port *ScenePort, direction int, keepProfile bool) sceneStep {
+	prevCardId, prevPortName, hasPrev := a.getSceneCurrentPort(direction)
+	return sceneStep{
+		name: fmt.Sprintf("set card %s port %s", port.CardName, port.PortName),
+		apply: func() error {
+			return a.setScenePort(port, direction, keepProfile)
+		},
+		rollback: func() {
+			if !hasPrev {
+				return
+			}
+			err := a.setPort(prevCardId, prevPortName, direction)
+			if err != nil {
+				logger.Warning(err)
+			}
+		},
+	}
+}
+
+// 场景的音量和降噪写入端口配置，切换端口后由配置恢复的流程生效
+func getScenePortConfigSteps(scene *AudioScene) []sceneStep {
+	var steps []sceneStep
+	addVolumeStep := func(port *ScenePort) {
+		_, portConfig := GetConfigKeeper().GetCardAndPortConfig(port.CardName, port.PortName)
+		prevVolume := portConfig.Volume
+		steps = append(steps, sceneStep{
+			name: fmt.Sprintf("set card %s port %s volume %v", port.CardName, port.PortName, port.Volume),
+			apply: func() error {
+				GetConfigKeeper().SetVolume(port.CardName, port.PortName, port.Volume)
+				return nil
+			},
+			rollback: func() {
+				GetConfigKeeper().SetVolume(port.CardName, port.PortName, prevVolume)
+			},
+		})
+	}
+	if scene.Output != nil {
+		addVolumeStep(scene.Output)
+	}
+	if scene.Input != nil {
+		addVolumeStep(scene.Input)
+
+		input := scene.Input
+		_, portConfig := GetConfigKeeper().GetCardAndPortConfig(input.CardName, input.PortName)
+		prevReduceNoise := portConfig.ReduceNoise
+		steps = append(steps, sceneStep{
+			name: fmt.Sprintf("set card %s port %s reduce noise %v", input.CardName, input.PortName, scene.ReduceNoise),
+			apply: func() error {
+				GetConfigKeeper().SetReduceNoise(input.CardName, input.PortName, scene.ReduceNoise)
+				return nil
+			},
+			rollback: func() {
+				GetConfigKeeper().SetReduceNoise(input.CardName, input.PortName, prevReduceNoise)
+			},
+		})
+	}
+	return steps
+}
+
+// 端口已经是当前端口时不会触发配置恢复，需要主动恢复一次
+func (a *Audio) resumeSceneConfig(scene *AudioScene) {
+	cards := a.getCards()
+	isScenePort := func(port *ScenePort, cardId uint32, portName string) bool {
+		if port == nil {
+			return false
+		}
+		card, err := cards.get(cardId)
+		return err == nil && card.core.Name == port.CardName && portName == port.PortName
+	}
+
+	sink := a.getDefaultSink()
+	if sink != nil && isScenePort(scene.Output, sink.Card, sink.ActivePort.Name) {
+		a.resumeSinkConfig(sink)
+	}
+	source := a.getReduceNoiseMasterSource()
+	if source != nil && isScenePort(scene.Input, source.Card, source.ActivePort.Name) {
+		a.resumeSourceConfig(source, true)
+	}
+}
+
+// applyScene 按 profile、端口配置、输出端口、输入端口的顺序应用场景，失败时回滚已经完成的修改
+func (a *Audio) applyScene(scene *AudioScene) error {
+	logger.Debugf("apply audio scene %q", scene.Name)
+	cards := a.getCards()
+	err := a.checkScene(scene, cards)
+	if err != nil {
+		return err
+	}
+
+	var steps []sceneStep
+	cardNames := make([]string, 0, len(scene.CardProfiles))
+	for cardName := range scene.CardProfiles {
+		cardNames = append(cardNames, cardName)
+	}
+	sort.Strings(cardNames)
+	for _, cardName := range cardNames {
+		card, _ := cards.getByName(cardName)
+		profile := scene.CardProfiles[cardName]
+		prevProfile := card.ActiveProfile.Name
+		if profile == prevProfile {
+			continue
+		}
+		steps = append(steps, sceneStep{
+			name: fmt.Sprintf("set card %s profile %s", cardName, profile),
+			apply: func() error {
+				a.setSceneCardProfile(card, profile)
+				return nil
+			},
+			rollback: func() {
+				a.setSceneCardProfile(card, prevProfile)
+			},
+		})
+	}
+
+	steps = append(steps, getScenePortConfigSteps(scene)...)
+	if scene.Output != nil {
+		_, keepProfile := scene.CardProfiles[scene.Output.CardName]
+		steps = append(steps, a.getScenePortStep(scene.Output, pulse.DirectionSink, keepProfile))
+	}
+	if scene.Input != nil {
+		_, keepProfile := scene.CardProfiles[scene.Input.CardName]
+		steps = append(steps, a.getScenePortStep(scene.Input, pulse.DirectionSource, keepProfile))
+	}
+	steps = append(steps, sceneStep{
+		name: "resume port config",
+		apply: func() error {
+			a.resumeSceneConfig(scene)
+			return nil
+		},
+	})
+
+	err = runSceneSteps(steps)
+	if err != nil {
+		return err
+	}
+
+	// 场景中的端口设为最高优先级，避免被自动切换
+	if scene.Output != nil {
+		GetPriorityManager().SetFirstOutputPort(scene.Output.CardName, scene.Output.PortName)
+		a.notifyUserPortPriorities(pulse.DirectionSink)
+	}
+	if scene.Input != nil {
+		GetPriorityManager().SetFirstInputPort(scene.Input.CardName, scene.Input.PortName)
+		a.notifyUserPortPriorities(pulse.DirectionSource)
+		a.inputAutoSwitchCount = 0
+	}
+	return nil
+}
+
+// 声卡出现时应用和它关联的场景
+func (a *Audio) autoApplyScene(card *Card) {
+	scene := GetSceneKeeper().GetAutoApplyScene(card.core.Name)
+	if scene == nil {
+		return
+	}
+	logger.Debugf("card %s added, auto apply audio scene %q", card.core.Name, scene.Name)
+	err := a.applyScene(scene)
+	if err != nil {
+		logger.Warningf("failed to auto apply audio scene %q: %v", scene.Name, err)
+	}
+}
+
+// SaveScene 把当前的输出端口、输入端口、声卡 profile、音量和降噪状态保存为场景，
+// 同名的场景会被覆盖，但保留自动应用的设置
+func (a *Audio) SaveScene(name string) *dbus.Error {
+	if name == "" {
+		return dbusutil.ToError(errors.New("empty scene name"))
+	}
+	scene, err := a.captureScene(name)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	GetSceneKeeper().SetScene(scene)
+	return nil
+}
+
+// ListScenes 返回所有场景，格式为按名称排序的 AudioScene 的 JSON 数组
+func (a *Audio) ListScenes() (scenesJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(GetSceneKeeper().GetScenes())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// ApplyScene 应用场景，任何一步失败时恢复到应用之前的设置
+func (a *Audio) ApplyScene(name string) *dbus.Error {
+	scene := GetSceneKeeper().GetScene(name)
+	if scene == nil {
+		return dbusutil.ToError(fmt.Errorf("scene %q not found", name))
+	}
+	return dbusutil.ToError(a.applyScene(scene))
+}
+
+// DeleteScene 删除场景
+func (a *Audio) DeleteScene(name string) *dbus.Error {
+	if !GetSceneKeeper().DeleteScene(name) {
+		return dbusutil.ToError(fmt.Errorf("scene %q not found", name))
+	}
+	return nil
+}
+
+// SetSceneAutoApplyCard 设置插入声卡时自动应用的场景，cardName 是 pulseaudio 中的声卡名称，
+// 为空时取消自动应用
+func (a *Audio) SetSceneAutoApplyCard(name string, cardName string) *dbus.Error {
+	return dbusutil.ToError(GetSceneKeeper().SetAutoApplyCard(name, cardName))
+}
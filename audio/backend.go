@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// audioBackend 是 Audio 使用的声音服务的接口，包括声卡、输出输入设备、音频流、模块和事件。
+// 运行时由 pulseBackend 通过 pulseaudio 实现，测试时使用内存中的实现
+type audioBackend interface {
+	moduleContext
+
+	GetServer() (*pulse.Server, error)
+	GetDefaultSink() string
+	GetDefaultSource() string
+	SetDefaultSink(name string)
+	SetDefaultSource(name string)
+
+	GetCardList() []*pulse.Card
+	GetCard(index uint32) (*pulse.Card, error)
+	SetCardProfile(index uint32, profile string)
+
+	GetSinkList() []*pulse.Sink
+	GetSink(index uint32) (*pulse.Sink, error)
+	SetSinkPortByIndex(index uint32, port string)
+	SetSinkVolumeByIndex(index uint32, v pulse.CVolume)
+	SetSinkMuteByIndex(index uint32, mute bool)
+
+	GetSourceList() []*pulse.Source
+	SetSourcePortByIndex(index uint32, port string)
+	SetSourceVolumeByIndex(index uint32, v pulse.CVolume)
+	SetSourceMuteByIndex(index uint32, mute bool)
+
+	GetSinkInputList() []*pulse.SinkInput
+	SetSinkInputVolume(index uint32, v pulse.CVolume)
+	SetSinkInputMute(index uint32, mute bool)
+	MoveSinkInputsByIndex(sinkInputs []uint32, sink uint32)
+
+	GetSourceOutputList() []*pulse.SourceOutput
+	SetSourceOutputVolume(index uint32, v pulse.CVolume)
+	SetSourceOutputMute(index uint32, mute bool)
+	MoveSourceOutputsByIndex(sourceOutputs []uint32, source uint32)
+
+	// NewSourceMeter 创建输入设备的音量计，不支持时返回 nil
+	NewSourceMeter(source uint32) *pulse.SourceMeter
+
+	AddEventChan(ch chan *pulse.Event)
+	RemoveEventChan(ch chan *pulse.Event)
+	AddStateChan(ch chan int)
+	RemoveStateChan(ch chan int)
+}
+
+// pulseBackend 使用 pulseaudio 客户端实现 audioBackend
+type pulseBackend struct {
+	ctx *pulse.Context
+}
+
+func newPulseBackend(ctx *pulse.Context) *pulseBackend {
+	return &pulseBackend{
+		ctx: ctx,
+	}
+}
+
+func (b *pulseBackend) LoadModule(name, argument string) (uint32, error) {
+	return b.ctx.LoadModule(name, argument)
+}
+
+func (b *pulseBackend) UnloadModule(index uint32) {
+	b.ctx.UnloadModule(index)
+}
+
+func (b *pulseBackend) GetModuleList() []*pulse.Module {
+	return b.ctx.GetModuleList()
+}
+
+func (b *pulseBackend) GetServer() (*pulse.Server, error) {
+	return b.ctx.GetServer()
+}
+
+func (b *pulseBackend) GetDefaultSink() string {
+	return b.ctx.GetDefaultSink()
+}
+
+func (b *pulseBackend) GetDefaultSource() string {
+	return b.ctx.GetDefaultSource()
+}
+
+func (b *pulseBackend) SetDefaultSink(name string) {
+	b.ctx.SetDefaultSink(name)
+}
+
+func (b *pulseBackend) SetDefaultSource(name string) {
+	b.ctx.SetDefaultSource(name)
+}
+
+func (b *pulseBackend) GetCardList() []*pulse.Card {
+	return b.ctx.GetCardList()
+}
+
+func (b *pulseBackend) GetCard(index uint32) (*pulse.Card, error) {
+	return b.ctx.GetCard(index)
+}
+
+func (b *pulseBackend) SetCardProfile(index uint32, profile string) {
+	card, err := b.ctx.GetCard(index)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	card.SetProfile(profile)
+}
+
+func (b *pulseBackend) GetSinkList() []*pulse.Sink {
+	return b.ctx.GetSinkList()
+}
+
+func (b *pulseBackend) GetSink(index uint32) (*pulse.Sink, error) {
+	return b.ctx.GetSink(index)
+}
+
+func (b *pulseBackend) SetSinkPortByIndex(index uint32, port string) {
+	b.ctx.SetSinkPortByIndex(index, port)
+}
+
+func (b *pulseBackend) SetSinkVolumeByIndex(index uint32, v pulse.CVolume) {
+	b.ctx.SetSinkVolumeByIndex(index, v)
+}
+
+func (b *pulseBackend) SetSinkMuteByIndex(index uint32, mute bool) {
+	b.ctx.SetSinkMuteByIndex(index, mute)
+}
+
+func (b *pulseBackend) GetSourceList() []*pulse.Source {
+	return b.ctx.GetSourceList()
+}
+
+func (b *pulseBackend) SetSourcePortByIndex(index uint32, port string) {
+	b.ctx.SetSourcePortByIndex(index, port)
+}
+
+func (b *pulseBackend) SetSourceVolumeByIndex(index uint32, v pulse.CVolume) {
+	b.ctx.SetSourceVolumeByIndex(index, v)
+}
+
+func (b *pulseBackend) SetSourceMuteByIndex(index uint32, mute bool) {
+	b.ctx.SetSourceMuteByIndex(index, mute)
+}
+
+func (b *pulseBackend) GetSinkInputList() []*pulse.SinkInput {
+	return b.ctx.GetSinkInputList()
+}
+
+func (b *pulseBackend) SetSinkInputVolume(index uint32, v pulse.CVolume) {
+	b.ctx.SetSinkInputVolume(index, v)
+}
+
+func (b *pulseBackend) SetSinkInputMute(index uint32, mute bool) {
+	b.ctx.SetSinkInputMute(index, mute)
+}
+
+func (b *pulseBackend) MoveSinkInputsByIndex(sinkInputs []uint32, sink uint32) {
+	b.ctx.MoveSinkInputsByIndex(sinkInputs, sink)
+}
+
+func (b *pulseBackend) GetSourceOutputList() []*pulse.SourceOutput {
+	return b.ctx.GetSourceOutputList()
+}
+
+func (b *pulseBackend) SetSourceOutputVolume(index uint32, v pulse.CVolume) {
+	b.ctx.SetSourceOutputVolume(index, v)
+}
+
+func (b *pulseBackend) SetSourceOutputMute(index uint32, mute bool) {
+	b.ctx.SetSourceOutputMute(index, mute)
+}
+
+func (b *pulseBackend) MoveSourceOutputsByIndex(sourceOutputs []uint32, source uint32) {
+	b.ctx.MoveSourceOutputsByIndex(sourceOutputs, source)
+}
+
+func (b *pulseBackend) NewSourceMeter(source uint32) *pulse.SourceMeter {
+	return pulse.NewSourceMeter(b.ctx, source)
+}
+
+func (b *pulseBackend) AddEventChan(ch chan *pulse.Event) {
+	b.ctx.AddEventChan(ch)
+}
+
+func (b *pulseBackend) RemoveEventChan(ch chan *pulse.Event) {
+	b.ctx.RemoveEventChan(ch)
+}
+
+func (b *pulseBackend) AddStateChan(ch chan int) {
+	b.ctx.AddStateChan(ch)
+}
+
+func (b *pulseBackend) RemoveStateChan(ch chan int) {
+	b.ctx.RemoveStateChan(ch)
+}
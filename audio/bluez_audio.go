@@ -134,7 +134,7 @@ func isBluezDeviceValid(bluezPath string) bool {
 }
 
 /* 设置蓝牙声卡模式 */
-func (card *Card) SetBluezMode(mode string) {
+func (card *Card) SetBluezMode(ctx audioBackend, mode string) {
 	mode = strings.ToLower(mode)
 	filterList := strv.Strv(bluezModeFilterList)
 
@@ -146,17 +146,17 @@ func (card *Card) SetBluezMode(mode string) {
 		}
 		if profile.Available != 0 && strings.Contains(v, mode) {
 			logger.Debugf("set %s to %s", card.core.Name, profile.Name)
-			card.core.SetProfile(profile.Name)
+			ctx.SetCardProfile(card.Id, profile.Name)
 			return
 		}
 	}
 }
 
 /* 自动设置蓝牙声卡的模式 */
-func (card *Card) AutoSetBluezMode() {
+func (card *Card) AutoSetBluezMode(ctx audioBackend) {
 	mode := GetBluezAudioManager().GetMode(card.core.Name)
 	logger.Debugf("card %s auto set bluez mode %s", card.core.Name, mode)
-	card.SetBluezMode(mode)
+	card.SetBluezMode(ctx, mode)
 }
 
 /* 获取蓝牙声卡的模式(a2dp/headset) */
@@ -0,0 +1,353 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+const (
+	cmdParec = "parec"
+
+	// 录音流的 application.id，getSourceOutputVisible 根据它隐藏电平表使用的流
+	channelMeterAppId = "org.deepin.dde.daemon.audio.channel-meter"
+
+	channelMeterSampleRate  = 16000
+	channelMeterDefaultRate = 30
+	channelMeterMaxRate     = 60
+)
+
+// ChannelMeter 是一个输入设备（输出设备使用它的 monitor）的分声道电平表，
+// 按订阅者请求的最大频率发送 LevelsChanged 信号，最后一个订阅者离开后停止
+type ChannelMeter struct {
+	audio   *Audio
+	service *dbusutil.Service
+	PropsMu sync.RWMutex
+	// 声道数，LevelsChanged 信号中数组的长度
+	Channels int32
+	// 每秒发送 LevelsChanged 信号的次数
+	Rate uint32
+
+	id          string
+	device      string            // pulseaudio 中的 source 名称
+	subscribers map[string]uint32 // DBus 连接名 => 请求的频率
+	cmd         *exec.Cmd
+
+	signals *struct {
+		// 每个声道的峰值和均方根，范围 0 ~ 1
+		LevelsChanged struct {
+			peaks []float64
+			rms   []float64
+		}
+	}
+}
+
+// computeChannelLevels 计算交错排列的采样中每个声道的峰值和均方根
+func computeChannelLevels(samples []float32, channels int) (peaks []float64, rms []float64) {
+	peaks = make([]float64, channels)
+	rms = make([]float64, channels)
+	frames := len(samples) / channels
+	if frames == 0 {
+		return peaks, rms
+	}
+
+	for i := 0; i < frames*channels; i++ {
+		ch := i % channels
+		v := math.Abs(float64(samples[i]))
+		if v > 1 {
+			v = 1
+		}
+		if v > peaks[ch] {
+			peaks[ch] = v
+		}
+		rms[ch] += v * v
+	}
+	for ch := range rms {
+		rms[ch] = math.Sqrt(rms[ch] / float64(frames))
+	}
+	return peaks, rms
+}
+
+// readChannelLevels 从 r 中读取交错排列的 float32le 采样，每 framesPerReport 帧计算一次电平，
+// 直到读取出错，正常结束时返回 nil
+func readChannelLevels(r io.Reader, channels int, framesPerReport func() int,
+	report func(peaks, rms []float64)) error {
+	if channels <= 0 {
+		return fmt.Errorf("invalid channels: %d", channels)
+	}
+	buf := make([]byte, 4)
+	var samples []float32
+	for {
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		samples = append(samples, math.Float32frombits(binary.LittleEndian.Uint32(buf)))
+		if len(samples) >= framesPerReport()*channels {
+			report(computeChannelLevels(samples, channels))
+			samples = samples[:0]
+		}
+	}
+}
+
+func newChannelMeter(id string, device string, channels int, audio *Audio) *ChannelMeter {
+	return &ChannelMeter{
+		audio:       audio,
+		service:     audio.service,
+		Channels:    int32(channels),
+		id:          id,
+		device:      device,
+		subscribers: make(map[string]uint32),
+	}
+}
+
+func (m *ChannelMeter) getPath() dbus.ObjectPath {
+	return dbus.ObjectPath(dbusPath + "/ChannelMeter" + m.id)
+}
+
+func (*ChannelMeter) GetInterfaceName() string {
+	return dbusInterface + ".ChannelMeter"
+}
+
+// 调用者需要持有 m.PropsMu
+func (m *ChannelMeter) updateRate() {
+	var rate uint32
+	for _, r := range m.subscribers {
+		if r > rate {
+			rate = r
+		}
+	}
+	m.setPropRate(rate)
+}
+
+// subscribe 添加或者更新订阅者，rate 为 0 时使用默认的频率
+func (m *ChannelMeter) subscribe(sender string, rate uint32) {
+	if rate == 0 {
+		rate = channelMeterDefaultRate
+	} else if rate > channelMeterMaxRate {
+		rate = channelMeterMaxRate
+	}
+	m.PropsMu.Lock()
+	m.subscribers[sender] = rate
+	m.updateRate()
+	m.PropsMu.Unlock()
+}
+
+// unsubscribe 删除订阅者，返回剩余的订阅者数量
+func (m *ChannelMeter) unsubscribe(sender string) int {
+	m.PropsMu.Lock()
+	defer m.PropsMu.Unlock()
+	delete(m.subscribers, sender)
+	m.updateRate()
+	return len(m.subscribers)
+}
+
+func (m *ChannelMeter) hasSubscriber(sender string) bool {
+	m.PropsMu.RLock()
+	defer m.PropsMu.RUnlock()
+	_, ok := m.subscribers[sender]
+	return ok
+}
+
+func (m *ChannelMeter) getFramesPerReport() int {
+	m.PropsMu.RLock()
+	rate := m.Rate
+	m.PropsMu.RUnlock()
+	if rate == 0 {
+		rate = channelMeterDefaultRate
+	}
+	return channelMeterSampleRate / int(rate)
+}
+
+func (m *ChannelMeter) emitLevels(peaks, rms []float64) {
+	m.PropsMu.RLock()
+	stopped := m.cmd == nil
+	m.PropsMu.RUnlock()
+	if stopped {
+		return
+	}
+	err := m.service.Emit(m, "LevelsChanged", peaks, rms)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// start 启动 parec 录制 source 的采样
+func (m *ChannelMeter) start() error {
+	cmd := exec.Command(cmdParec,
+		"--device="+m.device,
+		"--format=float32le",
+		"--rate="+strconv.Itoa(channelMeterSampleRate),
+		"--channels="+strconv.Itoa(int(m.Channels)),
+		"--raw",
+		"--latency-msec=20",
+		"--property=application.id="+channelMeterAppId)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	m.PropsMu.Lock()
+	m.cmd = cmd
+	m.PropsMu.Unlock()
+
+	logger.Debugf("start channel meter %s on %s", m.id, m.device)
+	go func() {
+		err := readChannelLevels(bufio.NewReader(stdout), int(m.Channels), m.getFramesPerReport, m.emitLevels)
+		if err != nil {
+			logger.Warning(err)
+		}
+		err = cmd.Wait()
+		m.PropsMu.Lock()
+		stopped := m.cmd != cmd
+		if !stopped {
+			m.cmd = nil
+		}
+		m.PropsMu.Unlock()
+		if !stopped {
+			// parec 意外退出，删除电平表，订阅者需要重新订阅
+			logger.Warningf("channel meter %s exited: %v", m.id, err)
+			m.audio.removeChannelMeter(m)
+		}
+	}()
+	return nil
+}
+
+// stop 停止 parec
+func (m *ChannelMeter) stop() {
+	m.PropsMu.Lock()
+	cmd := m.cmd
+	m.cmd = nil
+	m.PropsMu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	logger.Debugf("stop channel meter %s", m.id)
+	err := cmd.Process.Kill()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// Unsubscribe 取消订阅，最后一个订阅者离开后电平表停止
+func (m *ChannelMeter) Unsubscribe(sender dbus.Sender) *dbus.Error {
+	if !m.hasSubscriber(string(sender)) {
+		return dbusutil.ToError(errors.New("not subscribed"))
+	}
+	m.audio.unsubscribeChannelMeter(m, string(sender))
+	return nil
+}
+
+// 订阅输入设备的电平表，同一个设备的订阅者共享一个电平表
+func (a *Audio) subscribeChannelMeter(sender string, id string, device string, channels int, rate uint32) (dbus.ObjectPath, error) {
+	a.channelMetersMu.Lock()
+	defer a.channelMetersMu.Unlock()
+
+	m, ok := a.channelMeters[id]
+	if !ok {
+		if device == "" || channels <= 0 {
+			return "/", fmt.Errorf("invalid device %q or channels %d", device, channels)
+		}
+		m = newChannelMeter(id, device, channels, a)
+		err := a.service.Export(m.getPath(), m)
+		if err != nil {
+			return "/", err
+		}
+		err = m.start()
+		if err != nil {
+			stopErr := a.service.StopExport(m)
+			if stopErr != nil {
+				logger.Warning(stopErr)
+			}
+			return "/", err
+		}
+		a.channelMeters[id] = m
+	}
+	m.subscribe(sender, rate)
+	return m.getPath(), nil
+}
+
+// 取消订阅，没有订阅者的电平表被停止
+func (a *Audio) unsubscribeChannelMeter(m *ChannelMeter, sender string) {
+	a.channelMetersMu.Lock()
+	defer a.channelMetersMu.Unlock()
+
+	if m.unsubscribe(sender) > 0 || a.channelMeters[m.id] != m {
+		return
+	}
+	a.stopChannelMeter(m)
+	delete(a.channelMeters, m.id)
+}
+
+// 删除 parec 意外退出的电平表
+func (a *Audio) removeChannelMeter(m *ChannelMeter) {
+	a.channelMetersMu.Lock()
+	defer a.channelMetersMu.Unlock()
+
+	if a.channelMeters[m.id] != m {
+		return
+	}
+	a.stopChannelMeter(m)
+	delete(a.channelMeters, m.id)
+}
+
+// DBus 连接断开时取消它的所有订阅
+func (a *Audio) removeChannelMeterSubscriber(sender string) {
+	var meters []*ChannelMeter
+	a.channelMetersMu.Lock()
+	for _, m := range a.channelMeters {
+		if m.hasSubscriber(sender) {
+			meters = append(meters, m)
+		}
+	}
+	a.channelMetersMu.Unlock()
+
+	for _, m := range meters {
+		a.unsubscribeChannelMeter(m, sender)
+	}
+}
+
+// 调用者需要持有 a.channelMetersMu
+func (a *Audio) stopChannelMeter(m *ChannelMeter) {
+	m.stop()
+	err := a.service.StopExport(m)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// 停止所有的电平表，pulseaudio 断开时调用
+func (a *Audio) stopChannelMeters() {
+	a.channelMetersMu.Lock()
+	defer a.channelMetersMu.Unlock()
+
+	for id, m := range a.channelMeters {
+		a.stopChannelMeter(m)
+		delete(a.channelMeters, id)
+	}
+}
+
+func (a *Audio) handleNameOwnerChanged(name, oldOwner, newOwner string) {
+	if newOwner == "" && oldOwner != "" {
+		a.removeChannelMeterSubscriber(name)
+	}
+}
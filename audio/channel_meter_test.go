@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeChannelLevels(t *testing.T) {
+	peaks, rms := computeChannelLevels([]float32{0.5, -1, -0.5, 0, 0.5, 2}, 2)
+	assert.Equal(t, []float64{0.5, 1}, peaks)
+	assert.InDelta(t, 0.5, rms[0], 1e-9)
+	assert.InDelta(t, math.Sqrt(2.0/3), rms[1], 1e-9)
+
+	// 不完整的帧被忽略
+	peaks, rms = computeChannelLevels([]float32{0.25}, 2)
+	assert.Equal(t, []float64{0, 0}, peaks)
+	assert.Equal(t, []float64{0, 0}, rms)
+}
+
+func TestReadChannelLevels(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []float32{0.1, 0.2, 0.3, -0.4, 0.5, 0.6, 0.7} {
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, v))
+	}
+
+	var reports [][]float64
+	err := readChannelLevels(&buf, 2, func() int { return 2 }, func(peaks, rms []float64) {
+		reports = append(reports, peaks)
+	})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.InDeltaSlice(t, []float64{0.3, 0.4}, reports[0], 1e-6)
+
+	assert.Error(t, readChannelLevels(&buf, 0, func() int { return 1 }, nil))
+}
@@ -20,6 +20,9 @@ type PortConfig struct {
 	Balance        float64
 	ReduceNoise    bool
 	Mute           bool // 静音改为全局，此配置废弃
+
+	// 降噪使用的 module-echo-cancel 预设，为空时使用默认预设
+	ReduceNoisePreset string `json:",omitempty"`
 }
 
 type CardConfig struct {
@@ -212,6 +215,12 @@ func (ck *ConfigKeeper) SetReduceNoise(cardName string, portName string, reduce
 	ck.Save()
 }
 
+func (ck *ConfigKeeper) SetReduceNoisePreset(cardName string, portName string, preset string) {
+	_, port := ck.GetCardAndPortConfig(cardName, portName)
+	port.ReduceNoisePreset = preset
+	ck.Save()
+}
+
 func (ck *ConfigKeeper) SetMuteOutput(mute bool) {
 	ck.Mute.MuteOutput = mute
 	ck.Save()
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"sync"
+)
+
+const (
+	defaultDuckingEnabled     = true
+	defaultDuckingAttenuation = 0.6
+)
+
+var defaultDuckingRoles = []string{"phone"}
+
+type duckingConfig struct {
+	enabled     bool
+	attenuation float64  // 降低音量的比例，范围 0 ~ 1
+	roles       []string // 触发降低音量的 media.role
+	apps        []string // 触发降低音量的应用标识，和 SinkInput 的 AppId 相同
+}
+
+// duckingStream 是 duckingPolicy 需要的 sink-input 信息
+type duckingStream struct {
+	index  uint32
+	role   string
+	appId  string
+	volume float64
+}
+
+// duckingPolicy 在通信类的流（比如 media.role=phone）存在时降低其他流的音量，
+// 所有通信类的流结束后恢复原来的音量
+type duckingPolicy struct {
+	// 设置 sink-input 的音量，调用时持有 p.mu
+	setVolume func(index uint32, volume float64)
+
+	mu       sync.Mutex
+	cfg      duckingConfig
+	streams  map[uint32]*duckingStream
+	triggers map[uint32]struct{}
+	ducked   map[uint32]float64 // 被降低音量的流 => 原来的音量
+}
+
+func newDuckingPolicy(cfg duckingConfig, setVolume func(index uint32, volume float64)) *duckingPolicy {
+	return &duckingPolicy{
+		setVolume: setVolume,
+		cfg:       cfg,
+		streams:   make(map[uint32]*duckingStream),
+		triggers:  make(map[uint32]struct{}),
+		ducked:    make(map[uint32]float64),
+	}
+}
+
+func strvContains(list []string, val string) bool {
+	for _, v := range list {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *duckingPolicy) isTrigger(s *duckingStream) bool {
+	if !p.cfg.enabled {
+		return false
+	}
+	if s.role != "" && strvContains(p.cfg.roles, s.role) {
+		return true
+	}
+	return s.appId != "" && strvContains(p.cfg.apps, s.appId)
+}
+
+func (p *duckingPolicy) duck(s *duckingStream) {
+	if _, ok := p.ducked[s.index]; ok {
+		return
+	}
+	volume := s.volume * (1 - p.cfg.attenuation)
+	logger.Debugf("ducking sink-input #%d volume %v -> %v", s.index, s.volume, volume)
+	p.ducked[s.index] = s.volume
+	p.setVolume(s.index, volume)
+}
+
+func (p *duckingPolicy) duckAll() {
+	for index, s := range p.streams {
+		if _, ok := p.triggers[index]; ok {
+			continue
+		}
+		p.duck(s)
+	}
+}
+
+func (p *duckingPolicy) restoreAll() {
+	for index, volume := range p.ducked {
+		logger.Debugf("restore sink-input #%d volume %v", index, volume)
+		p.setVolume(index, volume)
+		if s, ok := p.streams[index]; ok {
+			s.volume = volume
+		}
+	}
+	p.ducked = make(map[uint32]float64)
+}
+
+// addStream 在添加 sink-input 时调用
+func (p *duckingPolicy) addStream(s duckingStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.streams[s.index] = &s
+	if p.isTrigger(&s) {
+		p.triggers[s.index] = struct{}{}
+		if len(p.triggers) == 1 {
+			logger.Debugf("start ducking, triggered by sink-input #%d", s.index)
+			p.duckAll()
+		}
+		return
+	}
+	if len(p.triggers) > 0 {
+		p.duck(&s)
+	}
+}
+
+// removeStream 在删除 sink-input 时调用
+func (p *duckingPolicy) removeStream(index uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.streams, index)
+	delete(p.ducked, index)
+	if _, ok := p.triggers[index]; ok {
+		delete(p.triggers, index)
+		if len(p.triggers) == 0 {
+			logger.Debug("stop ducking")
+			p.restoreAll()
+		}
+	}
+}
+
+// syncVolume 在 sink-input 的音量变化时调用，被降低音量的流忽略
+func (p *duckingPolicy) syncVolume(index uint32, volume float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.ducked[index]; ok {
+		return
+	}
+	if s, ok := p.streams[index]; ok {
+		s.volume = volume
+	}
+}
+
+// userSetVolume 在用户设置 sink-input 的音量时调用，
+// 降低音量期间用户修改过音量的流，通信结束后不再恢复
+func (p *duckingPolicy) userSetVolume(index uint32, volume float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.ducked, index)
+	if s, ok := p.streams[index]; ok {
+		s.volume = volume
+	}
+}
+
+// setConfig 修改配置，先恢复所有流的音量，再按新的配置重新判断
+func (p *duckingPolicy) setConfig(cfg duckingConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.restoreAll()
+	p.cfg = cfg
+	p.triggers = make(map[uint32]struct{})
+	for index, s := range p.streams {
+		if p.isTrigger(s) {
+			p.triggers[index] = struct{}{}
+		}
+	}
+	if len(p.triggers) > 0 {
+		p.duckAll()
+	}
+}
+
+// clear 清除所有流，pulseaudio 断开时调用，不恢复音量
+func (p *duckingPolicy) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.streams = make(map[uint32]*duckingStream)
+	p.triggers = make(map[uint32]struct{})
+	p.ducked = make(map[uint32]float64)
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSinkInputs 记录 duckingPolicy 设置的音量
+type fakeSinkInputs map[uint32]float64
+
+func (f fakeSinkInputs) setVolume(index uint32, volume float64) {
+	f[index] = volume
+}
+
+func newTestDuckingPolicy(sinkInputs fakeSinkInputs) *duckingPolicy {
+	return newDuckingPolicy(duckingConfig{
+		enabled:     true,
+		attenuation: 0.5,
+		roles:       []string{"phone"},
+		apps:        []string{"wemeetapp"},
+	}, sinkInputs.setVolume)
+}
+
+func TestDuckingPolicy(t *testing.T) {
+	sinkInputs := make(fakeSinkInputs)
+	p := newTestDuckingPolicy(sinkInputs)
+
+	p.addStream(duckingStream{index: 1, role: "music", appId: "deepin-music", volume: 0.8})
+	p.addStream(duckingStream{index: 2, appId: "firefox", volume: 0.6})
+	assert.Empty(t, sinkInputs)
+
+	// 通话开始，降低其他流的音量
+	p.addStream(duckingStream{index: 3, role: "phone", appId: "skype", volume: 1})
+	assert.Equal(t, fakeSinkInputs{1: 0.4, 2: 0.3}, sinkInputs)
+
+	// 通话期间新增的流也降低音量
+	p.addStream(duckingStream{index: 4, role: "video", appId: "mpv", volume: 1})
+	assert.Equal(t, 0.5, sinkInputs[4])
+
+	// 第二个通话结束时不恢复
+	p.addStream(duckingStream{index: 5, appId: "wemeetapp", volume: 1})
+	p.removeStream(5)
+	assert.Equal(t, 0.4, sinkInputs[1])
+
+	// 降低音量期间的音量变化不影响恢复的音量
+	p.syncVolume(1, 0.4)
+	// 用户修改过音量的流不再恢复
+	p.userSetVolume(2, 0.9)
+	sinkInputs[2] = 0.9
+	p.removeStream(4)
+
+	p.removeStream(3)
+	assert.Equal(t, fakeSinkInputs{1: 0.8, 2: 0.9, 4: 0.5}, sinkInputs)
+}
+
+func TestDuckingPolicy_setConfig(t *testing.T) {
+	sinkInputs := make(fakeSinkInputs)
+	p := newTestDuckingPolicy(sinkInputs)
+
+	p.addStream(duckingStream{index: 1, role: "music", volume: 0.8})
+	p.addStream(duckingStream{index: 2, role: "phone", volume: 1})
+	assert.Equal(t, 0.4, sinkInputs[1])
+
+	// 修改降低的比例
+	cfg := p.cfg
+	cfg.attenuation = 0.25
+	p.setConfig(cfg)
+	assert.InDelta(t, 0.6, sinkInputs[1], 1e-9)
+
+	// 禁用后恢复音量
+	cfg.enabled = false
+	p.setConfig(cfg)
+	assert.Equal(t, 0.8, sinkInputs[1])
+
+	// 修改触发的 role 后重新判断
+	cfg.enabled = true
+	cfg.roles = []string{"music"}
+	p.setConfig(cfg)
+	assert.Equal(t, fakeSinkInputs{1: 0.8, 2: 0.75}, sinkInputs)
+
+	p.clear()
+	p.addStream(duckingStream{index: 3, role: "game", volume: 1})
+	assert.Equal(t, fakeSinkInputs{1: 0.8, 2: 0.75}, sinkInputs)
+}
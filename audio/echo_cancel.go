@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+const (
+	echoCancelModuleName = "module-echo-cancel"
+	// 降噪通道的名称，isPhysicalDevice 根据名称判断是否是降噪通道
+	echoCancelSourceName = "echoCancelSource"
+
+	defaultReduceNoisePreset = "webrtc"
+)
+
+// echoCancelPreset 是 module-echo-cancel 的 aec_method 和 aec_args 的预设
+type echoCancelPreset struct {
+	Name   string
+	Method string // aec_method
+	Args   string // aec_args
+}
+
+var echoCancelPresets = []echoCancelPreset{
+	{
+		Name:   "webrtc",
+		Method: "webrtc",
+		Args:   "analog_gain_control=0 digital_gain_control=1",
+	},
+	{
+		Name:   "webrtc-strong",
+		Method: "webrtc",
+		Args:   "analog_gain_control=0 digital_gain_control=1 noise_suppression=1 high_pass_filter=1 extended_filter=1",
+	},
+	{
+		Name:   "webrtc-agc",
+		Method: "webrtc",
+		Args:   "analog_gain_control=1 digital_gain_control=1 noise_suppression=1",
+	},
+	{
+		Name:   "speex",
+		Method: "speex",
+		Args:   "agc=1 denoise=1",
+	},
+}
+
+func getEchoCancelPresetNames() []string {
+	names := make([]string, len(echoCancelPresets))
+	for i, preset := range echoCancelPresets {
+		names[i] = preset.Name
+	}
+	return names
+}
+
+// 根据名称获取预设，名称为空时返回默认预设
+func getEchoCancelPreset(name string) (*echoCancelPreset, error) {
+	if name == "" {
+		name = defaultReduceNoisePreset
+	}
+	for i := range echoCancelPresets {
+		if echoCancelPresets[i].Name == name {
+			return &echoCancelPresets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("invalid reduce noise preset %q", name)
+}
+
+// 生成加载 module-echo-cancel 的参数，降噪通道绑定到 master 输入设备上
+func getEchoCancelModuleArgs(master string, preset *echoCancelPreset) string {
+	return fmt.Sprintf("use_master_format=1 aec_method=%s aec_args=\"%s\" source_master=%s source_name=%s",
+		preset.Method, preset.Args, master, echoCancelSourceName)
+}
+
+// moduleContext 是管理 pulseaudio 模块时使用的 pulse context 的方法
+type moduleContext interface {
+	LoadModule(name, argument string) (uint32, error)
+	UnloadModule(index uint32)
+	GetModuleList() []*pulse.Module
+}
+
+// echoCancelManager 管理 module-echo-cancel 模块，同一时间只加载一个，绑定到当前的物理输入设备上
+type echoCancelManager struct {
+	ctx moduleContext
+
+	mu          sync.Mutex
+	loaded      bool
+	moduleIndex uint32
+	master      string // 绑定的物理输入设备
+	preset      string
+}
+
+func newEchoCancelManager(ctx moduleContext) *echoCancelManager {
+	return &echoCancelManager{
+		ctx: ctx,
+	}
+}
+
+// unloadStale 卸载之前加载的降噪模块，比如 echoCancelEnable.sh 或者上次运行时加载的
+func (m *echoCancelManager) unloadStale() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, module := range m.ctx.GetModuleList() {
+		if module.Name != echoCancelModuleName {
+			continue
+		}
+		if m.loaded && module.Index == m.moduleIndex {
+			continue
+		}
+		if strings.Contains(module.Argument, "source_name="+echoCancelSourceName) {
+			logger.Debugf("unload stale %s #%d", echoCancelModuleName, module.Index)
+			m.ctx.UnloadModule(module.Index)
+		}
+	}
+}
+
+// enable 加载降噪模块，绑定的输入设备或者预设改变时重新加载
+func (m *echoCancelManager) enable(master, presetName string) error {
+	if master == "" {
+		return errors.New("empty master source")
+	}
+	preset, err := getEchoCancelPreset(presetName)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded && m.master == master && m.preset == preset.Name {
+		return nil
+	}
+	m.unload()
+
+	args := getEchoCancelModuleArgs(master, preset)
+	logger.Debugf("load %s %s", echoCancelModuleName, args)
+	index, err := m.ctx.LoadModule(echoCancelModuleName, args)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", echoCancelModuleName, err)
+	}
+	m.loaded = true
+	m.moduleIndex = index
+	m.master = master
+	m.preset = preset.Name
+	return nil
+}
+
+// 调用者需要持有 m.mu
+func (m *echoCancelManager) unload() {
+	if !m.loaded {
+		return
+	}
+	logger.Debugf("unload %s #%d", echoCancelModuleName, m.moduleIndex)
+	m.ctx.UnloadModule(m.moduleIndex)
+	m.loaded = false
+	m.master = ""
+	m.preset = ""
+}
+
+// disable 卸载降噪模块，返回之前绑定的输入设备
+func (m *echoCancelManager) disable() (master string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	master = m.master
+	m.unload()
+	return master
+}
+
+// getMaster 返回绑定的输入设备，没有加载时返回空字符串
+func (m *echoCancelManager) getMaster() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.master
+}
+
+// checkMaster 在输入设备被移除后调用，绑定的输入设备不存在时 pulseaudio 会自动卸载降噪模块，
+// 这里只更新状态，返回模块是否已经被卸载
+func (m *echoCancelManager) checkMaster(sourceExists func(name string) bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.loaded || sourceExists(m.master) {
+		return false
+	}
+	logger.Debugf("master source %s of %s removed", m.master, echoCancelModuleName)
+	m.loaded = false
+	m.master = ""
+	m.preset = ""
+	return true
+}
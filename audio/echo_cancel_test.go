@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeModuleContext struct {
+	modules   []*pulse.Module
+	nextIndex uint32
+	loadErr   error
+}
+
+func (c *fakeModuleContext) LoadModule(name, argument string) (uint32, error) {
+	if c.loadErr != nil {
+		return 0, c.loadErr
+	}
+	c.nextIndex++
+	c.modules = append(c.modules, &pulse.Module{
+		Index:    c.nextIndex,
+		Name:     name,
+		Argument: argument,
+	})
+	return c.nextIndex, nil
+}
+
+func (c *fakeModuleContext) UnloadModule(index uint32) {
+	for i, module := range c.modules {
+		if module.Index == index {
+			c.modules = append(c.modules[:i], c.modules[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *fakeModuleContext) GetModuleList() []*pulse.Module {
+	// pulse context 每次返回新的列表，遍历时可以卸载模块
+	return append([]*pulse.Module(nil), c.modules...)
+}
+
+func TestGetEchoCancelPreset(t *testing.T) {
+	preset, err := getEchoCancelPreset("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultReduceNoisePreset, preset.Name)
+
+	preset, err = getEchoCancelPreset("speex")
+	require.NoError(t, err)
+	assert.Equal(t, "speex", preset.Method)
+
+	_, err = getEchoCancelPreset("rnnoise")
+	assert.Error(t, err)
+
+	assert.Equal(t, `use_master_format=1 aec_method=webrtc aec_args="analog_gain_control=0 digital_gain_control=1" source_master=alsa_input.pci source_name=echoCancelSource`,
+		getEchoCancelModuleArgs("alsa_input.pci", &echoCancelPresets[0]))
+	assert.Len(t, getEchoCancelPresetNames(), len(echoCancelPresets))
+}
+
+func TestEchoCancelManager(t *testing.T) {
+	ctx := &fakeModuleContext{
+		modules: []*pulse.Module{
+			{Index: 100, Name: "module-alsa-card"},
+			{Index: 101, Name: echoCancelModuleName, Argument: "aec_method=webrtc source_name=echoCancelSource"},
+		},
+		nextIndex: 101,
+	}
+	m := newEchoCancelManager(ctx)
+
+	// 卸载之前遗留的降噪模块
+	m.unloadStale()
+	require.Len(t, ctx.modules, 1)
+	assert.Equal(t, uint32(100), ctx.modules[0].Index)
+
+	require.NoError(t, m.enable("alsa_input.pci", ""))
+	require.Len(t, ctx.modules, 2)
+	assert.Contains(t, ctx.modules[1].Argument, "source_master=alsa_input.pci")
+	assert.Equal(t, "alsa_input.pci", m.getMaster())
+
+	// 设置没有变化时不重新加载
+	require.NoError(t, m.enable("alsa_input.pci", defaultReduceNoisePreset))
+	assert.Equal(t, uint32(102), ctx.modules[1].Index)
+	m.unloadStale()
+	assert.Len(t, ctx.modules, 2)
+
+	// 切换预设和输入设备时重新加载
+	require.NoError(t, m.enable("alsa_input.pci", "speex"))
+	require.Len(t, ctx.modules, 2)
+	assert.Contains(t, ctx.modules[1].Argument, "aec_method=speex")
+	require.NoError(t, m.enable("alsa_input.usb", "speex"))
+	require.Len(t, ctx.modules, 2)
+	assert.Equal(t, uint32(104), ctx.modules[1].Index)
+
+	assert.Error(t, m.enable("alsa_input.usb", "invalid"))
+	assert.Error(t, m.enable("", "speex"))
+
+	assert.Equal(t, "alsa_input.usb", m.disable())
+	assert.Len(t, ctx.modules, 1)
+	assert.Equal(t, "", m.disable())
+
+	// 绑定的输入设备被移除
+	require.NoError(t, m.enable("alsa_input.usb", ""))
+	assert.False(t, m.checkMaster(func(name string) bool { return true }))
+	assert.True(t, m.checkMaster(func(name string) bool { return false }))
+	assert.Equal(t, "", m.getMaster())
+
+	ctx.loadErr = errors.New("load failed")
+	assert.Error(t, m.enable("alsa_input.pci", ""))
+	assert.Equal(t, "", m.getMaster())
+}
@@ -0,0 +1,620 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// fakeCardDevices 是声卡在一个 profile 下的 sink 和 source，Index 和 Card 由 fakeBackend 分配
+type fakeCardDevices struct {
+	sinks   []pulse.Sink
+	sources []pulse.Source
+}
+
+// fakeCard 描述插入 fakeBackend 的声卡，切换 profile 时替换成对应的设备
+type fakeCard struct {
+	card    pulse.Card
+	devices map[string]fakeCardDevices // profile => 设备
+}
+
+// fakeBackend 是内存中的 audioBackend，可以模拟声卡插拔和端口可用状态的变化，
+// 行为尽量和 pulseaudio 一致，并在数据变化时发送事件
+type fakeBackend struct {
+	fakeModuleContext
+
+	mu            sync.Mutex
+	cards         []*fakeCard
+	sinks         []*pulse.Sink
+	sources       []*pulse.Source
+	sinkInputs    []*pulse.SinkInput
+	sourceOutputs []*pulse.SourceOutput
+	defaultSink   string
+	defaultSource string
+	nextIndex     uint32
+	eventChans    []chan *pulse.Event
+	stateChans    []chan int
+	eventCount    int // 发送过的事件数量
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{}
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) emit(facility int, eventType int, index uint32) {
+	event := &pulse.Event{
+		Facility: facility,
+		Type:     eventType,
+		Index:    index,
+	}
+	b.eventCount++
+	for _, ch := range b.eventChans {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *fakeBackend) getEventCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.eventCount
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) findCard(index uint32) *fakeCard {
+	for _, c := range b.cards {
+		if c.card.Index == index {
+			return c
+		}
+	}
+	return nil
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) findCardByName(name string) *fakeCard {
+	for _, c := range b.cards {
+		if c.card.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) findSink(index uint32) *pulse.Sink {
+	for _, s := range b.sinks {
+		if s.Index == index {
+			return s
+		}
+	}
+	return nil
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) findSource(index uint32) *pulse.Source {
+	for _, s := range b.sources {
+		if s.Index == index {
+			return s
+		}
+	}
+	return nil
+}
+
+// addSink 添加一个 sink，card 为 math.MaxUint32 时表示没有声卡，返回 sink 的索引
+func (b *fakeBackend) addSink(sink pulse.Sink) uint32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.addSinkLocked(sink)
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) addSinkLocked(sink pulse.Sink) uint32 {
+	b.nextIndex++
+	sink.Index = b.nextIndex
+	b.sinks = append(b.sinks, &sink)
+	b.emit(pulse.FacilitySink, pulse.EventTypeNew, sink.Index)
+	// 和 pulseaudio 一样，没有默认设备时使用新的设备
+	if b.defaultSink == "" {
+		b.defaultSink = sink.Name
+		b.emit(pulse.FacilityServer, pulse.EventTypeChange, 0)
+	}
+	return sink.Index
+}
+
+// 调用者需要持有 b.mu
+func (b *fakeBackend) addSourceLocked(source pulse.Source) uint32 {
+	b.nextIndex++
+	source.Index = b.nextIndex
+	b.sources = append(b.sources, &source)
+	b.emit(pulse.FacilitySource, pulse.EventTypeNew, source.Index)
+	if b.defaultSource == "" {
+		b.defaultSource = source.Name
+		b.emit(pulse.FacilityServer, pulse.EventTypeChange, 0)
+	}
+	return source.Index
+}
+
+// 删除声卡的所有设备，默认设备被删除时和 pulseaudio 一样使用剩下的第一个设备，调用者需要持有 b.mu
+func (b *fakeBackend) removeCardDevices(cardIndex uint32) {
+	var sinks []*pulse.Sink
+	for _, s := range b.sinks {
+		if s.Card != cardIndex {
+			sinks = append(sinks, s)
+			continue
+		}
+		b.emit(pulse.FacilitySink, pulse.EventTypeRemove, s.Index)
+		if s.Name == b.defaultSink {
+			b.defaultSink = ""
+		}
+	}
+	b.sinks = sinks
+	if b.defaultSink == "" && len(b.sinks) > 0 {
+		b.defaultSink = b.sinks[0].Name
+		b.emit(pulse.FacilityServer, pulse.EventTypeChange, 0)
+	}
+
+	var sources []*pulse.Source
+	for _, s := range b.sources {
+		if s.Card != cardIndex {
+			sources = append(sources, s)
+			continue
+		}
+		b.emit(pulse.FacilitySource, pulse.EventTypeRemove, s.Index)
+		if s.Name == b.defaultSource {
+			b.defaultSource = ""
+		}
+	}
+	b.sources = sources
+	if b.defaultSource == "" && len(b.sources) > 0 {
+		b.defaultSource = b.sources[0].Name
+		b.emit(pulse.FacilityServer, pulse.EventTypeChange, 0)
+	}
+}
+
+// 添加声卡当前 profile 下的设备，调用者需要持有 b.mu
+func (b *fakeBackend) addCardDevices(c *fakeCard) {
+	devices := c.devices[c.card.ActiveProfile.Name]
+	for _, sink := range devices.sinks {
+		sink.Card = c.card.Index
+		b.addSinkLocked(sink)
+	}
+	for _, source := range devices.sources {
+		source.Card = c.card.Index
+		b.addSourceLocked(source)
+	}
+}
+
+// plugCard 插入声卡并创建当前 profile 下的设备，返回声卡的索引
+func (b *fakeBackend) plugCard(card pulse.Card, devices map[string]fakeCardDevices) uint32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextIndex++
+	card.Index = b.nextIndex
+	c := &fakeCard{
+		card:    card,
+		devices: devices,
+	}
+	b.cards = append(b.cards, c)
+	b.emit(pulse.FacilityCard, pulse.EventTypeNew, card.Index)
+	b.addCardDevices(c)
+	return card.Index
+}
+
+// unplugCard 拔出声卡，同时删除它的设备
+func (b *fakeBackend) unplugCard(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.findCardByName(name)
+	if c == nil {
+		panic(fmt.Sprintf("card %s not found", name))
+	}
+	b.removeCardDevices(c.card.Index)
+	for i, card := range b.cards {
+		if card == c {
+			b.cards = append(b.cards[:i], b.cards[i+1:]...)
+			break
+		}
+	}
+	b.emit(pulse.FacilityCard, pulse.EventTypeRemove, c.card.Index)
+}
+
+// setPortAvailable 修改声卡端口的可用状态，比如插拔耳机，同时更新使用这个端口的设备
+func (b *fakeBackend) setPortAvailable(cardName string, portName string, available int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.findCardByName(cardName)
+	if c == nil {
+		panic(fmt.Sprintf("card %s not found", cardName))
+	}
+	for i := range c.card.Ports {
+		if c.card.Ports[i].Name == portName {
+			c.card.Ports[i].Available = available
+		}
+	}
+	b.emit(pulse.FacilityCard, pulse.EventTypeChange, c.card.Index)
+
+	for _, s := range b.sinks {
+		if s.Card != c.card.Index || !updatePortAvailable(s.Ports, &s.ActivePort, portName, available) {
+			continue
+		}
+		b.emit(pulse.FacilitySink, pulse.EventTypeChange, s.Index)
+	}
+	for _, s := range b.sources {
+		if s.Card != c.card.Index || !updatePortAvailable(s.Ports, &s.ActivePort, portName, available) {
+			continue
+		}
+		b.emit(pulse.FacilitySource, pulse.EventTypeChange, s.Index)
+	}
+}
+
+func updatePortAvailable(ports []pulse.PortInfo, activePort *pulse.PortInfo, portName string, available int) bool {
+	found := false
+	for i := range ports {
+		if ports[i].Name == portName {
+			ports[i].Available = available
+			found = true
+		}
+	}
+	if activePort.Name == portName {
+		activePort.Available = available
+	}
+	return found
+}
+
+func (b *fakeBackend) getCardProfile(name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.findCardByName(name)
+	if c == nil {
+		return ""
+	}
+	return c.card.ActiveProfile.Name
+}
+
+func (b *fakeBackend) getSinkByName(name string) *pulse.Sink {
+	for _, s := range b.GetSinkList() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func copyCard(card *pulse.Card) *pulse.Card {
+	cardCopy := *card
+	cardCopy.Profiles = append(pulse.ProfileInfos2(nil), card.Profiles...)
+	cardCopy.Ports = append(pulse.CardPortInfos(nil), card.Ports...)
+	return &cardCopy
+}
+
+func copySink(sink *pulse.Sink) *pulse.Sink {
+	sinkCopy := *sink
+	sinkCopy.Ports = append([]pulse.PortInfo(nil), sink.Ports...)
+	return &sinkCopy
+}
+
+func copySource(source *pulse.Source) *pulse.Source {
+	sourceCopy := *source
+	sourceCopy.Ports = append([]pulse.PortInfo(nil), source.Ports...)
+	return &sourceCopy
+}
+
+func (b *fakeBackend) GetServer() (*pulse.Server, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &pulse.Server{
+		DefaultSinkName:   b.defaultSink,
+		DefaultSourceName: b.defaultSource,
+	}, nil
+}
+
+func (b *fakeBackend) GetDefaultSink() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.defaultSink
+}
+
+func (b *fakeBackend) GetDefaultSource() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.defaultSource
+}
+
+func (b *fakeBackend) SetDefaultSink(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sinks {
+		if s.Name == name {
+			b.defaultSink = name
+			b.emit(pulse.FacilityServer, pulse.EventTypeChange, 0)
+			return
+		}
+	}
+}
+
+func (b *fakeBackend) SetDefaultSource(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sources {
+		if s.Name == name {
+			b.defaultSource = name
+			b.emit(pulse.FacilityServer, pulse.EventTypeChange, 0)
+			return
+		}
+	}
+}
+
+func (b *fakeBackend) GetCardList() []*pulse.Card {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*pulse.Card, len(b.cards))
+	for i, c := range b.cards {
+		result[i] = copyCard(&c.card)
+	}
+	return result
+}
+
+func (b *fakeBackend) GetCard(index uint32) (*pulse.Card, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.findCard(index)
+	if c == nil {
+		return nil, fmt.Errorf("card #%d not found", index)
+	}
+	return copyCard(&c.card), nil
+}
+
+// SetCardProfile 切换 profile，和 pulseaudio 一样删除旧的设备并创建新 profile 下的设备
+func (b *fakeBackend) SetCardProfile(index uint32, profile string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.findCard(index)
+	if c == nil || c.card.ActiveProfile.Name == profile {
+		return
+	}
+	for _, p := range c.card.Profiles {
+		if p.Name == profile {
+			b.removeCardDevices(index)
+			c.card.ActiveProfile = p
+			b.emit(pulse.FacilityCard, pulse.EventTypeChange, index)
+			b.addCardDevices(c)
+			return
+		}
+	}
+}
+
+func (b *fakeBackend) GetSinkList() []*pulse.Sink {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*pulse.Sink, len(b.sinks))
+	for i, s := range b.sinks {
+		result[i] = copySink(s)
+	}
+	return result
+}
+
+func (b *fakeBackend) GetSink(index uint32) (*pulse.Sink, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.findSink(index)
+	if s == nil {
+		return nil, fmt.Errorf("sink #%d not found", index)
+	}
+	return copySink(s), nil
+}
+
+func (b *fakeBackend) SetSinkPortByIndex(index uint32, port string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.findSink(index)
+	if s == nil {
+		return
+	}
+	for _, p := range s.Ports {
+		if p.Name == port {
+			s.ActivePort = p
+			b.emit(pulse.FacilitySink, pulse.EventTypeChange, index)
+			return
+		}
+	}
+}
+
+func (b *fakeBackend) SetSinkVolumeByIndex(index uint32, v pulse.CVolume) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.findSink(index); s != nil {
+		s.Volume = v
+		b.emit(pulse.FacilitySink, pulse.EventTypeChange, index)
+	}
+}
+
+func (b *fakeBackend) SetSinkMuteByIndex(index uint32, mute bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.findSink(index); s != nil {
+		s.Mute = mute
+		b.emit(pulse.FacilitySink, pulse.EventTypeChange, index)
+	}
+}
+
+func (b *fakeBackend) GetSourceList() []*pulse.Source {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*pulse.Source, len(b.sources))
+	for i, s := range b.sources {
+		result[i] = copySource(s)
+	}
+	return result
+}
+
+func (b *fakeBackend) SetSourcePortByIndex(index uint32, port string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.findSource(index)
+	if s == nil {
+		return
+	}
+	for _, p := range s.Ports {
+		if p.Name == port {
+			s.ActivePort = p
+			b.emit(pulse.FacilitySource, pulse.EventTypeChange, index)
+			return
+		}
+	}
+}
+
+func (b *fakeBackend) SetSourceVolumeByIndex(index uint32, v pulse.CVolume) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.findSource(index); s != nil {
+		s.Volume = v
+		b.emit(pulse.FacilitySource, pulse.EventTypeChange, index)
+	}
+}
+
+func (b *fakeBackend) SetSourceMuteByIndex(index uint32, mute bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.findSource(index); s != nil {
+		s.Mute = mute
+		b.emit(pulse.FacilitySource, pulse.EventTypeChange, index)
+	}
+}
+
+func (b *fakeBackend) GetSinkInputList() []*pulse.SinkInput {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*pulse.SinkInput, len(b.sinkInputs))
+	for i, s := range b.sinkInputs {
+		sinkInput := *s
+		result[i] = &sinkInput
+	}
+	return result
+}
+
+func (b *fakeBackend) SetSinkInputVolume(index uint32, v pulse.CVolume) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sinkInputs {
+		if s.Index == index {
+			s.Volume = v
+			b.emit(pulse.FacilitySinkInput, pulse.EventTypeChange, index)
+		}
+	}
+}
+
+func (b *fakeBackend) SetSinkInputMute(index uint32, mute bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sinkInputs {
+		if s.Index == index {
+			s.Mute = mute
+			b.emit(pulse.FacilitySinkInput, pulse.EventTypeChange, index)
+		}
+	}
+}
+
+func (b *fakeBackend) MoveSinkInputsByIndex(sinkInputs []uint32, sink uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sinkInputs {
+		for _, index := range sinkInputs {
+			if s.Index == index {
+				s.Sink = sink
+				b.emit(pulse.FacilitySinkInput, pulse.EventTypeChange, index)
+			}
+		}
+	}
+}
+
+func (b *fakeBackend) GetSourceOutputList() []*pulse.SourceOutput {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*pulse.SourceOutput, len(b.sourceOutputs))
+	for i, s := range b.sourceOutputs {
+		sourceOutput := *s
+		result[i] = &sourceOutput
+	}
+	return result
+}
+
+func (b *fakeBackend) SetSourceOutputVolume(index uint32, v pulse.CVolume) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sourceOutputs {
+		if s.Index == index {
+			s.Volume = v
+			b.emit(pulse.FacilitySourceOutput, pulse.EventTypeChange, index)
+		}
+	}
+}
+
+func (b *fakeBackend) SetSourceOutputMute(index uint32, mute bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sourceOutputs {
+		if s.Index == index {
+			s.Mute = mute
+			b.emit(pulse.FacilitySourceOutput, pulse.EventTypeChange, index)
+		}
+	}
+}
+
+func (b *fakeBackend) MoveSourceOutputsByIndex(sourceOutputs []uint32, source uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sourceOutputs {
+		for _, index := range sourceOutputs {
+			if s.Index == index {
+				s.Source = source
+				b.emit(pulse.FacilitySourceOutput, pulse.EventTypeChange, index)
+			}
+		}
+	}
+}
+
+// NewSourceMeter 不支持音量计
+func (b *fakeBackend) NewSourceMeter(source uint32) *pulse.SourceMeter {
+	return nil
+}
+
+func (b *fakeBackend) AddEventChan(ch chan *pulse.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.eventChans = append(b.eventChans, ch)
+}
+
+func (b *fakeBackend) RemoveEventChan(ch chan *pulse.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, c := range b.eventChans {
+		if c == ch {
+			b.eventChans = append(b.eventChans[:i], b.eventChans[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *fakeBackend) AddStateChan(ch chan int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stateChans = append(b.stateChans, ch)
+}
+
+func (b *fakeBackend) RemoveStateChan(ch chan int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, c := range b.stateChans {
+		if c == ch {
+			b.stateChans = append(b.stateChans[:i], b.stateChans[i+1:]...)
+			return
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package audio
 
 import (
+	"errors"
 	"time"
 
 	"github.com/linuxdeepin/dde-daemon/loader"
@@ -49,6 +50,9 @@ func (m *Module) start() error {
 	err = m.audio.init()
 	if err != nil {
 		logger.Warning("failed to init audio module:", err)
+		// 由健康检查发现并重启模块
+		m.audio.destroy()
+		m.audio = nil
 		return nil
 	}
 
@@ -63,6 +67,18 @@ func (m *Module) start() error {
 
 	so := service.GetServerObject(m.audio)
 	err = so.SetWriteCallback(m.audio, "ReduceNoise", m.audio.writeReduceNoise)
+	for propName, cb := range map[string]dbusutil.PropertyWriteCallback{
+		"ReduceNoisePreset":  m.audio.writeReduceNoisePreset,
+		"DuckingEnabled":     m.audio.writeDuckingEnabled,
+		"DuckingAttenuation": m.audio.writeDuckingAttenuation,
+		"DuckingRoles":       m.audio.writeDuckingRoles,
+		"DuckingApps":        m.audio.writeDuckingApps,
+	} {
+		err = so.SetWriteCallback(m.audio, propName, cb)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
 
 	err = m.audio.syncConfig.Register()
 	if err != nil {
@@ -105,6 +121,20 @@ func (m *Module) Stop() error {
 	return nil
 }
 
+// CanRestart 实现 loader.Restartable
+func (m *Module) CanRestart() bool {
+	return true
+}
+
+// CheckHealth 实现 loader.HealthChecker
+func (m *Module) CheckHealth() error {
+	if m.audio == nil {
+		// pulseaudio 启动失败时 Start 也返回 nil，此时需要重启模块
+		return errors.New("audio is not initialized")
+	}
+	return loader.CheckNameOwned(dbusServiceName)
+}
+
 func waitSoundThemePlayerExit() {
 	srv, err := dbusutil.NewSystemService()
 	if err != nil {
@@ -210,3 +210,23 @@ func (pm *PriorityManager) SetFirstInputPort(cardName string, portName string) {
 	pm.Print()
 	pm.Save()
 }
+
+// 获取用户的端口优先级列表
+func (pm *PriorityManager) GetUserPorts(direction int) PriorityPortList {
+	if direction == pulse.DirectionSink {
+		return pm.Output.UserPorts
+	}
+	return pm.Input.UserPorts
+}
+
+// 设置用户的端口优先级列表，为空时恢复按类型自动切换
+// 注意：cardName和portName应当使用 pulse.Card.Name 和 pulse.CardPortInfo.Name
+func (pm *PriorityManager) SetUserPorts(direction int, ports PriorityPortList) {
+	if direction == pulse.DirectionSink {
+		pm.Output.SetUserPorts(ports)
+	} else {
+		pm.Input.SetUserPorts(ports)
+	}
+	pm.Print()
+	pm.Save()
+}
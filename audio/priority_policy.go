@@ -122,6 +122,10 @@ func (typeList *PriorityTypeList) hasElement(value int) bool {
 type PriorityPolicy struct {
 	Ports PriorityPortList
 	Types PriorityTypeList
+
+	// 用户设置的端口优先级列表，为空时按类型优先级自动切换
+	// 不为空时只会自动切换到列表中的端口，按列表的顺序选择
+	UserPorts PriorityPortList `json:",omitempty"`
 }
 
 // 新建一个PriorityPolicy
@@ -387,6 +391,16 @@ func (pp *PriorityPolicy) SetTheFirstPort(cardName string, portName string) bool
 		}
 	}
 
+	// 端口在用户的优先级列表中时，也设为列表中优先级最高的
+	for i, p := range pp.UserPorts {
+		if p.CardName == cardName && p.PortName == portName {
+			userPorts := PriorityPortList{p}
+			userPorts = append(userPorts, pp.UserPorts[:i]...)
+			pp.UserPorts = append(userPorts, pp.UserPorts[i+1:]...)
+			break
+		}
+	}
+
 	return true
 }
 
@@ -401,3 +415,50 @@ func (pp *PriorityPolicy) RemoveCard(cardName string) {
 		}
 	}
 }
+
+// 设置用户的端口优先级列表，并按列表的顺序调整端口实例的优先级，不在列表中的端口排在后面
+func (pp *PriorityPolicy) SetUserPorts(ports PriorityPortList) {
+	pp.UserPorts = ports
+
+	sorted := make(PriorityPortList, 0, len(pp.Ports))
+	for _, userPort := range ports {
+		index := pp.FindPortIndex(userPort.CardName, userPort.PortName)
+		if index >= 0 {
+			sorted = append(sorted, pp.Ports[index])
+		}
+	}
+	for _, port := range pp.Ports {
+		if !sorted.hasElement(port) {
+			sorted = append(sorted, port)
+		}
+	}
+	pp.Ports = sorted
+}
+
+// 判断是否可以自动切换到指定端口，没有设置用户的端口优先级列表时所有端口都可以
+func (pp *PriorityPolicy) IsAutoSwitchPort(cardName string, portName string) bool {
+	if len(pp.UserPorts) == 0 {
+		return true
+	}
+	return pp.UserPorts.hasElement(&PriorityPort{CardName: cardName, PortName: portName})
+}
+
+// 获取自动切换的目标端口，设置了用户的端口优先级列表时，返回列表中第一个有效的端口
+func (pp *PriorityPolicy) GetTheAutoSwitchPort() PriorityPort {
+	if len(pp.UserPorts) == 0 {
+		return pp.GetTheFirstPort()
+	}
+
+	for _, userPort := range pp.UserPorts {
+		index := pp.FindPortIndex(userPort.CardName, userPort.PortName)
+		if index >= 0 {
+			return *(pp.Ports[index])
+		}
+	}
+
+	return PriorityPort{
+		"",
+		"",
+		PortTypeInvalid,
+	}
+}
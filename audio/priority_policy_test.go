@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPriorityPolicy() *PriorityPolicy {
+	pp := NewPriorityPolicy()
+	pp.completeTypes()
+	pp.SetPorts(PriorityPortList{
+		{CardName: "pci", PortName: "analog-output-speaker", PortType: PortTypeBuiltin},
+		{CardName: "pci", PortName: "hdmi-output-0", PortType: PortTypeHdmi},
+		{CardName: "usb", PortName: "analog-output", PortType: PortTypeUsb},
+	})
+	return pp
+}
+
+func getPriorityPortNames(ports PriorityPortList) []string {
+	names := make([]string, len(ports))
+	for i, port := range ports {
+		names[i] = port.CardName + ":" + port.PortName
+	}
+	return names
+}
+
+func TestPriorityPolicy_UserPorts(t *testing.T) {
+	pp := newTestPriorityPolicy()
+	assert.Equal(t, []string{"usb:analog-output", "pci:analog-output-speaker", "pci:hdmi-output-0"},
+		getPriorityPortNames(pp.Ports))
+	assert.True(t, pp.IsAutoSwitchPort("pci", "hdmi-output-0"))
+	assert.Equal(t, pp.GetTheFirstPort(), pp.GetTheAutoSwitchPort())
+
+	// 不在列表中的端口排在后面，不会自动切换
+	pp.SetUserPorts(PriorityPortList{
+		{CardName: "bluez", PortName: "headset-output", PortType: PortTypeUnknown},
+		{CardName: "pci", PortName: "analog-output-speaker", PortType: PortTypeBuiltin},
+		{CardName: "usb", PortName: "analog-output", PortType: PortTypeUsb},
+	})
+	assert.Equal(t, []string{"pci:analog-output-speaker", "usb:analog-output", "pci:hdmi-output-0"},
+		getPriorityPortNames(pp.Ports))
+	assert.False(t, pp.IsAutoSwitchPort("pci", "hdmi-output-0"))
+	assert.Equal(t, "analog-output-speaker", pp.GetTheAutoSwitchPort().PortName)
+
+	// 手动选择列表中的端口时，列表中的优先级也改变
+	pp.SetTheFirstPort("usb", "analog-output")
+	assert.Equal(t, "analog-output", pp.GetTheAutoSwitchPort().PortName)
+	assert.Equal(t, []string{"usb:analog-output", "bluez:headset-output", "pci:analog-output-speaker"},
+		getPriorityPortNames(pp.UserPorts))
+
+	// 手动选择不在列表中的端口时，列表不变
+	pp.SetTheFirstPort("pci", "hdmi-output-0")
+	assert.Equal(t, "hdmi-output-0", pp.GetTheFirstPort().PortName)
+	assert.Equal(t, "analog-output", pp.GetTheAutoSwitchPort().PortName)
+
+	// 列表中的端口出现时，按列表的顺序选择
+	pp.SetPorts(PriorityPortList{
+		{CardName: "pci", PortName: "analog-output-speaker", PortType: PortTypeBuiltin},
+		{CardName: "pci", PortName: "hdmi-output-0", PortType: PortTypeHdmi},
+		{CardName: "bluez", PortName: "headset-output", PortType: PortTypeBluetooth},
+	})
+	assert.Equal(t, "headset-output", pp.GetTheAutoSwitchPort().PortName)
+
+	// 列表中没有有效的端口
+	pp.SetUserPorts(PriorityPortList{{CardName: "usb", PortName: "analog-output"}})
+	assert.Equal(t, PortTypeInvalid, pp.GetTheAutoSwitchPort().PortType)
+
+	// 清空列表后按类型的优先级切换
+	pp.SetUserPorts(nil)
+	assert.True(t, pp.IsAutoSwitchPort("pci", "hdmi-output-0"))
+	assert.Equal(t, pp.GetTheFirstPort(), pp.GetTheAutoSwitchPort())
+}
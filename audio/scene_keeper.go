@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// ScenePort 是场景中的输出或输入端口，声卡使用 pulseaudio 中的声卡名称
+type ScenePort struct {
+	CardName string
+	PortName string
+	Volume   float64
+}
+
+// AudioScene 是一组音频设置，应用时一起切换声卡 profile、端口、音量和降噪
+type AudioScene struct {
+	Name          string
+	Output        *ScenePort        `json:",omitempty"`
+	Input         *ScenePort        `json:",omitempty"`
+	CardProfiles  map[string]string `json:",omitempty"` // 声卡名称 => profile
+	ReduceNoise   bool
+	AutoApplyCard string `json:",omitempty"` // 这个声卡出现时自动应用场景
+}
+
+func (s *AudioScene) clone() *AudioScene {
+	sceneCopy := *s
+	if s.Output != nil {
+		output := *s.Output
+		sceneCopy.Output = &output
+	}
+	if s.Input != nil {
+		input := *s.Input
+		sceneCopy.Input = &input
+	}
+	if s.CardProfiles != nil {
+		sceneCopy.CardProfiles = make(map[string]string, len(s.CardProfiles))
+		for cardName, profile := range s.CardProfiles {
+			sceneCopy.CardProfiles[cardName] = profile
+		}
+	}
+	return &sceneCopy
+}
+
+// SceneKeeper 保存用户的音频场景
+type SceneKeeper struct {
+	mu     sync.Mutex
+	Scenes map[string]*AudioScene // 场景名称 => AudioScene
+	file   string                 // 配置文件路径
+}
+
+// 创建单例
+func createSceneKeeperSingleton(path string) func() *SceneKeeper {
+	var sk *SceneKeeper = nil
+	return func() *SceneKeeper {
+		if sk == nil {
+			sk = NewSceneKeeper(path)
+		}
+		return sk
+	}
+}
+
+// 获取单例
+var globalSceneKeeperFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/audio-scenes.json")
+var GetSceneKeeper = createSceneKeeperSingleton(globalSceneKeeperFile)
+
+func NewSceneKeeper(path string) *SceneKeeper {
+	return &SceneKeeper{
+		Scenes: make(map[string]*AudioScene),
+		file:   path,
+	}
+}
+
+// 调用者需要持有 sk.mu
+func (sk *SceneKeeper) save() error {
+	data, err := json.MarshalIndent(sk.Scenes, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(sk.file), 0755)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = ioutil.WriteFile(sk.file, data, 0644)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	return nil
+}
+
+func (sk *SceneKeeper) Save() error {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	return sk.save()
+}
+
+func (sk *SceneKeeper) Load() error {
+	data, err := ioutil.ReadFile(sk.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return err
+	}
+
+	scenes := make(map[string]*AudioScene)
+	err = json.Unmarshal(data, &scenes)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	for name, scene := range scenes {
+		if scene == nil {
+			delete(scenes, name)
+			continue
+		}
+		scene.Name = name
+	}
+
+	sk.mu.Lock()
+	sk.Scenes = scenes
+	sk.mu.Unlock()
+	return nil
+}
+
+// GetScene 返回场景的副本，场景不存在时返回 nil
+func (sk *SceneKeeper) GetScene(name string) *AudioScene {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	scene, ok := sk.Scenes[name]
+	if !ok {
+		return nil
+	}
+	return scene.clone()
+}
+
+// GetScenes 返回所有场景的副本，按名称排序
+func (sk *SceneKeeper) GetScenes() []*AudioScene {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	result := make([]*AudioScene, 0, len(sk.Scenes))
+	for _, scene := range sk.Scenes {
+		result = append(result, scene.clone())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// SetScene 添加或者覆盖场景，覆盖时保留原来的自动应用设置
+func (sk *SceneKeeper) SetScene(scene *AudioScene) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	scene = scene.clone()
+	if old, ok := sk.Scenes[scene.Name]; ok && scene.AutoApplyCard == "" {
+		scene.AutoApplyCard = old.AutoApplyCard
+	}
+	sk.Scenes[scene.Name] = scene
+	sk.save()
+}
+
+// DeleteScene 删除场景，返回场景是否存在
+func (sk *SceneKeeper) DeleteScene(name string) bool {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	if _, ok := sk.Scenes[name]; !ok {
+		return false
+	}
+	delete(sk.Scenes, name)
+	sk.save()
+	return true
+}
+
+// SetAutoApplyCard 设置场景在哪个声卡出现时自动应用，cardName 为空时取消自动应用。
+// 一个声卡只对应一个场景，其他场景上相同的设置会被清除
+func (sk *SceneKeeper) SetAutoApplyCard(name string, cardName string) error {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	scene, ok := sk.Scenes[name]
+	if !ok {
+		return fmt.Errorf("scene %q not found", name)
+	}
+	if cardName != "" {
+		for _, other := range sk.Scenes {
+			if other.AutoApplyCard == cardName {
+				other.AutoApplyCard = ""
+			}
+		}
+	}
+	scene.AutoApplyCard = cardName
+	sk.save()
+	return nil
+}
+
+// GetAutoApplyScene 返回声卡出现时需要自动应用的场景的副本，没有时返回 nil
+func (sk *SceneKeeper) GetAutoApplyScene(cardName string) *AudioScene {
+	if cardName == "" {
+		return nil
+	}
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	for _, scene := range sk.Scenes {
+		if scene.AutoApplyCard == cardName {
+			return scene.clone()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSceneKeeper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-scenes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sub/audio-scenes.json")
+
+	sk := NewSceneKeeper(file)
+	assert.Error(t, sk.Load())
+	assert.Nil(t, sk.GetScene("desk"))
+
+	desk := &AudioScene{
+		Name:         "desk",
+		Output:       &ScenePort{CardName: "alsa_card.usb-dac", PortName: "analog-output", Volume: 0.5},
+		Input:        &ScenePort{CardName: "alsa_card.usb-webcam", PortName: "analog-input-mic", Volume: 0.8},
+		CardProfiles: map[string]string{"alsa_card.usb-dac": "output:analog-stereo"},
+		ReduceNoise:  true,
+	}
+	sk.SetScene(desk)
+	sk.SetScene(&AudioScene{
+		Name:         "meeting",
+		Output:       &ScenePort{CardName: "bluez_card.00_11", PortName: "headset-output", Volume: 0.6},
+		CardProfiles: map[string]string{"bluez_card.00_11": "headset_head_unit"},
+	})
+	require.NoError(t, sk.SetAutoApplyCard("meeting", "bluez_card.00_11"))
+	assert.Error(t, sk.SetAutoApplyCard("cinema", "bluez_card.00_11"))
+
+	sk2 := NewSceneKeeper(file)
+	require.NoError(t, sk2.Load())
+	scenes := sk2.GetScenes()
+	require.Len(t, scenes, 2)
+	assert.Equal(t, desk, scenes[0])
+	assert.Equal(t, "meeting", scenes[1].Name)
+	assert.Equal(t, "meeting", sk2.GetAutoApplyScene("bluez_card.00_11").Name)
+	assert.Nil(t, sk2.GetAutoApplyScene(""))
+
+	// 返回的是副本
+	scene := sk2.GetScene("desk")
+	scene.Output.Volume = 1
+	scene.CardProfiles["alsa_card.usb-dac"] = "off"
+	assert.Equal(t, desk, sk2.GetScene("desk"))
+
+	// 覆盖场景时保留自动应用的设置
+	sk2.SetScene(&AudioScene{Name: "meeting"})
+	assert.Equal(t, "bluez_card.00_11", sk2.GetScene("meeting").AutoApplyCard)
+
+	// 一个声卡只自动应用一个场景
+	require.NoError(t, sk2.SetAutoApplyCard("desk", "bluez_card.00_11"))
+	assert.Equal(t, "", sk2.GetScene("meeting").AutoApplyCard)
+	assert.Equal(t, "desk", sk2.GetAutoApplyScene("bluez_card.00_11").Name)
+
+	assert.True(t, sk2.DeleteScene("desk"))
+	assert.False(t, sk2.DeleteScene("desk"))
+	assert.Nil(t, sk2.GetAutoApplyScene("bluez_card.00_11"))
+}
+
+func TestRunSceneSteps(t *testing.T) {
+	var log []string
+	newStep := func(name string, err error) sceneStep {
+		return sceneStep{
+			name: name,
+			apply: func() error {
+				log = append(log, "apply "+name)
+				return err
+			},
+			rollback: func() {
+				log = append(log, "rollback "+name)
+			},
+		}
+	}
+
+	require.NoError(t, runSceneSteps([]sceneStep{newStep("profile", nil), newStep("port", nil)}))
+	assert.Equal(t, []string{"apply profile", "apply port"}, log)
+
+	// 失败时按相反的顺序回滚已经完成的步骤
+	log = nil
+	resume := sceneStep{
+		name: "resume",
+		apply: func() error {
+			log = append(log, "apply resume")
+			return nil
+		},
+	}
+	err := runSceneSteps([]sceneStep{
+		newStep("profile", nil),
+		resume,
+		newStep("output", nil),
+		newStep("input", errors.New("not found")),
+		newStep("volume", nil),
+	})
+	assert.EqualError(t, err, "input: not found")
+	assert.Equal(t, []string{
+		"apply profile",
+		"apply resume",
+		"apply output",
+		"apply input",
+		"rollback output",
+		"rollback profile",
+	}, log)
+}
@@ -33,6 +33,10 @@ type Sink struct {
 	Volume     float64
 	cVolume    pulse.CVolume
 	channelMap pulse.ChannelMap
+	// 声道数
+	channels int
+	// monitor 的名称
+	monitorSource string
 	// 左右声道平衡值
 	Balance float64
 	// 是否支持左右声道调整
@@ -69,13 +73,10 @@ func newSink(sinkInfo *pulse.Sink, audio *Audio) *Sink {
 
 // 检测端口是否被禁用
 func (s *Sink) CheckPort() *dbus.Error {
-	enabled, err := s.audio.IsPortEnabled(s.Card, s.ActivePort.Name)
-	if err != nil {
-		return err
-	}
-
-	if !enabled {
-		return dbusutil.ToError(fmt.Errorf("port<%d:%s> is disabled", s.Card, s.ActivePort.Name))
+	cardName, portName := s.audio.getSinkConfigKey(s)
+	_, portConfig := GetConfigKeeper().GetCardAndPortConfig(cardName, portName)
+	if !portConfig.Enabled {
+		return dbusutil.ToError(fmt.Errorf("port<%s:%s> is disabled", cardName, portName))
 	}
 
 	return nil
@@ -105,7 +106,8 @@ func (s *Sink) SetVolume(value float64, isPlay bool) *dbus.Error {
 	s.PropsMu.Unlock()
 	s.audio.context().SetSinkVolumeByIndex(s.index, cv)
 
-	GetConfigKeeper().SetVolume(s.audio.getCardNameById(s.Card), s.ActivePort.Name, value)
+	cardName, portName := s.audio.getSinkConfigKey(s)
+	GetConfigKeeper().SetVolume(cardName, portName, value)
 
 	if isPlay {
 		s.playFeedback()
@@ -133,7 +135,8 @@ func (s *Sink) SetBalance(value float64, isPlay bool) *dbus.Error {
 	s.PropsMu.RUnlock()
 	s.audio.context().SetSinkVolumeByIndex(s.index, cv)
 
-	GetConfigKeeper().SetBalance(s.audio.getCardNameById(s.Card), s.ActivePort.Name, value)
+	cardName, portName := s.audio.getSinkConfigKey(s)
+	GetConfigKeeper().SetBalance(cardName, portName, value)
 
 	if isPlay {
 		s.playFeedback()
@@ -217,7 +220,11 @@ func (s *Sink) SetPort(name string) *dbus.Error {
 }
 
 func (s *Sink) getPath() dbus.ObjectPath {
-	return dbus.ObjectPath(dbusPath + "/Sink" + strconv.Itoa(int(s.index)))
+	return getSinkPath(s.index)
+}
+
+func getSinkPath(index uint32) dbus.ObjectPath {
+	return dbus.ObjectPath(dbusPath + "/Sink" + strconv.Itoa(int(index)))
 }
 
 func (*Sink) GetInterfaceName() string {
@@ -233,6 +240,8 @@ func (s *Sink) update(sinkInfo *pulse.Sink) {
 	s.BaseVolume = sinkInfo.BaseVolume.ToPercent()
 	s.cVolume = sinkInfo.Volume
 	s.channelMap = sinkInfo.ChannelMap
+	s.channels = sinkInfo.ChannelMap.Channels()
+	s.monitorSource = sinkInfo.MonitorSourceName
 
 	s.setPropMute(sinkInfo.Mute)
 	s.setPropVolume(floatPrecision(sinkInfo.Volume.Avg()))
@@ -262,6 +271,17 @@ func (s *Sink) GetMeter() (meter dbus.ObjectPath, busErr *dbus.Error) {
 	return "/", nil
 }
 
+// SubscribeLevels 订阅输出设备每个声道的电平，使用输出设备的 monitor 录制，
+// rate 是每秒发送 LevelsChanged 信号的次数，为 0 时使用默认值
+func (s *Sink) SubscribeLevels(sender dbus.Sender, rate uint32) (meter dbus.ObjectPath, busErr *dbus.Error) {
+	s.PropsMu.RLock()
+	monitor := s.monitorSource
+	channels := s.channels
+	s.PropsMu.RUnlock()
+	meter, err := s.audio.subscribeChannelMeter(string(sender), fmt.Sprintf("sink%d", s.index), monitor, channels, rate)
+	return meter, dbusutil.ToError(err)
+}
+
 func (s *Sink) playFeedback() {
 	s.PropsMu.RLock()
 	name := s.Name
@@ -21,6 +21,7 @@ const (
 	PropAppName          = "application.name"
 	PropAppProcessID     = "application.process.id"
 	PropAppProcessBinary = "application.process.binary"
+	PropAppId            = "application.id"
 )
 
 type SinkInput struct {
@@ -31,6 +32,7 @@ type SinkInput struct {
 	correctIconCalled bool
 	correctedIcon     string
 	visible           bool
+	role              string // media.role
 	cVolume           pulse.CVolume
 	channelMap        pulse.ChannelMap
 	// Name process name
@@ -43,6 +45,10 @@ type SinkInput struct {
 	Fade           float64
 	SupportFade    bool
 	SinkIndex      uint32
+	// 所在的输出设备
+	Sink dbus.ObjectPath
+	// 应用标识，用于保存应用的音量配置，不可见的sink-input为空
+	AppId string
 }
 
 func newSinkInput(sinkInputInfo *pulse.SinkInput, audio *Audio) *SinkInput {
@@ -54,11 +60,24 @@ func newSinkInput(sinkInputInfo *pulse.SinkInput, audio *Audio) *SinkInput {
 		service: audio.service,
 		index:   sinkInputInfo.Index,
 		visible: getSinkInputVisible(sinkInputInfo),
+		role:    sinkInputInfo.PropList[pulse.PA_PROP_MEDIA_ROLE],
 	}
 	sinkInput.update(sinkInputInfo)
 	return sinkInput
 }
 
+// 获取sink-input所属应用的标识，与correctIcon使用相同的判断：
+// 能识别的应用使用修正后的图标名，其他的依次使用application.process.binary和application.name
+func getSinkInputAppId(sinkInputInfo *pulse.SinkInput, correctedIcon string) string {
+	if correctedIcon != "" {
+		return correctedIcon
+	}
+	if processBin := sinkInputInfo.PropList[PropAppProcessBinary]; processBin != "" {
+		return processBin
+	}
+	return sinkInputInfo.PropList[PropAppName]
+}
+
 func (s *SinkInput) getPropSinkIndex() uint32 {
 	s.PropsMu.RLock()
 	v := s.SinkIndex
@@ -66,6 +85,13 @@ func (s *SinkInput) getPropSinkIndex() uint32 {
 	return v
 }
 
+func (s *SinkInput) getPropAppId() string {
+	s.PropsMu.RLock()
+	v := s.AppId
+	s.PropsMu.RUnlock()
+	return v
+}
+
 func getSinkInputVisible(sinkInputInfo *pulse.SinkInput) bool {
 	appName := sinkInputInfo.PropList[pulse.PA_PROP_APPLICATION_NAME]
 	switch appName {
@@ -98,6 +124,10 @@ func (s *SinkInput) SetVolume(value float64, isPlay bool) *dbus.Error {
 	cv := s.cVolume.SetAvg(value)
 	s.PropsMu.RUnlock()
 	s.audio.context().SetSinkInputVolume(s.index, cv)
+	s.audio.ducking.userSetVolume(s.index, value)
+	if appId := s.getPropAppId(); appId != "" {
+		GetAppConfigKeeper().SetVolume(appId, value)
+	}
 
 	if isPlay {
 		playFeedback()
@@ -137,12 +167,38 @@ func (s *SinkInput) SetFade(value float64) *dbus.Error {
 
 func (s *SinkInput) SetMute(value bool) *dbus.Error {
 	s.audio.context().SetSinkInputMute(s.index, value)
+	if appId := s.getPropAppId(); appId != "" {
+		GetAppConfigKeeper().SetMute(appId, value)
+	}
 	if !value {
 		playFeedback()
 	}
 	return nil
 }
 
+// MoveToSink 把sink-input移动到sinkPath对应的输出设备，并记录为应用偏好的输出设备。
+// 移动到默认输出设备时清除偏好，之后跟随默认输出设备切换
+func (s *SinkInput) MoveToSink(sinkPath dbus.ObjectPath) *dbus.Error {
+	sink := s.audio.getSinkByPath(sinkPath)
+	if sink == nil {
+		return dbusutil.ToError(fmt.Errorf("invalid sink path: %q", sinkPath))
+	}
+
+	logger.Debugf("move sink-input #%d to sink #%d", s.index, sink.index)
+	s.audio.context().MoveSinkInputsByIndex([]uint32{s.index}, sink.index)
+
+	if appId := s.getPropAppId(); appId != "" {
+		var sinkName string
+		if sink != s.audio.getDefaultSink() {
+			sink.PropsMu.RLock()
+			sinkName = sink.Name
+			sink.PropsMu.RUnlock()
+		}
+		GetAppConfigKeeper().SetSinkName(appId, sinkName)
+	}
+	return nil
+}
+
 func (s *SinkInput) getPath() dbus.ObjectPath {
 	return dbus.ObjectPath(dbusPath + "/SinkInput" + strconv.Itoa(int(s.index)))
 }
@@ -275,12 +331,14 @@ func (s *SinkInput) update(sinkInputInfo *pulse.SinkInput) {
 
 	if !s.visible {
 		s.SinkIndex = sinkInputInfo.Sink
+		s.Sink = getSinkPath(sinkInputInfo.Sink)
 		return
 	}
 
 	s.cVolume = sinkInputInfo.Volume
 	s.channelMap = sinkInputInfo.ChannelMap
 	s.setPropSinkIndex(sinkInputInfo.Sink)
+	s.setPropSink(getSinkPath(sinkInputInfo.Sink))
 	name := sinkInputInfo.PropList[PropAppName]
 	s.setPropName(name)
 	icon := sinkInputInfo.PropList[PropAppIconName]
@@ -296,6 +354,7 @@ func (s *SinkInput) update(sinkInputInfo *pulse.SinkInput) {
 		icon = "media-player"
 	}
 	s.setPropIcon(icon)
+	s.setPropAppId(getSinkInputAppId(sinkInputInfo, correctedIcon))
 
 	s.setPropVolume(sinkInputInfo.Volume.Avg())
 	s.setPropMute(sinkInputInfo.Mute)
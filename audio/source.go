@@ -21,6 +21,7 @@ type Source struct {
 	index       uint32
 	cVolume     pulse.CVolume
 	channelMap  pulse.ChannelMap
+	channels    int // 声道数
 	Name        string
 	Description string
 	// 默认的输入音量
@@ -202,7 +203,7 @@ func (s *Source) GetMeter() (meter dbus.ObjectPath, busErr *dbus.Error) {
 		return m.getPath(), nil
 	}
 
-	sourceMeter := pulse.NewSourceMeter(s.audio.ctx, s.index)
+	sourceMeter := s.audio.ctx.NewSourceMeter(s.index)
 	m = newMeter(id, sourceMeter, s.audio)
 	meterPath := m.getPath()
 	err := s.service.Export(meterPath, m)
@@ -222,8 +223,22 @@ func (s *Source) GetMeter() (meter dbus.ObjectPath, busErr *dbus.Error) {
 	return meterPath, nil
 }
 
+// SubscribeLevels 订阅输入设备每个声道的电平，rate 是每秒发送 LevelsChanged 信号的次数，为 0 时使用默认值
+func (s *Source) SubscribeLevels(sender dbus.Sender, rate uint32) (meter dbus.ObjectPath, busErr *dbus.Error) {
+	s.PropsMu.RLock()
+	name := s.Name
+	channels := s.channels
+	s.PropsMu.RUnlock()
+	meter, err := s.audio.subscribeChannelMeter(string(sender), fmt.Sprintf("source%d", s.index), name, channels, rate)
+	return meter, dbusutil.ToError(err)
+}
+
 func (s *Source) getPath() dbus.ObjectPath {
-	return dbus.ObjectPath(dbusPath + "/Source" + strconv.Itoa(int(s.index)))
+	return getSourcePath(s.index)
+}
+
+func getSourcePath(index uint32) dbus.ObjectPath {
+	return dbus.ObjectPath(dbusPath + "/Source" + strconv.Itoa(int(index)))
 }
 
 func (*Source) GetInterfaceName() string {
@@ -247,6 +262,7 @@ func (s *Source) update(sourceInfo *pulse.Source) {
 	s.PropsMu.Lock()
 	s.cVolume = sourceInfo.Volume
 	s.channelMap = sourceInfo.ChannelMap
+	s.channels = sourceInfo.ChannelMap.Channels()
 	s.Name = sourceInfo.Name
 	s.Description = sourceInfo.Description
 	s.Card = sourceInfo.Card
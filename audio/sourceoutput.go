@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+// SourceOutput 是录音的流
+type SourceOutput struct {
+	audio   *Audio
+	service *dbusutil.Service
+	PropsMu sync.RWMutex
+	index   uint32
+	visible bool
+	cVolume pulse.CVolume
+	// Name process name
+	Name string
+	Icon string
+	// 录音程序的进程号，获取不到时为 0
+	ProcessId   uint32
+	Mute        bool
+	Volume      float64
+	SourceIndex uint32
+	// 所在的输入设备
+	Source dbus.ObjectPath
+}
+
+func newSourceOutput(sourceOutputInfo *pulse.SourceOutput, audio *Audio) *SourceOutput {
+	if sourceOutputInfo == nil {
+		return nil
+	}
+	sourceOutput := &SourceOutput{
+		audio:   audio,
+		service: audio.service,
+		index:   sourceOutputInfo.Index,
+		visible: getSourceOutputVisible(sourceOutputInfo, audio.isMonitorSource),
+	}
+	sourceOutput.update(sourceOutputInfo)
+	return sourceOutput
+}
+
+// isMonitorSource 判断 index 对应的输入设备是否是输出设备的 monitor
+func getSourceOutputVisible(sourceOutputInfo *pulse.SourceOutput, isMonitorSource func(index uint32) bool) bool {
+	// 模块创建的流，比如 module-loopback、module-echo-cancel 的，不是应用在录音
+	if sourceOutputInfo.OwnerModule != math.MaxUint32 {
+		return false
+	}
+	// 录制 monitor 的流，比如虚拟输出设备、电平表的，不是在使用麦克风
+	if isMonitorSource(sourceOutputInfo.Source) {
+		return false
+	}
+	// 本进程创建的流，比如Meter使用的峰值检测流
+	if sourceOutputInfo.PropList[PropAppProcessID] == strconv.Itoa(os.Getpid()) {
+		return false
+	}
+	// 分声道电平表使用的 parec 的流
+	if sourceOutputInfo.PropList[PropAppId] == channelMeterAppId {
+		return false
+	}
+
+	switch sourceOutputInfo.PropList[pulse.PA_PROP_MEDIA_ROLE] {
+	case "event", "a11y", "test", "filter":
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *SourceOutput) getPropName() string {
+	s.PropsMu.RLock()
+	v := s.Name
+	s.PropsMu.RUnlock()
+	return v
+}
+
+func (s *SourceOutput) getPropProcessId() uint32 {
+	s.PropsMu.RLock()
+	v := s.ProcessId
+	s.PropsMu.RUnlock()
+	return v
+}
+
+func (s *SourceOutput) SetVolume(value float64) *dbus.Error {
+	if !isVolumeValid(value) {
+		return dbusutil.ToError(fmt.Errorf("invalid volume value: %v", value))
+	}
+
+	if value == 0 {
+		value = 0.001
+	}
+	s.PropsMu.RLock()
+	cv := s.cVolume.SetAvg(value)
+	s.PropsMu.RUnlock()
+	s.audio.context().SetSourceOutputVolume(s.index, cv)
+	return nil
+}
+
+func (s *SourceOutput) SetMute(value bool) *dbus.Error {
+	s.audio.context().SetSourceOutputMute(s.index, value)
+	return nil
+}
+
+// MoveToSource 把source-output移动到sourcePath对应的输入设备
+func (s *SourceOutput) MoveToSource(sourcePath dbus.ObjectPath) *dbus.Error {
+	source := s.audio.getSourceByPath(sourcePath)
+	if source == nil {
+		return dbusutil.ToError(fmt.Errorf("invalid source path: %q", sourcePath))
+	}
+
+	logger.Debugf("move source-output #%d to source #%d", s.index, source.index)
+	s.audio.context().MoveSourceOutputsByIndex([]uint32{s.index}, source.index)
+	return nil
+}
+
+func (s *SourceOutput) getPath() dbus.ObjectPath {
+	return dbus.ObjectPath(dbusPath + "/SourceOutput" + strconv.Itoa(int(s.index)))
+}
+
+func (*SourceOutput) GetInterfaceName() string {
+	return dbusInterface + ".SourceOutput"
+}
+
+func (s *SourceOutput) update(sourceOutputInfo *pulse.SourceOutput) {
+	s.PropsMu.Lock()
+	defer s.PropsMu.Unlock()
+
+	if !s.visible {
+		s.SourceIndex = sourceOutputInfo.Source
+		s.Source = getSourcePath(sourceOutputInfo.Source)
+		return
+	}
+
+	s.cVolume = sourceOutputInfo.Volume
+	s.setPropName(sourceOutputInfo.PropList[PropAppName])
+	icon := sourceOutputInfo.PropList[PropAppIconName]
+	if icon == "" {
+		icon = "audio-input-microphone"
+	}
+	s.setPropIcon(icon)
+	pid, err := strconv.ParseUint(sourceOutputInfo.PropList[PropAppProcessID], 10, 32)
+	if err != nil {
+		pid = 0
+	}
+	s.setPropProcessId(uint32(pid))
+	s.setPropVolume(sourceOutputInfo.Volume.Avg())
+	s.setPropMute(sourceOutputInfo.Mute)
+	s.setPropSourceIndex(sourceOutputInfo.Source)
+	s.setPropSource(getSourcePath(sourceOutputInfo.Source))
+}
+
+// 判断 index 对应的输入设备是否是输出设备的 monitor
+func (a *Audio) isMonitorSource(index uint32) bool {
+	source, ok := a.sources[index]
+	if !ok {
+		return false
+	}
+	source.PropsMu.RLock()
+	name := source.Name
+	source.PropsMu.RUnlock()
+	return strings.HasSuffix(name, ".monitor")
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSourceOutputVisible(t *testing.T) {
+	newInfo := func(props map[string]string) *pulse.SourceOutput {
+		return &pulse.SourceOutput{PropList: props, OwnerModule: math.MaxUint32, Source: 1}
+	}
+	// 2 号输入设备是 monitor
+	isMonitorSource := func(index uint32) bool {
+		return index == 2
+	}
+	visible := func(info *pulse.SourceOutput) bool {
+		return getSourceOutputVisible(info, isMonitorSource)
+	}
+
+	assert.True(t, visible(newInfo(map[string]string{
+		PropAppName:      "Chromium",
+		PropAppProcessID: "1",
+	})))
+	assert.True(t, visible(newInfo(map[string]string{
+		pulse.PA_PROP_MEDIA_ROLE: "phone",
+	})))
+	assert.False(t, visible(newInfo(map[string]string{
+		pulse.PA_PROP_MEDIA_ROLE: "filter",
+	})))
+	assert.False(t, visible(newInfo(map[string]string{
+		PropAppProcessID: strconv.Itoa(os.Getpid()),
+	})))
+
+	// module-loopback、module-echo-cancel 等模块创建的流
+	info := newInfo(map[string]string{PropAppName: "Chromium"})
+	info.OwnerModule = 12
+	assert.False(t, visible(info))
+
+	// 录制 monitor 的流
+	info = newInfo(map[string]string{PropAppName: "OBS"})
+	info.Source = 2
+	assert.False(t, visible(info))
+}
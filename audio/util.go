@@ -68,7 +68,10 @@ func getMprisPlayers(sessionConn *dbus.Conn) ([]string, error) {
 	return playerNames, nil
 }
 
-func pauseAllPlayers() {
+// 暂停所有的 MPRIS 播放器，测试时替换为记录调用
+var pauseAllPlayers = pauseMprisPlayers
+
+func pauseMprisPlayers() {
 	sessionConn, err := dbus.SessionBus()
 	if err != nil {
 		return
@@ -0,0 +1,313 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/pulse"
+)
+
+const (
+	nullSinkModuleName    = "module-null-sink"
+	combineSinkModuleName = "module-combine-sink"
+	loopbackModuleName    = "module-loopback"
+
+	// 虚拟输出设备在 pulseaudio 中的 sink 名称的前缀
+	virtualSinkNamePrefix = "dde_virtual_sink."
+	// 虚拟输出设备没有声卡和端口，在 ConfigKeeper 中以 sink 名称作为声卡名称，使用这个端口名称保存配置
+	virtualSinkPortName = "virtual"
+)
+
+// pulseaudio 的 sink 名称只能使用这些字符
+var virtualSinkNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+func checkVirtualSinkName(name string) error {
+	if !virtualSinkNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid virtual sink name %q", name)
+	}
+	return nil
+}
+
+func getVirtualSinkName(name string) string {
+	return virtualSinkNamePrefix + name
+}
+
+func isVirtualSinkName(sinkName string) bool {
+	return strings.HasPrefix(sinkName, virtualSinkNamePrefix)
+}
+
+// getSinkModuleArgs 返回创建 sink 使用的模块和参数，exists 判断设备是否存在。
+// combine 类型只使用存在的设备，都不存在时返回空的参数
+func (vs *VirtualSink) getSinkModuleArgs(exists func(sinkName string) bool) (module string, args string) {
+	sinkName := getVirtualSinkName(vs.Name)
+	switch vs.Type {
+	case VirtualSinkTypeCombine:
+		var slaves []string
+		for _, slave := range vs.Slaves {
+			if exists(slave) {
+				slaves = append(slaves, slave)
+			}
+		}
+		if len(slaves) == 0 {
+			return combineSinkModuleName, ""
+		}
+		return combineSinkModuleName, fmt.Sprintf("sink_name=%s slaves=%s sink_properties=device.description=%s",
+			sinkName, strings.Join(slaves, ","), vs.Name)
+	case VirtualSinkTypeNull, VirtualSinkTypeLoopback:
+		return nullSinkModuleName, fmt.Sprintf("sink_name=%s sink_properties=device.description=%s",
+			sinkName, vs.Name)
+	}
+	return "", ""
+}
+
+// getLoopbackModuleArgs 返回 loopback 类型把 monitor 输出到目标设备的 module-loopback 的参数，
+// 目标设备不存在时返回空的参数。目标设备被移除时 pulseaudio 会自动卸载 module-loopback
+func (vs *VirtualSink) getLoopbackModuleArgs(exists func(sinkName string) bool) string {
+	if vs.Type != VirtualSinkTypeLoopback || !exists(vs.Target) {
+		return ""
+	}
+	return fmt.Sprintf("source=%s.monitor sink=%s source_dont_move=true sink_dont_move=true",
+		getVirtualSinkName(vs.Name), vs.Target)
+}
+
+// parseVirtualSinkModule 判断模块是否是虚拟输出设备加载的，返回虚拟输出设备的名称
+func parseVirtualSinkModule(module *pulse.Module) (name string, isLoopback bool, ok bool) {
+	var prefix string
+	switch module.Name {
+	case nullSinkModuleName, combineSinkModuleName:
+		prefix = "sink_name=" + virtualSinkNamePrefix
+	case loopbackModuleName:
+		prefix = "source=" + virtualSinkNamePrefix
+		isLoopback = true
+	default:
+		return "", false, false
+	}
+	if !strings.HasPrefix(module.Argument, prefix) {
+		return "", false, false
+	}
+	name = module.Argument[len(prefix):]
+	if i := strings.IndexByte(name, ' '); i >= 0 {
+		name = name[:i]
+	}
+	if isLoopback {
+		name = strings.TrimSuffix(name, ".monitor")
+	}
+	return name, isLoopback, name != ""
+}
+
+// virtualSinkManager 根据保存的虚拟输出设备加载和卸载模块
+type virtualSinkManager struct {
+	ctx moduleContext
+	mu  sync.Mutex
+}
+
+func newVirtualSinkManager(ctx moduleContext) *virtualSinkManager {
+	return &virtualSinkManager{
+		ctx: ctx,
+	}
+}
+
+func (m *virtualSinkManager) load(module, args string) error {
+	logger.Debugf("load %s %s", module, args)
+	_, err := m.ctx.LoadModule(module, args)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", module, err)
+	}
+	return nil
+}
+
+// sync 使加载的模块和 sinks 一致：卸载多余的和参数改变的模块，加载缺少的模块。
+// 依赖的设备出现后再次调用会补充加载，返回虚拟输出设备名称 => 加载时的错误
+func (m *virtualSinkManager) sync(sinks []*VirtualSink, exists func(sinkName string) bool) map[string]error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]*VirtualSink, len(sinks))
+	for _, vs := range sinks {
+		wanted[vs.Name] = vs
+	}
+	loadedSinks := make(map[string]bool)
+	loadedLoopbacks := make(map[string]bool)
+	for _, module := range m.ctx.GetModuleList() {
+		name, isLoopback, ok := parseVirtualSinkModule(module)
+		if !ok {
+			continue
+		}
+		vs := wanted[name]
+		if vs != nil && isLoopback && vs.Type == VirtualSinkTypeLoopback {
+			args := vs.getLoopbackModuleArgs(exists)
+			if args == "" || args == module.Argument {
+				loadedLoopbacks[name] = true
+				continue
+			}
+		} else if vs != nil && !isLoopback {
+			moduleName, args := vs.getSinkModuleArgs(exists)
+			// combine 类型的设备都不存在时保留已经加载的模块
+			if module.Name == moduleName && (args == "" || args == module.Argument) {
+				loadedSinks[name] = true
+				continue
+			}
+		}
+		logger.Debugf("unload %s #%d %s", module.Name, module.Index, module.Argument)
+		m.ctx.UnloadModule(module.Index)
+	}
+
+	errs := make(map[string]error)
+	for _, vs := range sinks {
+		if !loadedSinks[vs.Name] {
+			moduleName, args := vs.getSinkModuleArgs(exists)
+			if args == "" {
+				continue
+			}
+			err := m.load(moduleName, args)
+			if err != nil {
+				errs[vs.Name] = err
+				continue
+			}
+		}
+		if vs.Type == VirtualSinkTypeLoopback && !loadedLoopbacks[vs.Name] {
+			args := vs.getLoopbackModuleArgs(exists)
+			if args == "" {
+				continue
+			}
+			err := m.load(loopbackModuleName, args)
+			if err != nil {
+				errs[vs.Name] = err
+			}
+		}
+	}
+	return errs
+}
+
+// getSinkConfigKey 返回 sink 在 ConfigKeeper 中的声卡名称和端口名称
+func (a *Audio) getSinkConfigKey(s *Sink) (cardName string, portName string) {
+	if isVirtualSinkName(s.Name) {
+		return s.Name, virtualSinkPortName
+	}
+	return a.getCardNameById(s.Card), s.ActivePort.Name
+}
+
+// 加载保存的虚拟输出设备，在初始化和新增 sink 时调用，调用者不能持有 a.mu
+func (a *Audio) syncVirtualSinks() map[string]error {
+	sinkNames := make(map[string]bool)
+	for _, sinkInfo := range a.ctx.GetSinkList() {
+		sinkNames[sinkInfo.Name] = true
+	}
+	errs := a.virtualSinks.sync(GetVirtualSinkKeeper().GetSinks(), func(sinkName string) bool {
+		return sinkNames[sinkName]
+	})
+	for name, err := range errs {
+		logger.Warningf("failed to load virtual sink %q: %v", name, err)
+	}
+	return errs
+}
+
+func (a *Audio) createVirtualSink(vs *VirtualSink) error {
+	err := checkVirtualSinkName(vs.Name)
+	if err != nil {
+		return err
+	}
+	err = GetVirtualSinkKeeper().AddSink(vs)
+	if err != nil {
+		return err
+	}
+	err = a.syncVirtualSinks()[vs.Name]
+	if err != nil {
+		// 卸载已经加载的部分
+		GetVirtualSinkKeeper().DeleteSink(vs.Name)
+		a.syncVirtualSinks()
+		return err
+	}
+	logger.Debugf("created virtual sink %+v", vs)
+	return nil
+}
+
+// CreateCombinedSink 创建同时输出到多个设备的虚拟输出设备，sinks 是 Sink 对象的路径。
+// 虚拟输出设备会被保存，登录时重新创建，出现在 Sinks 属性中的名称为 dde_virtual_sink.<name>
+func (a *Audio) CreateCombinedSink(name string, sinks []dbus.ObjectPath) *dbus.Error {
+	if len(sinks) < 2 {
+		return dbusutil.ToError(errors.New("combined sink needs at least two sinks"))
+	}
+	vs := &VirtualSink{
+		Name: name,
+		Type: VirtualSinkTypeCombine,
+	}
+	for _, sinkPath := range sinks {
+		sink := a.getSinkByPath(sinkPath)
+		if sink == nil {
+			return dbusutil.ToError(fmt.Errorf("invalid sink path: %q", sinkPath))
+		}
+		for _, slave := range vs.Slaves {
+			if slave == sink.Name {
+				return dbusutil.ToError(fmt.Errorf("duplicate sink path: %q", sinkPath))
+			}
+		}
+		vs.Slaves = append(vs.Slaves, sink.Name)
+	}
+	return dbusutil.ToError(a.createVirtualSink(vs))
+}
+
+// CreateVirtualSink 创建虚拟输出设备，声音可以通过它的 monitor 录制。
+// target 为 "/" 时创建 null sink，否则声音同时通过 loopback 输出到 target 这个 Sink 上
+func (a *Audio) CreateVirtualSink(name string, target dbus.ObjectPath) *dbus.Error {
+	vs := &VirtualSink{
+		Name: name,
+		Type: VirtualSinkTypeNull,
+	}
+	if target != "" && target != "/" {
+		sink := a.getSinkByPath(target)
+		if sink == nil {
+			return dbusutil.ToError(fmt.Errorf("invalid sink path: %q", target))
+		}
+		vs.Type = VirtualSinkTypeLoopback
+		vs.Target = sink.Name
+	}
+	return dbusutil.ToError(a.createVirtualSink(vs))
+}
+
+// DestroyVirtualSink 删除 CreateCombinedSink 或者 CreateVirtualSink 创建的虚拟输出设备
+func (a *Audio) DestroyVirtualSink(name string) *dbus.Error {
+	if !GetVirtualSinkKeeper().DeleteSink(name) {
+		return dbusutil.ToError(fmt.Errorf("virtual sink %q not found", name))
+	}
+	a.syncVirtualSinks()
+
+	GetConfigKeeper().RemoveCardConfig(getVirtualSinkName(name))
+	GetConfigKeeper().Save()
+	logger.Debugf("destroyed virtual sink %q", name)
+	return nil
+}
+
+// ListVirtualSinks 返回所有虚拟输出设备，格式为按名称排序的 VirtualSink 的 JSON 数组
+func (a *Audio) ListVirtualSinks() (sinksJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(GetVirtualSinkKeeper().GetSinks())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SetDefaultVirtualSink 把虚拟输出设备设置为默认输出设备，
+// 之后不会自动切换端口，直到用户通过 SetPort 选择端口
+func (a *Audio) SetDefaultVirtualSink(name string) *dbus.Error {
+	if GetVirtualSinkKeeper().GetSink(name) == nil {
+		return dbusutil.ToError(fmt.Errorf("virtual sink %q not found", name))
+	}
+	sinkName := getVirtualSinkName(name)
+	if a.getSinkInfoByName(sinkName) == nil {
+		return dbusutil.ToError(fmt.Errorf("virtual sink %q is not loaded", name))
+	}
+	logger.Debugf("set default sink to virtual sink %s", sinkName)
+	a.context().SetDefaultSink(sinkName)
+	return nil
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+const (
+	VirtualSinkTypeCombine  = "combine"  // module-combine-sink，同时输出到多个设备
+	VirtualSinkTypeNull     = "null"     // module-null-sink，声音只能通过 monitor 录制
+	VirtualSinkTypeLoopback = "loopback" // module-null-sink，monitor 再通过 module-loopback 输出到一个设备
+)
+
+// VirtualSink 是用户创建的虚拟输出设备，设备使用 pulseaudio 中的 sink 名称
+type VirtualSink struct {
+	Name   string
+	Type   string
+	Slaves []string `json:",omitempty"` // combine 类型同时输出的设备
+	Target string   `json:",omitempty"` // loopback 类型输出到的设备
+}
+
+func (vs *VirtualSink) clone() *VirtualSink {
+	vsCopy := *vs
+	if vs.Slaves != nil {
+		vsCopy.Slaves = make([]string, len(vs.Slaves))
+		copy(vsCopy.Slaves, vs.Slaves)
+	}
+	return &vsCopy
+}
+
+// VirtualSinkKeeper 保存用户创建的虚拟输出设备，登录时重新创建
+type VirtualSinkKeeper struct {
+	mu    sync.Mutex
+	Sinks map[string]*VirtualSink // 名称 => VirtualSink
+	file  string                  // 配置文件路径
+}
+
+// 创建单例
+func createVirtualSinkKeeperSingleton(path string) func() *VirtualSinkKeeper {
+	var vk *VirtualSinkKeeper = nil
+	return func() *VirtualSinkKeeper {
+		if vk == nil {
+			vk = NewVirtualSinkKeeper(path)
+		}
+		return vk
+	}
+}
+
+// 获取单例
+var globalVirtualSinkKeeperFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/audio-virtual-sinks.json")
+var GetVirtualSinkKeeper = createVirtualSinkKeeperSingleton(globalVirtualSinkKeeperFile)
+
+func NewVirtualSinkKeeper(path string) *VirtualSinkKeeper {
+	return &VirtualSinkKeeper{
+		Sinks: make(map[string]*VirtualSink),
+		file:  path,
+	}
+}
+
+// 调用者需要持有 vk.mu
+func (vk *VirtualSinkKeeper) save() error {
+	data, err := json.MarshalIndent(vk.Sinks, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(vk.file), 0755)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+
+	err = ioutil.WriteFile(vk.file, data, 0644)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	return nil
+}
+
+func (vk *VirtualSinkKeeper) Save() error {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	return vk.save()
+}
+
+func (vk *VirtualSinkKeeper) Load() error {
+	data, err := ioutil.ReadFile(vk.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return err
+	}
+
+	sinks := make(map[string]*VirtualSink)
+	err = json.Unmarshal(data, &sinks)
+	if err != nil {
+		logger.Warning(err)
+		return err
+	}
+	for name, vs := range sinks {
+		if vs == nil {
+			delete(sinks, name)
+			continue
+		}
+		vs.Name = name
+	}
+
+	vk.mu.Lock()
+	vk.Sinks = sinks
+	vk.mu.Unlock()
+	return nil
+}
+
+// GetSink 返回虚拟输出设备的副本，不存在时返回 nil
+func (vk *VirtualSinkKeeper) GetSink(name string) *VirtualSink {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	vs, ok := vk.Sinks[name]
+	if !ok {
+		return nil
+	}
+	return vs.clone()
+}
+
+// GetSinks 返回所有虚拟输出设备的副本，按名称排序
+func (vk *VirtualSinkKeeper) GetSinks() []*VirtualSink {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	result := make([]*VirtualSink, 0, len(vk.Sinks))
+	for _, vs := range vk.Sinks {
+		result = append(result, vs.clone())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// AddSink 添加虚拟输出设备，名称已经存在时返回错误
+func (vk *VirtualSinkKeeper) AddSink(vs *VirtualSink) error {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	if _, ok := vk.Sinks[vs.Name]; ok {
+		return fmt.Errorf("virtual sink %q already exists", vs.Name)
+	}
+	vk.Sinks[vs.Name] = vs.clone()
+	vk.save()
+	return nil
+}
+
+// DeleteSink 删除虚拟输出设备，返回设备是否存在
+func (vk *VirtualSinkKeeper) DeleteSink(name string) bool {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	if _, ok := vk.Sinks[name]; !ok {
+		return false
+	}
+	delete(vk.Sinks, name)
+	vk.save()
+	return true
+}
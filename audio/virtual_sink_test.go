@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+package audio
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/go-lib/pulse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualSinkKeeper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio-virtual-sinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sub/audio-virtual-sinks.json")
+
+	vk := NewVirtualSinkKeeper(file)
+	assert.Error(t, vk.Load())
+
+	tv := &VirtualSink{
+		Name:   "tv-and-speakers",
+		Type:   VirtualSinkTypeCombine,
+		Slaves: []string{"alsa_output.hdmi", "alsa_output.analog"},
+	}
+	require.NoError(t, vk.AddSink(tv))
+	require.NoError(t, vk.AddSink(&VirtualSink{Name: "recording", Type: VirtualSinkTypeNull}))
+	assert.Error(t, vk.AddSink(&VirtualSink{Name: "recording", Type: VirtualSinkTypeLoopback}))
+
+	vk2 := NewVirtualSinkKeeper(file)
+	require.NoError(t, vk2.Load())
+	sinks := vk2.GetSinks()
+	require.Len(t, sinks, 2)
+	assert.Equal(t, "recording", sinks[0].Name)
+	assert.Equal(t, tv, sinks[1])
+
+	// 返回的是副本
+	sinks[1].Slaves[0] = "alsa_output.usb"
+	assert.Equal(t, tv, vk2.GetSink("tv-and-speakers"))
+
+	assert.True(t, vk2.DeleteSink("recording"))
+	assert.False(t, vk2.DeleteSink("recording"))
+	assert.Nil(t, vk2.GetSink("recording"))
+}
+
+func TestParseVirtualSinkModule(t *testing.T) {
+	name, isLoopback, ok := parseVirtualSinkModule(&pulse.Module{
+		Name:     combineSinkModuleName,
+		Argument: "sink_name=dde_virtual_sink.tv slaves=a,b sink_properties=device.description=tv",
+	})
+	assert.True(t, ok)
+	assert.False(t, isLoopback)
+	assert.Equal(t, "tv", name)
+
+	name, isLoopback, ok = parseVirtualSinkModule(&pulse.Module{
+		Name:     loopbackModuleName,
+		Argument: "source=dde_virtual_sink.rec.monitor sink=alsa_output.analog",
+	})
+	assert.True(t, ok)
+	assert.True(t, isLoopback)
+	assert.Equal(t, "rec", name)
+
+	_, _, ok = parseVirtualSinkModule(&pulse.Module{Name: nullSinkModuleName, Argument: "sink_name=other"})
+	assert.False(t, ok)
+	_, _, ok = parseVirtualSinkModule(&pulse.Module{Name: "module-alsa-card", Argument: "sink_name=dde_virtual_sink.tv"})
+	assert.False(t, ok)
+
+	assert.NoError(t, checkVirtualSinkName("screen_rec-1.0"))
+	assert.Error(t, checkVirtualSinkName(""))
+	assert.Error(t, checkVirtualSinkName("tv speakers"))
+}
+
+func TestVirtualSinkManager(t *testing.T) {
+	ctx := &fakeModuleContext{
+		modules: []*pulse.Module{
+			{Index: 100, Name: "module-alsa-card"},
+			// 上次运行时创建，已经被删除的虚拟输出设备
+			{Index: 101, Name: nullSinkModuleName, Argument: "sink_name=dde_virtual_sink.old sink_properties=device.description=old"},
+		},
+		nextIndex: 101,
+	}
+	m := newVirtualSinkManager(ctx)
+	existing := map[string]bool{"alsa_output.analog": true}
+	exists := func(sinkName string) bool {
+		return existing[sinkName]
+	}
+	sinks := []*VirtualSink{
+		{Name: "tv", Type: VirtualSinkTypeCombine, Slaves: []string{"alsa_output.hdmi", "alsa_output.analog"}},
+		{Name: "rec", Type: VirtualSinkTypeLoopback, Target: "alsa_output.hdmi"},
+	}
+
+	// HDMI 不存在时 combine 只使用存在的设备，loopback 只加载 null sink
+	assert.Empty(t, m.sync(sinks, exists))
+	require.Len(t, ctx.modules, 3)
+	assert.Equal(t, "module-alsa-card", ctx.modules[0].Name)
+	assert.Equal(t, "sink_name=dde_virtual_sink.tv slaves=alsa_output.analog sink_properties=device.description=tv",
+		ctx.modules[1].Argument)
+	assert.Equal(t, nullSinkModuleName, ctx.modules[2].Name)
+	assert.Equal(t, "sink_name=dde_virtual_sink.rec sink_properties=device.description=rec", ctx.modules[2].Argument)
+
+	// 没有变化时不重新加载
+	assert.Empty(t, m.sync(sinks, exists))
+	assert.Len(t, ctx.modules, 3)
+	assert.Equal(t, uint32(103), ctx.modules[2].Index)
+
+	// HDMI 出现后重新加载 combine，并加载 loopback
+	existing["alsa_output.hdmi"] = true
+	assert.Empty(t, m.sync(sinks, exists))
+	require.Len(t, ctx.modules, 4)
+	assert.Equal(t, uint32(103), ctx.modules[1].Index)
+	assert.Equal(t, "sink_name=dde_virtual_sink.tv slaves=alsa_output.hdmi,alsa_output.analog sink_properties=device.description=tv",
+		ctx.modules[2].Argument)
+	assert.Equal(t, loopbackModuleName, ctx.modules[3].Name)
+	assert.Equal(t, "source=dde_virtual_sink.rec.monitor sink=alsa_output.hdmi source_dont_move=true sink_dont_move=true",
+		ctx.modules[3].Argument)
+
+	// 删除后卸载对应的模块
+	assert.Empty(t, m.sync(sinks[:1], exists))
+	require.Len(t, ctx.modules, 2)
+	assert.Equal(t, combineSinkModuleName, ctx.modules[1].Name)
+
+	ctx.loadErr = errors.New("load failed")
+	errs := m.sync(append(sinks[:1], &VirtualSink{Name: "null", Type: VirtualSinkTypeNull}), exists)
+	assert.Len(t, errs, 1)
+	assert.Error(t, errs["null"])
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -67,19 +68,24 @@ type SessionDaemon struct {
 
 	configManagerPath dbus.ObjectPath
 	systemSigLoop     *dbusutil.SignalLoop
+
+	startup *startupProfiler
 }
 
 func (*SessionDaemon) GetInterfaceName() string {
 	return dbusInterface
 }
 
-func NewSessionDaemon(logger *log.Logger) *SessionDaemon {
+func NewSessionDaemon(logger *log.Logger, startup *startupProfiler) *SessionDaemon {
 	daemon := &SessionDaemon{
 		flags: &Flags{
 			IgnoreMissingModules: _options.ignore,
 			ForceStart:           _options.force,
+			StartConcurrency:     _options.startConcurrency,
+			StartTimeout:         _options.startTimeout,
 		},
-		log: logger,
+		log:     logger,
+		startup: startup,
 	}
 	err := daemon.initDsgConfig()
 	if err != nil {
@@ -314,6 +320,58 @@ func (s *SessionDaemon) StartPart2() *dbus.Error {
 	}
 	// start part2
 	err := loader.EnableModules(s.part2EnabledModules, s.part2DisabledModules, 0)
+	s.startup.finish(true)
+	return dbusutil.ToError(err)
+}
+
+// ListModules 返回所有模块的名称、状态和依赖，格式为 JSON
+func (s *SessionDaemon) ListModules() (modulesJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(loader.ListModuleInfo())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// GetModuleStartTimes 返回各模块最近一次启动的耗时，格式为 JSON
+func (s *SessionDaemon) GetModuleStartTimes() (timesJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(getModuleStartTimes())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// GetStartupReport 返回启动报告，格式为 JSON，启动还没有完成时返回当前的状态
+func (s *SessionDaemon) GetStartupReport() (reportJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(s.startup.getReport())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+func (s *SessionDaemon) GetModuleState(name string) (state string, busErr *dbus.Error) {
+	moduleState, err := loader.GetModuleState(name)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return moduleState.String(), nil
+}
+
+// RestartModule 重启模块以及依赖它的模块
+func (s *SessionDaemon) RestartModule(name string) *dbus.Error {
+	moduleLocker.Lock()
+	defer moduleLocker.Unlock()
+	module := loader.GetModule(name)
+	if module == nil {
+		return dbusutil.ToError(fmt.Errorf("no such a module named %s", name))
+	}
+	if !module.IsEnable() && module.State() != loader.ModuleStateFailed {
+		return dbusutil.ToError(fmt.Errorf("module %s is not enabled", name))
+	}
+	logger.Info("restart module", name)
+	err := loader.RestartModule(name)
 	return dbusutil.ToError(err)
 }
 
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// 启动报告中最多记录的耗时最长的 DBus 调用数量
+const maxSlowDBusCalls = 20
+
+type dbusCallRecord struct {
+	Destination string
+	Path        string
+	Method      string
+	BeginMs     int64 // 调用开始的时间，相对于进程启动，单位毫秒
+	CostMs      int64
+	Error       string `json:",omitempty"`
+}
+
+type dbusNameRecord struct {
+	Name       string
+	AcquiredMs int64 // 获取到服务名的时间，相对于进程启动，单位毫秒
+	CostMs     int64
+}
+
+type pendingDBusCall struct {
+	record      dbusCallRecord
+	begin       time.Time
+	requestName string // RequestName 调用请求的服务名
+}
+
+// dbusCallMonitor 作为 session bus 的监视器（BecomeMonitor），记录 daemon 发出的 DBus 调用的耗时，
+// 以及获取服务名的时间，不需要修改各个模块的代码。system bus 需要 root 权限才能监视，所以不记录。
+type dbusCallMonitor struct {
+	conn        *dbus.Conn
+	self        string // daemon 连接的 unique name
+	monitorName string // 监视器连接的 unique name
+	begin       time.Time
+	quit        chan struct{}
+	loopDone    chan struct{} // loop 返回时关闭
+	stopOnce    sync.Once
+
+	mu        sync.Mutex
+	pending   map[uint32]*pendingDBusCall
+	slowCalls []dbusCallRecord // 按耗时从大到小排序
+	names     []dbusNameRecord
+}
+
+func newDBusCallMonitor(self string, begin time.Time) (*dbusCallMonitor, error) {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Auth(nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	err = conn.Hello()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	m := &dbusCallMonitor{
+		conn:        conn,
+		self:        self,
+		monitorName: conn.Names()[0],
+		begin:       begin,
+		quit:        make(chan struct{}),
+		loopDone:    make(chan struct{}),
+		pending:     make(map[uint32]*pendingDBusCall),
+	}
+
+	// 成为监视器后不能再发送任何消息，所以在发送 BecomeMonitor 之前就截获所有消息，
+	// 避免 godbus 自动回复收到的方法调用。
+	ch := make(chan *dbus.Message, 512)
+	conn.Eavesdrop(ch)
+	rules := []string{
+		fmt.Sprintf("sender='%s'", self),
+		fmt.Sprintf("destination='%s'", self),
+	}
+	conn.BusObject().Go("org.freedesktop.DBus.Monitoring.BecomeMonitor", 0, nil, rules, uint32(0))
+	go m.loop(ch)
+	return m, nil
+}
+
+func (m *dbusCallMonitor) loop(ch chan *dbus.Message) {
+	defer close(m.loopDone)
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				// 连接关闭时 godbus 会关闭 ch
+				return
+			}
+			dest, _ := getMessageHeader(msg, dbus.FieldDestination)
+			if dest == m.monitorName {
+				// BecomeMonitor 的回复，或者成为监视器后收到的 NameLost 信号
+				if msg.Type == dbus.TypeError {
+					logger.Warning("failed to become dbus monitor:", msg.Body)
+					return
+				}
+				continue
+			}
+			m.handleMessage(msg, time.Now())
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+func getMessageHeader(msg *dbus.Message, field dbus.HeaderField) (string, bool) {
+	v, ok := msg.Headers[field]
+	if !ok {
+		return "", false
+	}
+	str, ok := v.Value().(string)
+	return str, ok
+}
+
+func (m *dbusCallMonitor) handleMessage(msg *dbus.Message, now time.Time) {
+	sender, _ := getMessageHeader(msg, dbus.FieldSender)
+	dest, _ := getMessageHeader(msg, dbus.FieldDestination)
+
+	switch msg.Type {
+	case dbus.TypeMethodCall:
+		if sender != m.self || dest == m.self || msg.Flags&dbus.FlagNoReplyExpected != 0 {
+			return
+		}
+		var path string
+		if v, ok := msg.Headers[dbus.FieldPath]; ok {
+			objPath, _ := v.Value().(dbus.ObjectPath)
+			path = string(objPath)
+		}
+		iface, _ := getMessageHeader(msg, dbus.FieldInterface)
+		member, _ := getMessageHeader(msg, dbus.FieldMember)
+		method := member
+		if iface != "" {
+			method = iface + "." + member
+		}
+		call := &pendingDBusCall{
+			record: dbusCallRecord{
+				Destination: dest,
+				Path:        path,
+				Method:      method,
+				BeginMs:     now.Sub(m.begin).Milliseconds(),
+			},
+			begin: now,
+		}
+		if method == "org.freedesktop.DBus.RequestName" && len(msg.Body) > 0 {
+			call.requestName, _ = msg.Body[0].(string)
+		}
+
+		m.mu.Lock()
+		m.pending[msg.Serial()] = call
+		m.mu.Unlock()
+
+	case dbus.TypeMethodReply, dbus.TypeError:
+		if dest != m.self {
+			return
+		}
+		v, ok := msg.Headers[dbus.FieldReplySerial]
+		if !ok {
+			return
+		}
+		replySerial, _ := v.Value().(uint32)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		call, ok := m.pending[replySerial]
+		if !ok {
+			return
+		}
+		delete(m.pending, replySerial)
+		record := call.record
+		record.CostMs = now.Sub(call.begin).Milliseconds()
+		if msg.Type == dbus.TypeError {
+			record.Error, _ = getMessageHeader(msg, dbus.FieldErrorName)
+		}
+		if call.requestName != "" && record.Error == "" {
+			m.names = append(m.names, dbusNameRecord{
+				Name:       call.requestName,
+				AcquiredMs: now.Sub(m.begin).Milliseconds(),
+				CostMs:     record.CostMs,
+			})
+		}
+		m.addSlowCall(record)
+	}
+}
+
+// 调用者需要持有 m.mu
+func (m *dbusCallMonitor) addSlowCall(record dbusCallRecord) {
+	if len(m.slowCalls) >= maxSlowDBusCalls &&
+		m.slowCalls[len(m.slowCalls)-1].CostMs >= record.CostMs {
+		return
+	}
+	idx := sort.Search(len(m.slowCalls), func(i int) bool {
+		return m.slowCalls[i].CostMs < record.CostMs
+	})
+	m.slowCalls = append(m.slowCalls, dbusCallRecord{})
+	copy(m.slowCalls[idx+1:], m.slowCalls[idx:])
+	m.slowCalls[idx] = record
+	if len(m.slowCalls) > maxSlowDBusCalls {
+		m.slowCalls = m.slowCalls[:maxSlowDBusCalls]
+	}
+}
+
+func (m *dbusCallMonitor) getSlowCalls() []dbusCallRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]dbusCallRecord(nil), m.slowCalls...)
+}
+
+func (m *dbusCallMonitor) getNames() []dbusNameRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]dbusNameRecord(nil), m.names...)
+}
+
+func (m *dbusCallMonitor) stop() {
+	m.stopOnce.Do(func() {
+		// 先等待 loop 返回再关闭连接
+		close(m.quit)
+		<-m.loopDone
+		err := m.conn.Close()
+		if err != nil {
+			logger.Warning(err)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBusCallMonitor_handleMessage(t *testing.T) {
+	begin := time.Now()
+	m := &dbusCallMonitor{
+		self:    ":1.10",
+		begin:   begin,
+		pending: make(map[uint32]*pendingDBusCall),
+	}
+
+	call := &dbus.Message{
+		Type: dbus.TypeMethodCall,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldSender:      dbus.MakeVariant(":1.10"),
+			dbus.FieldDestination: dbus.MakeVariant("org.freedesktop.DBus"),
+			dbus.FieldPath:        dbus.MakeVariant(dbus.ObjectPath("/org/freedesktop/DBus")),
+			dbus.FieldInterface:   dbus.MakeVariant("org.freedesktop.DBus"),
+			dbus.FieldMember:      dbus.MakeVariant("RequestName"),
+		},
+		Body: []interface{}{"com.deepin.daemon.Audio", uint32(0)},
+	}
+	m.handleMessage(call, begin.Add(100*time.Millisecond))
+	assert.Len(t, m.pending, 1)
+
+	// 回复给其他连接的消息被忽略
+	reply := &dbus.Message{
+		Type: dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldDestination: dbus.MakeVariant(":1.11"),
+			dbus.FieldReplySerial: dbus.MakeVariant(call.Serial()),
+		},
+	}
+	m.handleMessage(reply, begin.Add(120*time.Millisecond))
+	assert.Len(t, m.pending, 1)
+
+	reply.Headers[dbus.FieldDestination] = dbus.MakeVariant(":1.10")
+	m.handleMessage(reply, begin.Add(130*time.Millisecond))
+	assert.Empty(t, m.pending)
+	assert.Equal(t, []dbusNameRecord{{
+		Name:       "com.deepin.daemon.Audio",
+		AcquiredMs: 130,
+		CostMs:     30,
+	}}, m.getNames())
+	assert.Equal(t, []dbusCallRecord{{
+		Destination: "org.freedesktop.DBus",
+		Path:        "/org/freedesktop/DBus",
+		Method:      "org.freedesktop.DBus.RequestName",
+		BeginMs:     100,
+		CostMs:      30,
+	}}, m.getSlowCalls())
+}
+
+func TestDBusCallMonitor_addSlowCall(t *testing.T) {
+	m := &dbusCallMonitor{}
+	for i := 0; i < maxSlowDBusCalls+5; i++ {
+		m.addSlowCall(dbusCallRecord{CostMs: int64(i % 7 * 10)})
+	}
+	calls := m.getSlowCalls()
+	assert.Len(t, calls, maxSlowDBusCalls)
+	for i := 1; i < len(calls); i++ {
+		assert.True(t, calls[i-1].CostMs >= calls[i].CostMs)
+	}
+	assert.EqualValues(t, 60, calls[0].CostMs)
+}
+
+func TestDBusCallMonitor_loopChanClosed(t *testing.T) {
+	m := &dbusCallMonitor{
+		quit:     make(chan struct{}),
+		loopDone: make(chan struct{}),
+	}
+	ch := make(chan *dbus.Message)
+	go m.loop(ch)
+	// 连接关闭时 godbus 关闭 ch，loop 不能处理 nil 消息
+	close(ch)
+	select {
+	case <-m.loopDone:
+	case <-time.After(time.Second):
+		assert.FailNow(t, "loop does not return")
+	}
+}
@@ -13,6 +13,32 @@ func (v *SessionDaemon) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.CallTrace,
 			InArgs: []string{"times", "seconds"},
 		},
+		{
+			Name:    "GetModuleStartTimes",
+			Fn:      v.GetModuleStartTimes,
+			OutArgs: []string{"timesJSON"},
+		},
+		{
+			Name:    "GetModuleState",
+			Fn:      v.GetModuleState,
+			InArgs:  []string{"name"},
+			OutArgs: []string{"state"},
+		},
+		{
+			Name:    "GetStartupReport",
+			Fn:      v.GetStartupReport,
+			OutArgs: []string{"reportJSON"},
+		},
+		{
+			Name:    "ListModules",
+			Fn:      v.ListModules,
+			OutArgs: []string{"modulesJSON"},
+		},
+		{
+			Name:   "RestartModule",
+			Fn:     v.RestartModule,
+			InArgs: []string{"name"},
+		},
 		{
 			Name: "StartPart2",
 			Fn:   v.StartPart2,
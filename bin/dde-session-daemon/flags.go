@@ -4,7 +4,11 @@
 
 package main
 
+import "time"
+
 type Flags struct {
 	IgnoreMissingModules bool
 	ForceStart           bool
+	StartConcurrency     int           // 同时启动的模块数量上限，0 表示不限制
+	StartTimeout         time.Duration // 单个模块启动的超时时间，0 表示不限制
 }
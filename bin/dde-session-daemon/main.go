@@ -39,6 +39,10 @@ import (
 )
 
 var logger = log.NewLogger("daemon/dde-session-daemon")
+
+// 模块健康检查的间隔
+const supervisorInterval = 30 * time.Second
+
 var hasDDECookie bool
 
 func isInShutdown() bool {
@@ -90,6 +94,10 @@ var _options struct {
 	ignore   bool
 	force    bool
 
+	startConcurrency int
+	startTimeout     time.Duration
+	profileStartup   bool
+
 	enablingModules []string
 	disableModules  []string
 }
@@ -141,6 +149,18 @@ func init() {
 	flag.BoolVar(&_options.ignore, "i", true, ignoreUsage)
 	flag.BoolVar(&_options.ignore, "ignore", true, ignoreUsage)
 
+	// -start-concurrency
+	flag.IntVar(&_options.startConcurrency, "start-concurrency", 0,
+		"Max number of modules starting at the same time, 0 means no limit.")
+
+	// -start-timeout
+	flag.DurationVar(&_options.startTimeout, "start-timeout", 0,
+		"Timeout of starting one module, 0 means no limit. A module that times out continues starting in background and the modules depending on it start after it succeeds.")
+
+	// -profile-startup
+	flag.BoolVar(&_options.profileStartup, "profile-startup", false,
+		"Write a pprof CPU profile covering startup to $XDG_RUNTIME_DIR/dde-session-daemon. The startup report there always records DBus name acquisition times and the slowest DBus calls.")
+
 	// -list
 	flag.StringVar(&_options.list, "list", "",
 		"List all the modules or the dependencies of one module. The argument can be all or the name of the module.")
@@ -154,6 +174,7 @@ func init() {
 }
 
 func main() {
+	startup := newStartupProfiler(time.Now())
 	logger.SetLogLevel(log.LevelInfo)
 	if !allowRun() {
 		logger.Warning("session manager does not allow me to run")
@@ -166,6 +187,12 @@ func main() {
 	}
 
 	flag.Parse()
+	if _options.profileStartup {
+		err := startup.startCPUProfile()
+		if err != nil {
+			logger.Warning("failed to start cpu profile:", err)
+		}
+	}
 	InitI18n()
 	BindTextdomainCodeset("dde-daemon", "UTF-8")
 	Textdomain("dde-daemon")
@@ -195,7 +222,7 @@ func main() {
 	C.init()
 	proxy.SetupProxy()
 
-	app := NewSessionDaemon(logger)
+	app := NewSessionDaemon(logger, startup)
 	if app == nil {
 		return
 	}
@@ -210,6 +237,13 @@ func main() {
 	}
 
 	loader.SetService(service)
+	// 监视器只在启动过程中运行，启动完成后停止，开销很小，所以总是记录 DBus 调用
+	err = startup.startDBusMonitor(service.Conn().Names()[0])
+	if err != nil {
+		logger.Warning("failed to monitor dbus calls:", err)
+	}
+	loader.SetStartConcurrency(app.flags.StartConcurrency)
+	loader.SetStartTimeout(app.flags.StartTimeout)
 
 	if _options.logLevel == "" &&
 		(utils.IsEnvExists(log.DebugLevelEnv) || utils.IsEnvExists(log.DebugMatchEnv)) {
@@ -244,6 +278,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 分两个阶段启动时，在 StartPart2 中完成启动报告
+	startup.finish(!hasDDECookie)
+	// 自动重启模块和 DBus 接口、配置变化引起的启用停用使用同一个锁
+	loader.StartSupervisor(supervisorInterval, &moduleLocker)
+
 	err = migrateUserEnv()
 	if err != nil {
 		logger.Warning("failed to migrate user env:", err)
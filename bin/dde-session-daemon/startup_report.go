@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/linuxdeepin/dde-daemon/loader"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+const (
+	startupReportFile     = "startup-report.json"
+	startupCPUProfileFile = "startup-cpu.prof"
+)
+
+type moduleStartTime struct {
+	Name     string
+	WaitMs   int64 // 在 WaitDependencies 中等待依赖的模块启动的耗时，单位毫秒
+	StartMs  int64 // 模块 Start 的耗时，单位毫秒
+	TimedOut bool
+	Error    string `json:",omitempty"`
+}
+
+type startupReport struct {
+	BeginTime  time.Time
+	TotalMs    int64 // 从进程启动到所有模块启动完成的耗时，单位毫秒
+	Finished   bool  // 为 false 时启动还没有完成，报告只包含当前已经启动的模块
+	Modules    []moduleStartTime
+	DBusNames  []dbusNameRecord
+	SlowCalls  []dbusCallRecord
+	CPUProfile string `json:",omitempty"`
+}
+
+// startupProfiler 收集 dde-session-daemon 启动过程的耗时，启动完成后把报告写到 $XDG_RUNTIME_DIR 中。
+type startupProfiler struct {
+	begin time.Time
+
+	mu       sync.Mutex
+	monitor  *dbusCallMonitor
+	cpuFile  *os.File
+	endTime  time.Time
+	finished bool
+}
+
+func newStartupProfiler(begin time.Time) *startupProfiler {
+	return &startupProfiler{
+		begin: begin,
+	}
+}
+
+func getStartupReportDir() (string, error) {
+	runDir, err := basedir.GetUserRuntimeDir(true)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(runDir, "dde-session-daemon")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// 开始记录启动过程的 CPU profile，在 finish 时停止
+func (p *startupProfiler) startCPUProfile() error {
+	dir, err := getStartupReportDir()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, startupCPUProfileFile))
+	if err != nil {
+		return err
+	}
+	err = pprof.StartCPUProfile(f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	p.mu.Lock()
+	p.cpuFile = f
+	p.mu.Unlock()
+	return nil
+}
+
+// 开始记录 daemon 连接发出的 DBus 调用，self 是 daemon 在 session bus 上的 unique name
+func (p *startupProfiler) startDBusMonitor(self string) error {
+	monitor, err := newDBusCallMonitor(self, p.begin)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.monitor = monitor
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *startupProfiler) getReport() *startupReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := &startupReport{
+		BeginTime: p.begin,
+		Finished:  p.finished,
+		Modules:   getModuleStartTimes(),
+	}
+	if p.finished {
+		report.TotalMs = p.endTime.Sub(p.begin).Milliseconds()
+	} else {
+		report.TotalMs = time.Since(p.begin).Milliseconds()
+	}
+	if p.monitor != nil {
+		report.DBusNames = p.monitor.getNames()
+		report.SlowCalls = p.monitor.getSlowCalls()
+	}
+	if p.cpuFile != nil {
+		report.CPUProfile = p.cpuFile.Name()
+	}
+	return report
+}
+
+// 写入启动报告，final 为 true 表示启动已经完成，停止记录 DBus 调用和 CPU profile。
+// 分两个阶段启动时，第一阶段完成后也会写入一次报告。
+func (p *startupProfiler) finish(final bool) {
+	p.mu.Lock()
+	if p.finished {
+		p.mu.Unlock()
+		return
+	}
+	if final {
+		p.finished = true
+		p.endTime = time.Now()
+		if p.monitor != nil {
+			p.monitor.stop()
+		}
+		if p.cpuFile != nil {
+			pprof.StopCPUProfile()
+			err := p.cpuFile.Close()
+			if err != nil {
+				logger.Warning(err)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	err := p.writeReport()
+	if err != nil {
+		logger.Warning("failed to write startup report:", err)
+	}
+}
+
+func (p *startupProfiler) writeReport() error {
+	dir, err := getStartupReportDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p.getReport(), "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, startupReportFile)
+	err = ioutil.WriteFile(filename, data, 0600)
+	if err != nil {
+		return err
+	}
+	logger.Info("write startup report to", filename)
+	return nil
+}
+
+func getModuleStartTimes() []moduleStartTime {
+	stats := loader.GetStartStats()
+	times := make([]moduleStartTime, 0, len(stats))
+	for _, stat := range stats {
+		times = append(times, moduleStartTime{
+			Name:     stat.Name,
+			WaitMs:   stat.WaitDuration.Milliseconds(),
+			StartMs:  stat.StartDuration.Milliseconds(),
+			TimedOut: stat.TimedOut,
+			Error:    stat.Error,
+		})
+	}
+	return times
+}
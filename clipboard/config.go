@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus"
+	configManager "github.com/linuxdeepin/go-dbus-factory/org.desktopspec.ConfigManager"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+const (
+	dsettingsAppID                     = "org.deepin.dde.daemon"
+	dsettingsClipboardName             = "org.deepin.dde.daemon.clipboard"
+	dsettingsKeyManagePrimary          = "managePrimary"
+	dsettingsKeySyncPrimaryToClipboard = "syncPrimaryToClipboard"
+	dsettingsKeySyncClipboardToPrimary = "syncClipboardToPrimary"
+	dsettingsKeyMaxTotalSize           = "maxTotalSize"
+	dsettingsKeyMimeAllowList          = "mimeAllowList"
+	dsettingsKeyMimeDenyList           = "mimeDenyList"
+	dsettingsKeyExcludedApps           = "excludedApps"
+)
+
+// 剪贴板模块的 dconfig 配置，config 为 nil 时所有开关都视为关闭。
+type config struct {
+	mu                     sync.Mutex
+	managePrimary          bool
+	syncPrimaryToClipboard bool
+	syncClipboardToPrimary bool
+	policy                 *contentPolicy
+}
+
+func newConfig() *config {
+	return &config{
+		policy: newDefaultContentPolicy(),
+	}
+}
+
+func variantToStrv(v dbus.Variant) ([]string, bool) {
+	list, ok := v.Value().([]dbus.Variant)
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.Value().(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result, true
+}
+
+func variantToInt64(v dbus.Variant) (int64, bool) {
+	switch val := v.Value().(type) {
+	case int64:
+		return val, true
+	case int32:
+		return int64(val), true
+	case uint64:
+		return int64(val), true
+	case uint32:
+		return int64(val), true
+	case float64:
+		return int64(val), true
+	}
+	return 0, false
+}
+
+func (c *config) init(bus *dbus.Conn, sigLoop *dbusutil.SignalLoop) error {
+	ds := configManager.NewConfigManager(bus)
+	dsPath, err := ds.AcquireManager(0, dsettingsAppID, dsettingsClipboardName, "")
+	if err != nil {
+		return err
+	}
+
+	clipboardDS, err := configManager.NewManager(bus, dsPath)
+	if err != nil {
+		return err
+	}
+
+	getBool := func(key string, dest *bool) {
+		v, err := clipboardDS.Value(0, key)
+		if err != nil {
+			logger.Warning(err)
+			return
+		}
+		val, ok := v.Value().(bool)
+		if !ok {
+			logger.Warningf("invalid value type of %s: %T", key, v.Value())
+			return
+		}
+		c.mu.Lock()
+		*dest = val
+		c.mu.Unlock()
+		logger.Infof("clipboard config %s: %v", key, val)
+	}
+
+	// 策略变化时整体替换，读取的地方不需要持有锁
+	updatePolicy := func(key string) {
+		v, err := clipboardDS.Value(0, key)
+		if err != nil {
+			logger.Warning(err)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		policy := *c.policy
+		ok := true
+		switch key {
+		case dsettingsKeyMaxTotalSize:
+			policy.MaxTotalSize, ok = variantToInt64(v)
+		case dsettingsKeyMimeAllowList:
+			policy.AllowMimeTypes, ok = variantToStrv(v)
+		case dsettingsKeyMimeDenyList:
+			policy.DenyMimeTypes, ok = variantToStrv(v)
+		case dsettingsKeyExcludedApps:
+			policy.ExcludedApps, ok = variantToStrv(v)
+		}
+		if !ok {
+			logger.Warningf("invalid value type of %s: %T", key, v.Value())
+			return
+		}
+		c.policy = &policy
+		logger.Infof("clipboard config %s: %v", key, v.Value())
+	}
+
+	getBool(dsettingsKeyManagePrimary, &c.managePrimary)
+	getBool(dsettingsKeySyncPrimaryToClipboard, &c.syncPrimaryToClipboard)
+	getBool(dsettingsKeySyncClipboardToPrimary, &c.syncClipboardToPrimary)
+	updatePolicy(dsettingsKeyMaxTotalSize)
+	updatePolicy(dsettingsKeyMimeAllowList)
+	updatePolicy(dsettingsKeyMimeDenyList)
+	updatePolicy(dsettingsKeyExcludedApps)
+
+	clipboardDS.InitSignalExt(sigLoop, true)
+	// 监听dsg配置变化
+	_, err = clipboardDS.ConnectValueChanged(func(key string) {
+		switch key {
+		case dsettingsKeyManagePrimary:
+			getBool(key, &c.managePrimary)
+		case dsettingsKeySyncPrimaryToClipboard:
+			getBool(key, &c.syncPrimaryToClipboard)
+		case dsettingsKeySyncClipboardToPrimary:
+			getBool(key, &c.syncClipboardToPrimary)
+		case dsettingsKeyMaxTotalSize, dsettingsKeyMimeAllowList,
+			dsettingsKeyMimeDenyList, dsettingsKeyExcludedApps:
+			updatePolicy(key)
+		}
+	})
+	return err
+}
+
+func (c *config) get(val *bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *val
+}
+
+func (c *config) isManagePrimary() bool {
+	if c == nil {
+		return false
+	}
+	return c.get(&c.managePrimary)
+}
+
+func (c *config) isSyncPrimaryToClipboard() bool {
+	if c == nil {
+		return false
+	}
+	return c.get(&c.syncPrimaryToClipboard)
+}
+
+func (c *config) isSyncClipboardToPrimary() bool {
+	if c == nil {
+		return false
+	}
+	return c.get(&c.syncClipboardToPrimary)
+}
+
+// 获取当前的剪贴板内容策略，返回值不能被修改
+func (c *config) getPolicy() *contentPolicy {
+	if c == nil {
+		return newDefaultContentPolicy()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.policy
+}
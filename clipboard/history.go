@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	historyMaxItems      = 50
+	historyTargetMaxSize = 8 * 1024 * 1024
+	historyPreviewMaxLen = 200
+)
+
+// 带有这些 target 的剪贴板数据被认为是敏感数据，不记录到历史中
+var historySensitiveTargets = []string{
+	"x-kde-passwordManagerHint",
+	"application/x-nspasteboard-concealed-type",
+}
+
+// 可以用作文本预览的 target，按优先级排列
+var historyTextTargets = []string{
+	"UTF8_STRING",
+	"text/plain;charset=utf-8",
+	"text/plain",
+	"STRING",
+	"TEXT",
+}
+
+var errHistoryItemNotFound = errors.New("history item not found")
+
+// 历史中保存的 target 数据，target 和 type 以名称保存，因为 atom 的值在不同的 X 会话中不一样。
+type historyTarget struct {
+	Target string
+	Type   string
+	Format uint8
+	Data   []byte
+}
+
+type historyItem struct {
+	Id      uint64
+	Time    int64 // unix 时间戳，单位秒
+	Digest  string
+	Targets []*historyTarget
+}
+
+// 通过 DBus 返回的历史项摘要，不包含数据
+type historyItemInfo struct {
+	Id      uint64
+	Time    int64
+	Targets []string
+	Size    int
+	Preview string
+}
+
+func (item *historyItem) getTarget(name string) *historyTarget {
+	for _, t := range item.Targets {
+		if t.Target == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (item *historyItem) preview() string {
+	for _, name := range historyTextTargets {
+		t := item.getTarget(name)
+		if t == nil || !utf8.Valid(t.Data) {
+			continue
+		}
+		text := string(t.Data)
+		if utf8.RuneCountInString(text) > historyPreviewMaxLen {
+			text = string([]rune(text)[:historyPreviewMaxLen])
+		}
+		return text
+	}
+	return ""
+}
+
+func (item *historyItem) info() *historyItemInfo {
+	info := &historyItemInfo{
+		Id:      item.Id,
+		Time:    item.Time,
+		Targets: make([]string, 0, len(item.Targets)),
+		Preview: item.preview(),
+	}
+	for _, t := range item.Targets {
+		info.Targets = append(info.Targets, t.Target)
+		info.Size += len(t.Data)
+	}
+	return info
+}
+
+// 判断 target 是否应该被记录到历史中，只记录文本、图片和 uri-list
+func isHistoryTarget(name string) bool {
+	switch name {
+	case "UTF8_STRING", "STRING", "TEXT", "COMPOUND_TEXT",
+		"text/uri-list", "x-special/gnome-copied-files",
+		"image/png", "image/jpeg", "image/bmp":
+		return true
+	}
+	return strings.HasPrefix(name, "text/plain")
+}
+
+func isSensitiveTargets(names []string) bool {
+	for _, name := range names {
+		for _, sensitive := range historySensitiveTargets {
+			if name == sensitive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// historyStore 保存剪贴板历史，每一项保存为 dir 目录中的一个 json 文件。
+type historyStore struct {
+	dir           string
+	maxItems      int
+	maxTargetSize int
+
+	mu     sync.Mutex
+	items  []*historyItem // 按时间从新到旧排列
+	nextId uint64
+}
+
+func newHistoryStore(dir string) *historyStore {
+	return &historyStore{
+		dir:           dir,
+		maxItems:      historyMaxItems,
+		maxTargetSize: historyTargetMaxSize,
+		nextId:        1,
+	}
+}
+
+func (hs *historyStore) itemFile(id uint64) string {
+	return filepath.Join(hs.dir, strconv.FormatUint(id, 10)+".json")
+}
+
+func (hs *historyStore) load() error {
+	fileInfoList, err := ioutil.ReadDir(hs.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var items []*historyItem
+	for _, fileInfo := range fileInfoList {
+		if fileInfo.IsDir() || filepath.Ext(fileInfo.Name()) != ".json" {
+			continue
+		}
+		filename := filepath.Join(hs.dir, fileInfo.Name())
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		var item historyItem
+		err = json.Unmarshal(data, &item)
+		if err != nil {
+			logger.Warningf("failed to load history item %s: %v", filename, err)
+			_ = os.Remove(filename)
+			continue
+		}
+		items = append(items, &item)
+	}
+
+	// 与内存中的顺序保持一致：按时间从新到旧，时间相同时按 Id 从大到小
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Time != items[j].Time {
+			return items[i].Time > items[j].Time
+		}
+		return items[i].Id > items[j].Id
+	})
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.items = items
+	for _, item := range items {
+		if item.Id >= hs.nextId {
+			hs.nextId = item.Id + 1
+		}
+	}
+	hs.trim()
+	return nil
+}
+
+func (hs *historyStore) saveItem(item *historyItem) error {
+	err := os.MkdirAll(hs.dir, 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(hs.itemFile(item.Id), data, 0600)
+}
+
+func (hs *historyStore) removeItemFile(id uint64) {
+	err := os.Remove(hs.itemFile(id))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning(err)
+	}
+}
+
+// 删除超出数量限制的旧历史，调用者需要持有 hs.mu
+func (hs *historyStore) trim() {
+	if len(hs.items) <= hs.maxItems {
+		return
+	}
+	for _, item := range hs.items[hs.maxItems:] {
+		hs.removeItemFile(item.Id)
+	}
+	hs.items = hs.items[:hs.maxItems]
+}
+
+// add 添加一条历史，targets 需要已经过滤，返回新加入或被置顶的历史项。
+// 如果最近的一条历史内容相同，则只更新它的时间。
+func (hs *historyStore) add(targets []*historyTarget) (*historyItem, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no targets")
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Target < targets[j].Target
+	})
+	digest := getHistoryDigest(targets)
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	for idx, item := range hs.items {
+		if item.Digest != digest {
+			continue
+		}
+		item.Time = time.Now().Unix()
+		copy(hs.items[1:idx+1], hs.items[:idx])
+		hs.items[0] = item
+		return item, hs.saveItem(item)
+	}
+
+	item := &historyItem{
+		Id:      hs.nextId,
+		Time:    time.Now().Unix(),
+		Digest:  digest,
+		Targets: targets,
+	}
+	hs.nextId++
+	hs.items = append([]*historyItem{item}, hs.items...)
+	hs.trim()
+	return item, hs.saveItem(item)
+}
+
+func (hs *historyStore) get(id uint64) (*historyItem, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for _, item := range hs.items {
+		if item.Id == id {
+			return item, nil
+		}
+	}
+	return nil, errHistoryItemNotFound
+}
+
+func (hs *historyStore) delete(id uint64) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for idx, item := range hs.items {
+		if item.Id == id {
+			hs.items = append(hs.items[:idx], hs.items[idx+1:]...)
+			hs.removeItemFile(id)
+			return nil
+		}
+	}
+	return errHistoryItemNotFound
+}
+
+func (hs *historyStore) clear() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.items = nil
+	err := emptyDir(hs.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// list 返回历史摘要，keyword 不为空时只返回文本预览或 target 中包含 keyword 的历史项，忽略大小写。
+func (hs *historyStore) list(keyword string) []*historyItemInfo {
+	keyword = strings.ToLower(keyword)
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	result := make([]*historyItemInfo, 0, len(hs.items))
+	for _, item := range hs.items {
+		info := item.info()
+		if keyword != "" && !info.match(keyword) {
+			continue
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+func (hs *historyStore) listJSON(keyword string) (string, error) {
+	data, err := json.Marshal(hs.list(keyword))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (hs *historyStore) getJSON(id uint64) (string, error) {
+	item, err := hs.get(id)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (info *historyItemInfo) match(keyword string) bool {
+	if strings.Contains(strings.ToLower(info.Preview), keyword) {
+		return true
+	}
+	for _, target := range info.Targets {
+		if strings.Contains(strings.ToLower(target), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func getHistoryDigest(targets []*historyTarget) string {
+	var buf []byte
+	for _, t := range targets {
+		buf = append(buf, fmt.Sprintf("%s|%s|%d|%d|", t.Target, t.Type, t.Format, len(t.Data))...)
+		buf = append(buf, getBytesMd5sum(t.Data)...)
+	}
+	return getBytesMd5sum(buf)
+}
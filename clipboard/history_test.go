@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/linuxdeepin/dde-daemon/clipboard/mocks"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTextHistoryTargets(text string) []*historyTarget {
+	return []*historyTarget{
+		{
+			Target: "UTF8_STRING",
+			Type:   "UTF8_STRING",
+			Format: 8,
+			Data:   []byte(text),
+		},
+	}
+}
+
+func TestHistoryStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dde-daemon-clipboard-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hs := newHistoryStore(dir)
+	hs.maxItems = 2
+
+	item1, err := hs.add(newTextHistoryTargets("hello"))
+	require.NoError(t, err)
+	item2, err := hs.add(newTextHistoryTargets("world"))
+	require.NoError(t, err)
+	assert.NotEqual(t, item1.Id, item2.Id)
+
+	// 相同内容只置顶，不新增
+	item, err := hs.add(newTextHistoryTargets("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, item1.Id, item.Id)
+	list := hs.list("")
+	require.Len(t, list, 2)
+	assert.Equal(t, item1.Id, list[0].Id)
+	assert.Equal(t, "hello", list[0].Preview)
+
+	list = hs.list("WOR")
+	require.Len(t, list, 1)
+	assert.Equal(t, item2.Id, list[0].Id)
+
+	// 超出数量限制时删除最旧的
+	item3, err := hs.add(newTextHistoryTargets("foo"))
+	require.NoError(t, err)
+	_, err = hs.get(item2.Id)
+	assert.Equal(t, errHistoryItemNotFound, err)
+
+	// 从磁盘重新加载
+	hs1 := newHistoryStore(dir)
+	err = hs1.load()
+	require.NoError(t, err)
+	list = hs1.list("")
+	require.Len(t, list, 2)
+	assert.Equal(t, item3.Id, list[0].Id)
+	assert.Equal(t, item1.Id, list[1].Id)
+	assert.Equal(t, item3.Id+1, hs1.nextId)
+
+	err = hs1.delete(item3.Id)
+	assert.NoError(t, err)
+	err = hs1.delete(item3.Id)
+	assert.Equal(t, errHistoryItemNotFound, err)
+
+	err = hs1.clear()
+	assert.NoError(t, err)
+	assert.Empty(t, hs1.list(""))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestHistoryStore_loadOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dde-daemon-clipboard-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hs := newHistoryStore(dir)
+	item1, err := hs.add(newTextHistoryTargets("hello"))
+	require.NoError(t, err)
+	item2, err := hs.add(newTextHistoryTargets("world"))
+	require.NoError(t, err)
+
+	// 旧的历史项被重新复制后置顶，重新加载后仍应排在最前面
+	item1.Time = item2.Time + 10
+	require.NoError(t, hs.saveItem(item1))
+
+	hs1 := newHistoryStore(dir)
+	require.NoError(t, hs1.load())
+	list := hs1.list("")
+	require.Len(t, list, 2)
+	assert.Equal(t, item1.Id, list[0].Id)
+	assert.Equal(t, item2.Id, list[1].Id)
+}
+
+func Test_isHistoryTarget(t *testing.T) {
+	assert.True(t, isHistoryTarget("UTF8_STRING"))
+	assert.True(t, isHistoryTarget("text/plain;charset=utf-8"))
+	assert.True(t, isHistoryTarget("text/uri-list"))
+	assert.True(t, isHistoryTarget("image/png"))
+	assert.False(t, isHistoryTarget("text/html"))
+	assert.False(t, isHistoryTarget("application/x-qt-image"))
+}
+
+func TestManager_recordHistory(t *testing.T) {
+	initAtomsForTest()
+	dir, err := ioutil.TempDir("", "dde-daemon-clipboard-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	xc := &mocks.XClient{}
+	m := &Manager{
+		xc:      xc,
+		history: newHistoryStore(dir),
+	}
+
+	const (
+		atomUtf8 = x.Atom(200)
+		atomHtml = x.Atom(201)
+		atomHint = x.Atom(202)
+	)
+	xc.On("GetAtomName", atomUtf8).Return("UTF8_STRING", nil)
+	xc.On("GetAtomName", atomHtml).Return("text/html", nil)
+	xc.On("GetAtomName", atomHint).Return("x-kde-passwordManagerHint", nil)
+
+	m.recordHistory(map[x.Atom]*TargetData{
+		atomUtf8: {Target: atomUtf8, Type: atomUtf8, Format: 8, Data: []byte("abc")},
+		atomHtml: {Target: atomHtml, Type: atomHtml, Format: 8, Data: []byte("<b>abc</b>")},
+	})
+	list := m.history.list("")
+	require.Len(t, list, 1)
+	assert.Equal(t, []string{"UTF8_STRING"}, list[0].Targets)
+
+	// 敏感数据不记录
+	m.recordHistory(map[x.Atom]*TargetData{
+		atomUtf8: {Target: atomUtf8, Type: atomUtf8, Format: 8, Data: []byte("secret")},
+		atomHint: {Target: atomHint, Type: atomUtf8, Format: 8, Data: []byte("secret")},
+	})
+	assert.Len(t, m.history.list(""), 1)
+
+	// 超出大小限制的 target 不记录
+	m.history.maxTargetSize = 2
+	m.recordHistory(map[x.Atom]*TargetData{
+		atomUtf8: {Target: atomUtf8, Type: atomUtf8, Format: 8, Data: []byte("def")},
+	})
+	assert.Len(t, m.history.list(""), 1)
+}
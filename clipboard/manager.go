@@ -12,16 +12,19 @@ import (
 	"sync"
 	"time"
 
+	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/log"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/xfixes"
 )
 
-//go:generate dbusutil-gen em -type Manager
+//go:generate dbusutil-gen em -type Manager,WlManager
 
 var (
 	atomClipboardManager     x.Atom
 	atomClipboard            x.Atom
+	atomPrimary              x.Atom
+	atomPrimaryProp          x.Atom
 	atomSaveTargets          x.Atom
 	atomTargets              x.Atom
 	atomMultiple             x.Atom
@@ -41,6 +44,8 @@ var (
 func initAtoms(xConn *x.Conn) {
 	atomClipboardManager, _ = xConn.GetAtom("CLIPBOARD_MANAGER")
 	atomClipboard, _ = xConn.GetAtom("CLIPBOARD")
+	atomPrimary, _ = xConn.GetAtom("PRIMARY")
+	atomPrimaryProp, _ = xConn.GetAtom("_DEEPIN_PRIMARY_PROP")
 	atomSaveTargets, _ = xConn.GetAtom("SAVE_TARGETS")
 	atomTargets, _ = xConn.GetAtom("TARGETS")
 	atomMultiple, _ = xConn.GetAtom("MULTIPLE")
@@ -76,20 +81,34 @@ type Manager struct {
 	clipboardManagerLostTs    x.Timestamp // 丢失 CLIPBOARD_MANAGER selection 的时间戳
 	clipboardAcquireTs        x.Timestamp // 获取 CLIPBOARD selection 的时间戳
 	clipboardLostTs           x.Timestamp // 丢失 CLIPBOARD selection 的时间戳
+	primaryAcquireTs          x.Timestamp // 获取 PRIMARY selection 的时间戳
+	primaryLostTs             x.Timestamp // 丢失 PRIMARY selection 的时间戳
 
 	contentMu sync.Mutex
 	content   []*TargetData
 
+	primaryContentMu sync.Mutex
+	primaryContent   []*TargetData
+	primaryUpdateMu  sync.Mutex
+	primaryTimer     *time.Timer
+	primaryLatestTs  x.Timestamp // 最近一次 PRIMARY selection 所有者变化的时间戳，由 primaryUpdateMu 保护
+	// 保证同一时间只有一个 handlePrimaryUpdated 在运行，它们使用同一个属性转换数据
+	primarySaveMu sync.Mutex
+
 	saveTargetsMu          sync.Mutex
 	saveTargetsSuccessTime time.Time
 	saveTargetsRequestor   x.Window
-}
 
-func (m *Manager) getTargetData(target x.Atom) *TargetData {
-	m.contentMu.Lock()
-	defer m.contentMu.Unlock()
+	history *historyStore
+	config  *config
+
+	service        *dbusutil.Service
+	PropsMu        sync.RWMutex
+	SkippedTargets uint64 // 因为内容策略没有保存的 target 的数量
+}
 
-	for _, td := range m.content {
+func findTargetData(content []*TargetData, target x.Atom) *TargetData {
+	for _, td := range content {
 		if td.Target == target {
 			return td
 		}
@@ -97,6 +116,18 @@ func (m *Manager) getTargetData(target x.Atom) *TargetData {
 	return nil
 }
 
+// 获取 selection 对应的剪贴板数据，只支持 CLIPBOARD 和 PRIMARY
+func (m *Manager) getContent(selection x.Atom) []*TargetData {
+	if selection == atomPrimary {
+		m.primaryContentMu.Lock()
+		defer m.primaryContentMu.Unlock()
+		return m.primaryContent
+	}
+	m.contentMu.Lock()
+	defer m.contentMu.Unlock()
+	return m.content
+}
+
 func (m *Manager) setContent(targetDataMap map[x.Atom]*TargetData) {
 	// 给剪贴板数据带上特殊标记，为了让前端 dde-clipboard 知道是本程序给出的剪贴板数据
 	targetDataMap[atomFromClipboardManager] = &TargetData{
@@ -152,6 +183,15 @@ func (m *Manager) start() error {
 		logger.Warning(err)
 	}
 
+	// 是否管理 PRIMARY selection 由配置决定，但总是监听它的变化，以便配置可以随时生效。
+	err = m.xc.SelectSelectionInputE(m.window, atomPrimary,
+		xfixes.SelectionEventMaskSetSelectionOwner|
+			xfixes.SelectionEventMaskSelectionClientClose|
+			xfixes.SelectionEventMaskSelectionWindowDestroy)
+	if err != nil {
+		logger.Warning(err)
+	}
+
 	m.ec = newEventCaptor()
 	eventChan := make(chan x.GenericEvent, 50)
 	m.xc.Conn().AddEventChan(eventChan)
@@ -193,6 +233,8 @@ func (m *Manager) handleEvent(ev x.GenericEvent) {
 			go m.convertClipboardManager(event)
 		} else if event.Selection == atomClipboard {
 			go m.convertClipboard(event)
+		} else if event.Selection == atomPrimary {
+			go m.convertPrimary(event)
 		}
 
 	case x.PropertyNotifyEventCode:
@@ -253,12 +295,14 @@ func (m *Manager) handleEvent(ev x.GenericEvent) {
 							logger.Debug("do not call handleClipboardUpdated")
 							return
 						}
-						err := m.handleClipboardUpdated(event.SelectionTimestamp)
+						err := m.handleClipboardUpdated(event.Owner, event.SelectionTimestamp)
 						if err != nil {
 							logger.Warning("handle clipboard updated err:", err)
 						}
 					})
 				}
+			} else if event.Selection == atomPrimary {
+				m.handlePrimaryOwnerChanged(event)
 			} else if event.Selection == atomClipboardManager {
 				if event.Owner == m.window {
 					logger.Debug("i have become the owner of CLIPBOARD_MANAGER selection, ts:", event.SelectionTimestamp)
@@ -277,13 +321,15 @@ func (m *Manager) handleEvent(ev x.GenericEvent) {
 				if err != nil {
 					logger.Warning(err)
 				}
+			} else if event.Selection == atomPrimary {
+				m.handlePrimaryOwnerGone(event.Timestamp)
 			}
 		}
 	}
 }
 
 // 处理剪贴板数据更新
-func (m *Manager) handleClipboardUpdated(ts x.Timestamp) error {
+func (m *Manager) handleClipboardUpdated(owner x.Window, ts x.Timestamp) error {
 	logger.Debug("handleClipboardUpdated", ts)
 
 	targets, err := m.getClipboardTargets(ts)
@@ -291,8 +337,10 @@ func (m *Manager) handleClipboardUpdated(ts x.Timestamp) error {
 		return err
 	}
 	logger.Debug("targets:", targets)
-	targetDataMap := m.saveTargets(targets, ts)
+	targetDataMap := m.saveTargets(owner, targets, ts)
 	m.setContent(targetDataMap)
+	m.recordHistory(targetDataMap)
+	m.syncClipboardToPrimary(targetDataMap)
 
 	logger.Debug("handleClipboardUpdated finish", ts)
 	return nil
@@ -321,13 +369,19 @@ func (m *Manager) becomeClipboardOwner(ts x.Timestamp) error {
 
 // 转换 CLIPBOARD selection 的 TARGETS target，剪贴板获取支持的所有 targets。
 func (m *Manager) getClipboardTargets(ts x.Timestamp) ([]x.Atom, error) {
+	return m.getSelectionTargets(atomClipboard, ts)
+}
+
+// 获取 selection 的所有 targets
+func (m *Manager) getSelectionTargets(selection x.Atom, ts x.Timestamp) ([]x.Atom, error) {
+	prop := getConvertProperty(selection, atomTargets)
 	selNotifyEvent, err := m.ec.captureSelectionNotifyEvent(func() error {
-		m.xc.ConvertSelection(m.window, atomClipboard,
-			atomTargets, atomTargets, ts)
+		m.xc.ConvertSelection(m.window, selection,
+			atomTargets, prop, ts)
 		return m.xc.Flush()
 	}, func(event *x.SelectionNotifyEvent) bool {
 		return event.Target == atomTargets &&
-			event.Selection == atomClipboard &&
+			event.Selection == selection &&
 			event.Requestor == m.window
 	})
 	if err != nil {
@@ -335,7 +389,7 @@ func (m *Manager) getClipboardTargets(ts x.Timestamp) ([]x.Atom, error) {
 	}
 
 	if selNotifyEvent.Property == x.None {
-		return nil, errors.New("failed to convert clipboard targets")
+		return nil, fmt.Errorf("failed to convert %s targets", getAtomDesc(m.xc.Conn(), selection))
 	}
 
 	propReply, err := m.getProperty(m.window, selNotifyEvent.Property, true)
@@ -459,8 +513,9 @@ func (m *Manager) covertClipboardManagerSaveTargets(ev *x.SelectionRequestEvent)
 		}
 	}
 
-	targetDataMap := m.saveTargets(targets, ev.Time)
+	targetDataMap := m.saveTargets(ev.Requestor, targets, ev.Time)
 	m.setContent(targetDataMap)
+	m.recordHistory(targetDataMap)
 
 	m.saveTargetsRequestor = ev.Requestor
 	m.saveTargetsSuccessTime = time.Now()
@@ -469,10 +524,16 @@ func (m *Manager) covertClipboardManagerSaveTargets(ev *x.SelectionRequestEvent)
 
 // 处理 CLIPBOARD selection 的转换请求
 func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
+	m.convertSelectionContent(ev, m.clipboardAcquireTs, m.clipboardLostTs, m.getContent(atomClipboard))
+}
+
+// 用保存的数据 content 处理 selection 的转换请求
+func (m *Manager) convertSelectionContent(ev *x.SelectionRequestEvent, acquireTs, lostTs x.Timestamp,
+	content []*TargetData) {
 	targetName, _ := m.xc.GetAtomName(ev.Target)
-	logger.Debugf("convert clipboard target %s|%d", targetName, ev.Target)
+	logger.Debugf("convert %s target %s|%d", getAtomDesc(m.xc.Conn(), ev.Selection), targetName, ev.Target)
 
-	if !canConvertSelection(m.clipboardAcquireTs, m.clipboardLostTs, ev.Time) {
+	if !canConvertSelection(acquireTs, lostTs, ev.Time) {
 		logger.Debug("can not covert selection, ts invalid")
 		m.finishSelectionRequest(ev, false)
 		return
@@ -484,11 +545,9 @@ func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 		w := x.NewWriter()
 		w.Write4b(uint32(atomTargets))
 		w.Write4b(uint32(atomTimestamp))
-		m.contentMu.Lock()
-		for _, targetData := range m.content {
+		for _, targetData := range content {
 			w.Write4b(uint32(targetData.Target))
 		}
-		m.contentMu.Unlock()
 
 		err := m.xc.ChangePropertyE(x.PropModeReplace, ev.Requestor,
 			ev.Property, x.AtomAtom, 32, w.Bytes())
@@ -499,7 +558,7 @@ func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 	case atomTimestamp:
 		// TIMESTAMP
 		w := x.NewWriter()
-		w.Write4b(uint32(m.clipboardAcquireTs))
+		w.Write4b(uint32(acquireTs))
 		err := m.xc.ChangePropertyE(x.PropModeReplace, ev.Requestor,
 			ev.Property, x.AtomInteger, 32, w.Bytes())
 		if err != nil {
@@ -508,7 +567,7 @@ func (m *Manager) convertClipboard(ev *x.SelectionRequestEvent) {
 		m.finishSelectionRequest(ev, err == nil)
 		// TODO 支持 MULTIPLE target
 	default:
-		targetData := m.getTargetData(ev.Target)
+		targetData := findTargetData(content, ev.Target)
 		if targetData == nil {
 			m.finishSelectionRequest(ev, false)
 			return
@@ -639,9 +698,24 @@ func (m *Manager) finishSelectionRequest(ev *x.SelectionRequestEvent, success bo
 	}
 }
 
-func (m *Manager) saveTargets(targets []x.Atom, ts x.Timestamp) map[x.Atom]*TargetData {
+func (m *Manager) saveTargets(owner x.Window, targets []x.Atom, ts x.Timestamp) map[x.Atom]*TargetData {
+	return m.saveSelectionTargets(atomClipboard, owner, targets, ts)
+}
+
+// 按照剪贴板内容策略保存 selection 的数据，owner 是 selection 的所有者窗口，为 0 表示未知。
+func (m *Manager) saveSelectionTargets(selection x.Atom, owner x.Window, targets []x.Atom,
+	ts x.Timestamp) map[x.Atom]*TargetData {
 	result := make(map[x.Atom]*TargetData, len(targets))
+	policy := m.config.getPolicy()
+
+	if m.isOwnerExcluded(policy, owner) {
+		logger.Debug("owner is excluded, do not save targets, owner:", owner)
+		m.addSkippedTargets(len(targets))
+		return result
+	}
 
+	var total int64
+	var skipped int
 	for _, target := range targets {
 		targetName, err := m.xc.GetAtomName(target)
 		if err != nil {
@@ -653,15 +727,26 @@ func (m *Manager) saveTargets(targets []x.Atom, ts x.Timestamp) map[x.Atom]*Targ
 			continue
 		}
 
+		if !policy.isTargetAllowed(targetName) {
+			logger.Debugf("skip target %s|%d, not allowed by policy", targetName, target)
+			skipped++
+			continue
+		}
+
 		logger.Debugf("save target %s|%d", targetName, target)
-		td, err := m.saveTarget(target, ts)
-		if err != nil {
+		td, err := m.saveSelectionTarget(selection, target, ts, policy.remainingSize(total))
+		if err == errTargetTooLarge {
+			logger.Debugf("skip target %s|%d, too large", targetName, target)
+			skipped++
+		} else if err != nil {
 			logger.Warningf("save target failed %s|%d, err: %v", targetName, target, err)
 		} else {
 			result[td.Target] = td
+			total += int64(len(td.Data))
 			logger.Debugf("save target success %s|%d", targetName, target)
 		}
 	}
+	m.addSkippedTargets(skipped)
 	return result
 }
 
@@ -673,6 +758,11 @@ func shouldIgnoreSaveTarget(target x.Atom, targetName string) bool {
 		x.AtomPixmap:
 		return true
 	}
+	return shouldIgnoreTargetName(targetName)
+}
+
+// 根据 target 名称判断是否忽略，X11 和 Wayland 共用
+func shouldIgnoreTargetName(targetName string) bool {
 	if strings.HasPrefix(targetName, "image/") {
 		switch targetName {
 		case "image/jpeg", "image/png", "image/bmp":
@@ -684,12 +774,24 @@ func shouldIgnoreSaveTarget(target x.Atom, targetName string) bool {
 	return false
 }
 
-func (m *Manager) saveTarget(target x.Atom, ts x.Timestamp) (targetData *TargetData, err error) {
+// 转换 selection 时用于接收数据的属性，CLIPBOARD 使用 target 本身，
+// PRIMARY 使用单独的属性，避免与 CLIPBOARD 的同名 target 转换冲突。
+func getConvertProperty(selection, target x.Atom) x.Atom {
+	if selection == atomPrimary {
+		return atomPrimaryProp
+	}
+	return target
+}
+
+// 保存 selection 的一个 target 的数据，数据超过 maxSize 字节时返回 errTargetTooLarge，maxSize 为 noSizeLimit 时不限制。
+func (m *Manager) saveSelectionTarget(selection, target x.Atom, ts x.Timestamp,
+	maxSize int64) (targetData *TargetData, err error) {
+	prop := getConvertProperty(selection, target)
 	selNotifyEvent, err := m.ec.captureSelectionNotifyEvent(func() error {
-		m.xc.ConvertSelection(m.window, atomClipboard, target, target, ts)
+		m.xc.ConvertSelection(m.window, selection, target, prop, ts)
 		return m.xc.Flush()
 	}, func(event *x.SelectionNotifyEvent) bool {
-		return event.Selection == atomClipboard &&
+		return event.Selection == selection &&
 			event.Requestor == m.window &&
 			event.Target == target
 	})
@@ -707,13 +809,27 @@ func (m *Manager) saveTarget(target x.Atom, ts x.Timestamp) (targetData *TargetD
 	}
 
 	if propReply.Type == atomIncr {
-		targetData, err = m.receiveTargetIncr(target, selNotifyEvent.Property)
+		// INCR 属性的值是数据大小的下限，超过限制时不接收数据。
+		// 所有者在等待属性被删除，仍然要删除属性，否则它会一直停在传输开始前，属性也不会被清理。
+		if len(propReply.Value) >= 4 && isSizeExceeded(int64(x.Get32(propReply.Value)), maxSize) {
+			err = m.xc.DeletePropertyE(m.window, selNotifyEvent.Property)
+			if err != nil {
+				return
+			}
+			err = errTargetTooLarge
+			return
+		}
+		targetData, err = m.receiveTargetIncr(target, selNotifyEvent.Property, maxSize)
 	} else {
 		err = m.xc.DeletePropertyE(m.window, selNotifyEvent.Property)
 		if err != nil {
 			return
 		}
 		logger.Debug("data len:", len(propReply.Value))
+		if isSizeExceeded(int64(len(propReply.Value)), maxSize) {
+			err = errTargetTooLarge
+			return
+		}
 		targetData = &TargetData{
 			Target: target,
 			Type:   propReply.Type,
@@ -742,11 +858,13 @@ func (m *Manager) getProperty(win x.Window, propertyAtom x.Atom, delete bool) (*
 	return propReply, nil
 }
 
-func (m *Manager) receiveTargetIncr(target, prop x.Atom) (targetData *TargetData, err error) {
+// 通过 INCR 机制接收数据，数据超过 maxSize 字节后继续完成传输，但是丢弃数据，最后返回 errTargetTooLarge。
+func (m *Manager) receiveTargetIncr(target, prop x.Atom, maxSize int64) (targetData *TargetData, err error) {
 	logger.Debug("start receiveTargetIncr", target)
 	var data [][]byte
 	t0 := time.Now()
 	total := 0
+	tooLarge := false
 	for {
 		var propNotifyEvent *x.PropertyNotifyEvent
 		propNotifyEvent, err = m.ec.capturePropertyNotifyEvent(func() error {
@@ -791,6 +909,10 @@ func (m *Manager) receiveTargetIncr(target, prop x.Atom) (targetData *TargetData
 				logger.Warning(err)
 				return
 			}
+			if tooLarge {
+				err = errTargetTooLarge
+				return
+			}
 
 			targetData = &TargetData{
 				Target: target,
@@ -804,7 +926,13 @@ func (m *Manager) receiveTargetIncr(target, prop x.Atom) (targetData *TargetData
 			logger.Debugf("incr receive data size: %d", len(propReply.Value))
 		}
 		total += len(propReply.Value)
-		data = append(data, propReply.Value)
+		if isSizeExceeded(int64(total), maxSize) {
+			tooLarge = true
+			data = nil
+		}
+		if !tooLarge {
+			data = append(data, propReply.Value)
+		}
 	}
 }
 
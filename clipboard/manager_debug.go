@@ -17,6 +17,8 @@ import (
 	x "github.com/linuxdeepin/go-x11-client"
 )
 
+const contentDumpDir = "/tmp/dde-session-daemon-clipboard"
+
 func (m *Manager) saveClipboard() error {
 	owner, err := m.xc.GetSelectionOwner(atomClipboard)
 	if err != nil {
@@ -36,7 +38,7 @@ func (m *Manager) saveClipboard() error {
 	}
 	logger.Debug("targets:", targets)
 
-	targetDataMap := m.saveTargets(targets, ts)
+	targetDataMap := m.saveTargets(owner, targets, ts)
 	m.setContent(targetDataMap)
 	m.contentMu.Lock()
 	for _, targetData := range m.content {
@@ -52,9 +54,15 @@ func (m *Manager) SaveClipboard() *dbus.Error {
 	return dbusutil.ToError(err)
 }
 
-func (m *Manager) writeContent() error {
-	dir := "/tmp/dde-session-daemon-clipboard"
+// 导出剪贴板数据时的一项，id 是 target 的编号，X11 中是 atom 的值
+type contentDumpEntry struct {
+	id   uint32
+	name string
+	data []byte
+}
 
+// 把剪贴板数据导出到目录 dir 中，用于调试
+func writeContentToDir(dir string, entries []contentDumpEntry) error {
 	err := os.Mkdir(dir, 0700)
 	if err != nil {
 		if !os.IsExist(err) {
@@ -67,23 +75,17 @@ func (m *Manager) writeContent() error {
 	}
 
 	var buf bytes.Buffer
-	m.contentMu.Lock()
-	for _, targetData := range m.content {
-		target := targetData.Target
-		targetName, _ := m.xc.GetAtomName(target)
-		_, err = fmt.Fprintf(&buf, "%d,%s\n", target, targetName)
+	for _, entry := range entries {
+		_, err = fmt.Fprintf(&buf, "%d,%s\n", entry.id, entry.name)
 		if err != nil {
-			m.contentMu.Unlock()
 			return err
 		}
 
-		err = ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(int(target))), targetData.Data, 0644)
+		err = ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(int(entry.id))), entry.data, 0644)
 		if err != nil {
-			m.contentMu.Unlock()
 			return err
 		}
 	}
-	m.contentMu.Unlock()
 	err = ioutil.WriteFile(filepath.Join(dir, "index.txt"), buf.Bytes(), 0600)
 	if err != nil {
 		return err
@@ -92,6 +94,23 @@ func (m *Manager) writeContent() error {
 	return nil
 }
 
+func (m *Manager) writeContent() error {
+	var entries []contentDumpEntry
+	m.contentMu.Lock()
+	for _, targetData := range m.content {
+		target := targetData.Target
+		targetName, _ := m.xc.GetAtomName(target)
+		entries = append(entries, contentDumpEntry{
+			id:   uint32(target),
+			name: targetName,
+			data: targetData.Data,
+		})
+	}
+	m.contentMu.Unlock()
+
+	return writeContentToDir(contentDumpDir, entries)
+}
+
 func (m *Manager) WriteContent() *dbus.Error {
 	err := m.writeContent()
 	return dbusutil.ToError(err)
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	x "github.com/linuxdeepin/go-x11-client"
+)
+
+var errHistoryDisabled = errors.New("clipboard history is disabled")
+
+// 把剪贴板数据转换为历史项中保存的 target 数据，过滤掉不需要记录的 target。
+// 返回值 sensitive 为 true 表示这是敏感数据，不应该被记录。
+func (m *Manager) getHistoryTargets(targetDataMap map[x.Atom]*TargetData) (targets []*historyTarget, sensitive bool) {
+	names := make(map[x.Atom]string, len(targetDataMap))
+	nameList := make([]string, 0, len(targetDataMap))
+	for atom := range targetDataMap {
+		name, err := m.xc.GetAtomName(atom)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		names[atom] = name
+		nameList = append(nameList, name)
+	}
+	if isSensitiveTargets(nameList) {
+		return nil, true
+	}
+
+	for atom, td := range targetDataMap {
+		name, ok := names[atom]
+		if !ok || atom == atomFromClipboardManager || !isHistoryTarget(name) {
+			continue
+		}
+		if len(td.Data) == 0 {
+			continue
+		}
+		if len(td.Data) > m.history.maxTargetSize {
+			logger.Debugf("target %s too large for history, len: %d", name, len(td.Data))
+			continue
+		}
+		typeName, err := m.xc.GetAtomName(td.Type)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		targets = append(targets, &historyTarget{
+			Target: name,
+			Type:   typeName,
+			Format: td.Format,
+			Data:   td.Data,
+		})
+	}
+	return targets, false
+}
+
+// 记录剪贴板历史
+func (m *Manager) recordHistory(targetDataMap map[x.Atom]*TargetData) {
+	if m.history == nil {
+		return
+	}
+
+	targets, sensitive := m.getHistoryTargets(targetDataMap)
+	if sensitive {
+		logger.Debug("clipboard content is sensitive, do not record history")
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	item, err := m.history.add(targets)
+	if err != nil {
+		logger.Warning("failed to add history item:", err)
+		return
+	}
+	logger.Debug("record clipboard history item", item.Id)
+}
+
+// 把历史项恢复为剪贴板内容，并获取 CLIPBOARD selection
+func (m *Manager) restoreHistory(item *historyItem) error {
+	targetDataMap := make(map[x.Atom]*TargetData, len(item.Targets))
+	for _, t := range item.Targets {
+		target, err := m.xc.GetAtom(t.Target)
+		if err != nil {
+			return err
+		}
+		type0, err := m.xc.GetAtom(t.Type)
+		if err != nil {
+			return err
+		}
+		targetDataMap[target] = &TargetData{
+			Target: target,
+			Type:   type0,
+			Format: t.Format,
+			Data:   t.Data,
+		}
+	}
+	m.setContent(targetDataMap)
+
+	ts, err := m.getTimestamp()
+	if err != nil {
+		return err
+	}
+	return m.becomeClipboardOwner(ts)
+}
+
+func (m *Manager) ListHistory() (historyJSON string, busErr *dbus.Error) {
+	return listHistory(m.history, "")
+}
+
+func (m *Manager) SearchHistory(keyword string) (historyJSON string, busErr *dbus.Error) {
+	return listHistory(m.history, keyword)
+}
+
+func (m *Manager) GetHistoryItem(id uint64) (itemJSON string, busErr *dbus.Error) {
+	return getHistoryItem(m.history, id)
+}
+
+func (m *Manager) RestoreHistoryItem(id uint64) *dbus.Error {
+	return restoreHistoryItem(m.history, id, m.restoreHistory)
+}
+
+func (m *Manager) DeleteHistoryItem(id uint64) *dbus.Error {
+	return deleteHistoryItem(m.history, id)
+}
+
+func (m *Manager) ClearHistory() *dbus.Error {
+	return clearHistory(m.history)
+}
+
+// 以下为 Manager 和 WlManager 共用的历史记录 DBus 方法实现，hs 为 nil 表示历史记录未启用
+
+func listHistory(hs *historyStore, keyword string) (string, *dbus.Error) {
+	if hs == nil {
+		return "", dbusutil.ToError(errHistoryDisabled)
+	}
+	historyJSON, err := hs.listJSON(keyword)
+	return historyJSON, dbusutil.ToError(err)
+}
+
+func getHistoryItem(hs *historyStore, id uint64) (string, *dbus.Error) {
+	if hs == nil {
+		return "", dbusutil.ToError(errHistoryDisabled)
+	}
+	itemJSON, err := hs.getJSON(id)
+	return itemJSON, dbusutil.ToError(err)
+}
+
+// restore 负责把历史项设置为剪贴板内容，由 X11 和 Wayland 各自实现
+func restoreHistoryItem(hs *historyStore, id uint64, restore func(item *historyItem) error) *dbus.Error {
+	if hs == nil {
+		return dbusutil.ToError(errHistoryDisabled)
+	}
+	item, err := hs.get(id)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	return dbusutil.ToError(restore(item))
+}
+
+func deleteHistoryItem(hs *historyStore, id uint64) *dbus.Error {
+	if hs == nil {
+		return dbusutil.ToError(errHistoryDisabled)
+	}
+	return dbusutil.ToError(hs.delete(id))
+}
+
+func clearHistory(hs *historyStore) *dbus.Error {
+	if hs == nil {
+		return dbusutil.ToError(errHistoryDisabled)
+	}
+	return dbusutil.ToError(hs.clear())
+}
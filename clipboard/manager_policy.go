@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"github.com/linuxdeepin/go-lib/procfs"
+	x "github.com/linuxdeepin/go-x11-client"
+)
+
+// 判断 selection 的所有者是否在内容策略的排除列表中，通过所有者窗口的 PID 找到程序的可执行文件。
+func (m *Manager) isOwnerExcluded(policy *contentPolicy, owner x.Window) bool {
+	if owner == 0 || len(policy.ExcludedApps) == 0 {
+		return false
+	}
+	pid, err := m.xc.GetWindowPid(owner)
+	if err != nil {
+		logger.Debugf("failed to get pid of window %d: %v", owner, err)
+		return false
+	}
+	exe, err := procfs.Process(pid).Exe()
+	if err != nil {
+		logger.Debugf("failed to get exe of process %d: %v", pid, err)
+		return false
+	}
+	return policy.isAppExcluded(exe)
+}
+
+// 增加 SkippedTargets 属性的值
+func (m *Manager) addSkippedTargets(n int) {
+	if n <= 0 {
+		return
+	}
+	m.PropsMu.Lock()
+	defer m.PropsMu.Unlock()
+	if m.service == nil {
+		m.SkippedTargets += uint64(n)
+		return
+	}
+	m.setPropSkippedTargets(m.SkippedTargets + uint64(n))
+}
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+// Manager 和 WlManager 的 DBus 属性的 setter
+
+func (v *Manager) setPropSkippedTargets(value uint64) (changed bool) {
+	if v.SkippedTargets != value {
+		v.SkippedTargets = value
+		v.emitPropChangedSkippedTargets(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedSkippedTargets(value uint64) error {
+	return v.service.EmitPropertyChanged(v, "SkippedTargets", value)
+}
+
+func (v *WlManager) setPropSkippedTargets(value uint64) (changed bool) {
+	if v.SkippedTargets != value {
+		v.SkippedTargets = value
+		v.emitPropChangedSkippedTargets(value)
+		return true
+	}
+	return false
+}
+
+func (v *WlManager) emitPropChangedSkippedTargets(value uint64) error {
+	return v.service.EmitPropertyChanged(v, "SkippedTargets", value)
+}
@@ -212,6 +212,27 @@ func (_m *XClient) GetSelectionOwner(selection x.Atom) (x.Window, error) {
 	return r0, r1
 }
 
+// GetWindowPid provides a mock function with given fields: win
+func (_m *XClient) GetWindowPid(win x.Window) (uint, error) {
+	ret := _m.Called(win)
+
+	var r0 uint
+	if rf, ok := ret.Get(0).(func(x.Window) uint); ok {
+		r0 = rf(win)
+	} else {
+		r0 = ret.Get(0).(uint)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(x.Window) error); ok {
+		r1 = rf(win)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SelectSelectionInputE provides a mock function with given fields: window, selection, eventMask
 func (_m *XClient) SelectSelectionInputE(window x.Window, selection x.Atom, eventMask uint32) error {
 	ret := _m.Called(window, selection, eventMask)
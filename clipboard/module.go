@@ -5,7 +5,14 @@
 package clipboard
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/log"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/xfixes"
 	"github.com/linuxdeepin/dde-daemon/loader"
@@ -28,20 +35,78 @@ func newModule() *Module {
 
 type Module struct {
 	*loader.ModuleBase
+	sysSigLoop *dbusutil.SignalLoop
+	wc         WlClient
 }
 
 func (*Module) GetDependencies() []string {
 	return nil
 }
 
+func newHistoryStoreFromCache() *historyStore {
+	history := newHistoryStore(filepath.Join(basedir.GetUserCacheDir(), "deepin/dde-daemon/clipboard-history"))
+	err := history.load()
+	if err != nil {
+		logger.Warning("failed to load clipboard history:", err)
+	}
+	return history
+}
+
+func isWaylandSession() bool {
+	return strings.Contains(os.Getenv("XDG_SESSION_TYPE"), "wayland")
+}
+
 func (mo *Module) Start() error {
 	logger.Debug("clipboard module start")
 
-	xConn, err := x.NewConn()
+	service := loader.GetService()
+	var m dbusutil.Implementer
+	var err error
+	if isWaylandSession() {
+		m, err = mo.startWayland(service)
+	} else {
+		m, err = mo.startX(service)
+	}
 	if err != nil {
 		return err
 	}
 
+	err = service.Export("/com/deepin/daemon/ClipboardManager", m)
+	if err != nil {
+		return err
+	}
+
+	err = service.RequestName(dbusServiceName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 从 dconfig 读取配置，失败时使用默认配置
+func (mo *Module) initConfig() *config {
+	cfg := newConfig()
+	sysBus, err := dbus.SystemBus()
+	if err != nil {
+		logger.Warning(err)
+		return cfg
+	}
+	mo.sysSigLoop = dbusutil.NewSignalLoop(sysBus, 10)
+	mo.sysSigLoop.Start()
+	err = cfg.init(sysBus, mo.sysSigLoop)
+	if err != nil {
+		logger.Warning("failed to init clipboard config:", err)
+	}
+	return cfg
+}
+
+func (mo *Module) startX(service *dbusutil.Service) (*Manager, error) {
+	xConn, err := x.NewConn()
+	if err != nil {
+		return nil, err
+	}
+
 	initAtoms(xConn)
 
 	_, err = xfixes.QueryVersion(xConn, xfixes.MajorVersion, xfixes.MinorVersion).Reply(xConn)
@@ -49,30 +114,46 @@ func (mo *Module) Start() error {
 		logger.Warning(err)
 	}
 
-	m := &Manager{}
+	m := &Manager{
+		service: service,
+	}
 	m.xc = &xClient{
 		conn: xConn,
 	}
+	m.history = newHistoryStoreFromCache()
+	m.config = mo.initConfig()
 
 	err = m.start()
 	if err != nil {
-		return err
-	}
-
-	service := loader.GetService()
-	err = service.Export("/com/deepin/daemon/ClipboardManager", m)
-	if err != nil {
-		return err
+		return nil, err
 	}
+	return m, nil
+}
 
-	err = service.RequestName(dbusServiceName)
+func (mo *Module) startWayland(service *dbusutil.Service) (*WlManager, error) {
+	wc, err := newWlClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	mo.wc = wc
+
+	m := newWlManager(wc)
+	m.service = service
+	m.history = newHistoryStoreFromCache()
+	m.config = mo.initConfig()
+	m.start()
+	return m, nil
 }
 
-func (*Module) Stop() error {
+func (mo *Module) Stop() error {
+	if mo.sysSigLoop != nil {
+		mo.sysSigLoop.Stop()
+	}
+	if mo.wc != nil {
+		err := mo.wc.Close()
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
 	return nil
 }
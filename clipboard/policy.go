@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 不限制数据大小
+const noSizeLimit = -1
+
+const defaultMaxTotalSize = 64 * 1024 * 1024
+
+var errTargetTooLarge = errors.New("target data too large")
+
+// 默认不保存这些程序的剪贴板数据，一般是密码管理器
+var defaultExcludedApps = []string{
+	"keepassxc",
+	"keepass2",
+	"bitwarden",
+	"1password",
+	"enpass",
+}
+
+// contentPolicy 决定保存剪贴板数据时哪些 target 可以保存
+type contentPolicy struct {
+	MaxTotalSize   int64    // 一次保存的所有 target 数据的总大小上限，单位字节，小于等于 0 表示不限制
+	AllowMimeTypes []string // 不为空时只保存匹配的 target，支持通配符，比如 image/*
+	DenyMimeTypes  []string // 不保存匹配的 target，优先于 AllowMimeTypes
+	ExcludedApps   []string // 不保存这些程序的剪贴板数据，可以是可执行文件的名称或者完整路径
+}
+
+func newDefaultContentPolicy() *contentPolicy {
+	return &contentPolicy{
+		MaxTotalSize: defaultMaxTotalSize,
+		ExcludedApps: defaultExcludedApps,
+	}
+}
+
+func matchMimeType(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		ok, err := path.Match(strings.ToLower(pattern), name)
+		if err != nil {
+			logger.Warningf("bad mime type pattern %q: %v", pattern, err)
+			continue
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *contentPolicy) isTargetAllowed(name string) bool {
+	if matchMimeType(p.DenyMimeTypes, name) {
+		return false
+	}
+	if len(p.AllowMimeTypes) > 0 && !matchMimeType(p.AllowMimeTypes, name) {
+		return false
+	}
+	return true
+}
+
+// 已经保存了 total 字节的数据时，下一个 target 最多还能保存多少字节
+func (p *contentPolicy) remainingSize(total int64) int64 {
+	if p.MaxTotalSize <= 0 {
+		return noSizeLimit
+	}
+	remain := p.MaxTotalSize - total
+	if remain < 0 {
+		remain = 0
+	}
+	return remain
+}
+
+func (p *contentPolicy) isAppExcluded(exe string) bool {
+	if exe == "" {
+		return false
+	}
+	base := filepath.Base(exe)
+	for _, app := range p.ExcludedApps {
+		if app == exe || strings.EqualFold(app, base) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSizeExceeded(size, maxSize int64) bool {
+	return maxSize != noSizeLimit && size > maxSize
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/dde-daemon/clipboard/mocks"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_contentPolicy_isTargetAllowed(t *testing.T) {
+	p := &contentPolicy{}
+	assert.True(t, p.isTargetAllowed("image/png"))
+
+	p.DenyMimeTypes = []string{"image/*"}
+	assert.False(t, p.isTargetAllowed("image/png"))
+	assert.False(t, p.isTargetAllowed("IMAGE/PNG"))
+	assert.True(t, p.isTargetAllowed("text/plain"))
+
+	p.AllowMimeTypes = []string{"text/*", "image/png"}
+	assert.True(t, p.isTargetAllowed("text/plain"))
+	assert.False(t, p.isTargetAllowed("application/x-qt-image"))
+	// 禁止列表优先
+	assert.False(t, p.isTargetAllowed("image/png"))
+}
+
+func Test_contentPolicy_remainingSize(t *testing.T) {
+	p := &contentPolicy{MaxTotalSize: 100}
+	assert.EqualValues(t, 100, p.remainingSize(0))
+	assert.EqualValues(t, 40, p.remainingSize(60))
+	assert.EqualValues(t, 0, p.remainingSize(120))
+
+	p.MaxTotalSize = 0
+	assert.EqualValues(t, noSizeLimit, p.remainingSize(120))
+
+	assert.False(t, isSizeExceeded(100, 100))
+	assert.True(t, isSizeExceeded(101, 100))
+	assert.False(t, isSizeExceeded(1<<40, noSizeLimit))
+}
+
+func Test_contentPolicy_isAppExcluded(t *testing.T) {
+	p := newDefaultContentPolicy()
+	assert.True(t, p.isAppExcluded("/usr/bin/keepassxc"))
+	assert.True(t, p.isAppExcluded("/opt/apps/KeePassXC"))
+	assert.False(t, p.isAppExcluded("/usr/bin/deepin-editor"))
+	assert.False(t, p.isAppExcluded(""))
+
+	p.ExcludedApps = []string{"/opt/app/bin/secret"}
+	assert.True(t, p.isAppExcluded("/opt/app/bin/secret"))
+	assert.False(t, p.isAppExcluded("/usr/bin/secret"))
+}
+
+func TestManager_isOwnerExcluded(t *testing.T) {
+	xc := &mocks.XClient{}
+	m := &Manager{xc: xc}
+	owner := x.Window(1)
+
+	exe, err := os.Executable()
+	assert.NoError(t, err)
+	policy := &contentPolicy{ExcludedApps: []string{filepath.Base(exe)}}
+
+	xc.On("GetWindowPid", owner).Return(uint(os.Getpid()), nil).Once()
+	assert.True(t, m.isOwnerExcluded(policy, owner))
+
+	xc.On("GetWindowPid", owner).Return(uint(0), errors.New("no pid")).Once()
+	assert.False(t, m.isOwnerExcluded(policy, owner))
+
+	// 所有者未知
+	assert.False(t, m.isOwnerExcluded(policy, 0))
+	xc.AssertExpectations(t)
+
+	m.addSkippedTargets(2)
+	m.addSkippedTargets(0)
+	assert.EqualValues(t, 2, m.SkippedTargets)
+}
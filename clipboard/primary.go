@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/ext/xfixes"
+)
+
+// PRIMARY selection 在用户拖动选择文本的过程中会频繁变化，所有者变化后等待一段时间再保存数据，
+// 连续的多次变化只保存最后一次。
+const primarySaveDelay = 500 * time.Millisecond
+
+// 是否需要读取 PRIMARY selection 的数据
+func (m *Manager) shouldSavePrimary() bool {
+	return m.config.isManagePrimary() || m.config.isSyncPrimaryToClipboard()
+}
+
+func (m *Manager) setPrimaryContent(targetDataMap map[x.Atom]*TargetData) {
+	targetDataSlice := mapToSliceTargetData(targetDataMap)
+	m.primaryContentMu.Lock()
+	m.primaryContent = targetDataSlice
+	m.primaryContentMu.Unlock()
+}
+
+// 复制剪贴板数据，去掉本程序添加的特殊标记
+func copyTargetDataMap(targetDataMap map[x.Atom]*TargetData) map[x.Atom]*TargetData {
+	result := make(map[x.Atom]*TargetData, len(targetDataMap))
+	for target, td := range targetDataMap {
+		if target == atomFromClipboardManager {
+			continue
+		}
+		result[target] = td
+	}
+	return result
+}
+
+func (m *Manager) handlePrimaryOwnerChanged(event *xfixes.SelectionNotifyEvent) {
+	if event.Owner == m.window {
+		logger.Debug("i have become the owner of PRIMARY selection, ts:", event.SelectionTimestamp)
+		m.primaryAcquireTs = event.SelectionTimestamp
+		m.primaryLostTs = 0
+		return
+	}
+
+	logger.Debug("other app have become the owner of PRIMARY selection, ts:", event.SelectionTimestamp)
+	if event.SelectionTimestamp >= m.primaryAcquireTs {
+		m.primaryLostTs = event.SelectionTimestamp
+	}
+	if event.Owner == x.None || !m.shouldSavePrimary() {
+		return
+	}
+
+	owner := event.Owner
+	ts := event.SelectionTimestamp
+	m.primaryUpdateMu.Lock()
+	if ts > m.primaryLatestTs {
+		m.primaryLatestTs = ts
+	}
+	if m.primaryTimer != nil {
+		// 已经开始执行的回调不会被停止，由 isPrimaryUpdateStale 丢弃它的结果
+		m.primaryTimer.Stop()
+	}
+	m.primaryTimer = time.AfterFunc(primarySaveDelay, func() {
+		m.primarySaveMu.Lock()
+		defer m.primarySaveMu.Unlock()
+		if m.isPrimaryUpdateStale(ts) {
+			logger.Debug("skip stale primary update", ts)
+			return
+		}
+		err := m.handlePrimaryUpdated(owner, ts)
+		if err != nil {
+			logger.Warning("handle primary updated err:", err)
+		}
+	})
+	m.primaryUpdateMu.Unlock()
+}
+
+// 时间戳为 ts 的更新之后 PRIMARY selection 的所有者又变化了
+func (m *Manager) isPrimaryUpdateStale(ts x.Timestamp) bool {
+	m.primaryUpdateMu.Lock()
+	defer m.primaryUpdateMu.Unlock()
+	return ts < m.primaryLatestTs
+}
+
+// 处理 PRIMARY selection 数据更新，调用者需要持有 m.primarySaveMu 锁
+func (m *Manager) handlePrimaryUpdated(owner x.Window, ts x.Timestamp) error {
+	logger.Debug("handlePrimaryUpdated", ts)
+
+	targets, err := m.getSelectionTargets(atomPrimary, ts)
+	if err != nil {
+		return err
+	}
+	logger.Debug("primary targets:", targets)
+	targetDataMap := m.saveSelectionTargets(atomPrimary, owner, targets, ts)
+	if len(targetDataMap) == 0 {
+		return nil
+	}
+	if m.isPrimaryUpdateStale(ts) {
+		logger.Debug("discard stale primary data", ts)
+		return nil
+	}
+
+	if m.config.isManagePrimary() {
+		m.setPrimaryContent(targetDataMap)
+	}
+
+	if m.config.isSyncPrimaryToClipboard() {
+		// setContent 会修改传入的 map，所以需要复制一份
+		m.setContent(copyTargetDataMap(targetDataMap))
+		now, err := m.getTimestamp()
+		if err != nil {
+			return err
+		}
+		err = m.becomeClipboardOwner(now)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Debug("handlePrimaryUpdated finish", ts)
+	return nil
+}
+
+// PRIMARY selection 的所有者退出后，如果有保存的数据则成为新的所有者
+func (m *Manager) handlePrimaryOwnerGone(ts x.Timestamp) {
+	if !m.config.isManagePrimary() || len(m.getContent(atomPrimary)) == 0 {
+		return
+	}
+	err := m.becomePrimaryOwner(ts)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// 把 CLIPBOARD selection 的数据同步到 PRIMARY selection
+func (m *Manager) syncClipboardToPrimary(targetDataMap map[x.Atom]*TargetData) {
+	if !m.config.isSyncClipboardToPrimary() {
+		return
+	}
+	primaryDataMap := copyTargetDataMap(targetDataMap)
+	if len(primaryDataMap) == 0 {
+		return
+	}
+	m.setPrimaryContent(primaryDataMap)
+
+	ts, err := m.getTimestamp()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	err = m.becomePrimaryOwner(ts)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+func (m *Manager) becomePrimaryOwner(ts x.Timestamp) error {
+	err := setSelectionOwner(m.xc, m.window, atomPrimary, ts)
+	if err != nil {
+		return err
+	}
+	logger.Debug("set primary selection owner to me")
+	return nil
+}
+
+// 处理 PRIMARY selection 的转换请求
+func (m *Manager) convertPrimary(ev *x.SelectionRequestEvent) {
+	m.convertSelectionContent(ev, m.primaryAcquireTs, m.primaryLostTs, m.getContent(atomPrimary))
+}
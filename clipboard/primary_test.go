@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"testing"
+
+	"github.com/linuxdeepin/dde-daemon/clipboard/mocks"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func initPrimaryAtomsForTest() {
+	initAtomsForTest()
+	const base = 150
+	atomPrimary = base + 1
+	atomPrimaryProp = base + 2
+	atomFromClipboardManager = base + 3
+}
+
+func Test_getConvertProperty(t *testing.T) {
+	initPrimaryAtomsForTest()
+	target := x.Atom(200)
+	assert.Equal(t, target, getConvertProperty(atomClipboard, target))
+	assert.Equal(t, atomPrimaryProp, getConvertProperty(atomPrimary, target))
+}
+
+func Test_copyTargetDataMap(t *testing.T) {
+	initPrimaryAtomsForTest()
+	td := &TargetData{Target: 200}
+	result := copyTargetDataMap(map[x.Atom]*TargetData{
+		200:                      td,
+		atomFromClipboardManager: {Target: atomFromClipboardManager},
+	})
+	assert.Equal(t, map[x.Atom]*TargetData{200: td}, result)
+}
+
+func TestManager_convertPrimary(t *testing.T) {
+	initPrimaryAtomsForTest()
+	reqWin := x.Window(2)
+	target := x.Atom(200)
+	ev := &x.SelectionRequestEvent{
+		Time:      10,
+		Owner:     1,
+		Requestor: reqWin,
+		Selection: atomPrimary,
+		Target:    target,
+		Property:  target,
+	}
+
+	xc := &mocks.XClient{}
+	m := &Manager{
+		xc:     xc,
+		window: 1,
+	}
+	xc.On("GetAtomName", target).Return("UTF8_STRING", nil)
+	xc.On("Conn").Return(nil)
+
+	// 没有获取 PRIMARY selection 时转换失败
+	xc.On("SendEventE", false, reqWin, uint32(x.EventMaskNoEvent), &x.SelectionNotifyEvent{
+		Time:      ev.Time,
+		Requestor: reqWin,
+		Selection: atomPrimary,
+		Target:    target,
+		Property:  x.None,
+	}).Return(nil).Once()
+	m.convertPrimary(ev)
+
+	m.primaryAcquireTs = 5
+	m.setPrimaryContent(map[x.Atom]*TargetData{
+		target: {Target: target, Type: target, Format: 8, Data: []byte("abc")},
+	})
+	xc.On("ChangePropertyE", uint8(x.PropModeReplace), reqWin, target, target, uint8(8),
+		[]byte("abc")).Return(nil).Once()
+	xc.On("SendEventE", false, reqWin, uint32(x.EventMaskNoEvent), &x.SelectionNotifyEvent{
+		Time:      ev.Time,
+		Requestor: reqWin,
+		Selection: atomPrimary,
+		Target:    target,
+		Property:  target,
+	}).Return(nil).Once()
+	m.convertPrimary(ev)
+
+	xc.AssertExpectations(t)
+}
+
+func TestManager_isPrimaryUpdateStale(t *testing.T) {
+	m := &Manager{}
+	assert.False(t, m.isPrimaryUpdateStale(5))
+
+	m.primaryLatestTs = 10
+	assert.True(t, m.isPrimaryUpdateStale(5))
+	assert.False(t, m.isPrimaryUpdateStale(10))
+}
@@ -0,0 +1,471 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	wlInterfaceSeat                = "wl_seat"
+	wlInterfaceExtDataControl      = "ext_data_control_manager_v1"
+	wlInterfaceWlrDataControl      = "zwlr_data_control_manager_v1"
+	wlDataControlManagerMaxVersion = 1
+
+	wlReceiveTimeout = 5 * time.Second
+
+	wlReconnectMaxDelay = time.Minute
+)
+
+// 连接断开后第一次重连前等待的时间，重连失败时加倍，直到 wlReconnectMaxDelay
+var wlReconnectMinDelay = time.Second
+
+// data-control 协议中的请求和事件的 opcode，ext 和 wlr 两个版本相同
+const (
+	// wl_registry
+	wlRegistryRequestBind  = 0
+	wlRegistryEventGlobal  = 0
+	wlDisplayRequestGetReg = 1
+
+	// data_control_manager
+	wlManagerRequestCreateDataSource = 0
+	wlManagerRequestGetDataDevice    = 1
+
+	// data_control_device
+	wlDeviceRequestSetSelection   = 0
+	wlDeviceEventDataOffer        = 0
+	wlDeviceEventSelection        = 1
+	wlDeviceEventFinished         = 2
+	wlDeviceEventPrimarySelection = 3
+
+	// data_control_source
+	wlSourceRequestOffer   = 0
+	wlSourceRequestDestroy = 1
+	wlSourceEventSend      = 0
+	wlSourceEventCancelled = 1
+
+	// data_control_offer
+	wlOfferRequestReceive = 0
+	wlOfferRequestDestroy = 1
+	wlOfferEventOffer     = 0
+)
+
+var (
+	errNoSelection    = errors.New("no selection")
+	errWlNotConnected = errors.New("wayland connection is not ready")
+)
+
+// WlClient 是 Wayland 剪贴板后端，与 XClient 的作用相同，方便测试时替换。
+type WlClient interface {
+	// 设置 selection 变化的回调，mimeTypes 为空表示 selection 被清空，比如所有者退出了。
+	SetSelectionChangedHandler(fn func(mimeTypes []string))
+	// 读取当前 selection 中 mimeType 类型的数据
+	// maxSize 为 noSizeLimit 时不限制数据大小，超过 maxSize 时返回 errTargetTooLarge
+	ReceiveSelection(mimeType string, maxSize int64) ([]byte, error)
+	// 成为 selection 的所有者，其他程序请求数据时调用 getData 获取数据
+	SetSelection(mimeTypes []string, getData func(mimeType string) []byte) error
+	Close() error
+}
+
+type wlGlobal struct {
+	name    uint32
+	iface   string
+	version uint32
+}
+
+type wlClient struct {
+	// 连接断开后用来重新连接混成器
+	dial      func() (*wlConn, error)
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu               sync.Mutex
+	conn             *wlConn
+	managerId        uint32
+	deviceId         uint32
+	offers           map[uint32][]string // offer id => mime types
+	selectionOffer   uint32
+	sourceId         uint32
+	getData          func(mimeType string) []byte
+	selectionChanged func(mimeTypes []string)
+}
+
+func newWlClient() (*wlClient, error) {
+	return newWlClientWithDial(dialWayland)
+}
+
+func newWlClientWithDial(dial func() (*wlConn, error)) (*wlClient, error) {
+	wc := &wlClient{
+		dial: dial,
+		done: make(chan struct{}),
+	}
+	conn, err := wc.connect()
+	if err != nil {
+		return nil, err
+	}
+	go wc.keepConnected(conn)
+	return wc, nil
+}
+
+// 建立新的连接并初始化，之前连接上的 offer 和 data source 都已失效
+func (wc *wlClient) connect() (*wlConn, error) {
+	conn, err := wc.dial()
+	if err != nil {
+		return nil, err
+	}
+	wc.mu.Lock()
+	wc.conn = conn
+	wc.managerId = 0
+	wc.deviceId = 0
+	wc.offers = make(map[uint32][]string)
+	wc.selectionOffer = 0
+	wc.sourceId = 0
+	wc.getData = nil
+	wc.mu.Unlock()
+
+	go func() {
+		err := conn.readLoop()
+		logger.Warning("wayland connection closed:", err)
+	}()
+
+	err = wc.init(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// 连接断开后重新连接，直到 Close 被调用
+func (wc *wlClient) keepConnected(conn *wlConn) {
+	for {
+		select {
+		case <-conn.closed:
+		case <-wc.done:
+			return
+		}
+
+		delay := wlReconnectMinDelay
+		for {
+			select {
+			case <-time.After(delay):
+			case <-wc.done:
+				return
+			}
+			newConn, err := wc.connect()
+			if err == nil {
+				logger.Info("reconnected to wayland compositor")
+				conn = newConn
+				break
+			}
+			logger.Warning("failed to reconnect to wayland compositor:", err)
+			delay *= 2
+			if delay > wlReconnectMaxDelay {
+				delay = wlReconnectMaxDelay
+			}
+		}
+	}
+}
+
+func (wc *wlClient) init(conn *wlConn) error {
+	var globalsMu sync.Mutex
+	globals := make(map[string]*wlGlobal)
+	registryId := conn.newObject(func(ev *wlEvent) {
+		if ev.opcode != wlRegistryEventGlobal {
+			return
+		}
+		g := &wlGlobal{
+			name:    ev.uint(),
+			iface:   ev.string(),
+			version: ev.uint(),
+		}
+		globalsMu.Lock()
+		if _, ok := globals[g.iface]; !ok {
+			globals[g.iface] = g
+		}
+		globalsMu.Unlock()
+	})
+	msg := &wlMessage{}
+	msg.putUint(registryId)
+	err := conn.sendRequest(wlDisplayId, wlDisplayRequestGetReg, msg)
+	if err != nil {
+		return err
+	}
+	err = conn.roundtrip()
+	if err != nil {
+		return err
+	}
+
+	globalsMu.Lock()
+	seat := globals[wlInterfaceSeat]
+	manager := globals[wlInterfaceExtDataControl]
+	if manager == nil {
+		manager = globals[wlInterfaceWlrDataControl]
+	}
+	globalsMu.Unlock()
+	if seat == nil {
+		return errors.New("no wl_seat")
+	}
+	if manager == nil {
+		return errors.New("compositor does not support data-control protocol")
+	}
+	logger.Debug("use data control manager:", manager.iface)
+
+	// 不关心 seat 的事件
+	seatId := bindGlobal(conn, registryId, seat, 1, nil)
+	managerId := bindGlobal(conn, registryId, manager, wlDataControlManagerMaxVersion, nil)
+
+	deviceId := conn.newObject(wc.handleDeviceEvent(conn))
+	wc.mu.Lock()
+	wc.managerId = managerId
+	wc.deviceId = deviceId
+	wc.mu.Unlock()
+	msg = &wlMessage{}
+	msg.putUint(deviceId)
+	msg.putUint(seatId)
+	err = conn.sendRequest(managerId, wlManagerRequestGetDataDevice, msg)
+	if err != nil {
+		return err
+	}
+	return conn.roundtrip()
+}
+
+func bindGlobal(conn *wlConn, registryId uint32, g *wlGlobal, maxVersion uint32, handler wlEventHandler) uint32 {
+	version := g.version
+	if version > maxVersion {
+		version = maxVersion
+	}
+	id := conn.newObject(handler)
+	msg := &wlMessage{}
+	msg.putUint(g.name)
+	msg.putString(g.iface)
+	msg.putUint(version)
+	msg.putUint(id)
+	err := conn.sendRequest(registryId, wlRegistryRequestBind, msg)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return id
+}
+
+func destroyOffer(conn *wlConn, id uint32) {
+	err := conn.sendRequest(id, wlOfferRequestDestroy, nil)
+	if err != nil {
+		logger.Warning(err)
+	}
+	conn.removeObject(id)
+}
+
+func (wc *wlClient) handleDeviceEvent(conn *wlConn) wlEventHandler {
+	return func(ev *wlEvent) {
+		wc.handleDeviceEventAux(conn, ev)
+	}
+}
+
+func (wc *wlClient) handleDeviceEventAux(conn *wlConn, ev *wlEvent) {
+	switch ev.opcode {
+	case wlDeviceEventDataOffer:
+		offerId := ev.uint()
+		wc.mu.Lock()
+		wc.offers[offerId] = nil
+		wc.mu.Unlock()
+		conn.setHandler(offerId, func(ev *wlEvent) {
+			if ev.opcode != wlOfferEventOffer {
+				return
+			}
+			mimeType := ev.string()
+			wc.mu.Lock()
+			wc.offers[offerId] = append(wc.offers[offerId], mimeType)
+			wc.mu.Unlock()
+		})
+
+	case wlDeviceEventSelection:
+		offerId := ev.uint()
+		wc.mu.Lock()
+		oldOffer := wc.selectionOffer
+		wc.selectionOffer = offerId
+		mimeTypes := wc.offers[offerId]
+		delete(wc.offers, oldOffer)
+		handler := wc.selectionChanged
+		// ReceiveSelection 持有 wc.mu 发送 receive 请求，在锁内销毁旧的 offer，
+		// 保证正在使用它的 receive 请求先发送，否则混成器会报告协议错误并断开连接
+		if oldOffer != 0 && oldOffer != offerId {
+			destroyOffer(conn, oldOffer)
+		}
+		wc.mu.Unlock()
+
+		if handler != nil {
+			// 处理函数会读取 selection 数据，不能阻塞事件循环
+			go handler(mimeTypes)
+		}
+
+	case wlDeviceEventPrimarySelection:
+		// 不管理 primary selection
+		offerId := ev.uint()
+		if offerId != 0 {
+			wc.mu.Lock()
+			delete(wc.offers, offerId)
+			wc.mu.Unlock()
+			destroyOffer(conn, offerId)
+		}
+
+	case wlDeviceEventFinished:
+		logger.Warning("data control device finished")
+	}
+}
+
+func (wc *wlClient) handleSourceEvent(conn *wlConn, sourceId uint32) wlEventHandler {
+	return func(ev *wlEvent) {
+		switch ev.opcode {
+		case wlSourceEventSend:
+			mimeType := ev.string()
+			fd := ev.fd()
+			if ev.err != nil {
+				return
+			}
+			wc.mu.Lock()
+			getData := wc.getData
+			if sourceId != wc.sourceId {
+				getData = nil
+			}
+			wc.mu.Unlock()
+
+			go func() {
+				f := os.NewFile(uintptr(fd), "clipboard-send")
+				defer f.Close()
+				if getData == nil {
+					return
+				}
+				_, err := f.Write(getData(mimeType))
+				if err != nil {
+					logger.Warning("failed to send selection data:", err)
+				}
+			}()
+
+		case wlSourceEventCancelled:
+			logger.Debug("data source cancelled", sourceId)
+			wc.mu.Lock()
+			if wc.sourceId == sourceId {
+				wc.sourceId = 0
+				wc.getData = nil
+			}
+			wc.mu.Unlock()
+			err := conn.sendRequest(sourceId, wlSourceRequestDestroy, nil)
+			if err != nil {
+				logger.Warning(err)
+			}
+			conn.removeObject(sourceId)
+		}
+	}
+}
+
+func (wc *wlClient) SetSelectionChangedHandler(fn func(mimeTypes []string)) {
+	wc.mu.Lock()
+	wc.selectionChanged = fn
+	wc.mu.Unlock()
+}
+
+func (wc *wlClient) ReceiveSelection(mimeType string, maxSize int64) ([]byte, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	msg := &wlMessage{}
+	msg.putString(mimeType)
+	msg.putFd(int(w.Fd()))
+	// 发送 receive 请求时持有 wc.mu，防止 offer 在此期间被 selection 事件销毁
+	wc.mu.Lock()
+	offerId := wc.selectionOffer
+	if offerId == 0 {
+		err = errNoSelection
+	} else {
+		err = wc.conn.sendRequest(offerId, wlOfferRequestReceive, msg)
+	}
+	wc.mu.Unlock()
+	// fd 已经发送给混成器，关闭本地的写端，这样数据发送完后才能读到 EOF
+	_ = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.SetReadDeadline(time.Now().Add(wlReceiveTimeout))
+	if err != nil {
+		logger.Warning(err)
+	}
+	var src io.Reader = r
+	if maxSize != noSizeLimit {
+		// 多读一个字节用来判断是否超过限制
+		src = io.LimitReader(r, maxSize+1)
+	}
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, src)
+	if err != nil {
+		return nil, err
+	}
+	if isSizeExceeded(n, maxSize) {
+		return nil, errTargetTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+func (wc *wlClient) SetSelection(mimeTypes []string, getData func(mimeType string) []byte) error {
+	wc.mu.Lock()
+	conn := wc.conn
+	managerId := wc.managerId
+	deviceId := wc.deviceId
+	wc.mu.Unlock()
+	if managerId == 0 || deviceId == 0 {
+		return errWlNotConnected
+	}
+
+	sourceId := conn.newObject(nil)
+	conn.setHandler(sourceId, wc.handleSourceEvent(conn, sourceId))
+	conn.setEventFds(sourceId, wlSourceEventSend, 1)
+	msg := &wlMessage{}
+	msg.putUint(sourceId)
+	err := conn.sendRequest(managerId, wlManagerRequestCreateDataSource, msg)
+	if err != nil {
+		return err
+	}
+	for _, mimeType := range mimeTypes {
+		msg = &wlMessage{}
+		msg.putString(mimeType)
+		err = conn.sendRequest(sourceId, wlSourceRequestOffer, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	wc.mu.Lock()
+	if wc.conn != conn {
+		// 期间重新连接了，data source 已经失效
+		wc.mu.Unlock()
+		return errWlNotConnected
+	}
+	wc.sourceId = sourceId
+	wc.getData = getData
+	wc.mu.Unlock()
+
+	msg = &wlMessage{}
+	msg.putUint(sourceId)
+	return conn.sendRequest(deviceId, wlDeviceRequestSetSelection, msg)
+}
+
+func (wc *wlClient) Close() error {
+	wc.closeOnce.Do(func() {
+		close(wc.done)
+	})
+	wc.mu.Lock()
+	conn := wc.conn
+	wc.mu.Unlock()
+	return conn.Close()
+}
@@ -0,0 +1,516 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCompositor 在 socketpair 的另一端模拟实现了 data-control 协议的 Wayland 混成器，
+// 另外模拟一个外部程序来设置和读取剪贴板。
+type fakeCompositor struct {
+	conn    *net.UnixConn
+	writeMu sync.Mutex
+
+	mu              sync.Mutex
+	nextId          uint32
+	objects         map[uint32]string   // 客户端创建的对象 id => 类型
+	sources         map[uint32][]string // 客户端的 data source => mime types
+	externalOffers  map[uint32]map[string][]byte
+	sourceOffers    map[uint32]uint32 // offer => 客户端的 data source
+	deviceId        uint32
+	selectionSource uint32
+}
+
+func newUnixConnPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	require.NoError(t, err)
+
+	newUnixConn := func(fd int) *net.UnixConn {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		defer f.Close()
+		conn, err := net.FileConn(f)
+		require.NoError(t, err)
+		return conn.(*net.UnixConn)
+	}
+	return newUnixConn(fds[0]), newUnixConn(fds[1])
+}
+
+func newFakeCompositor(t *testing.T) (*fakeCompositor, *wlConn) {
+	serverConn, clientConn := newUnixConnPair(t)
+	fc := &fakeCompositor{
+		conn:           serverConn,
+		nextId:         0xff000000,
+		objects:        make(map[uint32]string),
+		sources:        make(map[uint32][]string),
+		externalOffers: make(map[uint32]map[string][]byte),
+		sourceOffers:   make(map[uint32]uint32),
+	}
+	go fc.readLoop()
+	return fc, newWlConn(clientConn)
+}
+
+func (fc *fakeCompositor) sendEvent(sender uint32, opcode uint16, msg *wlMessage) {
+	if msg == nil {
+		msg = &wlMessage{}
+	}
+	var oob []byte
+	if len(msg.fds) > 0 {
+		oob = syscall.UnixRights(msg.fds...)
+	}
+	fc.writeMu.Lock()
+	defer fc.writeMu.Unlock()
+	_, _, _ = fc.conn.WriteMsgUnix(msg.encode(sender, opcode), oob, nil)
+}
+
+func (fc *fakeCompositor) readLoop() {
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(wlMaxFds*4))
+	var pending []byte
+	var fds []int
+	for {
+		n, oobn, _, _, err := fc.conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+		if oobn > 0 {
+			scms, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+			for i := range scms {
+				rights, _ := syscall.ParseUnixRights(&scms[i])
+				fds = append(fds, rights...)
+			}
+		}
+		for {
+			req, size, err := parseWlEvent(pending)
+			if err != nil || size == 0 {
+				break
+			}
+			pending = pending[size:]
+			req.fds = fds
+			fc.handleRequest(req)
+			fds = req.fds
+		}
+	}
+}
+
+func (fc *fakeCompositor) handleRequest(req *wlEvent) {
+	fc.mu.Lock()
+	typ := fc.objects[req.sender]
+	fc.mu.Unlock()
+	if req.sender == wlDisplayId {
+		typ = "wl_display"
+	}
+
+	switch typ {
+	case "wl_display":
+		newId := req.uint()
+		if req.opcode == 0 { // sync
+			msg := &wlMessage{}
+			msg.putUint(0)
+			fc.sendEvent(newId, 0, msg)
+			return
+		}
+		// get_registry
+		fc.mu.Lock()
+		fc.objects[newId] = "wl_registry"
+		fc.mu.Unlock()
+		for i, iface := range []string{wlInterfaceSeat, wlInterfaceExtDataControl} {
+			msg := &wlMessage{}
+			msg.putUint(uint32(i + 1))
+			msg.putString(iface)
+			msg.putUint(1)
+			fc.sendEvent(newId, wlRegistryEventGlobal, msg)
+		}
+
+	case "wl_registry":
+		req.uint()
+		iface := req.string()
+		req.uint()
+		id := req.uint()
+		fc.mu.Lock()
+		fc.objects[id] = iface
+		fc.mu.Unlock()
+
+	case wlInterfaceExtDataControl:
+		id := req.uint()
+		fc.mu.Lock()
+		if req.opcode == wlManagerRequestCreateDataSource {
+			fc.objects[id] = "source"
+			fc.sources[id] = nil
+		} else {
+			fc.objects[id] = "device"
+			fc.deviceId = id
+		}
+		fc.mu.Unlock()
+		if req.opcode == wlManagerRequestGetDataDevice {
+			msg := &wlMessage{}
+			msg.putUint(0)
+			fc.sendEvent(id, wlDeviceEventSelection, msg)
+		}
+
+	case "source":
+		if req.opcode == wlSourceRequestOffer {
+			mimeType := req.string()
+			fc.mu.Lock()
+			fc.sources[req.sender] = append(fc.sources[req.sender], mimeType)
+			fc.mu.Unlock()
+		}
+
+	case "device":
+		if req.opcode == wlDeviceRequestSetSelection {
+			fc.setClientSelection(req.uint())
+		}
+
+	case "offer":
+		if req.opcode != wlOfferRequestReceive {
+			return
+		}
+		mimeType := req.string()
+		fd := req.fd()
+		fc.mu.Lock()
+		data, isExternal := fc.externalOffers[req.sender]
+		sourceId := fc.sourceOffers[req.sender]
+		fc.mu.Unlock()
+		if isExternal {
+			f := os.NewFile(uintptr(fd), "receive")
+			_, _ = f.Write(data[mimeType])
+			_ = f.Close()
+			return
+		}
+		// 转发给设置 selection 的 data source
+		msg := &wlMessage{}
+		msg.putString(mimeType)
+		msg.putFd(fd)
+		fc.sendEvent(sourceId, wlSourceEventSend, msg)
+		_ = syscall.Close(fd)
+	}
+}
+
+// 调用者需要持有 fc.mu
+func (fc *fakeCompositor) cancelClientSource() {
+	if fc.selectionSource != 0 {
+		fc.sendEvent(fc.selectionSource, wlSourceEventCancelled, nil)
+		fc.selectionSource = 0
+	}
+}
+
+// 向客户端发送新的 selection
+func (fc *fakeCompositor) announceOffer(mimeTypes []string) uint32 {
+	offerId := fc.nextId
+	fc.nextId++
+	fc.objects[offerId] = "offer"
+
+	msg := &wlMessage{}
+	msg.putUint(offerId)
+	fc.sendEvent(fc.deviceId, wlDeviceEventDataOffer, msg)
+	for _, mimeType := range mimeTypes {
+		msg = &wlMessage{}
+		msg.putString(mimeType)
+		fc.sendEvent(offerId, wlOfferEventOffer, msg)
+	}
+	msg = &wlMessage{}
+	msg.putUint(offerId)
+	fc.sendEvent(fc.deviceId, wlDeviceEventSelection, msg)
+	return offerId
+}
+
+func (fc *fakeCompositor) setClientSelection(sourceId uint32) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.selectionSource != sourceId {
+		fc.cancelClientSource()
+	}
+	fc.selectionSource = sourceId
+	offerId := fc.announceOffer(fc.sources[sourceId])
+	fc.sourceOffers[offerId] = sourceId
+}
+
+// 模拟外部程序设置剪贴板
+func (fc *fakeCompositor) setExternalSelection(data map[string][]byte) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.cancelClientSource()
+	var mimeTypes []string
+	for mimeType := range data {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	offerId := fc.announceOffer(mimeTypes)
+	fc.externalOffers[offerId] = data
+}
+
+// 模拟外部程序退出，selection 被清空
+func (fc *fakeCompositor) clearSelection() {
+	msg := &wlMessage{}
+	msg.putUint(0)
+	fc.sendEvent(fc.deviceId, wlDeviceEventSelection, msg)
+}
+
+func (fc *fakeCompositor) getClientSource() (uint32, []string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.selectionSource, fc.sources[fc.selectionSource]
+}
+
+// 模拟外部程序从客户端设置的 selection 中读取数据
+func (fc *fakeCompositor) readClientSelection(mimeType string) ([]byte, error) {
+	sourceId, _ := fc.getClientSource()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	msg := &wlMessage{}
+	msg.putString(mimeType)
+	msg.putFd(int(w.Fd()))
+	fc.sendEvent(sourceId, wlSourceEventSend, msg)
+	_ = w.Close()
+
+	_ = r.SetReadDeadline(time.Now().Add(time.Second))
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, r)
+	return buf.Bytes(), err
+}
+
+func dialConn(conn *wlConn) func() (*wlConn, error) {
+	return func() (*wlConn, error) {
+		return conn, nil
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_wlMessage(t *testing.T) {
+	msg := &wlMessage{}
+	msg.putUint(42)
+	msg.putString("text/plain")
+	data := msg.encode(3, 1)
+	assert.Len(t, data, wlHeaderSize+4+4+12)
+
+	ev, size, err := parseWlEvent(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), size)
+	assert.EqualValues(t, 3, ev.sender)
+	assert.EqualValues(t, 1, ev.opcode)
+	assert.EqualValues(t, 42, ev.uint())
+	assert.Equal(t, "text/plain", ev.string())
+	assert.NoError(t, ev.err)
+	ev.uint()
+	assert.Equal(t, errWlMessageTooShort, ev.err)
+
+	// 数据不完整
+	_, size, err = parseWlEvent(data[:len(data)-1])
+	assert.NoError(t, err)
+	assert.Zero(t, size)
+}
+
+func TestWlClientInitTimeout(t *testing.T) {
+	oldTimeout := wlRoundtripTimeout
+	wlRoundtripTimeout = 100 * time.Millisecond
+	defer func() {
+		wlRoundtripTimeout = oldTimeout
+	}()
+
+	// 混成器不响应任何请求
+	serverConn, clientConn := newUnixConnPair(t)
+	defer serverConn.Close()
+	_, err := newWlClientWithDial(dialConn(newWlConn(clientConn)))
+	assert.Equal(t, errWlRoundtripTimedOut, err)
+}
+
+func TestWlConnDisplayError(t *testing.T) {
+	serverConn, clientConn := newUnixConnPair(t)
+	defer serverConn.Close()
+	conn := newWlConn(clientConn)
+	defer conn.Close()
+	go func() {
+		_ = conn.readLoop()
+	}()
+
+	go func() {
+		// 读取 wl_display.sync 请求后先发送错误，再发送 wl_callback.done
+		buf := make([]byte, 64)
+		n, err := serverConn.Read(buf)
+		if err != nil {
+			return
+		}
+		req, _, _ := parseWlEvent(buf[:n])
+		callbackId := req.uint()
+
+		msg := &wlMessage{}
+		msg.putUint(wlDisplayId)
+		msg.putUint(1)
+		msg.putString("invalid method")
+		_, _ = serverConn.Write(msg.encode(wlDisplayId, 0))
+		msg = &wlMessage{}
+		msg.putUint(0)
+		_, _ = serverConn.Write(msg.encode(callbackId, 0))
+	}()
+
+	err := conn.roundtrip()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid method")
+
+	// 连接断开后 roundtrip 立即返回错误
+	serverConn.Close()
+	<-conn.closed
+	assert.Error(t, conn.roundtrip())
+}
+
+func TestWlManager(t *testing.T) {
+	fc, conn := newFakeCompositor(t)
+	wc, err := newWlClientWithDial(dialConn(conn))
+	require.NoError(t, err)
+	defer wc.Close()
+
+	dir, err := ioutil.TempDir("", "dde-daemon-clipboard-history-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := newWlManager(wc)
+	m.history = newHistoryStore(dir)
+	m.start()
+
+	// 外部程序复制了文本
+	fc.setExternalSelection(map[string][]byte{
+		"text/plain;charset=utf-8": []byte("hello"),
+		"TARGETS":                  []byte("ignored"),
+		"image/webp":               []byte("ignored"),
+	})
+	waitFor(t, func() bool {
+		return len(m.getContent()) > 0
+	})
+	content := m.getContent()
+	require.Len(t, content, 1)
+	assert.Equal(t, "text/plain;charset=utf-8", content[0].MimeType)
+	assert.Equal(t, []byte("hello"), content[0].Data)
+	assert.Len(t, m.history.list(""), 1)
+
+	// 外部程序退出后，剪贴板管理器成为 selection 的所有者
+	fc.clearSelection()
+	waitFor(t, func() bool {
+		sourceId, _ := fc.getClientSource()
+		return sourceId != 0
+	})
+	_, mimeTypes := fc.getClientSource()
+	assert.ElementsMatch(t, []string{"text/plain;charset=utf-8", wlMimeFromClipboardManager}, mimeTypes)
+
+	data, err := fc.readClientSelection("text/plain;charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	// 其他程序复制后，剪贴板管理器的 data source 被取消
+	fc.setExternalSelection(map[string][]byte{
+		"text/plain;charset=utf-8": []byte("world"),
+	})
+	waitFor(t, func() bool {
+		content := m.getContent()
+		return len(content) == 1 && string(content[0].Data) == "world"
+	})
+	wc.mu.Lock()
+	assert.Zero(t, wc.sourceId)
+	wc.mu.Unlock()
+
+	m.RemoveTarget(m.getTargetId("text/plain;charset=utf-8"))
+	assert.Empty(t, m.getContent())
+}
+
+func TestWlClientReconnect(t *testing.T) {
+	oldDelay := wlReconnectMinDelay
+	wlReconnectMinDelay = 10 * time.Millisecond
+	defer func() {
+		wlReconnectMinDelay = oldDelay
+	}()
+
+	var mu sync.Mutex
+	var fcs []*fakeCompositor
+	dial := func() (*wlConn, error) {
+		fc, conn := newFakeCompositor(t)
+		mu.Lock()
+		fcs = append(fcs, fc)
+		mu.Unlock()
+		return conn, nil
+	}
+	getFc := func(i int) *fakeCompositor {
+		mu.Lock()
+		defer mu.Unlock()
+		if i >= len(fcs) {
+			return nil
+		}
+		return fcs[i]
+	}
+
+	wc, err := newWlClientWithDial(dial)
+	require.NoError(t, err)
+	defer wc.Close()
+	m := newWlManager(wc)
+	m.start()
+
+	getFc(0).setExternalSelection(map[string][]byte{
+		"text/plain": []byte("hello"),
+	})
+	waitFor(t, func() bool {
+		return len(m.getContent()) > 0
+	})
+
+	// 混成器断开连接后重新连接，剪贴板管理器成为新连接上的 selection 所有者
+	_ = getFc(0).conn.Close()
+	waitFor(t, func() bool {
+		fc := getFc(1)
+		if fc == nil {
+			return false
+		}
+		sourceId, _ := fc.getClientSource()
+		return sourceId != 0
+	})
+	data, err := getFc(1).readClientSelection("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+}
+
+func TestWlConnCloseUnusedFds(t *testing.T) {
+	serverConn, clientConn := newUnixConnPair(t)
+	defer serverConn.Close()
+	conn := newWlConn(clientConn)
+	defer conn.Close()
+	go func() {
+		_ = conn.readLoop()
+	}()
+
+	// 发给没有处理函数的对象的事件带的 fd 要被关闭，不能留给后面的事件
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	msg := &wlMessage{}
+	msg.putString("text/plain")
+	msg.putFd(int(w.Fd()))
+	_, _, err = serverConn.WriteMsgUnix(msg.encode(99, wlSourceEventSend), syscall.UnixRights(msg.fds...), nil)
+	require.NoError(t, err)
+	_ = w.Close()
+
+	// 所有写端都关闭后才能读到 EOF
+	_ = r.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,339 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	"github.com/linuxdeepin/go-lib/strv"
+)
+
+// 给剪贴板数据带上的特殊标记，与 X11 中的 FROM_DEEPIN_CLIPBOARD_MANAGER target 作用相同
+const wlMimeFromClipboardManager = "FROM_DEEPIN_CLIPBOARD_MANAGER"
+
+// Xwayland 转换过来的 selection 中可能包含这些 X11 特有的 target，不需要保存
+var wlIgnoredMimeTypes = strv.Strv{
+	"TARGETS", "SAVE_TARGETS", "TIMESTAMP", "MULTIPLE", "DELETE",
+	"INSERT_PROPERTY", "INSERT_SELECTION", "PIXMAP",
+}
+
+type wlTargetData struct {
+	Target   uint32 // 本程序给 mime type 分配的编号，相当于 X11 中的 atom
+	MimeType string
+	Data     []byte
+}
+
+// WlManager 是 Wayland 会话中的剪贴板管理器，通过 data-control 协议实现，
+// 提供与 Manager 相同的 DBus 接口。
+type WlManager struct {
+	wc WlClient
+
+	contentMu sync.Mutex
+	content   []*wlTargetData
+
+	targetIdsMu  sync.Mutex
+	targetIds    map[string]uint32
+	nextTargetId uint32
+
+	saveMu        sync.Mutex
+	lastMimeTypes []string
+
+	history *historyStore
+	config  *config
+
+	service        *dbusutil.Service
+	PropsMu        sync.RWMutex
+	SkippedTargets uint64 // 因为内容策略没有保存的 target 的数量
+}
+
+func newWlManager(wc WlClient) *WlManager {
+	return &WlManager{
+		wc:           wc,
+		targetIds:    make(map[string]uint32),
+		nextTargetId: 1,
+	}
+}
+
+func (m *WlManager) start() {
+	m.wc.SetSelectionChangedHandler(m.handleSelectionChanged)
+}
+
+func (m *WlManager) getTargetId(mimeType string) uint32 {
+	m.targetIdsMu.Lock()
+	defer m.targetIdsMu.Unlock()
+	id, ok := m.targetIds[mimeType]
+	if !ok {
+		id = m.nextTargetId
+		m.nextTargetId++
+		m.targetIds[mimeType] = id
+	}
+	return id
+}
+
+func (m *WlManager) getContent() []*wlTargetData {
+	m.contentMu.Lock()
+	defer m.contentMu.Unlock()
+	return m.content
+}
+
+func (m *WlManager) setContent(content []*wlTargetData) {
+	for _, td := range content {
+		logger.Debugf("content target %s len: %v", td.MimeType, len(td.Data))
+	}
+	m.contentMu.Lock()
+	m.content = content
+	m.contentMu.Unlock()
+}
+
+func (m *WlManager) handleSelectionChanged(mimeTypes []string) {
+	logger.Debug("selection changed, mime types:", mimeTypes)
+	if len(mimeTypes) == 0 {
+		// selection 被清空，一般是所有者退出了
+		if len(m.getContent()) == 0 {
+			return
+		}
+		err := m.becomeClipboardOwner()
+		if err != nil {
+			logger.Warning(err)
+		}
+		return
+	}
+
+	if strv.Strv(mimeTypes).Contains(wlMimeFromClipboardManager) {
+		logger.Debug("i have become the owner of selection")
+		return
+	}
+
+	m.saveMu.Lock()
+	m.lastMimeTypes = mimeTypes
+	m.saveMu.Unlock()
+
+	err := m.saveSelection(mimeTypes)
+	if err != nil {
+		logger.Warning("handle selection changed err:", err)
+	}
+}
+
+func shouldIgnoreSaveMimeType(mimeType string) bool {
+	return wlIgnoredMimeTypes.Contains(mimeType) || shouldIgnoreTargetName(mimeType)
+}
+
+// 增加 SkippedTargets 属性的值
+func (m *WlManager) addSkippedTargets(n int) {
+	if n <= 0 {
+		return
+	}
+	m.PropsMu.Lock()
+	defer m.PropsMu.Unlock()
+	if m.service == nil {
+		m.SkippedTargets += uint64(n)
+		return
+	}
+	m.setPropSkippedTargets(m.SkippedTargets + uint64(n))
+}
+
+// 按照剪贴板内容策略保存当前 selection 的数据。
+// data-control 协议无法获取 selection 所有者的 PID，所以不支持按程序排除。
+func (m *WlManager) saveSelection(mimeTypes []string) error {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	policy := m.config.getPolicy()
+	content := make([]*wlTargetData, 0, len(mimeTypes))
+	var total int64
+	var skipped int
+	defer func() {
+		m.addSkippedTargets(skipped)
+	}()
+	for _, mimeType := range mimeTypes {
+		if shouldIgnoreSaveMimeType(mimeType) {
+			logger.Debugf("ignore target %s", mimeType)
+			continue
+		}
+		if !policy.isTargetAllowed(mimeType) {
+			logger.Debugf("skip target %s, not allowed by policy", mimeType)
+			skipped++
+			continue
+		}
+		data, err := m.wc.ReceiveSelection(mimeType, policy.remainingSize(total))
+		if err == errTargetTooLarge {
+			logger.Debugf("skip target %s, too large", mimeType)
+			skipped++
+			continue
+		} else if err != nil {
+			logger.Warningf("save target failed %s, err: %v", mimeType, err)
+			if err == errNoSelection {
+				return err
+			}
+			continue
+		}
+		total += int64(len(data))
+		content = append(content, &wlTargetData{
+			Target:   m.getTargetId(mimeType),
+			MimeType: mimeType,
+			Data:     data,
+		})
+	}
+	if len(content) == 0 {
+		return errors.New("no target saved")
+	}
+
+	m.setContent(content)
+	m.recordHistory(content)
+	return nil
+}
+
+func (m *WlManager) getData(mimeType string) []byte {
+	if mimeType == wlMimeFromClipboardManager {
+		return []byte("1")
+	}
+	for _, td := range m.getContent() {
+		if td.MimeType == mimeType {
+			return td.Data
+		}
+	}
+	return nil
+}
+
+func (m *WlManager) becomeClipboardOwner() error {
+	content := m.getContent()
+	mimeTypes := make([]string, 0, len(content)+1)
+	for _, td := range content {
+		mimeTypes = append(mimeTypes, td.MimeType)
+	}
+	mimeTypes = append(mimeTypes, wlMimeFromClipboardManager)
+
+	err := m.wc.SetSelection(mimeTypes, m.getData)
+	if err != nil {
+		return err
+	}
+	logger.Debug("set selection owner to me")
+	return nil
+}
+
+func (m *WlManager) recordHistory(content []*wlTargetData) {
+	if m.history == nil {
+		return
+	}
+
+	names := make([]string, 0, len(content))
+	for _, td := range content {
+		names = append(names, td.MimeType)
+	}
+	if isSensitiveTargets(names) {
+		logger.Debug("clipboard content is sensitive, do not record history")
+		return
+	}
+
+	var targets []*historyTarget
+	for _, td := range content {
+		if !isHistoryTarget(td.MimeType) || len(td.Data) == 0 ||
+			len(td.Data) > m.history.maxTargetSize {
+			continue
+		}
+		targets = append(targets, &historyTarget{
+			Target: td.MimeType,
+			Type:   td.MimeType,
+			Format: 8,
+			Data:   td.Data,
+		})
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	item, err := m.history.add(targets)
+	if err != nil {
+		logger.Warning("failed to add history item:", err)
+		return
+	}
+	logger.Debug("record clipboard history item", item.Id)
+}
+
+func (m *WlManager) restoreHistory(item *historyItem) error {
+	content := make([]*wlTargetData, 0, len(item.Targets))
+	for _, t := range item.Targets {
+		content = append(content, &wlTargetData{
+			Target:   m.getTargetId(t.Target),
+			MimeType: t.Target,
+			Data:     t.Data,
+		})
+	}
+	m.setContent(content)
+	return m.becomeClipboardOwner()
+}
+
+func (m *WlManager) SaveClipboard() *dbus.Error {
+	m.saveMu.Lock()
+	mimeTypes := m.lastMimeTypes
+	m.saveMu.Unlock()
+	if len(mimeTypes) == 0 {
+		return dbusutil.ToError(errNoSelection)
+	}
+	err := m.saveSelection(mimeTypes)
+	return dbusutil.ToError(err)
+}
+
+func (m *WlManager) WriteContent() *dbus.Error {
+	var entries []contentDumpEntry
+	for _, td := range m.getContent() {
+		entries = append(entries, contentDumpEntry{
+			id:   td.Target,
+			name: td.MimeType,
+			data: td.Data,
+		})
+	}
+	err := writeContentToDir(contentDumpDir, entries)
+	return dbusutil.ToError(err)
+}
+
+func (m *WlManager) BecomeClipboardOwner() *dbus.Error {
+	err := m.becomeClipboardOwner()
+	return dbusutil.ToError(err)
+}
+
+func (m *WlManager) RemoveTarget(target uint32) *dbus.Error {
+	m.contentMu.Lock()
+	newContent := make([]*wlTargetData, 0, len(m.content))
+	for _, td := range m.content {
+		if td.Target != target {
+			newContent = append(newContent, td)
+		}
+	}
+	m.content = newContent
+	m.contentMu.Unlock()
+	return nil
+}
+
+func (m *WlManager) ListHistory() (historyJSON string, busErr *dbus.Error) {
+	return listHistory(m.history, "")
+}
+
+func (m *WlManager) SearchHistory(keyword string) (historyJSON string, busErr *dbus.Error) {
+	return listHistory(m.history, keyword)
+}
+
+func (m *WlManager) GetHistoryItem(id uint64) (itemJSON string, busErr *dbus.Error) {
+	return getHistoryItem(m.history, id)
+}
+
+func (m *WlManager) RestoreHistoryItem(id uint64) *dbus.Error {
+	return restoreHistoryItem(m.history, id, m.restoreHistory)
+}
+
+func (m *WlManager) DeleteHistoryItem(id uint64) *dbus.Error {
+	return deleteHistoryItem(m.history, id)
+}
+
+func (m *WlManager) ClearHistory() *dbus.Error {
+	return clearHistory(m.history)
+}
+
+func (m *WlManager) GetInterfaceName() string {
+	return dbusServiceName
+}
@@ -0,0 +1,411 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package clipboard
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 实现 Wayland 协议的线路格式，只包含剪贴板 data-control 需要的部分。
+// 参考 https://wayland.freedesktop.org/docs/html/ch04.html#sect-Protocol-Wire-Format
+
+const (
+	wlDisplayId = 1
+
+	wlHeaderSize = 8
+	wlMaxFds     = 28
+)
+
+// 混成器没有响应 wl_display.sync 时，roundtrip 最多等待的时间
+var wlRoundtripTimeout = 5 * time.Second
+
+var (
+	errWlMessageTooShort   = errors.New("wayland message too short")
+	errWlRoundtripTimedOut = errors.New("wayland roundtrip timed out")
+)
+
+// wlMessage 用于构造请求的参数
+type wlMessage struct {
+	buf []byte
+	fds []int
+}
+
+func (msg *wlMessage) putUint(v uint32) {
+	msg.buf = append(msg.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(msg.buf[len(msg.buf)-4:], v)
+}
+
+func (msg *wlMessage) putString(s string) {
+	// 长度包括结尾的 NUL，数据按 4 字节对齐
+	msg.putUint(uint32(len(s) + 1))
+	msg.buf = append(msg.buf, s...)
+	msg.buf = append(msg.buf, 0)
+	for len(msg.buf)%4 != 0 {
+		msg.buf = append(msg.buf, 0)
+	}
+}
+
+// fd 通过辅助数据传递，不占用消息体
+func (msg *wlMessage) putFd(fd int) {
+	msg.fds = append(msg.fds, fd)
+}
+
+func (msg *wlMessage) encode(sender uint32, opcode uint16) []byte {
+	size := wlHeaderSize + len(msg.buf)
+	data := make([]byte, wlHeaderSize, size)
+	binary.LittleEndian.PutUint32(data, sender)
+	binary.LittleEndian.PutUint32(data[4:], uint32(size)<<16|uint32(opcode))
+	return append(data, msg.buf...)
+}
+
+// wlEvent 是收到的事件，按参数顺序读取
+type wlEvent struct {
+	sender uint32
+	opcode uint16
+	data   []byte
+	// 属于这个事件的 fd，处理函数没有取走的会在处理完成后关闭
+	fds []int
+	err error
+}
+
+func (ev *wlEvent) uint() uint32 {
+	if ev.err != nil {
+		return 0
+	}
+	if len(ev.data) < 4 {
+		ev.err = errWlMessageTooShort
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(ev.data)
+	ev.data = ev.data[4:]
+	return v
+}
+
+func (ev *wlEvent) string() string {
+	length := int(ev.uint())
+	if ev.err != nil || length == 0 {
+		return ""
+	}
+	padded := (length + 3) &^ 3
+	if len(ev.data) < padded {
+		ev.err = errWlMessageTooShort
+		return ""
+	}
+	s := string(ev.data[:length-1])
+	ev.data = ev.data[padded:]
+	return s
+}
+
+func (ev *wlEvent) fd() int {
+	if ev.err != nil {
+		return -1
+	}
+	if len(ev.fds) == 0 {
+		ev.err = errors.New("no fd received")
+		return -1
+	}
+	fd := ev.fds[0]
+	ev.fds = ev.fds[1:]
+	return fd
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		_ = syscall.Close(fd)
+	}
+}
+
+// 解析 data 开头的一个完整消息，返回消息和消息的长度，数据不完整时返回长度 0
+func parseWlEvent(data []byte) (*wlEvent, int, error) {
+	if len(data) < wlHeaderSize {
+		return nil, 0, nil
+	}
+	sender := binary.LittleEndian.Uint32(data)
+	sizeOpcode := binary.LittleEndian.Uint32(data[4:])
+	size := int(sizeOpcode >> 16)
+	if size < wlHeaderSize {
+		return nil, 0, fmt.Errorf("invalid wayland message size %d", size)
+	}
+	if len(data) < size {
+		return nil, 0, nil
+	}
+	ev := &wlEvent{
+		sender: sender,
+		opcode: uint16(sizeOpcode & 0xffff),
+		data:   data[wlHeaderSize:size],
+	}
+	return ev, size, nil
+}
+
+type wlEventHandler func(ev *wlEvent)
+
+// wlConn 是到 Wayland 混成器的连接
+type wlConn struct {
+	conn    *net.UnixConn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextId   uint32
+	handlers map[uint32]wlEventHandler
+	// 对象 id => 带 fd 参数的事件 opcode => fd 的数量，
+	// 线路格式中没有 fd 的数量，需要按协议定义把收到的 fd 分配给事件
+	eventFds map[uint32]map[uint16]int
+	// 协议错误或者连接断开的原因，wl_display.error 是致命错误，发生后连接不再可用
+	err error
+
+	// readLoop 结束时关闭
+	closed chan struct{}
+}
+
+func getWaylandSocketPath() (string, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		display = "wayland-0"
+	}
+	if filepath.IsAbs(display) {
+		return display, nil
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", errors.New("XDG_RUNTIME_DIR is not set")
+	}
+	return filepath.Join(runtimeDir, display), nil
+}
+
+func dialWayland() (*wlConn, error) {
+	socketPath, err := getWaylandSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	return newWlConn(conn), nil
+}
+
+func newWlConn(conn *net.UnixConn) *wlConn {
+	c := &wlConn{
+		conn:     conn,
+		nextId:   wlDisplayId + 1,
+		handlers: make(map[uint32]wlEventHandler),
+		eventFds: make(map[uint32]map[uint16]int),
+		closed:   make(chan struct{}),
+	}
+	c.handlers[wlDisplayId] = c.handleDisplayEvent
+	return c
+}
+
+// 分配一个新的对象 id，并设置它的事件处理函数
+func (c *wlConn) newObject(handler wlEventHandler) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextId
+	c.nextId++
+	if handler != nil {
+		c.handlers[id] = handler
+	}
+	return id
+}
+
+func (c *wlConn) setHandler(id uint32, handler wlEventHandler) {
+	c.mu.Lock()
+	c.handlers[id] = handler
+	c.mu.Unlock()
+}
+
+func (c *wlConn) getHandler(id uint32) wlEventHandler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.handlers[id]
+}
+
+func (c *wlConn) removeObject(id uint32) {
+	c.mu.Lock()
+	delete(c.handlers, id)
+	c.mu.Unlock()
+}
+
+// 设置对象的 opcode 事件带有 n 个 fd 参数
+func (c *wlConn) setEventFds(id uint32, opcode uint16, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.eventFds[id]
+	if m == nil {
+		m = make(map[uint16]int)
+		c.eventFds[id] = m
+	}
+	m[opcode] = n
+}
+
+func (c *wlConn) getEventFds(id uint32, opcode uint16) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.eventFds[id][opcode]
+}
+
+// 混成器确认对象已经销毁，之后不会再有这个对象的事件
+func (c *wlConn) deleteObject(id uint32) {
+	c.mu.Lock()
+	delete(c.handlers, id)
+	delete(c.eventFds, id)
+	c.mu.Unlock()
+}
+
+func (c *wlConn) sendRequest(sender uint32, opcode uint16, msg *wlMessage) error {
+	if msg == nil {
+		msg = &wlMessage{}
+	}
+	data := msg.encode(sender, opcode)
+	var oob []byte
+	if len(msg.fds) > 0 {
+		oob = syscall.UnixRights(msg.fds...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, _, err := c.conn.WriteMsgUnix(data, oob, nil)
+	return err
+}
+
+func (c *wlConn) handleDisplayEvent(ev *wlEvent) {
+	switch ev.opcode {
+	case 0: // error
+		objectId := ev.uint()
+		code := ev.uint()
+		message := ev.string()
+		err := fmt.Errorf("wayland error, object: %d, code: %d, message: %s", objectId, code, message)
+		logger.Warning(err)
+		c.setErr(err)
+	case 1: // delete_id
+		c.deleteObject(ev.uint())
+	}
+}
+
+func (c *wlConn) setErr(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+func (c *wlConn) getErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// 同步请求，等待混成器处理完之前发送的所有请求，超过 wlRoundtripTimeout 或者连接出错时返回错误
+func (c *wlConn) roundtrip() error {
+	done := make(chan struct{})
+	var once sync.Once
+	callbackId := c.newObject(func(ev *wlEvent) {
+		once.Do(func() {
+			close(done)
+		})
+	})
+	msg := &wlMessage{}
+	msg.putUint(callbackId)
+	err := c.sendRequest(wlDisplayId, 0, msg) // wl_display.sync
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(wlRoundtripTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-c.closed:
+	case <-timer.C:
+		c.removeObject(callbackId)
+		return errWlRoundtripTimedOut
+	}
+	return c.getErr()
+}
+
+// 读取并分发事件，直到连接出错
+func (c *wlConn) readLoop() (err error) {
+	defer func() {
+		c.setErr(err)
+		close(c.closed)
+	}()
+
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(wlMaxFds*4))
+	var pending []byte
+	// 已经收到但还没有分配给事件的 fd
+	var fds []int
+	defer func() {
+		closeFds(fds)
+	}()
+	for {
+		n, oobn, _, _, err := c.conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, buf[:n]...)
+		if oobn > 0 {
+			scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err != nil {
+				return err
+			}
+			for i := range scms {
+				rights, err := syscall.ParseUnixRights(&scms[i])
+				if err != nil {
+					continue
+				}
+				fds = append(fds, rights...)
+			}
+		}
+
+		for {
+			ev, size, err := parseWlEvent(pending)
+			if err != nil {
+				return err
+			}
+			if size == 0 {
+				break
+			}
+			pending = pending[size:]
+			nFds := c.getEventFds(ev.sender, ev.opcode)
+			if nFds > len(fds) {
+				nFds = len(fds)
+			}
+			ev.fds = fds[:nFds:nFds]
+			fds = fds[nFds:]
+			handler := c.getHandler(ev.sender)
+			if handler != nil {
+				handler(ev)
+			}
+			closeFds(ev.fds)
+			if ev.err != nil {
+				logger.Warningf("bad wayland event, object: %d, opcode: %d, err: %v",
+					ev.sender, ev.opcode, ev.err)
+			}
+		}
+		if len(pending) == 0 {
+			pending = nil
+			// fd 和所属消息的数据一起发送，消息都处理完后剩下的 fd 不属于任何事件
+			if len(fds) > 0 {
+				logger.Warningf("close %d unexpected fds", len(fds))
+				closeFds(fds)
+				fds = nil
+			}
+		}
+	}
+}
+
+func (c *wlConn) Close() error {
+	return c.conn.Close()
+}
@@ -9,6 +9,7 @@ import (
 
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/xfixes"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
 )
 
 type XClient interface {
@@ -30,6 +31,7 @@ type XClient interface {
 	Flush() error
 	SelectSelectionInputE(window x.Window, selection x.Atom, eventMask uint32) error
 	ChangeWindowEventMask(win x.Window, evMask uint32) error
+	GetWindowPid(win x.Window) (uint, error)
 }
 
 //go:generate mockery -name XClient
@@ -114,6 +116,33 @@ func (xc *xClient) ChangeWindowEventMask(win x.Window, evMask uint32) error {
 	return x.ChangeWindowAttributesChecked(xc.conn, win, valueMask, []uint32{evMask}).Check(xc.conn)
 }
 
+// 获取窗口所属进程的 PID，selection 的所有者窗口一般是隐藏窗口，没有 _NET_WM_PID 属性时
+// 尝试从 WM_CLIENT_LEADER 指向的窗口获取。
+func (xc *xClient) GetWindowPid(win x.Window) (uint, error) {
+	pid, err := ewmh.GetWMPid(xc.conn, win).Reply(xc.conn)
+	if err == nil {
+		return uint(pid), nil
+	}
+
+	atomClientLeader, err1 := xc.conn.GetAtom("WM_CLIENT_LEADER")
+	if err1 != nil {
+		return 0, err
+	}
+	reply, err1 := x.GetProperty(xc.conn, false, win, atomClientLeader, x.AtomWindow, 0, 1).Reply(xc.conn)
+	if err1 != nil || reply.Format != 32 || len(reply.Value) < 4 {
+		return 0, err
+	}
+	leader := x.Window(x.Get32(reply.Value))
+	if leader == 0 || leader == win {
+		return 0, err
+	}
+	pid, err = ewmh.GetWMPid(xc.conn, leader).Reply(xc.conn)
+	if err != nil {
+		return 0, err
+	}
+	return uint(pid), nil
+}
+
 func (xc *xClient) Conn() *x.Conn {
 	return xc.conn
 }
@@ -34,6 +34,10 @@ type AppEntry struct {
 	IsDocked      bool
 	// dbusutil-gen: equal=method:Equal
 	WindowInfos windowInfosType
+	// 应用通过 Unity LauncherEntry API 设置的计数、进度和紧急状态
+	Badge    int64
+	Progress float64
+	Urgent   bool
 
 	service          *dbusutil.Service
 	manager          *Manager
@@ -65,6 +69,7 @@ func (entry *AppEntry) setAppInfo(newAppInfo *AppInfo) {
 		return
 	}
 	entry.appInfo = newAppInfo
+	entry.updateLauncherEntryState()
 
 	if newAppInfo == nil {
 		entry.winIconPreferred = true
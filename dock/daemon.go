@@ -5,6 +5,8 @@
 package dock
 
 import (
+	"errors"
+
 	"github.com/linuxdeepin/go-lib/log"
 	"github.com/linuxdeepin/dde-daemon/loader"
 
@@ -27,6 +29,12 @@ func (d *Daemon) Stop() error {
 	if dockManager != nil {
 		dockManager.destroy()
 		dockManager = nil
+
+		// 释放服务名，模块被重启时才能再次获取
+		err := loader.GetService().ReleaseName(dbusServiceName)
+		if err != nil {
+			logger.Warning(err)
+		}
 	}
 
 	if globalXConn != nil {
@@ -93,6 +101,19 @@ func (d *Daemon) Start() error {
 	return nil
 }
 
+// CanRestart 实现 loader.Restartable
+func (d *Daemon) CanRestart() bool {
+	return true
+}
+
+// CheckHealth 实现 loader.HealthChecker
+func (d *Daemon) CheckHealth() error {
+	if dockManager == nil {
+		return errors.New("dock manager is nil")
+	}
+	return loader.CheckNameOwned(dbusServiceName)
+}
+
 func (d *Daemon) GetDependencies() []string {
 	return []string{}
 }
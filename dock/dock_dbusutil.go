@@ -109,3 +109,42 @@ func (v *AppEntry) setPropWindowInfos(value windowInfosType) (changed bool) {
 func (v *AppEntry) emitPropChangedWindowInfos(value windowInfosType) error {
 	return v.service.EmitPropertyChanged(v, "WindowInfos", value)
 }
+
+func (v *AppEntry) setPropBadge(value int64) (changed bool) {
+	if v.Badge != value {
+		v.Badge = value
+		v.emitPropChangedBadge(value)
+		return true
+	}
+	return false
+}
+
+func (v *AppEntry) emitPropChangedBadge(value int64) error {
+	return v.service.EmitPropertyChanged(v, "Badge", value)
+}
+
+func (v *AppEntry) setPropProgress(value float64) (changed bool) {
+	if v.Progress != value {
+		v.Progress = value
+		v.emitPropChangedProgress(value)
+		return true
+	}
+	return false
+}
+
+func (v *AppEntry) emitPropChangedProgress(value float64) error {
+	return v.service.EmitPropertyChanged(v, "Progress", value)
+}
+
+func (v *AppEntry) setPropUrgent(value bool) (changed bool) {
+	if v.Urgent != value {
+		v.Urgent = value
+		v.emitPropChangedUrgent(value)
+		return true
+	}
+	return false
+}
+
+func (v *AppEntry) emitPropChangedUrgent(value bool) error {
+	return v.service.EmitPropertyChanged(v, "Urgent", value)
+}
@@ -0,0 +1,472 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+var dockLayoutFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/dock/layout.json")
+
+const dockFolderIdPrefix = "folder-"
+
+// dockFolder 是驻留应用的分组，成员的格式与 DockedApps 相同。
+// 分组显示在第一个成员所在的位置，成员按照它们在 Entries 中的顺序排列，所以用 MoveEntry 移动成员就可以调整分组内的顺序和分组的位置。
+type dockFolder struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// dockLayoutProfile 是一套命名的任务栏布局
+type dockLayoutProfile struct {
+	DockedApps  []string     `json:"docked_apps"`
+	Folders     []dockFolder `json:"folders"`
+	Position    string       `json:"position"`
+	DisplayMode string       `json:"display_mode"`
+	HideMode    string       `json:"hide_mode"`
+}
+
+type dockLayout struct {
+	Folders  []dockFolder                 `json:"folders"`
+	Profiles map[string]dockLayoutProfile `json:"profiles"`
+}
+
+// dockLayoutStorage 保存分组和布局方案
+type dockLayoutStorage struct {
+	mu   sync.Mutex
+	file string
+	data dockLayout
+	// 为 true 时 syncFolders 不修改分组，用于批量修改驻留应用
+	syncDisabled bool
+}
+
+func newDockLayoutStorage(file string) *dockLayoutStorage {
+	s := &dockLayoutStorage{file: file}
+	content, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(content, &s.data)
+		if err != nil {
+			logger.Warning("failed to load dock layout:", err)
+		}
+	} else if !os.IsNotExist(err) {
+		logger.Warning("failed to load dock layout:", err)
+	}
+	if s.data.Profiles == nil {
+		s.data.Profiles = make(map[string]dockLayoutProfile)
+	}
+	return s
+}
+
+// 调用者需要持有 s.mu 锁
+func (s *dockLayoutStorage) save() {
+	err := os.MkdirAll(filepath.Dir(s.file), 0755)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	// 先写入临时文件再重命名，避免写入中断时留下不完整的文件
+	tmpFile := s.file + ".tmp"
+	err = ioutil.WriteFile(tmpFile, content, 0644)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	err = os.Rename(tmpFile, s.file)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+func copyDockFolders(folders []dockFolder) []dockFolder {
+	if folders == nil {
+		return nil
+	}
+	result := make([]dockFolder, len(folders))
+	for i, folder := range folders {
+		folder.Members = append([]string(nil), folder.Members...)
+		result[i] = folder
+	}
+	return result
+}
+
+func (s *dockLayoutStorage) getFolders() []dockFolder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	folders := copyDockFolders(s.data.Folders)
+	if folders == nil {
+		folders = []dockFolder{}
+	}
+	return folders
+}
+
+func (s *dockLayoutStorage) setFolders(folders []dockFolder) {
+	s.mu.Lock()
+	s.data.Folders = copyDockFolders(folders)
+	s.save()
+	s.mu.Unlock()
+}
+
+// 调用者需要持有 s.mu 锁
+func (s *dockLayoutStorage) findFolder(id string) *dockFolder {
+	for i := range s.data.Folders {
+		if s.data.Folders[i].Id == id {
+			return &s.data.Folders[i]
+		}
+	}
+	return nil
+}
+
+// removeMember 把 member 从所有分组中删除，并删除因此变空的分组，调用者需要持有 s.mu 锁
+func (s *dockLayoutStorage) removeMember(member string) {
+	folders := s.data.Folders[:0]
+	for _, folder := range s.data.Folders {
+		folder.Members = removeStr(folder.Members, member)
+		if len(folder.Members) > 0 {
+			folders = append(folders, folder)
+		}
+	}
+	s.data.Folders = folders
+}
+
+func removeStr(list []string, str string) []string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != str {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// 调用者需要持有 s.mu 锁
+func (s *dockLayoutStorage) allocFolderId() string {
+	var max int
+	for _, folder := range s.data.Folders {
+		n, err := strconv.Atoi(strings.TrimPrefix(folder.Id, dockFolderIdPrefix))
+		if err == nil && n > max {
+			max = n
+		}
+	}
+	return dockFolderIdPrefix + strconv.Itoa(max+1)
+}
+
+func checkFolderMembers(members, dockedApps []string) error {
+	for _, member := range members {
+		if !strSliceContains(dockedApps, member) {
+			return fmt.Errorf("%q is not docked", unzipDesktopPath(member))
+		}
+	}
+	return nil
+}
+
+// createFolder 创建分组，成员必须是已驻留的应用，已在其他分组中的成员会从原分组中移出
+func (s *dockLayoutStorage) createFolder(name string, members, dockedApps []string) (string, error) {
+	if name == "" {
+		return "", errors.New("folder name is empty")
+	}
+	members = uniqStrSlice(members)
+	if len(members) == 0 {
+		return "", errors.New("folder members is empty")
+	}
+	err := checkFolderMembers(members, dockedApps)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, member := range members {
+		s.removeMember(member)
+	}
+	id := s.allocFolderId()
+	s.data.Folders = append(s.data.Folders, dockFolder{
+		Id:      id,
+		Name:    name,
+		Members: members,
+	})
+	s.sortFolderMembers(dockedApps)
+	s.save()
+	return id, nil
+}
+
+func (s *dockLayoutStorage) renameFolder(id, name string) error {
+	if name == "" {
+		return errors.New("folder name is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	folder := s.findFolder(id)
+	if folder == nil {
+		return fmt.Errorf("folder %q not found", id)
+	}
+	folder.Name = name
+	s.save()
+	return nil
+}
+
+func (s *dockLayoutStorage) addFolderMember(id, member string, dockedApps []string) error {
+	err := checkFolderMembers([]string{member}, dockedApps)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	folder := s.findFolder(id)
+	if folder == nil {
+		return fmt.Errorf("folder %q not found", id)
+	}
+	if strSliceContains(folder.Members, member) {
+		return nil
+	}
+	s.removeMember(member)
+	// removeMember 可能删除了其他分组，folder 指向的位置已经改变，所以重新查找
+	folder = s.findFolder(id)
+	folder.Members = append(folder.Members, member)
+	s.sortFolderMembers(dockedApps)
+	s.save()
+	return nil
+}
+
+// removeFolderMember 把成员移出分组，分组变空时删除分组
+func (s *dockLayoutStorage) removeFolderMember(id, member string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	folder := s.findFolder(id)
+	if folder == nil {
+		return fmt.Errorf("folder %q not found", id)
+	}
+	if !strSliceContains(folder.Members, member) {
+		return fmt.Errorf("%q is not in folder %q", unzipDesktopPath(member), id)
+	}
+	s.removeMember(member)
+	s.save()
+	return nil
+}
+
+func (s *dockLayoutStorage) deleteFolder(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, folder := range s.data.Folders {
+		if folder.Id == id {
+			s.data.Folders = append(s.data.Folders[:i], s.data.Folders[i+1:]...)
+			s.save()
+			return nil
+		}
+	}
+	return fmt.Errorf("folder %q not found", id)
+}
+
+// 按照成员在 dockedApps 中的顺序排列，调用者需要持有 s.mu 锁
+func (s *dockLayoutStorage) sortFolderMembers(dockedApps []string) {
+	index := make(map[string]int, len(dockedApps))
+	for i, app := range dockedApps {
+		index[app] = i
+	}
+	for _, folder := range s.data.Folders {
+		members := folder.Members
+		sort.SliceStable(members, func(i, j int) bool {
+			return index[members[i]] < index[members[j]]
+		})
+	}
+}
+
+// syncFolders 在驻留应用改变后调用，删除不再驻留的成员和空的分组，并按驻留顺序排列成员，返回分组是否改变
+func (s *dockLayoutStorage) syncFolders(dockedApps []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.syncDisabled {
+		return false
+	}
+	return s.syncFoldersLocked(dockedApps)
+}
+
+// 调用者需要持有 s.mu 锁
+func (s *dockLayoutStorage) syncFoldersLocked(dockedApps []string) bool {
+	old := copyDockFolders(s.data.Folders)
+	for _, folder := range old {
+		for _, member := range folder.Members {
+			if !strSliceContains(dockedApps, member) {
+				s.removeMember(member)
+			}
+		}
+	}
+	s.sortFolderMembers(dockedApps)
+
+	changed := len(old) != len(s.data.Folders)
+	for i := 0; !changed && i < len(old); i++ {
+		changed = !strSliceEqual(old[i].Members, s.data.Folders[i].Members)
+	}
+	if changed {
+		s.save()
+	}
+	return changed
+}
+
+// disableSyncFolders 暂停 syncFolders，批量取消驻留时不会逐个删除分组的成员
+func (s *dockLayoutStorage) disableSyncFolders() {
+	s.mu.Lock()
+	s.syncDisabled = true
+	s.mu.Unlock()
+}
+
+// enableSyncFolders 恢复 syncFolders，并按照 dockedApps 同步一次分组，返回分组是否改变
+func (s *dockLayoutStorage) enableSyncFolders(dockedApps []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncDisabled = false
+	return s.syncFoldersLocked(dockedApps)
+}
+
+func (s *dockLayoutStorage) getProfile(name string) (dockLayoutProfile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile, ok := s.data.Profiles[name]
+	return profile, ok
+}
+
+func (s *dockLayoutStorage) saveProfile(name string, profile dockLayoutProfile) error {
+	if name == "" {
+		return errors.New("profile name is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Profiles[name] = profile
+	s.save()
+	return nil
+}
+
+func (s *dockLayoutStorage) deleteProfile(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Profiles[name]; !ok {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	delete(s.data.Profiles, name)
+	s.save()
+	return nil
+}
+
+func (s *dockLayoutStorage) getProfileNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.data.Profiles))
+	for name := range s.data.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *dockLayoutStorage) getProfiles() map[string]dockLayoutProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profiles := make(map[string]dockLayoutProfile, len(s.data.Profiles))
+	for name, profile := range s.data.Profiles {
+		profiles[name] = profile
+	}
+	return profiles
+}
+
+func (s *dockLayoutStorage) setProfiles(profiles map[string]dockLayoutProfile) {
+	s.mu.Lock()
+	s.data.Profiles = make(map[string]dockLayoutProfile, len(profiles))
+	for name, profile := range profiles {
+		s.data.Profiles[name] = profile
+	}
+	s.save()
+	s.mu.Unlock()
+}
+
+func (m *Manager) emitFoldersChanged() {
+	err := m.service.Emit(m, "FoldersChanged")
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+func (m *Manager) setFolders(folders []dockFolder) {
+	m.layout.setFolders(folders)
+	m.layout.syncFolders(m.DockedApps.Get())
+	m.emitFoldersChanged()
+}
+
+// resetDockedApps 取消驻留所有应用，再按顺序驻留 dockedApps 中存在的应用，
+// 期间不同步分组，完成后同步一次，分组改变时只发送一次 FoldersChanged 信号
+func (m *Manager) resetDockedApps(dockedApps []string) {
+	m.layout.disableSyncFolders()
+	m.redockApps(dockedApps)
+	if m.layout.enableSyncFolders(m.DockedApps.Get()) {
+		m.emitFoldersChanged()
+	}
+}
+
+func (m *Manager) redockApps(dockedApps []string) {
+	for _, value := range m.DockedApps.Get() {
+		desktopFile := unzipDesktopPath(value)
+		_, err := m.requestUndock(desktopFile)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+
+	var index = 0
+	for _, value := range dockedApps {
+		desktopFile := unzipDesktopPath(value)
+		_, err := os.Stat(desktopFile)
+		if err == nil {
+			_, err = m.requestDock(desktopFile, int32(index))
+			if err != nil {
+				logger.Warning(err)
+			} else {
+				index++
+			}
+		}
+	}
+}
+
+func (m *Manager) getCurrentLayoutProfile() dockLayoutProfile {
+	return dockLayoutProfile{
+		DockedApps:  m.DockedApps.Get(),
+		Folders:     m.layout.getFolders(),
+		Position:    m.Position.GetString(),
+		DisplayMode: m.DisplayMode.GetString(),
+		HideMode:    m.HideMode.GetString(),
+	}
+}
+
+func (m *Manager) applyLayoutProfile(profile dockLayoutProfile) {
+	if profile.Position != "" {
+		m.Position.SetString(profile.Position)
+	}
+	if profile.DisplayMode != "" {
+		m.DisplayMode.SetString(profile.DisplayMode)
+	}
+	if profile.HideMode != "" {
+		m.HideMode.SetString(profile.HideMode)
+	}
+	// 驻留应用和分组都设置完成后再同步分组，并且只发送一次 FoldersChanged 信号
+	m.layout.disableSyncFolders()
+	m.redockApps(profile.DockedApps)
+	m.layout.setFolders(profile.Folders)
+	m.layout.enableSyncFolders(m.DockedApps.Get())
+	m.emitFoldersChanged()
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockLayoutFolders(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "layout.json")
+	s := newDockLayoutStorage(file)
+	assert.Empty(t, s.getFolders())
+
+	dockedApps := []string{"/S@a", "/S@b", "/S@c", "/S@d"}
+	_, err := s.createFolder("", []string{"/S@a"}, dockedApps)
+	assert.Error(t, err)
+	_, err = s.createFolder("office", []string{"/S@x"}, dockedApps)
+	assert.Error(t, err)
+
+	// 成员按照驻留顺序排列
+	id1, err := s.createFolder("office", []string{"/S@c", "/S@a"}, dockedApps)
+	require.NoError(t, err)
+	assert.Equal(t, "folder-1", id1)
+	id2, err := s.createFolder("games", []string{"/S@b"}, dockedApps)
+	require.NoError(t, err)
+	assert.Equal(t, "folder-2", id2)
+
+	folders := s.getFolders()
+	require.Len(t, folders, 2)
+	assert.Equal(t, []string{"/S@a", "/S@c"}, folders[0].Members)
+
+	// 修改副本不影响保存的分组
+	folders[0].Members[0] = "/S@z"
+	assert.Equal(t, []string{"/S@a", "/S@c"}, s.getFolders()[0].Members)
+
+	// 把 b 移到 office，games 变空后被删除
+	require.NoError(t, s.addFolderMember(id1, "/S@b", dockedApps))
+	folders = s.getFolders()
+	require.Len(t, folders, 1)
+	assert.Equal(t, []string{"/S@a", "/S@b", "/S@c"}, folders[0].Members)
+	assert.Error(t, s.addFolderMember(id2, "/S@d", dockedApps))
+
+	require.NoError(t, s.renameFolder(id1, "work"))
+	assert.Error(t, s.renameFolder(id1, ""))
+	assert.Error(t, s.removeFolderMember(id1, "/S@d"))
+	require.NoError(t, s.removeFolderMember(id1, "/S@b"))
+
+	// 重新加载
+	s = newDockLayoutStorage(file)
+	folders = s.getFolders()
+	require.Len(t, folders, 1)
+	assert.Equal(t, "work", folders[0].Name)
+	assert.Equal(t, []string{"/S@a", "/S@c"}, folders[0].Members)
+
+	// 移动 entry 和取消驻留
+	assert.False(t, s.syncFolders(dockedApps))
+	assert.True(t, s.syncFolders([]string{"/S@c", "/S@b", "/S@a"}))
+	assert.Equal(t, []string{"/S@c", "/S@a"}, s.getFolders()[0].Members)
+	assert.True(t, s.syncFolders([]string{"/S@b"}))
+	assert.Empty(t, s.getFolders())
+
+	assert.Error(t, s.deleteFolder(id1))
+}
+
+func TestDockLayoutSyncDisabled(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "layout.json")
+	s := newDockLayoutStorage(file)
+	dockedApps := []string{"/S@a", "/S@b", "/S@c"}
+	_, err := s.createFolder("office", []string{"/S@a", "/S@b"}, dockedApps)
+	require.NoError(t, err)
+	_, err = os.Stat(file + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// 重新驻留的过程中不删除分组的成员
+	s.disableSyncFolders()
+	assert.False(t, s.syncFolders(nil))
+	assert.False(t, s.syncFolders([]string{"/S@b"}))
+	assert.Equal(t, []string{"/S@a", "/S@b"}, s.getFolders()[0].Members)
+
+	assert.True(t, s.enableSyncFolders([]string{"/S@b", "/S@c", "/S@a"}))
+	assert.Equal(t, []string{"/S@b", "/S@a"}, s.getFolders()[0].Members)
+	assert.True(t, s.syncFolders([]string{"/S@c"}))
+	assert.Empty(t, s.getFolders())
+
+	s2 := newDockLayoutStorage(file)
+	assert.Empty(t, s2.getFolders())
+}
+
+func TestDockLayoutProfiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "layout.json")
+	s := newDockLayoutStorage(file)
+	assert.Empty(t, s.getProfileNames())
+
+	profile := dockLayoutProfile{
+		DockedApps: []string{"/S@a", "/S@b"},
+		Folders: []dockFolder{
+			{Id: "folder-1", Name: "office", Members: []string{"/S@b"}},
+		},
+		Position:    "bottom",
+		DisplayMode: "efficient",
+		HideMode:    "keep-showing",
+	}
+	assert.Error(t, s.saveProfile("", profile))
+	require.NoError(t, s.saveProfile("work", profile))
+	require.NoError(t, s.saveProfile("presentation", dockLayoutProfile{HideMode: "keep-hidden"}))
+	assert.Equal(t, []string{"presentation", "work"}, s.getProfileNames())
+
+	s = newDockLayoutStorage(file)
+	p, ok := s.getProfile("work")
+	require.True(t, ok)
+	assert.Equal(t, profile, p)
+
+	require.NoError(t, s.deleteProfile("presentation"))
+	assert.Error(t, s.deleteProfile("presentation"))
+	assert.Equal(t, []string{"work"}, s.getProfileNames())
+
+	s.setProfiles(map[string]dockLayoutProfile{"home": {Position: "left"}})
+	assert.Equal(t, []string{"home"}, s.getProfileNames())
+}
@@ -22,6 +22,7 @@ import (
 	sessionmanager "github.com/linuxdeepin/go-dbus-factory/com.deepin.sessionmanager"
 	wm "github.com/linuxdeepin/go-dbus-factory/com.deepin.wm"
 	wmswitcher "github.com/linuxdeepin/go-dbus-factory/com.deepin.wmswitcher"
+	ofdbus "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.dbus"
 	"github.com/linuxdeepin/go-gir/gio-2.0"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/dbusutil/gsprop"
@@ -73,7 +74,11 @@ type Manager struct {
 	entryCount          uint
 	identifyWindowFuns  []*IdentifyWindowFunc
 	identifyKWindowFuns []*IdentifyKWindowFunc
-	windowPatterns      WindowPatterns
+	identifyRules       *identifyRules
+	identifyCache       *identifyCache
+	launcherEntries     *launcherEntries
+	layout              *dockLayoutStorage
+	sessionDBusDaemon   ofdbus.DBus
 
 	forceQuitAppStatus forceQuitAppType
 	windowActMu        sync.Mutex
@@ -102,6 +107,7 @@ type Manager struct {
 
 		PluginSettingsSynced  struct{}
 		DockAppSettingsSynced struct{}
+		FoldersChanged        struct{}
 	}
 }
 
@@ -156,8 +162,10 @@ func (m *Manager) destroy() {
 
 	m.launcher.RemoveHandler(proxy.RemoveAllHandlers)
 	m.ddeLauncher.RemoveHandler(proxy.RemoveAllHandlers)
+	m.sessionDBusDaemon.RemoveHandler(proxy.RemoveAllHandlers)
 	m.sessionSigLoop.Stop()
 	m.syncConfig.Destroy()
+	m.identifyRules.destroy()
 
 	err := m.service.StopExport(m)
 	if err != nil {
@@ -394,6 +402,7 @@ func (m *Manager) requestUndock(desktopFile string) (bool, error) {
 	return true, nil
 }
 
+// MoveEntry 移动 entry，分组中的应用按照 entry 的顺序排列，所以也可以用来调整分组内的顺序
 func (m *Manager) MoveEntry(index, newIndex int32) *dbus.Error {
 	err := m.Entries.Move(int(index), int(newIndex))
 	if err != nil {
@@ -432,6 +441,157 @@ func (m *Manager) QueryWindowIdentifyMethod(wid uint32) (method string, busErr *
 	return "", dbusutil.ToError(fmt.Errorf("window %d not found", wid))
 }
 
+// AddIdentifyRule 添加一条用户窗口识别规则，格式与 window_patterns.json 中的一项相同，
+// 例如 {"rules":[["wmc","=:Foo"]],"ret":"id=foo"}，用户规则优先于系统规则匹配。
+func (m *Manager) AddIdentifyRule(ruleJSON string) *dbus.Error {
+	var pattern WindowPattern
+	err := json.Unmarshal([]byte(ruleJSON), &pattern)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.identifyRules.add(pattern)
+	return dbusutil.ToError(err)
+}
+
+// ListIdentifyRules 按匹配顺序返回所有窗口识别规则，source 为 user 或 system。
+func (m *Manager) ListIdentifyRules() (rulesJSON string, busErr *dbus.Error) {
+	data, err := json.Marshal(m.identifyRules.list())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// RemoveIdentifyRule 删除 ListIdentifyRules 中 source 为 user 的第 index 条规则。
+func (m *Manager) RemoveIdentifyRule(index int32) *dbus.Error {
+	err := m.identifyRules.remove(int(index))
+	return dbusutil.ToError(err)
+}
+
+// GetWindowIdentifyTrace 返回窗口最近一次识别的过程，包括依次尝试的识别函数、各自的结果和耗时，
+// 以及是否使用了识别结果缓存。
+func (m *Manager) GetWindowIdentifyTrace(win uint32) (traceJSON string, busErr *dbus.Error) {
+	winInfo, err := m.getWindowInfo(x.Window(win))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	trace := winInfo.getIdentifyTrace()
+	if trace == nil {
+		return "", dbusutil.ToError(fmt.Errorf("window %d has not been identified", win))
+	}
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// TestIdentify 不使用识别结果缓存，重新识别窗口，返回依次尝试过的识别方式、识别成功的方式及其依据，用于调试窗口分组错误的问题。
+func (m *Manager) TestIdentify(win uint32) (resultJSON string, busErr *dbus.Error) {
+	winInfo, err := m.getWindowInfo(x.Window(win))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := json.Marshal(m.testIdentifyWindow(winInfo))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// CreateFolder 把已驻留的应用放入新的分组，返回分组的 id
+func (m *Manager) CreateFolder(name string, desktopFiles []string) (id string, busErr *dbus.Error) {
+	members := make([]string, len(desktopFiles))
+	for i, desktopFile := range desktopFiles {
+		members[i] = zipDesktopPath(toLocalPath(desktopFile))
+	}
+	id, err := m.layout.createFolder(name, members, m.DockedApps.Get())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	m.emitFoldersChanged()
+	return id, nil
+}
+
+func (m *Manager) RenameFolder(id, name string) *dbus.Error {
+	err := m.layout.renameFolder(id, name)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	m.emitFoldersChanged()
+	return nil
+}
+
+// AddFolderMember 把已驻留的应用放入分组，应用已在其他分组中时从原分组中移出
+func (m *Manager) AddFolderMember(id, desktopFile string) *dbus.Error {
+	member := zipDesktopPath(toLocalPath(desktopFile))
+	err := m.layout.addFolderMember(id, member, m.DockedApps.Get())
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	m.emitFoldersChanged()
+	return nil
+}
+
+// RemoveFolderMember 把应用移出分组，分组变空时删除分组
+func (m *Manager) RemoveFolderMember(id, desktopFile string) *dbus.Error {
+	member := zipDesktopPath(toLocalPath(desktopFile))
+	err := m.layout.removeFolderMember(id, member)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	m.emitFoldersChanged()
+	return nil
+}
+
+// DeleteFolder 删除分组，分组中的应用仍然驻留
+func (m *Manager) DeleteFolder(id string) *dbus.Error {
+	err := m.layout.deleteFolder(id)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	m.emitFoldersChanged()
+	return nil
+}
+
+func (m *Manager) GetFolders() (foldersJSON string, busErr *dbus.Error) {
+	folders := m.layout.getFolders()
+	for i := range folders {
+		for j, member := range folders[i].Members {
+			folders[i].Members[j] = unzipDesktopPath(member)
+		}
+	}
+	data, err := json.Marshal(folders)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SaveLayoutProfile 把当前的驻留应用、分组、位置、显示模式和隐藏模式保存为名为 name 的布局方案，同名的方案会被覆盖
+func (m *Manager) SaveLayoutProfile(name string) *dbus.Error {
+	err := m.layout.saveProfile(name, m.getCurrentLayoutProfile())
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) ApplyLayoutProfile(name string) *dbus.Error {
+	profile, ok := m.layout.getProfile(name)
+	if !ok {
+		return dbusutil.ToError(fmt.Errorf("profile %q not found", name))
+	}
+	m.applyLayoutProfile(profile)
+	return nil
+}
+
+func (m *Manager) DeleteLayoutProfile(name string) *dbus.Error {
+	err := m.layout.deleteProfile(name)
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) GetLayoutProfiles() (names []string, busErr *dbus.Error) {
+	return m.layout.getProfileNames(), nil
+}
+
 func (m *Manager) GetDockedAppsDesktopFiles() (desktopFiles []string, busErr *dbus.Error) {
 	for _, entry := range m.Entries.FilterDocked() {
 		if entry.appInfo != nil {
@@ -123,6 +123,9 @@ func (m *Manager) saveDockedApps() {
 		list = append(list, zipDesktopPath(path))
 	}
 	m.DockedApps.Set(list)
+	if m.layout.syncFolders(list) {
+		m.emitFoldersChanged()
+	}
 }
 
 func needScratchDesktop(appInfo *AppInfo) bool {
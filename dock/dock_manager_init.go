@@ -18,6 +18,7 @@ import (
 	sessionmanager "github.com/linuxdeepin/go-dbus-factory/com.deepin.sessionmanager"
 	wm "github.com/linuxdeepin/go-dbus-factory/com.deepin.wm"
 	wmswitcher "github.com/linuxdeepin/go-dbus-factory/com.deepin.wmswitcher"
+	ofdbus "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.dbus"
 	gio "github.com/linuxdeepin/go-gir/gio-2.0"
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/gsettings"
@@ -190,6 +191,8 @@ func (m *Manager) listenLauncherSignal() {
 		categoryID int64) {
 		logger.Debugf("launcher item changed status: %s, itemInfo: %#v",
 			status, itemInfo)
+		// desktop 文件改变后，之前的窗口识别结果可能不再有效
+		m.identifyCache.clear()
 		switch status {
 		case "deleted":
 			m.handleLauncherItemDeleted(itemInfo)
@@ -254,10 +257,12 @@ func (m *Manager) init() error {
 	m.listenSettingsChanged()
 
 	m.windowInfoMap = make(map[x.Window]WindowInfoImp)
-	m.windowPatterns, err = loadWindowPatterns(windowPatternsFile)
-	if err != nil {
-		logger.Warning("loadWindowPatterns failed:", err)
-	}
+	m.identifyCache = newIdentifyCache()
+	m.launcherEntries = newLauncherEntries()
+	m.layout = newDockLayoutStorage(dockLayoutFile)
+	m.identifyRules = newIdentifyRules(windowPatternsFile, userWindowPatternsFile)
+	m.identifyRules.changedCb = m.identifyCache.clear
+	m.identifyRules.watch()
 
 	sessionBus := m.service.Conn()
 	m.wm = wm.NewWm(sessionBus)
@@ -269,6 +274,7 @@ func (m *Manager) init() error {
 	m.appsObj = libApps.NewApps(systemBus)
 	m.launcher = launcher.NewLauncher(sessionBus)
 	m.ddeLauncher = libDDELauncher.NewLauncher(sessionBus)
+	m.sessionDBusDaemon = ofdbus.NewDBus(sessionBus)
 	m.startManager = sessionmanager.NewStartManager(sessionBus)
 	m.wmSwitcher = wmswitcher.NewWMSwitcher(sessionBus)
 
@@ -287,6 +293,7 @@ func (m *Manager) init() error {
 	m.listenLauncherSignal()
 	m.listenWMSwitcherSignal()
 	m.listenWMSignal()
+	m.listenLauncherEntrySignal()
 	if strings.Contains(sessionType, "wayland") {
 		m.listenWaylandWMSignals()
 	}
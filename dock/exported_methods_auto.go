@@ -62,6 +62,21 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.ActivateWindow,
 			InArgs: []string{"win"},
 		},
+		{
+			Name:   "AddFolderMember",
+			Fn:     v.AddFolderMember,
+			InArgs: []string{"id", "desktopFile"},
+		},
+		{
+			Name:   "AddIdentifyRule",
+			Fn:     v.AddIdentifyRule,
+			InArgs: []string{"ruleJSON"},
+		},
+		{
+			Name:   "ApplyLayoutProfile",
+			Fn:     v.ApplyLayoutProfile,
+			InArgs: []string{"name"},
+		},
 		{
 			Name: "CancelPreviewWindow",
 			Fn:   v.CancelPreviewWindow,
@@ -71,6 +86,22 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.CloseWindow,
 			InArgs: []string{"win"},
 		},
+		{
+			Name:    "CreateFolder",
+			Fn:      v.CreateFolder,
+			InArgs:  []string{"name", "desktopFiles"},
+			OutArgs: []string{"id"},
+		},
+		{
+			Name:   "DeleteFolder",
+			Fn:     v.DeleteFolder,
+			InArgs: []string{"id"},
+		},
+		{
+			Name:   "DeleteLayoutProfile",
+			Fn:     v.DeleteLayoutProfile,
+			InArgs: []string{"name"},
+		},
 		{
 			Name:    "GetDockedAppsDesktopFiles",
 			Fn:      v.GetDockedAppsDesktopFiles,
@@ -81,11 +112,27 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:      v.GetEntryIDs,
 			OutArgs: []string{"list"},
 		},
+		{
+			Name:    "GetFolders",
+			Fn:      v.GetFolders,
+			OutArgs: []string{"foldersJSON"},
+		},
+		{
+			Name:    "GetLayoutProfiles",
+			Fn:      v.GetLayoutProfiles,
+			OutArgs: []string{"names"},
+		},
 		{
 			Name:    "GetPluginSettings",
 			Fn:      v.GetPluginSettings,
 			OutArgs: []string{"jsonStr"},
 		},
+		{
+			Name:    "GetWindowIdentifyTrace",
+			Fn:      v.GetWindowIdentifyTrace,
+			InArgs:  []string{"win"},
+			OutArgs: []string{"traceJSON"},
+		},
 		{
 			Name:    "IsDocked",
 			Fn:      v.IsDocked,
@@ -98,6 +145,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			InArgs:  []string{"desktopFile"},
 			OutArgs: []string{"onDock"},
 		},
+		{
+			Name:    "ListIdentifyRules",
+			Fn:      v.ListIdentifyRules,
+			OutArgs: []string{"rulesJSON"},
+		},
 		{
 			Name:   "MakeWindowAbove",
 			Fn:     v.MakeWindowAbove,
@@ -139,11 +191,26 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			InArgs:  []string{"wid"},
 			OutArgs: []string{"method"},
 		},
+		{
+			Name:   "RemoveFolderMember",
+			Fn:     v.RemoveFolderMember,
+			InArgs: []string{"id", "desktopFile"},
+		},
+		{
+			Name:   "RemoveIdentifyRule",
+			Fn:     v.RemoveIdentifyRule,
+			InArgs: []string{"index"},
+		},
 		{
 			Name:   "RemovePluginSettings",
 			Fn:     v.RemovePluginSettings,
 			InArgs: []string{"key1", "key2List"},
 		},
+		{
+			Name:   "RenameFolder",
+			Fn:     v.RenameFolder,
+			InArgs: []string{"id", "name"},
+		},
 		{
 			Name:    "RequestDock",
 			Fn:      v.RequestDock,
@@ -156,6 +223,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			InArgs:  []string{"desktopFile"},
 			OutArgs: []string{"undocked"},
 		},
+		{
+			Name:   "SaveLayoutProfile",
+			Fn:     v.SaveLayoutProfile,
+			InArgs: []string{"name"},
+		},
 		{
 			Name:   "SetFrontendWindowRect",
 			Fn:     v.SetFrontendWindowRect,
@@ -166,5 +238,11 @@ func (v *Manager) GetExportedMethods() dbusutil.ExportedMethods {
 			Fn:     v.SetPluginSettings,
 			InArgs: []string{"jsonStr"},
 		},
+		{
+			Name:    "TestIdentify",
+			Fn:      v.TestIdentify,
+			InArgs:  []string{"win"},
+			OutArgs: []string{"resultJSON"},
+		},
 	}
 }
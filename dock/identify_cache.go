@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linuxdeepin/go-lib/strv"
+)
+
+const identifyCacheMaxSize = 256
+
+// 这些识别方式的结果不只取决于 identifyCacheKey 中的信息，不能缓存，
+// 比如 PidEnv 依赖进程的环境变量，Scratch 依赖 scratch 目录中的文件，
+// Rule 的规则可以匹配 wmn、env.*、wmrole 和 hasPid，FlatpakAppID 依赖窗口的 flatpak app id
+var identifyUncacheableMethods = strv.Strv{"Android", "Pid", "PidEnv", "Scratch", "Rule", "FlatpakAppID"}
+
+func isIdentifyMethodCacheable(method string) bool {
+	return method != "" && !identifyUncacheableMethods.Contains(method)
+}
+
+// identifyCacheKey 中的信息相同的窗口，识别结果也相同
+type identifyCacheKey struct {
+	exe        string
+	cmdline    string
+	wmInstance string
+	wmClass    string
+	gtkAppId   string
+}
+
+func getIdentifyCacheKey(winInfo *WindowInfo) (identifyCacheKey, bool) {
+	process := winInfo.process
+	if process == nil || winInfo.innerId == "" {
+		return identifyCacheKey{}, false
+	}
+
+	key := identifyCacheKey{
+		exe:      process.exe,
+		cmdline:  strings.Join(process.cmdline, "\x00"),
+		gtkAppId: winInfo.gtkAppId,
+	}
+	if winInfo.wmClass != nil {
+		key.wmInstance = winInfo.wmClass.Instance
+		key.wmClass = winInfo.wmClass.Class
+	}
+	return key, true
+}
+
+type identifyCacheItem struct {
+	desktopFile string
+	// 识别成功的 IdentifyWindowFunc 的名称
+	method string
+	// AppInfo.identifyMethod，可能包含 +FixAutostart 后缀
+	identifyMethod string
+}
+
+// identifyCache 缓存窗口识别的结果，desktop 文件或者窗口识别规则改变时清空。
+type identifyCache struct {
+	mu    sync.Mutex
+	items map[identifyCacheKey]identifyCacheItem
+}
+
+func newIdentifyCache() *identifyCache {
+	return &identifyCache{
+		items: make(map[identifyCacheKey]identifyCacheItem),
+	}
+}
+
+func (c *identifyCache) get(key identifyCacheKey) (identifyCacheItem, bool) {
+	c.mu.Lock()
+	item, ok := c.items[key]
+	c.mu.Unlock()
+	return item, ok
+}
+
+func (c *identifyCache) set(key identifyCacheKey, item identifyCacheItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.items) >= identifyCacheMaxSize {
+		c.items = make(map[identifyCacheKey]identifyCacheItem)
+	}
+	c.items[key] = item
+}
+
+func (c *identifyCache) remove(key identifyCacheKey) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
+
+func (c *identifyCache) clear() {
+	c.mu.Lock()
+	if len(c.items) > 0 {
+		logger.Debug("clear identify cache")
+		c.items = make(map[identifyCacheKey]identifyCacheItem)
+	}
+	c.mu.Unlock()
+}
+
+// identifyStep 记录一个识别函数的执行结果，InnerId 不为空表示识别成功
+type identifyStep struct {
+	Name        string `json:"name"`
+	InnerId     string `json:"innerId"`
+	DesktopFile string `json:"desktopFile"`
+	DurationUs  int64  `json:"durationUs"`
+}
+
+// identifyTrace 记录一次窗口识别的过程，用于诊断识别缓慢或者错误的问题。
+type identifyTrace struct {
+	Time        time.Time      `json:"time"`
+	Cached      bool           `json:"cached"`
+	Steps       []identifyStep `json:"steps"`
+	Method      string         `json:"method"`
+	InnerId     string         `json:"innerId"`
+	DesktopFile string         `json:"desktopFile"`
+	DurationUs  int64          `json:"durationUs"`
+}
+
+func newIdentifyTrace() *identifyTrace {
+	return &identifyTrace{
+		Time: time.Now(),
+	}
+}
+
+func (t *identifyTrace) addStep(name string, start time.Time, innerId string, appInfo *AppInfo) {
+	step := identifyStep{
+		Name:       name,
+		InnerId:    innerId,
+		DurationUs: time.Since(start).Microseconds(),
+	}
+	if appInfo != nil {
+		step.DesktopFile = appInfo.GetFileName()
+	}
+	t.Steps = append(t.Steps, step)
+}
+
+func (t *identifyTrace) finish(innerId string, appInfo *AppInfo) {
+	t.InnerId = innerId
+	if appInfo != nil {
+		t.DesktopFile = appInfo.GetFileName()
+	}
+	t.DurationUs = time.Since(t.Time).Microseconds()
+}
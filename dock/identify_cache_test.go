@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetIdentifyCacheKey(t *testing.T) {
+	winInfo := &WindowInfo{}
+	winInfo.innerId = "w:1234"
+	_, ok := getIdentifyCacheKey(winInfo)
+	assert.False(t, ok)
+
+	winInfo.process = &ProcessInfo{
+		exe:     "/usr/bin/java",
+		cmdline: []string{"java", "-jar", "foo.jar"},
+	}
+	winInfo.wmClass = &icccm.WMClass{Instance: "foo", Class: "Foo"}
+	key1, ok := getIdentifyCacheKey(winInfo)
+	require.True(t, ok)
+
+	winInfo.process.cmdline = []string{"java", "-jar", "bar.jar"}
+	key2, ok := getIdentifyCacheKey(winInfo)
+	require.True(t, ok)
+	assert.NotEqual(t, key1, key2)
+
+	winInfo.innerId = ""
+	_, ok = getIdentifyCacheKey(winInfo)
+	assert.False(t, ok)
+}
+
+func TestIdentifyCache(t *testing.T) {
+	assert.True(t, isIdentifyMethodCacheable("Bamf"))
+	assert.False(t, isIdentifyMethodCacheable("Pid"))
+	assert.False(t, isIdentifyMethodCacheable("PidEnv"))
+	assert.False(t, isIdentifyMethodCacheable("Scratch"))
+	assert.False(t, isIdentifyMethodCacheable("Rule"))
+	assert.False(t, isIdentifyMethodCacheable("FlatpakAppID"))
+	assert.False(t, isIdentifyMethodCacheable(""))
+
+	c := newIdentifyCache()
+	key := identifyCacheKey{exe: "/usr/bin/foo"}
+	item := identifyCacheItem{desktopFile: "/usr/share/applications/foo.desktop", method: "Bamf", identifyMethod: "Bamf"}
+	c.set(key, item)
+	v, ok := c.get(key)
+	assert.True(t, ok)
+	assert.Equal(t, item, v)
+
+	c.remove(key)
+	_, ok = c.get(key)
+	assert.False(t, ok)
+
+	for i := 0; i < identifyCacheMaxSize; i++ {
+		c.set(identifyCacheKey{exe: fmt.Sprint(i)}, item)
+	}
+	c.set(key, item)
+	assert.Len(t, c.items, 1)
+
+	c.clear()
+	_, ok = c.get(key)
+	assert.False(t, ok)
+}
+
+func TestIdentifyTrace(t *testing.T) {
+	trace := newIdentifyTrace()
+	trace.addStep("PidEnv", time.Now(), "", nil)
+	appInfo := &AppInfo{filename: "/usr/share/applications/foo.desktop", innerId: "d:foo"}
+	trace.addStep("Bamf", time.Now().Add(-time.Millisecond), appInfo.innerId, appInfo)
+	trace.Method = "Bamf"
+	trace.finish(appInfo.innerId, appInfo)
+
+	require.Len(t, trace.Steps, 2)
+	assert.Equal(t, "", trace.Steps[0].InnerId)
+	assert.Equal(t, "d:foo", trace.Steps[1].InnerId)
+	assert.Equal(t, appInfo.filename, trace.Steps[1].DesktopFile)
+	assert.True(t, trace.Steps[1].DurationUs >= 1000)
+	assert.Equal(t, appInfo.filename, trace.DesktopFile)
+	assert.False(t, trace.Cached)
+}
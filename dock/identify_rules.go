@@ -0,0 +1,399 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+// 用户自定义的窗口识别规则，格式与系统的 window_patterns.json 相同，匹配时优先于系统规则。
+var userWindowPatternsFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/dock/window_patterns.json")
+
+const (
+	identifyRuleSourceUser   = "user"
+	identifyRuleSourceSystem = "system"
+)
+
+// identifyRules 合并了系统和用户的窗口识别规则，用户规则文件变化时会自动重新加载。
+type identifyRules struct {
+	mu       sync.RWMutex
+	system   WindowPatterns
+	user     WindowPatterns
+	userFile string
+	// 用户规则改变后调用
+	changedCb func()
+
+	fsWatcher   *fsnotify.Watcher
+	timerMu     sync.Mutex
+	reloadTimer *time.Timer // 由 timerMu 保护
+	done        chan struct{}
+}
+
+type identifyRuleMatch struct {
+	source  string
+	index   int
+	pattern *WindowPattern
+}
+
+// identifyRuleInfo 用于 ListIdentifyRules 和 TestIdentify 的 JSON 输出
+type identifyRuleInfo struct {
+	Source string       `json:"source"`
+	Index  int          `json:"index"`
+	Rules  []WindowRule `json:"rules"`
+	Result string       `json:"ret"`
+}
+
+func newIdentifyRules(systemFile, userFile string) *identifyRules {
+	r := &identifyRules{
+		userFile: userFile,
+		done:     make(chan struct{}),
+	}
+
+	var err error
+	r.system, err = loadWindowPatterns(systemFile)
+	if err != nil {
+		logger.Warning("loadWindowPatterns failed:", err)
+	}
+
+	err = r.loadUser()
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("load user window patterns failed:", err)
+	}
+	return r
+}
+
+// loadUser 加载用户规则文件，丢弃其中无效的规则。
+// 文件不存在时清空用户规则，读取或者解析失败时保留之前的规则，避免编辑文件的过程中规则丢失。
+func (r *identifyRules) loadUser() error {
+	patterns, err := loadWindowPatterns(r.userFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.mu.Lock()
+			r.user = nil
+			r.mu.Unlock()
+			r.emitChanged()
+		}
+		return err
+	}
+
+	valid := patterns[:0]
+	for i := range patterns {
+		err = patterns[i].check()
+		if err != nil {
+			logger.Warningf("ignore user window pattern %d: %v", i, err)
+			continue
+		}
+		valid = append(valid, patterns[i])
+	}
+
+	r.mu.Lock()
+	r.user = valid
+	r.mu.Unlock()
+	r.emitChanged()
+	return nil
+}
+
+func (r *identifyRules) emitChanged() {
+	if r.changedCb != nil {
+		r.changedCb()
+	}
+}
+
+// 调用者需要持有 r.mu 锁
+func (r *identifyRules) save() error {
+	err := os.MkdirAll(filepath.Dir(r.userFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	patterns := r.user
+	if patterns == nil {
+		patterns = WindowPatterns{}
+	}
+	data, err := json.MarshalIndent(patterns, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.userFile, data, 0644)
+}
+
+func (r *identifyRules) add(pattern WindowPattern) error {
+	err := pattern.check()
+	if err != nil {
+		return err
+	}
+	pattern.parse()
+
+	r.mu.Lock()
+	r.user = append(r.user, pattern)
+	err = r.save()
+	if err != nil {
+		r.user = r.user[:len(r.user)-1]
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+	r.emitChanged()
+	return nil
+}
+
+func (r *identifyRules) remove(index int) error {
+	r.mu.Lock()
+	if index < 0 || index >= len(r.user) {
+		r.mu.Unlock()
+		return fmt.Errorf("invalid user rule index %d", index)
+	}
+
+	old := r.user
+	r.user = make(WindowPatterns, 0, len(old)-1)
+	r.user = append(r.user, old[:index]...)
+	r.user = append(r.user, old[index+1:]...)
+	err := r.save()
+	if err != nil {
+		r.user = old
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+	r.emitChanged()
+	return nil
+}
+
+// list 按匹配顺序返回所有规则，用户规则在前
+func (r *identifyRules) list() []identifyRuleInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]identifyRuleInfo, 0, len(r.user)+len(r.system))
+	for i, pattern := range r.user {
+		result = append(result, newIdentifyRuleInfo(identifyRuleSourceUser, i, &pattern))
+	}
+	for i, pattern := range r.system {
+		result = append(result, newIdentifyRuleInfo(identifyRuleSourceSystem, i, &pattern))
+	}
+	return result
+}
+
+func newIdentifyRuleInfo(source string, index int, pattern *WindowPattern) identifyRuleInfo {
+	return identifyRuleInfo{
+		Source: source,
+		Index:  index,
+		Rules:  pattern.Rules,
+		Result: pattern.Result,
+	}
+}
+
+func (r *identifyRules) match(winInfo *WindowInfo) *identifyRuleMatch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if idx := r.user.matchIndex(winInfo); idx >= 0 {
+		return &identifyRuleMatch{source: identifyRuleSourceUser, index: idx, pattern: &r.user[idx]}
+	}
+	if idx := r.system.matchIndex(winInfo); idx >= 0 {
+		return &identifyRuleMatch{source: identifyRuleSourceSystem, index: idx, pattern: &r.system[idx]}
+	}
+	return nil
+}
+
+// watch 监听用户规则文件所在的目录，文件变化时重新加载
+func (r *identifyRules) watch() {
+	dir := filepath.Dir(r.userFile)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	r.fsWatcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warning("new fs watcher failed:", err)
+		return
+	}
+	err = r.fsWatcher.Add(dir)
+	if err != nil {
+		logger.Warning(err)
+	}
+	go r.handleFileEvents()
+}
+
+func (r *identifyRules) handleFileEvents() {
+	watcher := r.fsWatcher
+	defer watcher.Close()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				logger.Error("Invalid watcher event:", event)
+				return
+			}
+
+			if filepath.Base(event.Name) == filepath.Base(r.userFile) {
+				logger.Debug("event:", event)
+				r.deferReload()
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// 出错后继续监听，不能停止用户规则的重新加载
+			logger.Warning("error:", err)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *identifyRules) deferReload() {
+	delay := 500 * time.Millisecond
+	r.timerMu.Lock()
+	defer r.timerMu.Unlock()
+	select {
+	case <-r.done:
+		// 已经 destroy
+		return
+	default:
+	}
+	if r.reloadTimer == nil {
+		r.reloadTimer = time.AfterFunc(delay, func() {
+			err := r.loadUser()
+			if err != nil && !os.IsNotExist(err) {
+				logger.Warning("reload user window patterns failed:", err)
+				return
+			}
+			logger.Debug("user window patterns reloaded")
+		})
+	} else {
+		r.reloadTimer.Reset(delay)
+	}
+}
+
+func (r *identifyRules) destroy() {
+	r.timerMu.Lock()
+	if r.reloadTimer != nil {
+		r.reloadTimer.Stop()
+		r.reloadTimer = nil
+	}
+	close(r.done)
+	r.timerMu.Unlock()
+}
+
+// 各个窗口识别方式所依据的信息
+var identifyMethodReasons = map[string]string{
+	"Android":             "window is an uengine android app",
+	"PidEnv":              "GIO_LAUNCHED_DESKTOP_FILE in the environment of the window process",
+	"CmdlineTurboBooster": "desktop file in the command line of the window process",
+	"Cmdline-XWalk":       "manifest.json of the xwalk app in the command line",
+	"FlatpakAppID":        "flatpak app id of the window",
+	"CrxId":               "chromium app id in WM_CLASS instance",
+	"Rule":                "window identification rule",
+	"Bamf":                "desktop file reported by bamf",
+	"Pid":                 "another window of the same process is on the dock",
+	"Scratch":             "desktop file in the scratch dir",
+	"GtkAppId":            "_GTK_APPLICATION_ID of the window",
+	"WmClass":             "WM_CLASS of the window",
+	"ExeEnv":              "GIO_LAUNCHED_DESKTOP_FILE of the process whose exe matches the app id",
+	"AppId":               "app id of the wayland window",
+}
+
+// identifyTestResult 是 TestIdentify 的返回结果
+type identifyTestResult struct {
+	Window      uint32            `json:"window"`
+	Steps       []identifyStep    `json:"steps"`
+	Method      string            `json:"method"`
+	Reason      string            `json:"reason"`
+	InnerId     string            `json:"innerId"`
+	DesktopFile string            `json:"desktopFile"`
+	Rule        *identifyRuleInfo `json:"rule,omitempty"`
+	Props       map[string]string `json:"props"`
+}
+
+// testIdentifyWindow 不使用识别结果缓存，重新识别窗口
+func (m *Manager) testIdentifyWindow(winInfo WindowInfoImp) *identifyTestResult {
+	var innerId string
+	var appInfo *AppInfo
+	trace := newIdentifyTrace()
+	result := &identifyTestResult{
+		Window: uint32(winInfo.getXid()),
+	}
+
+	switch winInfo := winInfo.(type) {
+	case *WindowInfo:
+		innerId, appInfo = m.identifyWindowX(winInfo, trace)
+		if trace.Method == "Rule" {
+			match := m.identifyRules.match(winInfo)
+			if match != nil {
+				info := newIdentifyRuleInfo(match.source, match.index, match.pattern)
+				result.Rule = &info
+				result.Reason = describeRuleMatch(winInfo, match)
+			}
+		}
+		result.Props = getIdentifyProps(winInfo)
+
+	case *KWindowInfo:
+		innerId, appInfo = m.identifyWindowK(winInfo, trace)
+		result.Props = map[string]string{
+			"appId": winInfo.appId,
+			"title": winInfo.getTitle(),
+		}
+		if winInfo.process != nil {
+			result.Props["exec"] = filepath.Base(winInfo.process.exe)
+			result.Props["arg"] = strings.Join(winInfo.process.args, " ")
+		}
+	}
+
+	result.Steps = trace.Steps
+	result.InnerId = innerId
+	result.Method = trace.Method
+	if appInfo != nil {
+		// identifyMethod 中可能包含 +FixAutostart 后缀
+		if appInfo.identifyMethod != "" {
+			result.Method = appInfo.identifyMethod
+		}
+		result.DesktopFile = appInfo.GetFileName()
+	}
+	if trace.Method == "" {
+		result.Reason = "no identify method matched"
+	} else if result.Reason == "" {
+		result.Reason = identifyMethodReasons[trace.Method]
+	}
+	return result
+}
+
+// describeRuleMatch 说明规则中的每一项为什么匹配，例如 wmc "Foo" equal "Foo"
+func describeRuleMatch(winInfo *WindowInfo, match *identifyRuleMatch) string {
+	parts := make([]string, len(match.pattern.ParsedRules))
+	for i, rule := range match.pattern.ParsedRules {
+		parts[i] = fmt.Sprintf("%s %q %v", rule.Key, parseRuleKey(winInfo, rule.Key), rule.ValueParsed)
+	}
+	return fmt.Sprintf("%s rule %d matched: %s => %s", match.source, match.index,
+		strings.Join(parts, ", "), match.pattern.Result)
+}
+
+// getIdentifyProps 返回窗口识别规则中可以使用的窗口属性
+func getIdentifyProps(winInfo *WindowInfo) map[string]string {
+	props := make(map[string]string)
+	for _, key := range []string{"hasPid", "exec", "arg", "wmi", "wmc", "wmn", "wmrole"} {
+		props[key] = parseRuleKey(winInfo, key)
+	}
+	props["innerId"] = winInfo.innerId
+	props["gtkAppId"] = winInfo.gtkAppId
+	props["flatpakAppID"] = winInfo.flatpakAppID
+	if winInfo.process != nil {
+		props["env.GIO_LAUNCHED_DESKTOP_FILE"] = winInfo.process.environ.Get("GIO_LAUNCHED_DESKTOP_FILE")
+	}
+	return props
+}
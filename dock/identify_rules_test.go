@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowPatternCheck(t *testing.T) {
+	valid := []WindowPattern{
+		{Rules: []WindowRule{{"wmc", "=:Foo"}}, Result: "id=foo"},
+		{Rules: []WindowRule{{"exec", "r:^java$"}, {"env.APP", "c!bar"}}, Result: "env"},
+	}
+	for _, pattern := range valid {
+		assert.NoError(t, pattern.check(), pattern)
+	}
+
+	invalid := []WindowPattern{
+		{Result: "id=foo"},
+		{Rules: []WindowRule{{"unknown", "=:Foo"}}, Result: "id=foo"},
+		{Rules: []WindowRule{{"env.", "=:Foo"}}, Result: "id=foo"},
+		{Rules: []WindowRule{{"wmc", "x:Foo"}}, Result: "id=foo"},
+		{Rules: []WindowRule{{"wmc", "R:("}}, Result: "id=foo"},
+		{Rules: []WindowRule{{"wmc", "=:Foo"}}, Result: "id="},
+		{Rules: []WindowRule{{"wmc", "=:Foo"}}, Result: "foo"},
+	}
+	for _, pattern := range invalid {
+		assert.Error(t, pattern.check(), pattern)
+	}
+}
+
+func TestIdentifyRules(t *testing.T) {
+	dir := t.TempDir()
+	systemFile := filepath.Join(dir, "system.json")
+	userFile := filepath.Join(dir, "user/window_patterns.json")
+	err := ioutil.WriteFile(systemFile, []byte(`[{"rules":[["wmc","e:foo"]],"ret":"id=system-foo"}]`), 0644)
+	require.NoError(t, err)
+
+	r := newIdentifyRules(systemFile, userFile)
+	var changed int
+	r.changedCb = func() {
+		changed++
+	}
+	winInfo := &WindowInfo{
+		wmClass: &icccm.WMClass{Instance: "foo", Class: "Foo"},
+	}
+	match := r.match(winInfo)
+	require.NotNil(t, match)
+	assert.Equal(t, identifyRuleSourceSystem, match.source)
+	assert.Equal(t, "id=system-foo", match.pattern.Result)
+
+	// 用户规则优先于系统规则
+	err = r.add(WindowPattern{Rules: []WindowRule{{"wmi", "=:foo"}}, Result: "id=user-foo"})
+	require.NoError(t, err)
+	assert.Error(t, r.add(WindowPattern{Rules: []WindowRule{{"wmi", "=:foo"}}, Result: "bad"}))
+	assert.Equal(t, 1, changed)
+	match = r.match(winInfo)
+	require.NotNil(t, match)
+	assert.Equal(t, identifyRuleSourceUser, match.source)
+	assert.Equal(t, 0, match.index)
+	assert.Equal(t, "id=user-foo", match.pattern.Result)
+
+	rules := r.list()
+	require.Len(t, rules, 2)
+	assert.Equal(t, identifyRuleSourceUser, rules[0].Source)
+	assert.Equal(t, identifyRuleSourceSystem, rules[1].Source)
+
+	// 重新加载保存的用户规则文件
+	r2 := newIdentifyRules(systemFile, userFile)
+	match = r2.match(winInfo)
+	require.NotNil(t, match)
+	assert.Equal(t, "id=user-foo", match.pattern.Result)
+
+	assert.Error(t, r2.remove(1))
+	require.NoError(t, r2.remove(0))
+	require.NoError(t, r.loadUser())
+	assert.Equal(t, 2, changed)
+	match = r.match(winInfo)
+	require.NotNil(t, match)
+	assert.Equal(t, identifyRuleSourceSystem, match.source)
+
+	// 解析失败时保留之前的规则
+	require.NoError(t, r.add(WindowPattern{Rules: []WindowRule{{"wmi", "=:foo"}}, Result: "id=user-foo"}))
+	require.NoError(t, ioutil.WriteFile(userFile, []byte(`[{"rules":`), 0644))
+	assert.Error(t, r.loadUser())
+	assert.Equal(t, 3, changed)
+	match = r.match(winInfo)
+	require.NotNil(t, match)
+	assert.Equal(t, "id=user-foo", match.pattern.Result)
+
+	// 文件删除后清空用户规则
+	require.NoError(t, os.Remove(userFile))
+	assert.True(t, os.IsNotExist(r.loadUser()))
+	assert.Equal(t, 4, changed)
+	match = r.match(winInfo)
+	require.NotNil(t, match)
+	assert.Equal(t, identifyRuleSourceSystem, match.source)
+}
+
+func TestIdentifyRulesDeferReload(t *testing.T) {
+	dir := t.TempDir()
+	r := newIdentifyRules(filepath.Join(dir, "system.json"), filepath.Join(dir, "user.json"))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			r.deferReload()
+		}
+		close(done)
+	}()
+	r.deferReload()
+	r.destroy()
+	<-done
+
+	// destroy 之后不再重新加载
+	r.deferReload()
+	r.timerMu.Lock()
+	assert.Nil(t, r.reloadTimer)
+	r.timerMu.Unlock()
+}
@@ -75,14 +75,49 @@ func (m *Manager) registerIdentifyKWindowFunc(name string, fn _IdentifyKWindowFu
 }
 
 func (m *Manager) identifyWindow(winInfo WindowInfoImp) (innerId string, appInfo *AppInfo) {
+	trace := newIdentifyTrace()
 	switch winType := winInfo.(type) {
 	case *WindowInfo:
-		return m.identifyWindowX(winType)
+		innerId, appInfo = m.identifyWindowXCached(winType, trace)
 	case *KWindowInfo:
-		return m.identifyWindowK(winType)
+		innerId, appInfo = m.identifyWindowK(winType, trace)
 	default:
 		return "", nil
 	}
+	trace.finish(innerId, appInfo)
+	winInfo.setIdentifyTrace(trace)
+	return
+}
+
+// identifyWindowXCached 先查找识别结果缓存，未命中时再依次尝试各个识别函数，并缓存识别结果
+func (m *Manager) identifyWindowXCached(winInfo *WindowInfo, trace *identifyTrace) (string, *AppInfo) {
+	key, ok := getIdentifyCacheKey(winInfo)
+	if !ok {
+		return m.identifyWindowX(winInfo, trace)
+	}
+
+	item, ok := m.identifyCache.get(key)
+	if ok {
+		appInfo := NewAppInfoFromFile(item.desktopFile)
+		if appInfo != nil {
+			logger.Debugf("identifyWindow: cache hit, win: %d, desktop file: %q", winInfo.xid, item.desktopFile)
+			appInfo.identifyMethod = item.identifyMethod
+			trace.Cached = true
+			trace.Method = item.method
+			return appInfo.innerId, appInfo
+		}
+		m.identifyCache.remove(key)
+	}
+
+	innerId, appInfo := m.identifyWindowX(winInfo, trace)
+	if appInfo != nil && isIdentifyMethodCacheable(trace.Method) {
+		m.identifyCache.set(key, identifyCacheItem{
+			desktopFile:    appInfo.GetFileName(),
+			method:         trace.Method,
+			identifyMethod: appInfo.identifyMethod,
+		})
+	}
+	return innerId, appInfo
 }
 
 func identifyKWindowByWMClass(m *Manager, winInfo *KWindowInfo) (innerId string, appInfo *AppInfo) {
@@ -116,7 +151,7 @@ func identifyKWindowByWMClass(m *Manager, winInfo *KWindowInfo) (innerId string,
 	return
 }
 
-func (m *Manager) identifyWindowK(winInfo *KWindowInfo) (innerId string, appInfo *AppInfo) {
+func (m *Manager) identifyWindowK(winInfo *KWindowInfo, trace *identifyTrace) (innerId string, appInfo *AppInfo) {
 	// TODO: 对桌面调起的文管应用做规避处理，需要在此处添加，因为初始化时appId和title为空
 	if winInfo.appId == "dde-desktop" && m.shouldShowOnDock(winInfo) {
 		winInfo.appId = "dde-file-manager"
@@ -144,12 +179,16 @@ func (m *Manager) identifyWindowK(winInfo *KWindowInfo) (innerId string, appInfo
 	}
 
 	// 先使用appId获取appInfo,如果不能成功再通过定义的识别窗口机制去识别
+	start := time.Now()
 	appInfo = NewAppInfo(appId)
 	if appInfo == nil {
+		trace.addStep("AppId", start, "", nil)
 		for idx, item := range m.identifyKWindowFuns {
 			name := item.Name
 			logger.Debugf("identifyWindowK: try %s:%d", name, idx)
+			start = time.Now()
 			innerId, appInfo = item.Fn(m, winInfo)
+			trace.addStep(name, start, innerId, appInfo)
 			if innerId != "" {
 				// success
 				logger.Debugf("identifyWindowK by %s success, innerId: %q, appInfo: %v",
@@ -166,10 +205,12 @@ func (m *Manager) identifyWindowK(winInfo *KWindowInfo) (innerId string, appInfo
 						appInfo.identifyMethod = name
 					}
 				}
+				trace.Method = name
 				return
 			}
 		}
 	} else {
+		trace.addStep("AppId", start, appInfo.innerId, appInfo)
 		innerId = appInfo.innerId
 		fixedAppInfo := fixAutostartAppInfo(appInfo)
 		if fixedAppInfo != nil {
@@ -180,6 +221,7 @@ func (m *Manager) identifyWindowK(winInfo *KWindowInfo) (innerId string, appInfo
 
 		logger.Debugf("identifyWindowK by %s success, innerId: %q, appInfo: %v",
 			"AppId", innerId, appInfo)
+		trace.Method = "AppId"
 		return
 	}
 
@@ -188,7 +230,7 @@ func (m *Manager) identifyWindowK(winInfo *KWindowInfo) (innerId string, appInfo
 	return
 }
 
-func (m *Manager) identifyWindowX(winInfo *WindowInfo) (innerId string, appInfo *AppInfo) {
+func (m *Manager) identifyWindowX(winInfo *WindowInfo, trace *identifyTrace) (innerId string, appInfo *AppInfo) {
 	logger.Debugf("identifyWindow: window id: %v, window innerId: %q",
 		winInfo.xid, winInfo.innerId)
 	if winInfo.innerId == "" {
@@ -199,7 +241,9 @@ func (m *Manager) identifyWindowX(winInfo *WindowInfo) (innerId string, appInfo
 	for idx, item := range m.identifyWindowFuns {
 		name := item.Name
 		logger.Debugf("identifyWindow: try %s:%d", name, idx)
+		start := time.Now()
 		innerId, appInfo = item.Fn(m, winInfo)
+		trace.addStep(name, start, innerId, appInfo)
 		if innerId != "" {
 			// success
 			logger.Debugf("identifyWindow by %s success, innerId: %q, appInfo: %v",
@@ -215,6 +259,7 @@ func (m *Manager) identifyWindowX(winInfo *WindowInfo) (innerId string, appInfo
 					appInfo.identifyMethod = name
 				}
 			}
+			trace.Method = name
 			return
 		}
 	}
@@ -481,10 +526,11 @@ func identifyKwindowByExeEnv(m *Manager, winInfo *KWindowInfo) (string, *AppInfo
 
 func identifyWindowByRule(m *Manager, winInfo *WindowInfo) (string, *AppInfo) {
 	msgPrefix := fmt.Sprintf("identifyWindowByRule win: %d ", winInfo.xid)
-	ret := m.windowPatterns.Match(winInfo)
-	if ret == "" {
+	match := m.identifyRules.match(winInfo)
+	if match == nil {
 		return "", nil
 	}
+	ret := match.pattern.Result
 	logger.Debug(msgPrefix, "patterns match result:", ret)
 	// parse ret
 	// id=$appId or env
@@ -7,6 +7,7 @@ package dock
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -18,9 +19,9 @@ import (
 type WindowPatterns []WindowPattern
 
 type WindowPattern struct {
-	Rules       []WindowRule `json:"rules"`
-	Result      string       `json:"ret"`
-	ParsedRules []*WindowRuleParsed
+	Rules       []WindowRule        `json:"rules"`
+	Result      string              `json:"ret"`
+	ParsedRules []*WindowRuleParsed `json:"-"`
 }
 
 type WindowRule [2]string
@@ -51,20 +52,80 @@ func loadWindowPatterns(file string) (WindowPatterns, error) {
 
 	// parse pattterns
 	for i := range patterns {
-		pattern := &patterns[i]
-		rules := pattern.Rules
-		// parse rules in pattern
-		pattern.ParsedRules = make([]*WindowRuleParsed, len(rules))
-		for j := range rules {
-			rule := &rules[j]
-			pattern.ParsedRules[j] = rule.Parse()
-		}
+		patterns[i].parse()
 	}
 
 	return patterns, nil
 }
 
+func (pattern *WindowPattern) parse() {
+	rules := pattern.Rules
+	// parse rules in pattern
+	pattern.ParsedRules = make([]*WindowRuleParsed, len(rules))
+	for j := range rules {
+		rule := &rules[j]
+		pattern.ParsedRules[j] = rule.Parse()
+	}
+}
+
+// check returns an error if the pattern can never be used by identifyWindowByRule.
+func (pattern *WindowPattern) check() error {
+	if len(pattern.Rules) == 0 {
+		return errors.New("rules is empty")
+	}
+	for _, rule := range pattern.Rules {
+		key, value := rule[0], rule[1]
+		if !isValidRuleKey(key) {
+			return fmt.Errorf("invalid rule key %q", key)
+		}
+		valueParsed := parseRuleValue(value)
+		if valueParsed.Fn == nil {
+			return fmt.Errorf("invalid rule value %q", value)
+		}
+		var expr string
+		switch valueParsed.Type {
+		case 'R':
+			expr = valueParsed.Value
+		case 'r':
+			expr = "(?i)" + valueParsed.Value
+		default:
+			continue
+		}
+		_, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid rule value %q: %v", value, err)
+		}
+	}
+	if !isValidPatternResult(pattern.Result) {
+		return fmt.Errorf("invalid ret %q", pattern.Result)
+	}
+	return nil
+}
+
+// ret 的格式为 id=$appId 或者 env
+func isValidPatternResult(ret string) bool {
+	return ret == "env" || (len(ret) > 4 && strings.HasPrefix(ret, "id="))
+}
+
+func isValidRuleKey(key string) bool {
+	switch key {
+	case "hasPid", "exec", "arg", "wmi", "wmc", "wmn", "wmrole":
+		return true
+	}
+	const envPrefix = "env."
+	return len(key) > len(envPrefix) && strings.HasPrefix(key, envPrefix)
+}
+
 func (patterns WindowPatterns) Match(winInfo *WindowInfo) string {
+	idx := patterns.matchIndex(winInfo)
+	if idx < 0 {
+		return ""
+	}
+	return patterns[idx].Result
+}
+
+// matchIndex returns the index of the first matched pattern, or -1.
+func (patterns WindowPatterns) matchIndex(winInfo *WindowInfo) int {
 	for i := range patterns {
 		pattern := &patterns[i]
 		rules := pattern.ParsedRules
@@ -84,11 +145,11 @@ func (patterns WindowPatterns) Match(winInfo *WindowInfo) string {
 		if patternOk {
 			// pattern match success
 			logger.Debugf("pattern match success")
-			return pattern.Result
+			return i
 		}
 	}
 	// fail
-	return ""
+	return -1
 }
 
 func parseRuleKey(winInfo *WindowInfo, key string) string {
@@ -38,6 +38,8 @@ type WindowInfoImp interface {
 	killClient() error
 	changeXid(x.Window) bool
 	getCreatedTime() int64
+	getIdentifyTrace() *identifyTrace
+	setIdentifyTrace(*identifyTrace)
 }
 
 type KWindowInfo struct {
@@ -64,6 +66,8 @@ type baseWindowInfo struct {
 	appInfo      *AppInfo
 	process      *ProcessInfo
 	createdTime  int64
+	// 最近一次窗口识别的过程
+	identifyTrace *identifyTrace
 }
 
 func (winInfo *KWindowInfo) print() {
@@ -157,6 +161,14 @@ func (winInfo *baseWindowInfo) getCreatedTime() int64 {
 	return winInfo.createdTime
 }
 
+func (winInfo *baseWindowInfo) getIdentifyTrace() *identifyTrace {
+	return winInfo.identifyTrace
+}
+
+func (winInfo *baseWindowInfo) setIdentifyTrace(v *identifyTrace) {
+	winInfo.identifyTrace = v
+}
+
 func newKWindowInfo(winObj kwayland.Window, xid uint32) *KWindowInfo {
 	winInfo := &KWindowInfo{
 		winObj: winObj,
@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+// 应用通过 Unity LauncherEntry API 设置任务栏图标上的计数、进度和紧急状态，
+// 信号参数为 app_uri（例如 application://thunderbird.desktop）和属性字典。
+const (
+	launcherEntryInterface = "com.canonical.Unity.LauncherEntry"
+	launcherEntrySigUpdate = launcherEntryInterface + ".Update"
+	launcherEntryUriPrefix = "application://"
+)
+
+// launcherEntryState 是应用通过 LauncherEntry API 设置的状态，Update 信号中只包含改变了的属性。
+type launcherEntryState struct {
+	sender          string
+	count           int64
+	countVisible    bool
+	progress        float64
+	progressVisible bool
+	urgent          bool
+}
+
+// badge 返回 AppEntry.Badge 属性的值，0 表示不显示
+func (s *launcherEntryState) badge() int64 {
+	if s == nil || !s.countVisible {
+		return 0
+	}
+	return s.count
+}
+
+// progressValue 返回 AppEntry.Progress 属性的值，范围是 [0, 1]，0 表示不显示
+func (s *launcherEntryState) progressValue() float64 {
+	if s == nil || !s.progressVisible {
+		return 0
+	}
+	if s.progress < 0 {
+		return 0
+	} else if s.progress > 1 {
+		return 1
+	}
+	return s.progress
+}
+
+func (s *launcherEntryState) isUrgent() bool {
+	return s != nil && s.urgent
+}
+
+func (s *launcherEntryState) update(props map[string]dbus.Variant) {
+	for key, value := range props {
+		switch key {
+		case "count":
+			if v, ok := variantToInt64(value); ok {
+				s.count = v
+			}
+		case "count-visible":
+			if v, ok := value.Value().(bool); ok {
+				s.countVisible = v
+			}
+		case "progress":
+			if v, ok := value.Value().(float64); ok {
+				s.progress = v
+			}
+		case "progress-visible":
+			if v, ok := value.Value().(bool); ok {
+				s.progressVisible = v
+			}
+		case "urgent":
+			if v, ok := value.Value().(bool); ok {
+				s.urgent = v
+			}
+		default:
+			logger.Debugf("launcher entry: ignore property %q", key)
+		}
+	}
+}
+
+func variantToInt64(value dbus.Variant) (int64, bool) {
+	switch v := value.Value().(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// getLauncherEntryAppId 把 app_uri 转换为 desktop id，例如 application://thunderbird.desktop 转换为 thunderbird
+func getLauncherEntryAppId(appUri string) string {
+	if !strings.HasPrefix(appUri, launcherEntryUriPrefix) {
+		return ""
+	}
+	return strings.TrimSuffix(appUri[len(launcherEntryUriPrefix):], desktopExt)
+}
+
+func getAppInfoDesktopId(appInfo *AppInfo) string {
+	if appInfo == nil {
+		return ""
+	}
+	return strings.TrimSuffix(appInfo.GetId(), desktopExt)
+}
+
+// launcherEntries 保存各个应用的 LauncherEntry 状态，key 为 desktop id。
+// 应用可能在窗口出现之前就发送信号，所以状态与 AppEntry 分开保存。
+type launcherEntries struct {
+	mu     sync.Mutex
+	states map[string]*launcherEntryState
+}
+
+func newLauncherEntries() *launcherEntries {
+	return &launcherEntries{
+		states: make(map[string]*launcherEntryState),
+	}
+}
+
+func (le *launcherEntries) update(appId, sender string, props map[string]dbus.Variant) launcherEntryState {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	state := le.states[appId]
+	if state == nil {
+		state = &launcherEntryState{}
+		le.states[appId] = state
+	}
+	state.sender = sender
+	state.update(props)
+	return *state
+}
+
+func (le *launcherEntries) get(appId string) *launcherEntryState {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	state := le.states[appId]
+	if state == nil {
+		return nil
+	}
+	stateCopy := *state
+	return &stateCopy
+}
+
+// removeSender 删除 sender 设置的状态，返回受影响的 desktop id
+func (le *launcherEntries) removeSender(sender string) []string {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	var appIds []string
+	for appId, state := range le.states {
+		if state.sender == sender {
+			delete(le.states, appId)
+			appIds = append(appIds, appId)
+		}
+	}
+	return appIds
+}
+
+func (m *Manager) listenLauncherEntrySignal() {
+	sessionBus := m.service.Conn()
+	rule := "type='signal',interface='" + launcherEntryInterface + "',member='Update'"
+	err := sessionBus.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	m.sessionSigLoop.AddHandler(&dbusutil.SignalRule{
+		Name: launcherEntrySigUpdate,
+	}, func(sig *dbus.Signal) {
+		var appUri string
+		var props map[string]dbus.Variant
+		err := dbus.Store(sig.Body, &appUri, &props)
+		if err != nil {
+			logger.Warning("launcher entry: invalid Update signal:", err)
+			return
+		}
+		m.handleLauncherEntryUpdate(sig.Sender, appUri, props)
+	})
+
+	// 应用退出后清除它设置的状态
+	m.sessionDBusDaemon.InitSignalExt(m.sessionSigLoop, true)
+	_, err = m.sessionDBusDaemon.ConnectNameOwnerChanged(func(name, oldOwner, newOwner string) {
+		if newOwner == "" && strings.HasPrefix(name, ":") {
+			for _, appId := range m.launcherEntries.removeSender(name) {
+				m.updateEntriesLauncherEntryState(appId)
+			}
+		}
+	})
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+func (m *Manager) handleLauncherEntryUpdate(sender, appUri string, props map[string]dbus.Variant) {
+	appId := getLauncherEntryAppId(appUri)
+	logger.Debugf("launcher entry update sender: %s, appId: %q, props: %v", sender, appId, props)
+	if appId == "" {
+		return
+	}
+	m.launcherEntries.update(appId, sender, props)
+	m.updateEntriesLauncherEntryState(appId)
+}
+
+func (m *Manager) updateEntriesLauncherEntryState(appId string) {
+	m.Entries.mu.RLock()
+	defer m.Entries.mu.RUnlock()
+
+	for _, entry := range m.Entries.items {
+		if getAppInfoDesktopId(entry.appInfo) != appId {
+			continue
+		}
+		entry.PropsMu.Lock()
+		entry.updateLauncherEntryState()
+		entry.PropsMu.Unlock()
+	}
+}
+
+// 调用者需要持有 entry.PropsMu 锁
+func (entry *AppEntry) updateLauncherEntryState() {
+	var state *launcherEntryState
+	appId := getAppInfoDesktopId(entry.appInfo)
+	if appId != "" {
+		state = entry.manager.launcherEntries.get(appId)
+	}
+	entry.setPropBadge(state.badge())
+	entry.setPropProgress(state.progressValue())
+	entry.setPropUrgent(state.isUrgent())
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLauncherEntryAppId(t *testing.T) {
+	assert.Equal(t, "thunderbird", getLauncherEntryAppId("application://thunderbird.desktop"))
+	assert.Equal(t, "org.telegram.desktop", getLauncherEntryAppId("application://org.telegram.desktop.desktop"))
+	assert.Equal(t, "", getLauncherEntryAppId("thunderbird.desktop"))
+}
+
+func TestLauncherEntryState(t *testing.T) {
+	var state *launcherEntryState
+	assert.Equal(t, int64(0), state.badge())
+	assert.Equal(t, 0.0, state.progressValue())
+	assert.False(t, state.isUrgent())
+
+	state = &launcherEntryState{}
+	state.update(map[string]dbus.Variant{
+		"count":         dbus.MakeVariant(int64(3)),
+		"count-visible": dbus.MakeVariant(false),
+		"progress":      dbus.MakeVariant(0.5),
+		"urgent":        dbus.MakeVariant(true),
+	})
+	assert.Equal(t, int64(0), state.badge())
+	assert.Equal(t, 0.0, state.progressValue())
+	assert.True(t, state.isUrgent())
+
+	// Update 信号中只包含改变了的属性
+	state.update(map[string]dbus.Variant{
+		"count-visible":    dbus.MakeVariant(true),
+		"progress-visible": dbus.MakeVariant(true),
+		"urgent":           dbus.MakeVariant(false),
+	})
+	assert.Equal(t, int64(3), state.badge())
+	assert.Equal(t, 0.5, state.progressValue())
+	assert.False(t, state.isUrgent())
+
+	state.update(map[string]dbus.Variant{
+		"count":    dbus.MakeVariant(int32(7)),
+		"progress": dbus.MakeVariant(1.5),
+	})
+	assert.Equal(t, int64(7), state.badge())
+	assert.Equal(t, 1.0, state.progressValue())
+}
+
+func TestLauncherEntries(t *testing.T) {
+	le := newLauncherEntries()
+	assert.Nil(t, le.get("thunderbird"))
+
+	le.update("thunderbird", ":1.10", map[string]dbus.Variant{
+		"count":         dbus.MakeVariant(int64(2)),
+		"count-visible": dbus.MakeVariant(true),
+	})
+	le.update("telegram", ":1.11", map[string]dbus.Variant{
+		"urgent": dbus.MakeVariant(true),
+	})
+	state := le.get("thunderbird")
+	require.NotNil(t, state)
+	assert.Equal(t, int64(2), state.badge())
+
+	assert.Equal(t, []string{"thunderbird"}, le.removeSender(":1.10"))
+	assert.Nil(t, le.get("thunderbird"))
+	assert.NotNil(t, le.get("telegram"))
+	assert.Empty(t, le.removeSender(":1.10"))
+}
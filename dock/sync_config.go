@@ -6,7 +6,8 @@ package dock
 
 import (
 	"encoding/json"
-	"os"
+	"strconv"
+	"strings"
 )
 
 type syncConfig struct {
@@ -22,6 +23,8 @@ func (sc *syncConfig) Get() (interface{}, error) {
 	v.HideMode = sc.m.HideMode.GetString()
 	v.Position = sc.m.Position.GetString()
 	v.DockedApps = sc.m.DockedApps.Get()
+	v.Folders = sc.m.layout.getFolders()
+	v.LayoutProfiles = sc.m.layout.getProfiles()
 
 	pluginSettingsJsonStr := sc.m.settings.GetString(settingKeyPluginSettings)
 	err := json.Unmarshal([]byte(pluginSettingsJsonStr), &v.Plugins)
@@ -47,29 +50,7 @@ func (sc *syncConfig) setPluginSettings(settings pluginSettings) {
 
 func (sc *syncConfig) setDockedApps(dockedApps []string) {
 	m := sc.m
-	added := dockedApps
-	removed := m.DockedApps.Get()
-	for _, value := range removed {
-		desktopFile := unzipDesktopPath(value)
-		_, err := m.requestUndock(desktopFile)
-		if err != nil {
-			logger.Warning(err)
-		}
-	}
-
-	var index = 0
-	for _, value := range added {
-		desktopFile := unzipDesktopPath(value)
-		_, err := os.Stat(desktopFile)
-		if err == nil {
-			_, err = m.requestDock(desktopFile, int32(index))
-			if err != nil {
-				logger.Warning(err)
-			} else {
-				index++
-			}
-		}
-	}
+	m.resetDockedApps(dockedApps)
 
 	// emit signal
 	err := m.service.Emit(m, "DockAppSettingsSynced")
@@ -94,22 +75,66 @@ func (sc *syncConfig) Set(data []byte) error {
 	m.DisplayMode.SetString(v.DisplayMode)
 	m.HideMode.SetString(v.HideMode)
 	m.Position.SetString(v.Position)
+	// 1.3 之前版本的数据中没有分组和布局方案，保留现有的
+	hasLayout := isSyncVersionAtLeast(v.Version, syncConfigLayoutVersion)
+	folders := v.Folders
+	if !hasLayout {
+		folders = m.layout.getFolders()
+	}
 	sc.setDockedApps(v.DockedApps)
+	m.setFolders(folders)
+	if hasLayout {
+		m.layout.setProfiles(v.LayoutProfiles)
+	}
 	sc.setPluginSettings(v.Plugins)
 	return nil
 }
 
 const (
-	syncConfigVersion = "1.2"
+	syncConfigVersion = "1.3"
+	// 从这个版本开始同步分组和布局方案
+	syncConfigLayoutVersion = "1.3"
 )
 
+// isSyncVersionAtLeast 按数字逐段比较版本号，无法解析的版本号当作旧版本
+func isSyncVersionAtLeast(version, target string) bool {
+	parse := func(version string) ([]int, bool) {
+		var nums []int
+		for _, field := range strings.Split(version, ".") {
+			num, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, false
+			}
+			nums = append(nums, num)
+		}
+		return nums, true
+	}
+	v, ok := parse(version)
+	if !ok {
+		return false
+	}
+	t, _ := parse(target)
+	for i := 0; i < len(t); i++ {
+		var n int
+		if i < len(v) {
+			n = v[i]
+		}
+		if n != t[i] {
+			return n > t[i]
+		}
+	}
+	return true
+}
+
 type syncData struct {
-	Version             string         `json:"version"`
-	WindowSizeEfficient uint32         `json:"window_size_efficient"`
-	WindowSizeFashion   uint32         `json:"window_size_fashion"`
-	DisplayMode         string         `json:"display_mode"`
-	HideMode            string         `json:"hide_mode"`
-	Position            string         `json:"position"`
-	DockedApps          []string       `json:"docked_apps"`
-	Plugins             pluginSettings `json:"plugins"`
+	Version             string                       `json:"version"`
+	WindowSizeEfficient uint32                       `json:"window_size_efficient"`
+	WindowSizeFashion   uint32                       `json:"window_size_fashion"`
+	DisplayMode         string                       `json:"display_mode"`
+	HideMode            string                       `json:"hide_mode"`
+	Position            string                       `json:"position"`
+	DockedApps          []string                     `json:"docked_apps"`
+	Plugins             pluginSettings               `json:"plugins"`
+	Folders             []dockFolder                 `json:"folders"`
+	LayoutProfiles      map[string]dockLayoutProfile `json:"layout_profiles"`
 }
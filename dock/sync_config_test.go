@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSyncVersionAtLeast(t *testing.T) {
+	assert.True(t, isSyncVersionAtLeast("1.3", syncConfigLayoutVersion))
+	assert.True(t, isSyncVersionAtLeast("1.3.1", syncConfigLayoutVersion))
+	assert.True(t, isSyncVersionAtLeast("1.10", syncConfigLayoutVersion))
+	assert.True(t, isSyncVersionAtLeast("2", syncConfigLayoutVersion))
+	assert.False(t, isSyncVersionAtLeast("1.2", syncConfigLayoutVersion))
+	assert.False(t, isSyncVersionAtLeast("1", syncConfigLayoutVersion))
+	assert.False(t, isSyncVersionAtLeast("", syncConfigLayoutVersion))
+	assert.False(t, isSyncVersionAtLeast("1.x", syncConfigLayoutVersion))
+}
+
+func TestSyncData_emptyLayout(t *testing.T) {
+	// 空的分组和布局方案也需要同步
+	data, err := json.Marshal(syncData{
+		Version:        syncConfigVersion,
+		Folders:        []dockFolder{},
+		LayoutProfiles: map[string]dockLayoutProfile{},
+	})
+	require.NoError(t, err)
+	var v map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &v))
+	assert.Equal(t, []interface{}{}, v["folders"])
+	assert.Equal(t, map[string]interface{}{}, v["layout_profiles"])
+}
@@ -5,7 +5,10 @@
 package loader
 
 import (
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/linuxdeepin/go-lib/dbusutil"
 	"github.com/linuxdeepin/go-lib/log"
@@ -54,6 +57,55 @@ func EnableModules(enablingModules []string, disableModules []string, flag Enabl
 	return getLoader().EnableModules(enablingModules, disableModules, flag)
 }
 
+func RestartModule(name string) error {
+	return getLoader().RestartModule(name)
+}
+
+func GetModuleState(name string) (ModuleState, error) {
+	return getLoader().GetModuleState(name)
+}
+
+func ListModuleInfo() []ModuleInfo {
+	return getLoader().ListModuleInfo()
+}
+
+func SetStartConcurrency(n int) {
+	getLoader().SetStartConcurrency(n)
+}
+
+func SetStartTimeout(timeout time.Duration) {
+	getLoader().SetStartTimeout(timeout)
+}
+
+func GetStartStats() []ModuleStartStat {
+	return getLoader().GetStartStats()
+}
+
+func StartSupervisor(interval time.Duration, moduleLocker sync.Locker) {
+	getLoader().StartSupervisor(interval, moduleLocker)
+}
+
+func StopSupervisor() {
+	getLoader().StopSupervisor()
+}
+
+// CheckNameOwned 检查 daemon 的 DBus 连接是否仍然拥有服务名 name，可以用于实现 HealthChecker。
+func CheckNameOwned(name string) error {
+	service := GetService()
+	if service == nil {
+		return errors.New("service is not set")
+	}
+	owner, err := service.GetNameOwner(name)
+	if err != nil {
+		return err
+	}
+	names := service.Conn().Names()
+	if len(names) == 0 || owner != names[0] {
+		return fmt.Errorf("name %s is owned by %q", name, owner)
+	}
+	return nil
+}
+
 func ToggleLogDebug(enabled bool) {
 	var priority log.Priority = log.LevelInfo
 	if enabled {
@@ -6,6 +6,7 @@ package loader
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -31,6 +32,7 @@ const (
 	ErrorMissingModule
 	ErrorInternalError
 	ErrorConflict
+	ErrorNotRestartable
 )
 
 type EnableError struct {
@@ -52,6 +54,8 @@ func (e *EnableError) Error() string {
 		return fmt.Sprintf("%s started failed: %s", e.ModuleName, e.detail)
 	case ErrorConflict:
 		return fmt.Sprintf("tring to enable disabled module(%s)", e.ModuleName)
+	case ErrorNotRestartable:
+		return fmt.Sprintf("%s does not support restart", e.ModuleName)
 	}
 	panic("EnableError: Unknown Error, Should not be reached")
 }
@@ -61,6 +65,70 @@ type Loader struct {
 	log     *log.Logger
 	lock    sync.Mutex
 	service *dbusutil.Service
+
+	restartLock      sync.Mutex
+	supervisorQuit   chan struct{}
+	supervisorLocker sync.Locker
+
+	startConcurrency int           // 同时启动的模块数量上限，小于等于 0 表示不限制
+	startTimeout     time.Duration // 单个模块启动的超时时间，为 0 表示不限制
+
+	abortedMu    sync.Mutex
+	startAborted map[string]chan struct{} // 启动超时或者被跳过的模块，依赖它们的模块不再等待
+	// 依赖的模块启动超时而被跳过的模块，依赖的模块在后台启动成功后再启动它们，key 为依赖的模块名
+	startDeferred map[string][]Module
+
+	statsMu    sync.Mutex
+	startStats map[string]*ModuleStartStat
+}
+
+// ModuleStartStat 记录模块最近一次启动的耗时
+type ModuleStartStat struct {
+	Name          string
+	BeginTime     time.Time     // 开始等待依赖的时间
+	WaitDuration  time.Duration // 等待依赖的模块启动的耗时
+	StartDuration time.Duration // 模块 Start 的耗时
+	TimedOut      bool          // 启动是否超时，超时的模块会在后台继续启动，成功后再启动依赖它的模块
+	Error         string        `json:",omitempty"`
+}
+
+func (l *Loader) SetStartConcurrency(n int) {
+	l.lock.Lock()
+	l.startConcurrency = n
+	l.lock.Unlock()
+}
+
+func (l *Loader) SetStartTimeout(timeout time.Duration) {
+	l.lock.Lock()
+	l.startTimeout = timeout
+	l.lock.Unlock()
+}
+
+func (l *Loader) setStartStat(stat ModuleStartStat) {
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+	if l.startStats == nil {
+		l.startStats = make(map[string]*ModuleStartStat)
+	}
+	l.startStats[stat.Name] = &stat
+}
+
+// GetStartStats 返回模块最近一次启动的耗时，按开始时间排序
+func (l *Loader) GetStartStats() []ModuleStartStat {
+	l.statsMu.Lock()
+	result := make([]ModuleStartStat, 0, len(l.startStats))
+	for _, stat := range l.startStats {
+		result = append(result, *stat)
+	}
+	l.statsMu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].BeginTime.Equal(result[j].BeginTime) {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].BeginTime.Before(result[j].BeginTime)
+	})
+	return result
 }
 
 func (l *Loader) SetLogLevel(pri log.Priority) {
@@ -115,6 +183,174 @@ func (l *Loader) WaitDependencies(module Module) {
 	}
 }
 
+// 获取 name 模块启动中止的通知，模块启动超时或者失败时关闭
+func (l *Loader) getStartAbortedChan(name string) chan struct{} {
+	l.abortedMu.Lock()
+	defer l.abortedMu.Unlock()
+	if l.startAborted == nil {
+		l.startAborted = make(map[string]chan struct{})
+	}
+	ch, ok := l.startAborted[name]
+	if !ok {
+		ch = make(chan struct{})
+		l.startAborted[name] = ch
+	}
+	return ch
+}
+
+func (l *Loader) setStartAborted(name string, aborted bool) {
+	l.abortedMu.Lock()
+	defer l.abortedMu.Unlock()
+	ch, ok := l.startAborted[name]
+	if !aborted {
+		// 在后台启动成功了，之后依赖它的模块可以正常启动
+		if ok {
+			select {
+			case <-ch:
+				delete(l.startAborted, name)
+			default:
+			}
+		}
+		return
+	}
+	if l.startAborted == nil {
+		l.startAborted = make(map[string]chan struct{})
+	}
+	if !ok {
+		ch = make(chan struct{})
+		l.startAborted[name] = ch
+	}
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// 等待依赖的模块启动完成，依赖的模块启动超时或者失败时返回它的名字和错误
+func (l *Loader) waitDependencies(module Module) (string, error) {
+	for _, dependencyName := range module.GetDependencies() {
+		dep := l.modules[dependencyName]
+		select {
+		case <-dep.enabledChan():
+		case <-l.getStartAbortedChan(dependencyName):
+			return dependencyName, fmt.Errorf("dependency %s is not started", dependencyName)
+		}
+	}
+	return "", nil
+}
+
+// 记录因为 dependencyName 没有启动而被跳过的模块
+func (l *Loader) deferStart(dependencyName string, module Module) {
+	l.abortedMu.Lock()
+	defer l.abortedMu.Unlock()
+	if l.startDeferred == nil {
+		l.startDeferred = make(map[string][]Module)
+	}
+	l.startDeferred[dependencyName] = append(l.startDeferred[dependencyName], module)
+}
+
+// name 模块启动成功了，在后台启动之前因为它启动超时被跳过的模块
+func (l *Loader) startDeferredModules(name string) {
+	l.abortedMu.Lock()
+	modules := l.startDeferred[name]
+	delete(l.startDeferred, name)
+	l.abortedMu.Unlock()
+
+	for _, module := range modules {
+		go func(module Module) {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			if module.IsEnable() {
+				return
+			}
+			l.log.Infof("dependency %s started, enable module %s", name, module.Name())
+			l.enableModule(module, nil)
+		}(module)
+	}
+}
+
+// 等待依赖启动完成后启动模块，启动超时后返回，模块在后台继续启动。
+// 依赖的模块启动超时时先跳过模块，依赖的模块在后台启动成功后再启动它，依赖它的模块也是如此。
+// 调用者需要持有 l.lock
+func (l *Loader) enableModule(module Module, sem chan struct{}) {
+	name := module.Name()
+	l.log.Info("enable module", name)
+	stat := ModuleStartStat{
+		Name:      name,
+		BeginTime: time.Now(),
+	}
+
+	// wait for its dependency
+	abortedDep, err := l.waitDependencies(module)
+	stat.WaitDuration = time.Since(stat.BeginTime)
+	if err != nil {
+		l.log.Warningf("skip module %s: %v", name, err)
+		stat.Error = err.Error()
+		l.setStartStat(stat)
+		l.deferStart(abortedDep, module)
+		l.setStartAborted(name, true)
+		return
+	}
+	l.log.Info("module", name, "wait done, cost", stat.WaitDuration)
+
+	var releaseOnce sync.Once
+	release := func() {
+		if sem != nil {
+			releaseOnce.Do(func() { <-sem })
+		}
+	}
+	if sem != nil {
+		sem <- struct{}{}
+	}
+	startTime := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- module.Enable(true)
+		release()
+	}()
+
+	finish := func(err error, timedOut bool) {
+		stat.StartDuration = time.Since(startTime)
+		if err != nil {
+			stat.Error = err.Error()
+		}
+		l.setStartStat(stat)
+		duration := time.Since(stat.BeginTime)
+		if err == nil {
+			l.setStartAborted(name, false)
+			l.log.Infof("enable module %s done cost %s", name, duration)
+			l.startDeferredModules(name)
+		} else if timedOut {
+			// 已经当作启动失败处理，不再退出
+			l.log.Warningf("enable module %s failed after timeout: %s, cost %s", name, err, duration)
+		} else {
+			l.log.Fatalf("enable module %s failed: %s, cost %s", name, err, duration)
+		}
+	}
+
+	if l.startTimeout <= 0 {
+		finish(<-done, false)
+		return
+	}
+	timer := time.NewTimer(l.startTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		finish(err, false)
+	case <-timer.C:
+		l.log.Warningf("enable module %s timed out after %s, continue in background", name, l.startTimeout)
+		stat.TimedOut = true
+		l.setStartStat(stat)
+		l.setStartAborted(name, true)
+		// 超时的模块不再占用并发数量
+		release()
+		go func() {
+			finish(<-done, true)
+		}()
+	}
+}
+
 func (l *Loader) EnableModules(enablingModules []string, disableModules []string, flag EnableFlag) error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
@@ -140,38 +376,24 @@ func (l *Loader) EnableModules(enablingModules []string, disableModules []string
 	l.log.Infof("topo sort done, cost add up to %s", duration)
 
 	// enable modules
+	// 并发数量限制，为空时不限制
+	var sem chan struct{}
+	if l.startConcurrency > 0 {
+		sem = make(chan struct{}, l.startConcurrency)
+	}
+	var wg sync.WaitGroup
 	for _, node := range nodes {
 		if node == nil {
 			continue
 		}
 		module := l.modules[node.ID]
-		name := node.ID
-
+		wg.Add(1)
 		go func() {
-			l.log.Info("enable module", name)
-			startTime := time.Now()
-
-			// wait for its dependency
-			l.WaitDependencies(module)
-			endTime := time.Now()
-			duration := endTime.Sub(startTime)
-			l.log.Info("module", name, "wait done, cost", duration)
-
-			err := module.Enable(true)
-			endTime = time.Now()
-			duration = endTime.Sub(startTime)
-			if err != nil {
-				l.log.Fatalf("enable module %s failed: %s, cost %s", name, err, duration)
-			} else {
-				l.log.Infof("enable module %s done cost %s", name, duration)
-			}
+			defer wg.Done()
+			l.enableModule(module, sem)
 		}()
 	}
-
-	for _, n := range nodes {
-		m := l.modules[n.ID]
-		m.WaitEnable()
-	}
+	wg.Wait()
 
 	endTime = time.Now()
 	duration = endTime.Sub(startTime)
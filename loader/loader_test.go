@@ -5,13 +5,18 @@
 package loader
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/linuxdeepin/go-lib/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type Test_Module struct {
@@ -100,3 +105,337 @@ func Test_Loader(t *testing.T) {
 		assert.Equal(t, err, data.output)
 	}
 }
+
+// testEvents 记录模块启动和停止的顺序，EnableModules 会并发启动模块
+type testEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *testEvents) add(event string) {
+	e.mu.Lock()
+	e.events = append(e.events, event)
+	e.mu.Unlock()
+}
+
+func (e *testEvents) take() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := e.events
+	e.events = nil
+	return events
+}
+
+// testLocker 记录加锁和解锁，用来检查 supervisor 是否持有模块锁
+type testLocker struct {
+	events *testEvents
+}
+
+func (l *testLocker) Lock() {
+	l.events.add("lock")
+}
+
+func (l *testLocker) Unlock() {
+	l.events.add("unlock")
+}
+
+type restartTestModule struct {
+	*ModuleBase
+	dependencies   []string
+	events         *testEvents
+	startErr       error
+	healthErr      error
+	notRestartable bool
+}
+
+func newRestartTestModule(name string, events *testEvents, dependencies ...string) *restartTestModule {
+	m := &restartTestModule{
+		dependencies: dependencies,
+		events:       events,
+	}
+	m.ModuleBase = NewModuleBase(name, m, log.NewLogger(name))
+	return m
+}
+
+func (m *restartTestModule) GetDependencies() []string {
+	return m.dependencies
+}
+
+func (m *restartTestModule) Start() error {
+	m.events.add("start " + m.Name())
+	return m.startErr
+}
+
+func (m *restartTestModule) Stop() error {
+	m.events.add("stop " + m.Name())
+	return nil
+}
+
+func (m *restartTestModule) CheckHealth() error {
+	return m.healthErr
+}
+
+func (m *restartTestModule) CanRestart() bool {
+	return !m.notRestartable
+}
+
+func TestLoader_RestartModule(t *testing.T) {
+	events := &testEvents{}
+	l := &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	a := newRestartTestModule("a", events)
+	b := newRestartTestModule("b", events, "a")
+	c := newRestartTestModule("c", events, "b")
+	d := newRestartTestModule("d", events)
+	for _, m := range []Module{a, b, c, d} {
+		l.AddModule(m)
+	}
+	err := l.EnableModules([]string{"c", "d"}, nil, EnableFlagNone)
+	assert.NoError(t, err)
+	for _, m := range []Module{a, b, c, d} {
+		assert.Equal(t, ModuleStateRunning, m.State())
+	}
+
+	events.take()
+	err = l.RestartModule("b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stop c", "stop b", "start b", "start c"}, events.take())
+	assert.Equal(t, ModuleStateRunning, c.State())
+
+	err = l.RestartModule("x")
+	assert.Equal(t, &EnableError{ModuleName: "x", Code: ErrorMissingModule}, err)
+
+	// 不支持重启的模块不会被重启
+	d.notRestartable = true
+	err = l.RestartModule("d")
+	assert.Equal(t, &EnableError{ModuleName: "d", Code: ErrorNotRestartable}, err)
+	d.healthErr = errors.New("broken")
+	l.superviseOnce(map[string]int{})
+	assert.Empty(t, events.take())
+	assert.Equal(t, ModuleStateFailed, d.State())
+
+	// 依赖者不支持重启时也不重启
+	c.notRestartable = true
+	err = l.RestartModule("a")
+	assert.Equal(t, &EnableError{ModuleName: "c", Code: ErrorNotRestartable}, err)
+	assert.Empty(t, events.take())
+	c.notRestartable = false
+
+	d.notRestartable = false
+	d.healthErr = nil
+	assert.NoError(t, l.RestartModule("d"))
+	events.take()
+
+	// 健康检查失败时持有模块锁自动重启
+	d.healthErr = errors.New("broken")
+	l.supervisorLocker = &testLocker{events: events}
+	l.superviseOnce(map[string]int{})
+	got := events.take()
+	idx := -1
+	for i, event := range got {
+		if event == "stop d" {
+			idx = i
+		}
+	}
+	require.True(t, idx > 0 && idx+2 < len(got), got)
+	assert.Equal(t, []string{"lock", "stop d", "start d", "unlock"}, got[idx-1:idx+3])
+	l.supervisorLocker = nil
+
+	// 超过重启次数后保持 failed 状态
+	l.superviseOnce(map[string]int{"d": maxAutoRestartCount})
+	assert.Empty(t, events.take())
+	assert.Equal(t, ModuleStateFailed, d.State())
+	assert.Equal(t, d.healthErr, d.LastError())
+
+	// 启动失败
+	d.healthErr = nil
+	d.startErr = errors.New("start failed")
+	err = l.RestartModule("d")
+	assert.Error(t, err)
+	assert.Equal(t, ModuleStateFailed, d.State())
+	assert.False(t, d.IsEnable())
+
+	infos := l.ListModuleInfo()
+	assert.Len(t, infos, 4)
+	assert.Equal(t, ModuleInfo{
+		Name:         "c",
+		State:        "running",
+		Enabled:      true,
+		Dependencies: []string{"b"},
+	}, infos[2])
+	assert.Equal(t, "failed", infos[3].State)
+	assert.Equal(t, "start failed", infos[3].Error)
+}
+
+type slowTestModule struct {
+	*ModuleBase
+	delay        time.Duration
+	running      *int32
+	maxRun       *int32
+	dependencies []string
+	startErr     error
+}
+
+func (m *slowTestModule) GetDependencies() []string {
+	return m.dependencies
+}
+
+func (m *slowTestModule) Start() error {
+	n := atomic.AddInt32(m.running, 1)
+	for {
+		max := atomic.LoadInt32(m.maxRun)
+		if n <= max || atomic.CompareAndSwapInt32(m.maxRun, max, n) {
+			break
+		}
+	}
+	time.Sleep(m.delay)
+	atomic.AddInt32(m.running, -1)
+	return m.startErr
+}
+
+func (m *slowTestModule) Stop() error {
+	return nil
+}
+
+func TestLoader_EnableModulesConcurrency(t *testing.T) {
+	var running, maxRun int32
+	l := &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	l.SetStartConcurrency(2)
+	l.SetStartTimeout(200 * time.Millisecond)
+
+	var names []string
+	for i := 0; i < 5; i++ {
+		m := &slowTestModule{
+			delay:   50 * time.Millisecond,
+			running: &running,
+			maxRun:  &maxRun,
+		}
+		name := fmt.Sprintf("m%d", i)
+		m.ModuleBase = NewModuleBase(name, m, log.NewLogger(name))
+		l.AddModule(m)
+		names = append(names, name)
+	}
+	var slowRunning, slowMaxRun int32
+	slow := &slowTestModule{
+		delay:   time.Second,
+		running: &slowRunning,
+		maxRun:  &slowMaxRun,
+	}
+	slow.ModuleBase = NewModuleBase("slow", slow, log.NewLogger("slow"))
+	l.AddModule(slow)
+	names = append(names, "slow")
+
+	startTime := time.Now()
+	err := l.EnableModules(names, nil, EnableFlagNone)
+	assert.NoError(t, err)
+	// 超时的模块不会阻塞启动流程
+	assert.True(t, time.Since(startTime) < time.Second)
+	assert.True(t, atomic.LoadInt32(&maxRun) <= 2)
+
+	stats := l.GetStartStats()
+	assert.Len(t, stats, len(names))
+	for _, stat := range stats {
+		assert.Equal(t, stat.Name == "slow", stat.TimedOut, stat.Name)
+	}
+
+	slow.WaitEnable()
+	assert.Equal(t, ModuleStateRunning, slow.State())
+}
+
+func TestLoader_EnableModulesTimeout(t *testing.T) {
+	var running, maxRun int32
+	l := &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	l.SetStartTimeout(50 * time.Millisecond)
+	newModule := func(name string, delay time.Duration, startErr error, dependencies ...string) *slowTestModule {
+		m := &slowTestModule{
+			delay:        delay,
+			running:      &running,
+			maxRun:       &maxRun,
+			dependencies: dependencies,
+			startErr:     startErr,
+		}
+		m.ModuleBase = NewModuleBase(name, m, log.NewLogger(name))
+		l.AddModule(m)
+		return m
+	}
+	slow := newModule("slow", 300*time.Millisecond, errors.New("start failed"))
+	dep := newModule("dep", 0, nil, "slow")
+	depDep := newModule("depdep", 0, nil, "dep")
+	other := newModule("other", 0, nil)
+
+	err := l.EnableModules([]string{"depdep", "other"}, nil, EnableFlagNone)
+	assert.NoError(t, err)
+	assert.Equal(t, ModuleStateRunning, other.State())
+	// 依赖超时模块的模块被跳过
+	assert.Equal(t, ModuleStateStopped, dep.State())
+	assert.Equal(t, ModuleStateStopped, depDep.State())
+	for _, stat := range l.GetStartStats() {
+		switch stat.Name {
+		case "slow":
+			assert.True(t, stat.TimedOut)
+		case "dep":
+			assert.Contains(t, stat.Error, "slow")
+		case "depdep":
+			assert.Contains(t, stat.Error, "dep")
+		}
+	}
+
+	// 超时后启动失败不会退出
+	deadline := time.Now().Add(2 * time.Second)
+	for slow.State() != ModuleStateFailed {
+		if time.Now().After(deadline) {
+			assert.FailNow(t, "timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLoader_EnableModulesLateDependency(t *testing.T) {
+	var running, maxRun int32
+	l := &Loader{
+		modules: Modules{},
+		log:     log.NewLogger("daemon/loader"),
+	}
+	l.SetStartTimeout(50 * time.Millisecond)
+	newModule := func(name string, delay time.Duration, dependencies ...string) *slowTestModule {
+		m := &slowTestModule{
+			delay:        delay,
+			running:      &running,
+			maxRun:       &maxRun,
+			dependencies: dependencies,
+		}
+		m.ModuleBase = NewModuleBase(name, m, log.NewLogger(name))
+		l.AddModule(m)
+		return m
+	}
+	slow := newModule("slow", 200*time.Millisecond)
+	dep := newModule("dep", 0, "slow")
+	depDep := newModule("depdep", 0, "dep")
+
+	err := l.EnableModules([]string{"depdep"}, nil, EnableFlagNone)
+	assert.NoError(t, err)
+	assert.Equal(t, ModuleStateStopped, dep.State())
+	assert.Equal(t, ModuleStateStopped, depDep.State())
+
+	// 超时的模块在后台启动成功后，依赖它的模块也会启动
+	deadline := time.Now().Add(2 * time.Second)
+	for depDep.State() != ModuleStateRunning {
+		if time.Now().After(deadline) {
+			assert.FailNow(t, "timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ModuleStateRunning, slow.State())
+	assert.Equal(t, ModuleStateRunning, dep.State())
+	for _, stat := range l.GetStartStats() {
+		assert.Empty(t, stat.Error, stat.Name)
+	}
+}
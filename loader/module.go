@@ -19,7 +19,13 @@ type Module interface {
 	SetLogLevel(log.Priority)
 	LogLevel() log.Priority
 	WaitEnable() // TODO: should this function return when modules enable failed?
+	State() ModuleState
+	LastError() error
 	ModuleImpl
+
+	markFailed(err error)
+	// 第一次启动成功后关闭，与 WaitEnable 相同
+	enabledChan() <-chan struct{}
 }
 
 type Modules map[string]Module
@@ -29,19 +35,67 @@ type ModuleImpl interface {
 	Stop() error
 }
 
+// HealthChecker 是可选的接口，模块实现后由 loader 定期检查模块是否正常工作，
+// CheckHealth 返回错误时模块会被标记为 failed，模块实现了 Restartable 时还会被重启。
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// Restartable 是可选的接口，只有实现了它并且 CanRestart 返回 true 的模块才能被 RestartModule 重启，
+// 健康检查失败后的自动重启也是如此。实现者需要保证 Stop 之后可以再次 Start，并且 Stop 不会影响其他模块，
+// 比如不能关闭共享的 DBus 连接。
+type Restartable interface {
+	CanRestart() bool
+}
+
+func isRestartable(m Module) bool {
+	r, ok := m.(Restartable)
+	return ok && r.CanRestart()
+}
+
+type ModuleState uint32
+
+const (
+	ModuleStateStopped ModuleState = iota
+	ModuleStateStarting
+	ModuleStateRunning
+	ModuleStateFailed
+)
+
+func (s ModuleState) String() string {
+	switch s {
+	case ModuleStateStopped:
+		return "stopped"
+	case ModuleStateStarting:
+		return "starting"
+	case ModuleStateRunning:
+		return "running"
+	case ModuleStateFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(s))
+}
+
 type ModuleBase struct {
-	impl    ModuleImpl
-	enabled bool
-	name    string
-	log     *log.Logger
-	wg      sync.WaitGroup
+	impl      ModuleImpl
+	enabled   bool
+	name      string
+	log       *log.Logger
+	wg        sync.WaitGroup
+	wgOnce    sync.Once
+	enabledCh chan struct{}
+
+	stateMu sync.Mutex // 保护 enabled、state 和 lastErr
+	state   ModuleState
+	lastErr error
 }
 
 func NewModuleBase(name string, impl ModuleImpl, logger *log.Logger) *ModuleBase {
 	m := &ModuleBase{
-		name: name,
-		impl: impl,
-		log:  logger,
+		name:      name,
+		impl:      impl,
+		log:       logger,
+		enabledCh: make(chan struct{}),
 	}
 
 	// 此为等待「enabled」的 WaitGroup，故在 enable 完成之前，需要一直为等待状态。
@@ -51,40 +105,86 @@ func NewModuleBase(name string, impl ModuleImpl, logger *log.Logger) *ModuleBase
 	return m
 }
 
+func (d *ModuleBase) setState(state ModuleState, err error) {
+	d.stateMu.Lock()
+	d.state = state
+	d.lastErr = err
+	d.stateMu.Unlock()
+}
+
 func (d *ModuleBase) doEnable(enable bool) error {
 	if d.impl != nil {
 		fn := d.impl.Stop
 		if enable {
+			d.setState(ModuleStateStarting, nil)
 			fn = d.impl.Start
 		}
 
 		if err := fn(); err != nil {
+			if enable {
+				d.setState(ModuleStateFailed, err)
+			}
 			return err
 		}
 
 		if enable {
-			d.wg.Done()
+			// 模块重启后不需要再次通知等待者
+			d.wgOnce.Do(func() {
+				d.wg.Done()
+				close(d.enabledCh)
+			})
 		}
 	}
+	d.stateMu.Lock()
 	d.enabled = enable
+	if enable {
+		d.state = ModuleStateRunning
+	} else {
+		d.state = ModuleStateStopped
+	}
+	d.lastErr = nil
+	d.stateMu.Unlock()
 	return nil
 }
 
 func (d *ModuleBase) Enable(enable bool) error {
-	if d.enabled == enable {
+	if d.IsEnable() == enable {
 		return fmt.Errorf("%s daemon is already started", d.name)
 	}
 	return d.doEnable(enable)
 }
 
 func (d *ModuleBase) IsEnable() bool {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
 	return d.enabled
 }
 
+func (d *ModuleBase) State() ModuleState {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.state
+}
+
+// LastError 返回模块最近一次启动失败或者健康检查失败的原因
+func (d *ModuleBase) LastError() error {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.lastErr
+}
+
+func (d *ModuleBase) markFailed(err error) {
+	d.setState(ModuleStateFailed, err)
+}
+
 func (d *ModuleBase) WaitEnable() {
 	d.wg.Wait()
 }
 
+func (d *ModuleBase) enabledChan() <-chan struct{} {
+	return d.enabledCh
+}
+
 func (d *ModuleBase) Name() string {
 	return d.name
 }
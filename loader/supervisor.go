@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 健康检查连续失败后自动重启的最大次数，超过后保持 failed 状态，等待手动重启
+const maxAutoRestartCount = 3
+
+type ModuleInfo struct {
+	Name         string
+	State        string
+	Enabled      bool
+	Dependencies []string
+	Error        string `json:",omitempty"`
+}
+
+func getModuleInfo(m Module) ModuleInfo {
+	info := ModuleInfo{
+		Name:         m.Name(),
+		State:        m.State().String(),
+		Enabled:      m.IsEnable(),
+		Dependencies: m.GetDependencies(),
+	}
+	if err := m.LastError(); err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+// ListModuleInfo 返回所有模块的状态，按名称排序
+func (l *Loader) ListModuleInfo() []ModuleInfo {
+	modules := l.List()
+	result := make([]ModuleInfo, 0, len(modules))
+	for _, m := range modules {
+		result = append(result, getModuleInfo(m))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (l *Loader) GetModuleState(name string) (ModuleState, error) {
+	m := l.GetModule(name)
+	if m == nil {
+		return 0, &EnableError{ModuleName: name, Code: ErrorMissingModule}
+	}
+	return m.State(), nil
+}
+
+// 获取直接或间接依赖 name 模块并且已经启用的模块，调用者需要持有 l.lock
+func (l *Loader) getEnabledDependents(name string) []string {
+	var result []string
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) != 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, m := range l.modules {
+			if visited[m.Name()] || !m.IsEnable() {
+				continue
+			}
+			for _, dep := range m.GetDependencies() {
+				if dep == cur {
+					visited[m.Name()] = true
+					result = append(result, m.Name())
+					queue = append(queue, m.Name())
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// 获取重启 name 模块时需要重启的模块，按 DAGBuilder 的拓扑排序，依赖在前
+func (l *Loader) getRestartOrder(name string) ([]Module, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.modules[name]; !ok {
+		return nil, &EnableError{ModuleName: name, Code: ErrorMissingModule}
+	}
+	restarting := append([]string{name}, l.getEnabledDependents(name)...)
+	dag, err := NewDAGBuilder(l, restarting, nil, EnableFlagNone).Execute()
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := dag.TopologicalDag()
+	if !ok {
+		return nil, &EnableError{Code: ErrorCircleDependencies}
+	}
+
+	restartingSet := make(map[string]struct{}, len(restarting))
+	for _, n := range restarting {
+		restartingSet[n] = struct{}{}
+	}
+	var result []Module
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		// DAG 中还包含被重启模块的依赖，它们不需要重启
+		if _, ok := restartingSet[node.ID]; ok {
+			m := l.modules[node.ID]
+			if !isRestartable(m) {
+				return nil, &EnableError{ModuleName: m.Name(), Code: ErrorNotRestartable}
+			}
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// RestartModule 停止并重新启动模块，依赖它的已启用模块也会按依赖顺序重启。
+// 这些模块都需要实现 Restartable，否则不重启任何模块并返回错误。
+func (l *Loader) RestartModule(name string) error {
+	l.restartLock.Lock()
+	defer l.restartLock.Unlock()
+
+	modules, err := l.getRestartOrder(name)
+	if err != nil {
+		return err
+	}
+
+	// 先停止依赖者，再停止被依赖的模块
+	for i := len(modules) - 1; i >= 0; i-- {
+		m := modules[i]
+		if !m.IsEnable() {
+			continue
+		}
+		l.log.Info("stop module", m.Name())
+		err = m.Enable(false)
+		if err != nil {
+			return fmt.Errorf("failed to stop module %s: %w", m.Name(), err)
+		}
+	}
+
+	for _, m := range modules {
+		l.log.Info("start module", m.Name())
+		stat := ModuleStartStat{
+			Name:      m.Name(),
+			BeginTime: time.Now(),
+		}
+		err = m.Enable(true)
+		stat.StartDuration = time.Since(stat.BeginTime)
+		if err != nil {
+			stat.Error = err.Error()
+		}
+		l.setStartStat(stat)
+		if err != nil {
+			return &EnableError{ModuleName: m.Name(), Code: ErrorInternalError, detail: err.Error()}
+		}
+		l.log.Infof("restart module %s done cost %s", m.Name(), stat.StartDuration)
+	}
+	return nil
+}
+
+// StartSupervisor 每隔 interval 对运行中的模块做健康检查，失败的模块会被自动重启。
+// moduleLocker 是调用者启用、停用和重启模块时持有的锁，检查和重启模块时也会持有它，可以为 nil。
+func (l *Loader) StartSupervisor(interval time.Duration, moduleLocker sync.Locker) {
+	l.lock.Lock()
+	if l.supervisorQuit != nil {
+		l.lock.Unlock()
+		return
+	}
+	quit := make(chan struct{})
+	l.supervisorQuit = quit
+	l.supervisorLocker = moduleLocker
+	l.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		restartCounts := make(map[string]int)
+		for {
+			select {
+			case <-ticker.C:
+				l.superviseOnce(restartCounts)
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+func (l *Loader) StopSupervisor() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.supervisorQuit != nil {
+		close(l.supervisorQuit)
+		l.supervisorQuit = nil
+	}
+}
+
+func (l *Loader) superviseOnce(restartCounts map[string]int) {
+	l.lock.Lock()
+	locker := l.supervisorLocker
+	l.lock.Unlock()
+
+	for _, m := range l.List() {
+		if _, ok := m.(HealthChecker); !ok {
+			continue
+		}
+		if locker != nil {
+			locker.Lock()
+		}
+		l.superviseModule(m, restartCounts)
+		if locker != nil {
+			locker.Unlock()
+		}
+	}
+}
+
+// 检查并按需重启一个模块，调用者需要持有 supervisorLocker，这样不会和手动启用、停用或重启模块同时进行
+func (l *Loader) superviseModule(m Module, restartCounts map[string]int) {
+	checker := m.(HealthChecker)
+	if m.State() != ModuleStateRunning {
+		return
+	}
+	err := checker.CheckHealth()
+	if err == nil {
+		restartCounts[m.Name()] = 0
+		return
+	}
+
+	l.log.Warningf("module %s health check failed: %v", m.Name(), err)
+	m.markFailed(err)
+	if !isRestartable(m) {
+		l.log.Warningf("module %s does not support restart, keep it failed", m.Name())
+		return
+	}
+	if restartCounts[m.Name()] >= maxAutoRestartCount {
+		l.log.Warningf("module %s restarted too many times, give up", m.Name())
+		return
+	}
+	restartCounts[m.Name()]++
+	err = l.RestartModule(m.Name())
+	if err != nil {
+		l.log.Warningf("failed to restart module %s: %v", m.Name(), err)
+	}
+}
@@ -36,12 +36,32 @@ func (d *Daemon) Start() error {
 		return err
 	}
 	d.manager = m
+
+	err = service.Export(dbusPath, m)
+	if err != nil {
+		return err
+	}
+
+	err = service.RequestName(dbusServiceName)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 func (d *Daemon) Stop() error {
 	if d.manager != nil {
-		err := d.manager.stop()
+		service := loader.GetService()
+		err := service.ReleaseName(dbusServiceName)
+		if err != nil {
+			logger.Warning(err)
+		}
+		err = service.StopExport(d.manager)
+		if err != nil {
+			logger.Warning(err)
+		}
+
+		err = d.manager.stop()
 		if err != nil {
 			return err
 		}
@@ -6,6 +6,7 @@ package service_trigger
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/godbus/dbus"
 )
@@ -13,9 +14,11 @@ import (
 type DBusSignalMonitor struct {
 	Type       uint
 	conn       *dbus.Conn
-	services   []*Service
-	nameMap    map[string]string
 	signalChan chan *dbus.Signal
+
+	mu       sync.Mutex // 保护 services 和 nameMap，重新加载时会修改
+	services []*Service
+	nameMap  map[string]string
 }
 
 func newDBusSignalMonitor(Type uint) *DBusSignalMonitor {
@@ -25,10 +28,6 @@ func newDBusSignalMonitor(Type uint) *DBusSignalMonitor {
 	}
 }
 
-func (sigMonitor *DBusSignalMonitor) appendService(service *Service) {
-	sigMonitor.services = append(sigMonitor.services, service)
-}
-
 func (sigMonitor *DBusSignalMonitor) getConn() (*dbus.Conn, error) {
 	if sigMonitor.conn != nil {
 		return sigMonitor.conn, nil
@@ -55,6 +54,9 @@ const (
 )
 
 func (sigMonitor *DBusSignalMonitor) findMatchedServices(signal *dbus.Signal) []*Service {
+	sigMonitor.mu.Lock()
+	defer sigMonitor.mu.Unlock()
+
 	var sender string
 	if strings.HasPrefix(signal.Sender, ":") {
 		sender = sigMonitor.nameMap[signal.Sender]
@@ -68,13 +70,14 @@ func (sigMonitor *DBusSignalMonitor) findMatchedServices(signal *dbus.Signal) []
 		if dbusField.Sender == sender &&
 			signal.Name == dbusField.Interface+"."+dbusField.Signal {
 
-			if dbusField.Path != "" {
-				if dbusField.Path == string(signal.Path) {
-					matched = append(matched, service)
-				}
-			} else {
-				matched = append(matched, service)
+			if dbusField.Path != "" && dbusField.Path != string(signal.Path) {
+				continue
 			}
+			// 连接上其他服务的 match rule 也会让这个信号被收到，需要再检查一次参数
+			if !dbusField.matchArgs(signal.Body) {
+				continue
+			}
+			matched = append(matched, service)
 		}
 	}
 	return matched
@@ -90,37 +93,71 @@ func (sigMonitor *DBusSignalMonitor) init() {
 		logger.Warning(err)
 		return
 	}
-	rules := []string{ruleNameOwnerChanged}
-	for _, service := range sigMonitor.services {
-		rules = append(rules, service.getDBusMatchRule())
+	err = addMatch(conn, ruleNameOwnerChanged)
+	if err != nil {
+		logger.Warning(err)
+	}
+	sigMonitor.addServiceMatches(conn, sigMonitor.services)
+
+	sigMonitor.signalChan = make(chan *dbus.Signal, 20)
+}
+
+// 添加服务的 match rule，并记录服务发送者的 unique name
+func (sigMonitor *DBusSignalMonitor) addServiceMatches(conn *dbus.Conn, services []*Service) {
+	for _, service := range services {
+		err := addMatch(conn, service.getDBusMatchRule())
+		if err != nil {
+			logger.Warning(err)
+		}
 
 		dbusField := service.Monitor.DBus
 
 		// set nameMap
 		var nameKnown bool
+		sigMonitor.mu.Lock()
 		for _, name := range sigMonitor.nameMap {
 			if name == dbusField.Sender {
 				nameKnown = true
 				break
 			}
 		}
+		sigMonitor.mu.Unlock()
 		if !nameKnown {
 			owner, err := getNameOwner(conn, dbusField.Sender)
 			if err == nil {
 				logger.Debugf("The name %s is owned by %s", dbusField.Sender, owner)
+				sigMonitor.mu.Lock()
 				sigMonitor.nameMap[owner] = dbusField.Sender
+				sigMonitor.mu.Unlock()
 			}
 		}
 	}
+}
 
-	for _, rule := range rules {
-		err = addMatch(conn, rule)
+// setServices 设置监视的服务，重新加载时连接是共享的，不能关闭，所以只替换 match rule
+func (sigMonitor *DBusSignalMonitor) setServices(services []*Service) {
+	sigMonitor.mu.Lock()
+	oldServices := sigMonitor.services
+	sigMonitor.services = services
+	sigMonitor.mu.Unlock()
+	if sigMonitor.signalChan == nil {
+		// 还没有调用 init，init 时会添加 match rule
+		return
+	}
+
+	conn, err := sigMonitor.getConn()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	// 总线按次数记录 match rule，先添加再删除，保证相同的规则不会中断
+	sigMonitor.addServiceMatches(conn, services)
+	for _, service := range oldServices {
+		err = removeMatch(conn, service.getDBusMatchRule())
 		if err != nil {
 			logger.Warning(err)
 		}
 	}
-
-	sigMonitor.signalChan = make(chan *dbus.Signal, 20)
 }
 
 func addMatch(conn *dbus.Conn, rule string) error {
@@ -128,6 +165,11 @@ func addMatch(conn *dbus.Conn, rule string) error {
 	return conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
 }
 
+func removeMatch(conn *dbus.Conn, rule string) error {
+	logger.Debug("remove rule", rule)
+	return conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Err
+}
+
 func (sigMonitor *DBusSignalMonitor) handleNameOwnerChanged(signalBody []interface{}) {
 	if len(signalBody) != 3 {
 		return
@@ -151,6 +193,8 @@ func (sigMonitor *DBusSignalMonitor) handleNameOwnerChanged(signalBody []interfa
 		return
 	}
 
+	sigMonitor.mu.Lock()
+	defer sigMonitor.mu.Unlock()
 	var found bool
 	for _, service := range sigMonitor.services {
 		if service.Monitor.DBus.Sender == name {
@@ -193,7 +237,7 @@ func (sigMonitor *DBusSignalMonitor) signalLoop(m *Manager) {
 		services := sigMonitor.findMatchedServices(signal)
 		for _, service := range services {
 			logger.Debug("exec service", service)
-			go m.execService(service, signal)
+			go m.execService(service, signal.Body)
 		}
 	}
 	logger.Debug("signalLoop return", sigMonitor.Type)
@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+// 支持的占位符为 {{.Body[N]}}，括号内允许空格，以及旧的 %{argN} 格式
+var execPlaceholderRegexp = regexp.MustCompile(`^(?:\{\{\s*\.Body\[(\d+)\]\s*\}\}|%\{arg(\d+)\})`)
+
+var shellNames = []string{"sh", "bash", "dash", "zsh"}
+
+type execTemplatePart struct {
+	literal  string
+	argIndex int // 为 -1 时是普通文本
+}
+
+type execTemplate struct {
+	parts []execTemplatePart
+}
+
+func parseExecTemplates(exec []string) ([]*execTemplate, error) {
+	result := make([]*execTemplate, len(exec))
+	for i, arg := range exec {
+		tpl, err := parseExecTemplate(arg)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = tpl
+	}
+
+	// 要执行的程序必须是固定的，所有类型的触发器都一样
+	if len(result) > 0 && result[0].hasPlaceholder() {
+		return nil, fmt.Errorf("placeholder is not allowed in program %q", exec[0])
+	}
+
+	// 替换的值不能被 shell 当作代码解析，脚本和它之前的参数中都不能有占位符，
+	// 需要作为脚本之后的参数传递，在脚本中使用 "$1" 引用，比如 ["sh", "-c", "echo \"$1\"", "", "%{arg0}"]
+	scriptIdx := shellScriptIndex(exec)
+	for i := 0; i <= scriptIdx; i++ {
+		if result[i].hasPlaceholder() {
+			return nil, fmt.Errorf("placeholder is not allowed in shell script %q, pass it as a positional parameter",
+				exec[i])
+		}
+	}
+	return result, nil
+}
+
+func isShell(name string) bool {
+	base := filepath.Base(name)
+	for _, shell := range shellNames {
+		if base == shell {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回 sh -c 形式的命令中脚本参数的序号，不是这种形式时返回 -1。
+// 支持 env 前缀，以及 -ec、-lc 这样组合的选项。
+func shellScriptIndex(exec []string) int {
+	i := 0
+	if len(exec) > 0 && filepath.Base(exec[0]) == "env" {
+		// 跳过 env 的选项和环境变量
+		for i = 1; i < len(exec); i++ {
+			arg := exec[i]
+			if arg == "-u" || arg == "-C" {
+				i++
+			} else if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+				break
+			}
+		}
+	}
+	if i >= len(exec) || !isShell(exec[i]) {
+		return -1
+	}
+
+	command := false
+	for i++; i < len(exec); i++ {
+		arg := exec[i]
+		if arg == "--" || arg == "-" {
+			i++
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			if arg == "--rcfile" || arg == "--init-file" {
+				i++
+			}
+			continue
+		}
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			break
+		}
+		if arg[0] == '-' && strings.ContainsRune(arg[1:], 'c') {
+			command = true
+		}
+		// -o 和 -O 的下一个参数是选项名
+		if strings.ContainsAny(arg[1:], "oO") {
+			i++
+		}
+	}
+	if !command || i >= len(exec) {
+		return -1
+	}
+	return i
+}
+
+func parseExecTemplate(str string) (*execTemplate, error) {
+	tpl := &execTemplate{}
+	var literal strings.Builder
+	for len(str) > 0 {
+		idx := strings.IndexAny(str, "{%")
+		if idx < 0 {
+			literal.WriteString(str)
+			break
+		}
+		literal.WriteString(str[:idx])
+		str = str[idx:]
+
+		match := execPlaceholderRegexp.FindStringSubmatch(str)
+		if match == nil && !strings.HasPrefix(str, "{{") {
+			// 普通的 { 和 % 字符
+			literal.WriteString(str[:1])
+			str = str[1:]
+			continue
+		}
+		if match == nil {
+			end := strings.Index(str, "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed placeholder in %q", str)
+			}
+			return nil, fmt.Errorf("unsupported placeholder %q", str[:end+2])
+		}
+		indexStr := match[1]
+		if indexStr == "" {
+			indexStr = match[2]
+		}
+		argIndex, err := strconv.Atoi(indexStr)
+		if err != nil {
+			return nil, err
+		}
+
+		if literal.Len() > 0 {
+			tpl.parts = append(tpl.parts, execTemplatePart{literal: literal.String(), argIndex: -1})
+			literal.Reset()
+		}
+		tpl.parts = append(tpl.parts, execTemplatePart{argIndex: argIndex})
+		str = str[len(match[0]):]
+	}
+	if literal.Len() > 0 {
+		tpl.parts = append(tpl.parts, execTemplatePart{literal: literal.String(), argIndex: -1})
+	}
+	return tpl, nil
+}
+
+func (tpl *execTemplate) hasPlaceholder() bool {
+	for _, part := range tpl.parts {
+		if part.argIndex >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 整个参数只有一个占位符
+func (tpl *execTemplate) isWholePlaceholder() bool {
+	return len(tpl.parts) == 1 && tpl.parts[0].argIndex >= 0
+}
+
+// 使用触发时的参数展开模板，替换后的值不会再被展开
+func (tpl *execTemplate) expand(args []interface{}) (string, error) {
+	var sb strings.Builder
+	for _, part := range tpl.parts {
+		if part.argIndex < 0 {
+			sb.WriteString(part.literal)
+			continue
+		}
+
+		if part.argIndex >= len(args) {
+			return "", fmt.Errorf("placeholder .Body[%d] out of range, only %d args",
+				part.argIndex, len(args))
+		}
+		value, err := formatExecValue(args[part.argIndex])
+		if err != nil {
+			return "", fmt.Errorf("placeholder .Body[%d]: %v", part.argIndex, err)
+		}
+		sb.WriteString(value)
+	}
+	return sb.String(), nil
+}
+
+// 只允许基本类型的值，数组、字典和结构体没有明确的字符串格式，不允许使用
+func formatExecValue(value interface{}) (string, error) {
+	if variant, ok := value.(dbus.Variant); ok {
+		value = variant.Value()
+	}
+
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case dbus.ObjectPath:
+		str = string(v)
+	case dbus.Signature:
+		str = v.String()
+	case bool, byte, int16, uint16, int32, uint32, int64, uint64, int, uint, float64:
+		str = fmt.Sprint(v)
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+
+	if strings.IndexByte(str, 0) >= 0 {
+		return "", fmt.Errorf("value %q contains NUL", str)
+	}
+	return str, nil
+}
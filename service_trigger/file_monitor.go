@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var fileEventOps = map[string]fsnotify.Op{
+	"Create": fsnotify.Create,
+	"Write":  fsnotify.Write,
+	"Remove": fsnotify.Remove,
+	"Rename": fsnotify.Rename,
+	"Chmod":  fsnotify.Chmod,
+}
+
+const fileEventOpsAll = fsnotify.Create | fsnotify.Write | fsnotify.Remove |
+	fsnotify.Rename | fsnotify.Chmod
+
+type fileWatchRule struct {
+	path string
+	ops  fsnotify.Op
+}
+
+// 返回需要监视的路径，path 是目录时监视它本身，否则监视它所在的目录，这样文件被删除后重新创建也能收到事件
+func (rule *fileWatchRule) watchPath() string {
+	fileInfo, err := os.Stat(rule.path)
+	if err == nil && fileInfo.IsDir() {
+		return rule.path
+	}
+	return filepath.Dir(rule.path)
+}
+
+func (rule *fileWatchRule) match(ev fsnotify.Event) bool {
+	if ev.Op&rule.ops == 0 {
+		return false
+	}
+	name := filepath.Clean(ev.Name)
+	return name == rule.path || filepath.Dir(name) == rule.path
+}
+
+// 事件名称，多个事件同时发生时只取第一个
+func getFileEventName(op fsnotify.Op) string {
+	for _, name := range []string{"Create", "Write", "Remove", "Rename", "Chmod"} {
+		if op&fileEventOps[name] != 0 {
+			return name
+		}
+	}
+	return op.String()
+}
+
+type fileWatchEntry struct {
+	service *Service
+	rule    *fileWatchRule
+}
+
+// FileMonitor 监视 File 类型规则中的文件，文件变化时执行服务
+type FileMonitor struct {
+	entries []*fileWatchEntry
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+func newFileMonitor() *FileMonitor {
+	return &FileMonitor{}
+}
+
+func (fm *FileMonitor) appendService(service *Service) {
+	fm.entries = append(fm.entries, &fileWatchEntry{
+		service: service,
+		rule:    service.getFileWatchRule(),
+	})
+}
+
+func (fm *FileMonitor) start(m *Manager) error {
+	if len(fm.entries) == 0 {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watched := make(map[string]struct{})
+	for _, entry := range fm.entries {
+		path := entry.rule.watchPath()
+		if _, ok := watched[path]; ok {
+			continue
+		}
+		err = watcher.Add(path)
+		if err != nil {
+			logger.Warningf("service %v: failed to watch %q: %v", entry.service, path, err)
+			continue
+		}
+		logger.Debug("watch", path)
+		watched[path] = struct{}{}
+	}
+
+	fm.watcher = watcher
+	fm.done = make(chan struct{})
+	go fm.loop(m, watcher)
+	return nil
+}
+
+func (fm *FileMonitor) loop(m *Manager, watcher *fsnotify.Watcher) {
+	defer close(fm.done)
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			fm.handleEvent(m, ev)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warning(err)
+		}
+	}
+}
+
+func (fm *FileMonitor) handleEvent(m *Manager, ev fsnotify.Event) {
+	for _, entry := range fm.entries {
+		if !entry.rule.match(ev) {
+			continue
+		}
+		logger.Debug("exec service", entry.service)
+		go m.execService(entry.service, []interface{}{ev.Name, getFileEventName(ev.Op)})
+	}
+}
+
+func (fm *FileMonitor) stop() error {
+	if fm.watcher == nil {
+		return nil
+	}
+	err := fm.watcher.Close()
+	<-fm.done
+	fm.watcher = nil
+	return err
+}
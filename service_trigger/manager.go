@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/godbus/dbus"
@@ -22,8 +23,13 @@ import (
 )
 
 type Manager struct {
-	service    *dbusutil.Service
-	serviceMap map[string]*Service
+	service *dbusutil.Service
+	states  *serviceStates
+
+	// 保护 serviceMap、invalidServices 和各个 monitor，Reload 时会替换它们
+	mu              sync.Mutex
+	serviceMap      map[string]*Service
+	invalidServices map[string]*invalidService // key 为文件路径
 
 	notifications notifications.Notifications
 	sysDBusDaemon ofdbus.DBus
@@ -31,14 +37,36 @@ type Manager struct {
 	systemSigMonitor  *DBusSignalMonitor
 	sessionSigMonitor *DBusSignalMonitor
 	sysSigLoop        *dbusutil.SignalLoop
+	timerMonitor      *TimerMonitor
+	fileMonitor       *FileMonitor
+	udevMonitor       *UdevMonitor
 	agents            map[string]*agent
+
+	//nolint
+	signals *struct {
+		// 服务执行完成后发送，exitCode 为 -1 表示程序无法启动
+		ServiceTriggered struct {
+			name     string
+			exitCode int32
+		}
+	}
+}
+
+// 没有通过检查的服务文件
+type invalidService struct {
+	filename string
+	err      error
 }
 
 func newManager(service *dbusutil.Service) *Manager {
 	m := &Manager{
 		service:           service,
+		states:            newServiceStates(serviceStatesFile),
 		systemSigMonitor:  newDBusSignalMonitor(busTypeSystem),
 		sessionSigMonitor: newDBusSignalMonitor(busTypeSession),
+		timerMonitor:      newTimerMonitor(),
+		fileMonitor:       newFileMonitor(),
+		udevMonitor:       newUdevMonitor(),
 		agents:            make(map[string]*agent),
 	}
 	return m
@@ -62,7 +90,9 @@ func (m *Manager) handleSysBusNameOwnerChanged(name, oldOwner, newOwner string)
 }
 
 func (m *Manager) start() error {
+	m.mu.Lock()
 	m.loadServices()
+	m.mu.Unlock()
 	m.initAgents()
 
 	sessionBus := m.service.Conn()
@@ -87,13 +117,25 @@ func (m *Manager) start() error {
 
 	m.systemSigMonitor.init()
 	go m.systemSigMonitor.signalLoop(m)
+
+	m.mu.Lock()
+	m.startMonitors()
+	m.mu.Unlock()
 	return nil
 }
 
 func (m *Manager) stop() error {
 	m.sysSigLoop.Stop()
+	m.mu.Lock()
+	m.timerMonitor.stop()
+	m.udevMonitor.stop()
+	err := m.fileMonitor.stop()
+	m.mu.Unlock()
+	if err != nil {
+		logger.Warning(err)
+	}
 
-	err := m.sessionSigMonitor.stop()
+	err = m.sessionSigMonitor.stop()
 	if err != nil {
 		return err
 	}
@@ -180,10 +222,16 @@ func (m *Manager) initAgents() {
 
 func (m *Manager) loadServices() {
 	m.serviceMap = make(map[string]*Service)
+	m.invalidServices = make(map[string]*invalidService)
 	m.loadServicesFromDir("/usr/lib/deepin-daemon/" + moduleName)
 	m.loadServicesFromDir("/etc/deepin-daemon/" + moduleName)
 
+	var systemServices, sessionServices []*Service
 	for _, service := range m.serviceMap {
+		if !m.states.isEnabled(service.basename) {
+			logger.Debugf("service %v is disabled", service)
+			continue
+		}
 		switch service.Monitor.Type {
 		case typeDBus:
 			dbusField := service.Monitor.DBus
@@ -191,17 +239,59 @@ func (m *Manager) loadServices() {
 				continue
 			}
 			if dbusField.BusType == busTypeSystemStr {
-				m.systemSigMonitor.appendService(service)
+				systemServices = append(systemServices, service)
 			} else if dbusField.BusType == busTypeSessionStr {
-				m.sessionSigMonitor.appendService(service)
+				sessionServices = append(sessionServices, service)
 			}
+		case typeTimer:
+			m.timerMonitor.appendService(service)
+		case typeFile:
+			m.fileMonitor.appendService(service)
+		case typeUdev:
+			m.udevMonitor.appendService(service)
 		}
 	}
+	m.systemSigMonitor.setServices(systemServices)
+	m.sessionSigMonitor.setServices(sessionServices)
+}
+
+// reload 重新加载服务文件，DBus 信号监视器保持运行，其他的监视器重新创建
+func (m *Manager) reload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.timerMonitor.stop()
+	m.udevMonitor.stop()
+	err := m.fileMonitor.stop()
+	if err != nil {
+		logger.Warning(err)
+	}
+	m.timerMonitor = newTimerMonitor()
+	m.fileMonitor = newFileMonitor()
+	m.udevMonitor = newUdevMonitor()
+
+	m.loadServices()
+	m.startMonitors()
+}
+
+func (m *Manager) startMonitors() {
+	m.timerMonitor.start(m)
+	err := m.fileMonitor.start(m)
+	if err != nil {
+		logger.Warning("failed to start file monitor:", err)
+	}
+	err = m.udevMonitor.start(m)
+	if err != nil {
+		logger.Warning("failed to start udev monitor:", err)
+	}
 }
 
 const (
 	serviceFileExt    = ".service.json"
 	typeDBus          = "DBus"
+	typeTimer         = "Timer"
+	typeFile          = "File"
+	typeUdev          = "Udev"
 	busTypeSystemStr  = "System"
 	busTypeSessionStr = "Session"
 )
@@ -222,6 +312,10 @@ func (m *Manager) loadServicesFromDir(dirname string) {
 		service, err := loadService(filename)
 		if err != nil {
 			logger.Warningf("failed to load %q: %v", filename, err)
+			m.invalidServices[filename] = &invalidService{
+				filename: filename,
+				err:      err,
+			}
 			continue
 		} else {
 			logger.Debugf("load %q ok", filename)
@@ -245,48 +339,78 @@ func getNameOwner(conn *dbus.Conn, name string) (string, error) {
 	return owner, err
 }
 
-func newReplacer(signal *dbus.Signal) *strings.Replacer {
-	var oldNewSlice []string
-	for idx, item := range signal.Body {
-		oldStr := fmt.Sprintf("%%{arg%d}", idx)
-		newStr := fmt.Sprintf("%v", item)
-		logger.Debugf("old %q => new %q", oldStr, newStr)
-		oldNewSlice = append(oldNewSlice, oldStr, newStr)
+// execService 在满足服务的防抖和限流条件时执行服务，args 是触发时的参数
+func (m *Manager) execService(service *Service, args []interface{}) {
+	if service.limiter == nil {
+		m.runService(service, args)
+		return
+	}
+	service.limiter.trigger(args, func(args []interface{}) {
+		m.runService(service, args)
+	})
+}
+
+func (m *Manager) runService(service *Service, args []interface{}) {
+	fired := time.Now()
+	exitCode := m.runServiceAux(service, args)
+	m.states.recordRun(service.basename, fired, exitCode)
+	if m.service != nil {
+		err := m.service.Emit(m, "ServiceTriggered", service.basename, int32(exitCode))
+		if err != nil {
+			logger.Warning(err)
+		}
 	}
-	return strings.NewReplacer(oldNewSlice...)
 }
 
-func (m *Manager) execService(service *Service,
-	signal *dbus.Signal) {
+// 执行服务并返回退出码，程序无法启动时返回 -1
+func (m *Manager) runServiceAux(service *Service, args []interface{}) int {
 	if service.execFn != nil {
-		service.execFn(signal)
-		return
+		service.execFn(args)
+		return 0
 	}
 
 	if len(service.Exec) == 0 {
 		logger.Warning("service Exec empty")
-		return
+		return -1
+	}
+
+	execTemplates := service.execTemplates
+	if execTemplates == nil {
+		var err error
+		execTemplates, err = parseExecTemplates(service.Exec)
+		if err != nil {
+			logger.Warningf("service %v: %v", service, err)
+			return -1
+		}
+	}
+
+	var cmdArgs []string
+	for _, tpl := range execTemplates[1:] {
+		arg, err := tpl.expand(args)
+		if err != nil {
+			logger.Warningf("service %v: %v", service, err)
+			return -1
+		}
+		cmdArgs = append(cmdArgs, arg)
 	}
 
-	var args []string
-	execArgs := service.Exec[1:]
 	if logger.GetLogLevel() == log.LevelDebug {
 		if service.Exec[0] == "sh" {
 			// add -x option for debug shell
-			execArgs = append([]string{"-x"}, execArgs...)
+			cmdArgs = append([]string{"-x"}, cmdArgs...)
 		}
 	}
 
-	replacer := newReplacer(signal)
-	for _, arg := range execArgs {
-		args = append(args, replacer.Replace(arg))
-	}
-
-	logger.Debugf("run cmd %q %#v", service.Exec[0], args)
-	cmd := exec.Command(service.Exec[0], args...)
+	logger.Debugf("run cmd %q %#v", service.Exec[0], cmdArgs)
+	cmd := exec.Command(service.Exec[0], cmdArgs...)
 	out, err := cmd.CombinedOutput()
 	logger.Debugf("cmd combined output: %s", out)
 	if err != nil {
 		logger.Warning(err)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		return -1
 	}
+	return 0
 }
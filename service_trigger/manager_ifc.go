@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+//go:generate dbusutil-gen em -type Manager
+
+const (
+	dbusServiceName = "com.deepin.daemon.ServiceTrigger"
+	dbusPath        = "/com/deepin/daemon/ServiceTrigger"
+	dbusInterface   = dbusServiceName
+)
+
+func (*Manager) GetInterfaceName() string {
+	return dbusInterface
+}
+
+func newServiceStatus(service *Service) *ServiceStatus {
+	return &ServiceStatus{
+		Name:        service.basename,
+		Filename:    service.filename,
+		Type:        service.Monitor.Type,
+		Description: service.Description,
+		Valid:       true,
+	}
+}
+
+// 获取所有服务的状态，按名称排序，调用者需要持有 m.mu
+func (m *Manager) getServiceStatuses() []*ServiceStatus {
+	result := make([]*ServiceStatus, 0, len(m.serviceMap)+len(m.invalidServices))
+	for _, service := range m.serviceMap {
+		result = append(result, newServiceStatus(service))
+	}
+	for _, invalid := range m.invalidServices {
+		result = append(result, &ServiceStatus{
+			Name:     strings.TrimSuffix(filepath.Base(invalid.filename), serviceFileExt),
+			Filename: invalid.filename,
+			Error:    invalid.err.Error(),
+		})
+	}
+	for _, status := range result {
+		m.states.fillStatus(status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name == result[j].Name {
+			return result[i].Filename < result[j].Filename
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// 根据名称查找服务，调用者需要持有 m.mu
+func (m *Manager) getServiceByName(name string) *Service {
+	for _, service := range m.serviceMap {
+		if service.basename == name {
+			return service
+		}
+	}
+	return nil
+}
+
+// ListServices 返回所有服务的状态，包括没有通过检查的服务文件，格式为 ServiceStatus 数组的 JSON
+func (m *Manager) ListServices() (servicesJSON string, busErr *dbus.Error) {
+	m.mu.Lock()
+	statuses := m.getServiceStatuses()
+	m.mu.Unlock()
+
+	data, err := json.Marshal(statuses)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// GetServiceStatus 返回名称为 name 的服务的状态，格式为 ServiceStatus 的 JSON
+func (m *Manager) GetServiceStatus(name string) (statusJSON string, busErr *dbus.Error) {
+	m.mu.Lock()
+	var found *ServiceStatus
+	for _, status := range m.getServiceStatuses() {
+		if status.Name == name {
+			found = status
+			// 同名的文件中优先返回有效的
+			if status.Valid {
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if found == nil {
+		return "", dbusutil.ToError(fmt.Errorf("service %q not found", name))
+	}
+	data, err := json.Marshal(found)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// Reload 重新加载服务文件
+func (m *Manager) Reload() *dbus.Error {
+	logger.Info("reload services")
+	m.reload()
+	return nil
+}
+
+// Enable 启用服务，启用状态会保存下来
+func (m *Manager) Enable(name string) *dbus.Error {
+	return dbusutil.ToError(m.setServiceEnabled(name, true))
+}
+
+// Disable 禁用服务，禁用后不会再执行，禁用状态会保存下来
+func (m *Manager) Disable(name string) *dbus.Error {
+	return dbusutil.ToError(m.setServiceEnabled(name, false))
+}
+
+func (m *Manager) setServiceEnabled(name string, enabled bool) error {
+	m.mu.Lock()
+	service := m.getServiceByName(name)
+	m.mu.Unlock()
+	if service == nil {
+		return fmt.Errorf("service %q not found", name)
+	}
+
+	changed, err := m.states.setEnabled(name, enabled)
+	if err != nil {
+		return err
+	}
+	if changed {
+		logger.Infof("set service %s enabled %v", name, enabled)
+		m.reload()
+	}
+	return nil
+}
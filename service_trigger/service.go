@@ -10,14 +10,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/godbus/dbus"
 )
 
 type ServiceMonitor struct {
-	Type string
-	DBus *ServiceMonitorDBus
+	Type  string
+	DBus  *ServiceMonitorDBus
+	Timer *ServiceMonitorTimer
+	File  *ServiceMonitorFile
+	Udev  *ServiceMonitorUdev
 }
 
 // ServiceMonitorDBus type DBus
@@ -27,6 +32,40 @@ type ServiceMonitorDBus struct {
 	Interface string
 	Signal    string
 	Path      string // optional
+
+	// optional, 按信号参数过滤，key 为参数的序号，只能匹配字符串类型的参数
+	Args map[int]string
+	// optional, 第一个参数是这个名称或者以 "名称." 开头时才匹配，比如 com.deepin
+	Arg0Namespace string
+}
+
+// ServiceMonitorTimer type Timer, Interval 和 Cron 只能设置一个
+// Exec 中的 %{arg0} 为触发的时间
+type ServiceMonitorTimer struct {
+	Interval string // 间隔时间，比如 30m、1h，最小为 1s
+	Cron     string // cron 格式的定时规则：分 时 日 月 周，比如 "0 9 * * 1-5"
+}
+
+// ServiceMonitorFile type File
+// Exec 中的 %{arg0} 为发生变化的文件路径，%{arg1} 为事件名称
+type ServiceMonitorFile struct {
+	Path   string   // 绝对路径，文件不存在时监视它所在的目录
+	Events []string // optional, Create/Write/Remove/Rename/Chmod，为空时监视所有事件
+}
+
+// ServiceMonitorUdev type Udev
+// Exec 中的 %{arg0} 为 action，%{arg1} 为设备的 sysfs 路径，%{arg2} 为 subsystem
+type ServiceMonitorUdev struct {
+	Subsystem  string
+	Action     string            // optional, add/remove/change 等
+	Attributes map[string]string // optional, 设备的 sysfs 属性需要全部匹配
+	Properties map[string]string // optional, 设备的 udev 属性需要全部匹配
+}
+
+// ServiceRateLimit 限制在 Interval 时间内最多执行 Burst 次，超出的触发会被丢弃
+type ServiceRateLimit struct {
+	Interval string
+	Burst    int
 }
 
 type Service struct {
@@ -36,8 +75,18 @@ type Service struct {
 
 	Name        string
 	Description string
-	Exec        []string
-	execFn      func(signal *dbus.Signal)
+	// Exec 中可以使用 {{.Body[N]}} 或者 %{argN} 引用触发时的第 N 个参数，替换后的值作为一个整体的参数，不经过 shell 解析；
+	// sh -c 的脚本中不能使用占位符，需要作为脚本之后的位置参数传递，比如 ["sh", "-c", "echo \"$1\"", "", "%{arg0}"]。
+	// 要执行的程序 Exec[0] 中不能使用占位符。
+	// Timer、File 和 Udev 类型的参数来自外部，占位符只能单独作为一个参数。
+	Exec []string
+	// optional, 比如 500ms，触发后在这段时间内没有新的触发才执行，使用最后一次触发的参数
+	Debounce  string
+	RateLimit *ServiceRateLimit // optional, 默认 10s 内最多执行 20 次
+
+	execTemplates []*execTemplate
+	limiter       *serviceLimiter
+	execFn        func(args []interface{})
 }
 
 func (service *Service) getDBusMatchRule() string {
@@ -51,20 +100,103 @@ func (service *Service) getDBusMatchRule() string {
 	if dbusField.Path != "" {
 		rule += fmt.Sprintf(",path='%s'", dbusField.Path)
 	}
+
+	argIndexes := make([]int, 0, len(dbusField.Args))
+	for idx := range dbusField.Args {
+		argIndexes = append(argIndexes, idx)
+	}
+	sort.Ints(argIndexes)
+	for _, idx := range argIndexes {
+		rule += fmt.Sprintf(",arg%d=%s", idx, quoteMatchRuleValue(dbusField.Args[idx]))
+	}
+	if dbusField.Arg0Namespace != "" {
+		rule += fmt.Sprintf(",arg0namespace='%s'", dbusField.Arg0Namespace)
+	}
 	return rule
 }
 
-func (service *Service) check() error {
-	if service.Monitor.Type != "DBus" {
-		return fmt.Errorf("unknown Monitor.Type %q" + service.Monitor.Type)
+// 按照 DBus 规范转义 match rule 中的值，单引号内不能转义，所以单引号需要写在引号外面并加上反斜杠
+func quoteMatchRuleValue(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// 信号的参数是否满足 Args 和 Arg0Namespace 的过滤条件
+func (dbusField *ServiceMonitorDBus) matchArgs(body []interface{}) bool {
+	for idx, value := range dbusField.Args {
+		if idx >= len(body) {
+			return false
+		}
+		str, ok := body[idx].(string)
+		if !ok || str != value {
+			return false
+		}
 	}
 
-	if service.Monitor.Type == "DBus" {
-		err := service.checkDBus()
-		if err != nil {
-			return err
+	if dbusField.Arg0Namespace != "" {
+		if len(body) == 0 {
+			return false
+		}
+		arg0, ok := body[0].(string)
+		if !ok {
+			return false
+		}
+		if arg0 != dbusField.Arg0Namespace &&
+			!strings.HasPrefix(arg0, dbusField.Arg0Namespace+".") {
+			return false
 		}
 	}
+	return true
+}
+
+func (service *Service) getTimerSchedule() (schedule, error) {
+	timerField := service.Monitor.Timer
+	if timerField.Interval != "" {
+		return parseIntervalSchedule(timerField.Interval)
+	}
+	return parseCronSchedule(timerField.Cron)
+}
+
+func (service *Service) getFileWatchRule() *fileWatchRule {
+	fileField := service.Monitor.File
+	rule := &fileWatchRule{
+		path: filepath.Clean(fileField.Path),
+	}
+	for _, event := range fileField.Events {
+		rule.ops |= fileEventOps[event]
+	}
+	if rule.ops == 0 {
+		rule.ops = fileEventOpsAll
+	}
+	return rule
+}
+
+func (service *Service) getUdevMatchRule() *udevMatchRule {
+	udevField := service.Monitor.Udev
+	return &udevMatchRule{
+		subsystem:  udevField.Subsystem,
+		action:     udevField.Action,
+		attributes: udevField.Attributes,
+		properties: udevField.Properties,
+	}
+}
+
+func (service *Service) check() error {
+	var err error
+	switch service.Monitor.Type {
+	case typeDBus:
+		err = service.checkDBus()
+	case typeTimer:
+		err = service.checkTimer()
+	case typeFile:
+		err = service.checkFile()
+	case typeUdev:
+		err = service.checkUdev()
+	default:
+		err = fmt.Errorf("unknown Monitor.Type %q", service.Monitor.Type)
+	}
+	if err != nil {
+		return err
+	}
 
 	if service.Name == "" {
 		return errors.New("field Name is empty")
@@ -74,9 +206,60 @@ func (service *Service) check() error {
 		return errors.New("field Exec is empty")
 	}
 
+	service.execTemplates, err = parseExecTemplates(service.Exec)
+	if err == nil && service.Monitor.Type != typeDBus {
+		err = checkExecWholeArgs(service.Exec, service.execTemplates)
+	}
+	if err != nil {
+		return fmt.Errorf("field Exec is invalid: %v", err)
+	}
+
+	_, err = service.getLimiterConfig()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
+// 文件路径、设备属性这样的值不可信，不能拼接到其他参数或者 shell 脚本中，只能作为单独的参数传递
+func checkExecWholeArgs(exec []string, templates []*execTemplate) error {
+	for i, tpl := range templates {
+		if !tpl.hasPlaceholder() {
+			continue
+		}
+		if !tpl.isWholePlaceholder() {
+			return fmt.Errorf("placeholder in %q must be a whole argument", exec[i])
+		}
+	}
+	return nil
+}
+
+func (service *Service) getLimiterConfig() (*serviceLimiterConfig, error) {
+	cfg := &serviceLimiterConfig{
+		interval: defaultRateLimitInterval,
+		burst:    defaultRateLimitBurst,
+	}
+	var err error
+	if service.Debounce != "" {
+		cfg.debounce, err = time.ParseDuration(service.Debounce)
+		if err != nil || cfg.debounce <= 0 {
+			return nil, fmt.Errorf("field Debounce %q is invalid", service.Debounce)
+		}
+	}
+
+	if service.RateLimit != nil {
+		cfg.interval, err = time.ParseDuration(service.RateLimit.Interval)
+		if err != nil || cfg.interval <= 0 {
+			return nil, fmt.Errorf("field RateLimit.Interval %q is invalid", service.RateLimit.Interval)
+		}
+		if service.RateLimit.Burst <= 0 {
+			return nil, errors.New("field RateLimit.Burst must be positive")
+		}
+		cfg.burst = service.RateLimit.Burst
+	}
+	return cfg, nil
+}
+
 func (service *Service) checkDBus() error {
 	dbusField := service.Monitor.DBus
 	if dbusField == nil {
@@ -104,6 +287,82 @@ func (service *Service) checkDBus() error {
 	if dbusField.Signal == "" {
 		return errors.New("field Monitor.DBus.Signal is empty")
 	}
+
+	for idx := range dbusField.Args {
+		// DBus 规范中 argN 的 N 最大为 63
+		if idx < 0 || idx > 63 {
+			return fmt.Errorf("field Monitor.DBus.Args has invalid index %d", idx)
+		}
+	}
+
+	if dbusField.Arg0Namespace != "" && !isValidNamespace(dbusField.Arg0Namespace) {
+		return errors.New("field Monitor.DBus.Arg0Namespace is invalid")
+	}
+	return nil
+}
+
+func isValidNamespace(namespace string) bool {
+	for _, elem := range strings.Split(namespace, ".") {
+		if elem == "" {
+			return false
+		}
+		for _, c := range elem {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+				c >= '0' && c <= '9' || c == '_' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (service *Service) checkTimer() error {
+	timerField := service.Monitor.Timer
+	if timerField == nil {
+		return errors.New("field Monitor.Timer is nil")
+	}
+
+	if timerField.Interval == "" && timerField.Cron == "" {
+		return errors.New("field Monitor.Timer.Interval and Monitor.Timer.Cron are both empty")
+	}
+	if timerField.Interval != "" && timerField.Cron != "" {
+		return errors.New("field Monitor.Timer.Interval and Monitor.Timer.Cron are both set")
+	}
+
+	_, err := service.getTimerSchedule()
+	if err != nil {
+		return fmt.Errorf("field Monitor.Timer is invalid: %v", err)
+	}
+	return nil
+}
+
+func (service *Service) checkFile() error {
+	fileField := service.Monitor.File
+	if fileField == nil {
+		return errors.New("field Monitor.File is nil")
+	}
+
+	if !filepath.IsAbs(fileField.Path) {
+		return errors.New("field Monitor.File.Path is not an absolute path")
+	}
+
+	for _, event := range fileField.Events {
+		if _, ok := fileEventOps[event]; !ok {
+			return fmt.Errorf("field Monitor.File.Events has invalid event %q", event)
+		}
+	}
+	return nil
+}
+
+func (service *Service) checkUdev() error {
+	udevField := service.Monitor.Udev
+	if udevField == nil {
+		return errors.New("field Monitor.Udev is nil")
+	}
+
+	if udevField.Subsystem == "" {
+		return errors.New("field Monitor.Udev.Subsystem is empty")
+	}
 	return nil
 }
 
@@ -126,6 +385,8 @@ func loadService(filename string) (*Service, error) {
 
 	service.filename = filename
 	service.basename = strings.TrimSuffix(filepath.Base(filename), serviceFileExt)
+	limiterCfg, _ := service.getLimiterConfig()
+	service.limiter = newServiceLimiter(service.String(), limiterCfg)
 	return &service, nil
 }
 
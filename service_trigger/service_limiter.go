@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitInterval = 10 * time.Second
+	defaultRateLimitBurst    = 20
+)
+
+type serviceLimiterConfig struct {
+	debounce time.Duration
+	interval time.Duration
+	burst    int
+}
+
+// serviceLimiter 对服务的执行做防抖和限流，避免频繁的信号启动大量进程
+type serviceLimiter struct {
+	name string
+	cfg  serviceLimiterConfig
+	now  func() time.Time
+
+	mu            sync.Mutex
+	execTimes     []time.Time // interval 内执行的时间
+	debounceTimer *time.Timer
+	debounceArgs  []interface{}
+	debounceGen   uint64 // 每次重置防抖定时器时加一，用于忽略已经被替换的定时器
+	dropped       int
+}
+
+func newServiceLimiter(name string, cfg *serviceLimiterConfig) *serviceLimiter {
+	return &serviceLimiter{
+		name: name,
+		cfg:  *cfg,
+		now:  time.Now,
+	}
+}
+
+// trigger 在满足防抖和限流的条件时调用 run，设置了防抖时 run 会在之后的 goroutine 中调用
+func (l *serviceLimiter) trigger(args []interface{}, run func(args []interface{})) {
+	if l.cfg.debounce <= 0 {
+		if l.allow() {
+			run(args)
+		}
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.debounceArgs = args
+	if l.debounceTimer != nil {
+		l.debounceTimer.Stop()
+	}
+	l.debounceGen++
+	gen := l.debounceGen
+	l.debounceTimer = time.AfterFunc(l.cfg.debounce, func() {
+		l.fireDebounce(gen, run)
+	})
+}
+
+// 防抖的定时器到期，Stop 不能阻止已经开始执行的回调，gen 不是最新的时说明定时器已经被替换，
+// 不能取走新的触发的参数
+func (l *serviceLimiter) fireDebounce(gen uint64, run func(args []interface{})) {
+	l.mu.Lock()
+	if gen != l.debounceGen {
+		l.mu.Unlock()
+		return
+	}
+	args := l.debounceArgs
+	l.debounceArgs = nil
+	l.debounceTimer = nil
+	l.mu.Unlock()
+
+	if l.allow() {
+		run(args)
+	}
+}
+
+// 在最近 interval 时间内执行的次数少于 burst 时允许执行
+func (l *serviceLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	i := 0
+	for ; i < len(l.execTimes); i++ {
+		if now.Sub(l.execTimes[i]) < l.cfg.interval {
+			break
+		}
+	}
+	l.execTimes = l.execTimes[i:]
+
+	if len(l.execTimes) >= l.cfg.burst {
+		l.dropped++
+		if l.dropped == 1 {
+			logger.Warningf("service %s rate limit exceeded, drop triggers in %v", l.name, l.cfg.interval)
+		}
+		return false
+	}
+	if l.dropped > 0 {
+		logger.Debugf("service %s: %d triggers dropped by rate limit", l.name, l.dropped)
+		l.dropped = 0
+	}
+	l.execTimes = append(l.execTimes, now)
+	return true
+}
@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+)
+
+var serviceStatesFile = filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/service-trigger.json")
+
+// ServiceStatus 是 ListServices 和 GetServiceStatus 返回的服务状态
+type ServiceStatus struct {
+	Name         string // 服务文件名去掉 .service.json 后缀
+	Filename     string
+	Type         string
+	Description  string
+	Valid        bool   // 为 false 时服务文件没有通过检查，Error 为原因
+	Error        string `json:",omitempty"`
+	Enabled      bool
+	LastFired    int64 // 最后一次执行的 unix 时间，单位秒，为 0 表示没有执行过
+	LastExitCode int   // 最后一次执行的退出码，程序无法启动时为 -1
+	FireCount    int
+	FailureCount int
+}
+
+type serviceRunStatus struct {
+	lastFired    time.Time
+	lastExitCode int
+	fireCount    int
+	failureCount int
+}
+
+type serviceStatesConfig struct {
+	DisabledServices []string
+}
+
+// serviceStates 记录服务的执行状态，以及被禁用的服务，禁用的服务会保存到文件中
+type serviceStates struct {
+	file string
+
+	mu       sync.Mutex
+	disabled map[string]struct{}
+	runs     map[string]*serviceRunStatus
+}
+
+func newServiceStates(file string) *serviceStates {
+	s := &serviceStates{
+		file:     file,
+		disabled: make(map[string]struct{}),
+		runs:     make(map[string]*serviceRunStatus),
+	}
+	err := s.load()
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load service states:", err)
+	}
+	return s
+}
+
+func (s *serviceStates) load() error {
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	var cfg serviceStatesConfig
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return err
+	}
+	for _, name := range cfg.DisabledServices {
+		s.disabled[name] = struct{}{}
+	}
+	return nil
+}
+
+// 调用者需要持有 s.mu
+func (s *serviceStates) save() error {
+	cfg := serviceStatesConfig{
+		DisabledServices: make([]string, 0, len(s.disabled)),
+	}
+	for name := range s.disabled {
+		cfg.DisabledServices = append(cfg.DisabledServices, name)
+	}
+	sort.Strings(cfg.DisabledServices)
+
+	data, err := json.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.file), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.file, data, 0644)
+}
+
+func (s *serviceStates) isEnabled(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.disabled[name]
+	return !ok
+}
+
+// setEnabled 修改服务的启用状态，返回状态是否改变
+func (s *serviceStates) setEnabled(name string, enabled bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, disabled := s.disabled[name]
+	if enabled != disabled {
+		return false, nil
+	}
+	if enabled {
+		delete(s.disabled, name)
+	} else {
+		s.disabled[name] = struct{}{}
+	}
+	return true, s.save()
+}
+
+// recordRun 记录一次执行的结果，exitCode 为 -1 表示程序无法启动
+func (s *serviceStates) recordRun(name string, fired time.Time, exitCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.runs[name]
+	if run == nil {
+		run = &serviceRunStatus{}
+		s.runs[name] = run
+	}
+	run.lastFired = fired
+	run.lastExitCode = exitCode
+	run.fireCount++
+	if exitCode != 0 {
+		run.failureCount++
+	}
+}
+
+func (s *serviceStates) fillStatus(status *ServiceStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, disabled := s.disabled[status.Name]
+	status.Enabled = !disabled
+	run := s.runs[status.Name]
+	if run == nil {
+		return
+	}
+	status.LastFired = run.lastFired.Unix()
+	status.LastExitCode = run.lastExitCode
+	status.FireCount = run.fireCount
+	status.FailureCount = run.failureCount
+}
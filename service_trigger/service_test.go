@@ -0,0 +1,521 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_check(t *testing.T) {
+	newService := func(monitor ServiceMonitor) *Service {
+		return &Service{
+			Monitor: monitor,
+			Name:    "test",
+			Exec:    []string{"true"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		monitor ServiceMonitor
+		wantErr bool
+	}{
+		{"unknown type", ServiceMonitor{Type: "Unknown"}, true},
+		{"timer nil", ServiceMonitor{Type: typeTimer}, true},
+		{"timer interval", ServiceMonitor{Type: typeTimer,
+			Timer: &ServiceMonitorTimer{Interval: "30m"}}, false},
+		{"timer interval too short", ServiceMonitor{Type: typeTimer,
+			Timer: &ServiceMonitorTimer{Interval: "100ms"}}, true},
+		{"timer cron", ServiceMonitor{Type: typeTimer,
+			Timer: &ServiceMonitorTimer{Cron: "0 9 * * 1-5"}}, false},
+		{"timer bad cron", ServiceMonitor{Type: typeTimer,
+			Timer: &ServiceMonitorTimer{Cron: "0 25 * * *"}}, true},
+		{"timer both", ServiceMonitor{Type: typeTimer,
+			Timer: &ServiceMonitorTimer{Interval: "1h", Cron: "0 * * * *"}}, true},
+		{"file", ServiceMonitor{Type: typeFile,
+			File: &ServiceMonitorFile{Path: "/etc/hostname", Events: []string{"Write"}}}, false},
+		{"file relative path", ServiceMonitor{Type: typeFile,
+			File: &ServiceMonitorFile{Path: "etc/hostname"}}, true},
+		{"file bad event", ServiceMonitor{Type: typeFile,
+			File: &ServiceMonitorFile{Path: "/etc/hostname", Events: []string{"Open"}}}, true},
+		{"udev", ServiceMonitor{Type: typeUdev,
+			Udev: &ServiceMonitorUdev{Subsystem: "usb", Action: "add"}}, false},
+		{"udev no subsystem", ServiceMonitor{Type: typeUdev,
+			Udev: &ServiceMonitorUdev{Action: "add"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newService(tt.monitor).check()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckExecWholeArgs(t *testing.T) {
+	check := func(exec []string) error {
+		templates, err := parseExecTemplates(exec)
+		require.NoError(t, err)
+		return checkExecWholeArgs(exec, templates)
+	}
+	assert.NoError(t, check([]string{"sh", "-c", `echo "$1"`, "", "%{arg0}", "{{.Body[1]}}"}))
+	for _, exec := range [][]string{
+		{"touch", "/tmp/{{.Body[0]}}"},
+		{"echo", "%{arg0}%{arg1}"},
+	} {
+		assert.Error(t, check(exec), exec)
+	}
+}
+
+func TestParseCronSchedule(t *testing.T) {
+	loc := time.UTC
+	// 2022-06-01 是周三
+	begin := time.Date(2022, 6, 1, 10, 30, 15, 0, loc)
+
+	tests := []struct {
+		cron string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2022, 6, 1, 10, 31, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2022, 6, 1, 10, 45, 0, 0, loc)},
+		{"0 9 * * *", time.Date(2022, 6, 2, 9, 0, 0, 0, loc)},
+		{"0 9 * * 1-5", time.Date(2022, 6, 2, 9, 0, 0, 0, loc)},
+		{"0 9 * * 0", time.Date(2022, 6, 5, 9, 0, 0, 0, loc)},
+		{"0 9 * * 7", time.Date(2022, 6, 5, 9, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2022, 7, 1, 0, 0, 0, 0, loc)},
+		{"0 0 1,15 * *", time.Date(2022, 6, 15, 0, 0, 0, 0, loc)},
+		{"0 0 1 1 *", time.Date(2023, 1, 1, 0, 0, 0, 0, loc)},
+		{"30 8-18/2 * * *", time.Date(2022, 6, 1, 12, 30, 0, 0, loc)},
+		// 日和周都有限制时满足其中一个即可
+		{"0 0 10 * 5", time.Date(2022, 6, 3, 0, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, loc)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cron, func(t *testing.T) {
+			s, err := parseCronSchedule(tt.cron)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.next(begin))
+		})
+	}
+
+	for _, cron := range []string{"", "* * * *", "60 * * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCronSchedule(cron)
+		assert.Error(t, err, cron)
+	}
+}
+
+func TestCronSchedule_halfHourZone(t *testing.T) {
+	// 偏移为 +05:30 和 +05:45 的时区，整点不是 UTC 的整点
+	for _, loc := range []*time.Location{time.FixedZone("IST", 5*3600+30*60),
+		time.FixedZone("NPT", 5*3600+45*60)} {
+		s, err := parseCronSchedule("0 9 * * *")
+		require.NoError(t, err)
+		begin := time.Date(2022, 6, 1, 7, 10, 0, 0, loc)
+		assert.Equal(t, time.Date(2022, 6, 1, 9, 0, 0, 0, loc), s.next(begin), loc.String())
+
+		s, err = parseCronSchedule("15 */2 * * *")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2022, 6, 1, 8, 15, 0, 0, loc), s.next(begin), loc.String())
+	}
+}
+
+func TestParseIntervalSchedule(t *testing.T) {
+	s, err := parseIntervalSchedule("90s")
+	require.NoError(t, err)
+	begin := time.Date(2022, 6, 1, 10, 30, 0, 0, time.UTC)
+	assert.Equal(t, begin.Add(90*time.Second), s.next(begin))
+
+	_, err = parseIntervalSchedule("0s")
+	assert.Error(t, err)
+	_, err = parseIntervalSchedule("abc")
+	assert.Error(t, err)
+}
+
+type fakeSchedule time.Duration
+
+func (s fakeSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func TestTimerMonitor(t *testing.T) {
+	triggered := make(chan []interface{}, 1)
+	service := &Service{
+		Name: "timer",
+		execFn: func(args []interface{}) {
+			select {
+			case triggered <- args:
+			default:
+			}
+		},
+	}
+
+	tm := newTimerMonitor()
+	tm.entries = append(tm.entries, &timerEntry{
+		service:  service,
+		schedule: fakeSchedule(10 * time.Millisecond),
+	})
+	tm.start(&Manager{})
+	defer tm.stop()
+
+	select {
+	case args := <-triggered:
+		require.Len(t, args, 1)
+		_, err := time.Parse(time.RFC3339, args[0].(string))
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("timer service not triggered")
+	}
+}
+
+func TestFileWatchRule(t *testing.T) {
+	service := &Service{
+		Monitor: ServiceMonitor{
+			Type: typeFile,
+			File: &ServiceMonitorFile{Path: "/tmp/test/a.conf/", Events: []string{"Write", "Create"}},
+		},
+	}
+	rule := service.getFileWatchRule()
+	assert.Equal(t, "/tmp/test/a.conf", rule.path)
+	assert.Equal(t, "/tmp/test", rule.watchPath())
+
+	assert.True(t, rule.match(fsnotify.Event{Name: "/tmp/test/a.conf", Op: fsnotify.Write}))
+	assert.True(t, rule.match(fsnotify.Event{Name: "/tmp/test/a.conf", Op: fsnotify.Create | fsnotify.Chmod}))
+	assert.False(t, rule.match(fsnotify.Event{Name: "/tmp/test/a.conf", Op: fsnotify.Remove}))
+	assert.False(t, rule.match(fsnotify.Event{Name: "/tmp/test/b.conf", Op: fsnotify.Write}))
+
+	service.Monitor.File.Events = nil
+	rule = service.getFileWatchRule()
+	assert.True(t, rule.match(fsnotify.Event{Name: "/tmp/test/a.conf", Op: fsnotify.Remove}))
+
+	assert.Equal(t, "Create", getFileEventName(fsnotify.Create|fsnotify.Chmod))
+	assert.Equal(t, "Rename", getFileEventName(fsnotify.Rename))
+}
+
+type fakeUdevSource struct {
+	subsystems []string
+	handler    func(ev *udevEvent)
+}
+
+func (s *fakeUdevSource) start(subsystems []string, handler func(ev *udevEvent)) error {
+	s.subsystems = subsystems
+	s.handler = handler
+	return nil
+}
+
+func (s *fakeUdevSource) stop() {}
+
+func newFakeUdevEvent(action, subsystem string, attrs, props map[string]string) *udevEvent {
+	return &udevEvent{
+		Action:      action,
+		Subsystem:   subsystem,
+		SysfsPath:   "/sys/devices/test",
+		getAttr:     func(name string) string { return attrs[name] },
+		getProperty: func(name string) string { return props[name] },
+	}
+}
+
+func TestUdevMonitor(t *testing.T) {
+	triggered := make(chan []interface{}, 10)
+	newService := func(udev *ServiceMonitorUdev) *Service {
+		return &Service{
+			Monitor: ServiceMonitor{Type: typeUdev, Udev: udev},
+			execFn: func(args []interface{}) {
+				triggered <- args
+			},
+		}
+	}
+
+	source := &fakeUdevSource{}
+	um := newUdevMonitor()
+	um.source = source
+	um.appendService(newService(&ServiceMonitorUdev{
+		Subsystem:  "usb",
+		Action:     "add",
+		Attributes: map[string]string{"idVendor": "1234"},
+	}))
+	um.appendService(newService(&ServiceMonitorUdev{
+		Subsystem:  "usb",
+		Properties: map[string]string{"ID_MODEL": "test"},
+	}))
+	um.appendService(newService(&ServiceMonitorUdev{
+		Subsystem: "power_supply",
+	}))
+	require.NoError(t, um.start(&Manager{}))
+	defer um.stop()
+	assert.Equal(t, []string{"usb", "power_supply"}, source.subsystems)
+
+	source.handler(newFakeUdevEvent("add", "usb", map[string]string{"idVendor": "1234"}, nil))
+	select {
+	case args := <-triggered:
+		assert.Equal(t, []interface{}{"add", "/sys/devices/test", "usb"}, args)
+	case <-time.After(time.Second):
+		t.Fatal("udev service not triggered")
+	}
+
+	// action 不匹配，属性不匹配
+	source.handler(newFakeUdevEvent("remove", "usb", map[string]string{"idVendor": "1234"}, nil))
+	source.handler(newFakeUdevEvent("add", "usb", map[string]string{"idVendor": "5678"}, nil))
+	select {
+	case args := <-triggered:
+		t.Fatalf("unexpected trigger %v", args)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	source.handler(newFakeUdevEvent("change", "usb", nil, map[string]string{"ID_MODEL": "test"}))
+	select {
+	case args := <-triggered:
+		assert.Equal(t, "change", args[0])
+	case <-time.After(time.Second):
+		t.Fatal("udev service not triggered")
+	}
+}
+
+func TestService_getDBusMatchRule(t *testing.T) {
+	service := &Service{
+		Monitor: ServiceMonitor{
+			Type: typeDBus,
+			DBus: &ServiceMonitorDBus{
+				BusType:       busTypeSystemStr,
+				Sender:        "org.freedesktop.DBus",
+				Interface:     "org.freedesktop.DBus",
+				Signal:        "NameOwnerChanged",
+				Args:          map[int]string{2: "", 0: "it's"},
+				Arg0Namespace: "com.deepin",
+			},
+		},
+		Name: "test",
+		Exec: []string{"true"},
+	}
+	assert.NoError(t, service.check())
+	assert.Equal(t, "type='signal',sender='org.freedesktop.DBus',interface='org.freedesktop.DBus'"+
+		`,member='NameOwnerChanged',arg0='it'\''s',arg2='',arg0namespace='com.deepin'`,
+		service.getDBusMatchRule())
+
+	service.Monitor.DBus.Args = map[int]string{64: "a"}
+	assert.Error(t, service.check())
+	service.Monitor.DBus.Args = nil
+	service.Monitor.DBus.Arg0Namespace = "com..deepin"
+	assert.Error(t, service.check())
+
+	// DBus 信号的参数也不能决定要执行的程序
+	service.Monitor.DBus.Arg0Namespace = ""
+	service.Exec = []string{"{{.Body[0]}}"}
+	assert.Error(t, service.check())
+	service.Exec = []string{"/usr/bin/%{arg0}", "-v"}
+	assert.Error(t, service.check())
+}
+
+func TestServiceMonitorDBus_matchArgs(t *testing.T) {
+	dbusField := &ServiceMonitorDBus{
+		Args: map[int]string{1: "b"},
+	}
+	assert.True(t, dbusField.matchArgs([]interface{}{"a", "b"}))
+	assert.False(t, dbusField.matchArgs([]interface{}{"a", "c"}))
+	assert.False(t, dbusField.matchArgs([]interface{}{"a"}))
+	assert.False(t, dbusField.matchArgs([]interface{}{"a", uint32(1)}))
+
+	dbusField = &ServiceMonitorDBus{
+		Arg0Namespace: "com.deepin",
+	}
+	assert.True(t, dbusField.matchArgs([]interface{}{"com.deepin"}))
+	assert.True(t, dbusField.matchArgs([]interface{}{"com.deepin.dde.Dock"}))
+	assert.False(t, dbusField.matchArgs([]interface{}{"com.deepinx"}))
+	assert.False(t, dbusField.matchArgs(nil))
+}
+
+func TestExecTemplate(t *testing.T) {
+	exec := []string{"/usr/bin/notify", "{{.Body[0]}}", "id={{ .Body[1] }}/%{arg0}", "{{.Body[2]}}", "100%{a}"}
+	templates, err := parseExecTemplates(exec)
+	require.NoError(t, err)
+	args := []interface{}{"a b;rm -rf ~", uint32(7), dbus.MakeVariant(dbus.ObjectPath("/a"))}
+
+	var result []string
+	for _, tpl := range templates {
+		arg, err := tpl.expand(args)
+		require.NoError(t, err)
+		result = append(result, arg)
+	}
+	assert.Equal(t, []string{"/usr/bin/notify", "a b;rm -rf ~", "id=7/a b;rm -rf ~", "/a", "100%{a}"}, result)
+
+	// 值中的占位符不会再被展开
+	arg, err := templates[1].expand([]interface{}{"{{.Body[1]}}%{arg1}"})
+	assert.NoError(t, err)
+	assert.Equal(t, "{{.Body[1]}}%{arg1}", arg)
+	// 参数不够或者类型不支持，%{argN} 与 {{.Body[N]}} 相同
+	_, err = templates[2].expand([]interface{}{"a"})
+	assert.Error(t, err)
+	_, err = templates[1].expand([]interface{}{[]string{"a"}})
+	assert.Error(t, err)
+	_, err = templates[1].expand([]interface{}{"a\x00b"})
+	assert.Error(t, err)
+
+	for _, str := range []string{"{{.Body}}", "{{.Sender}}", "{{.Body[0]", "{{ printf }}"} {
+		_, err = parseExecTemplate(str)
+		assert.Error(t, err, str)
+	}
+}
+
+func TestExecTemplate_shell(t *testing.T) {
+	// 占位符只能作为脚本之后的位置参数
+	templates, err := parseExecTemplates([]string{"sh", "-c", `echo "$1"`, "", "{{.Body[0]}}"})
+	require.NoError(t, err)
+	arg, err := templates[4].expand([]interface{}{"it's $(id)"})
+	require.NoError(t, err)
+	assert.Equal(t, "it's $(id)", arg)
+
+	for _, exec := range [][]string{
+		{"sh", "-c", "echo {{.Body[0]}}"},
+		{"sh", "-c", "echo '%{arg0}'"},
+		{"/bin/sh", "-ec", "echo %{arg0}"},
+		{"bash", "-lc", "echo %{arg0}"},
+		{"bash", "-o", "pipefail", "-c", "echo %{arg0}"},
+		{"sh", "-c", "--", "echo %{arg0}"},
+		{"env", "sh", "-c", "echo %{arg0}"},
+		{"/usr/bin/env", "LANG=C", "bash", "-c", "echo %{arg0}"},
+		{"sh", "-c", "%{arg0}"},
+		{"%{arg0}"},
+		{"/usr/lib/{{ .Body[0] }}", "--check"},
+	} {
+		_, err = parseExecTemplates(exec)
+		assert.Error(t, err, exec)
+	}
+
+	assert.Equal(t, -1, shellScriptIndex([]string{"sh", "/usr/lib/a.sh", "%{arg0}"}))
+	assert.Equal(t, -1, shellScriptIndex([]string{"/usr/bin/notify", "-c", "%{arg0}"}))
+	assert.Equal(t, 5, shellScriptIndex([]string{"env", "-u", "A", "bash", "-c", "echo"}))
+}
+
+func TestServiceLimiter_rateLimit(t *testing.T) {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newServiceLimiter("test", &serviceLimiterConfig{
+		interval: 10 * time.Second,
+		burst:    3,
+	})
+	limiter.now = func() time.Time { return now }
+
+	var count int
+	run := func(args []interface{}) { count++ }
+	for i := 0; i < 5; i++ {
+		limiter.trigger(nil, run)
+	}
+	assert.Equal(t, 3, count)
+
+	now = now.Add(5 * time.Second)
+	limiter.trigger(nil, run)
+	assert.Equal(t, 3, count)
+
+	now = now.Add(5 * time.Second)
+	limiter.trigger(nil, run)
+	limiter.trigger(nil, run)
+	assert.Equal(t, 5, count)
+}
+
+func TestServiceLimiter_debounce(t *testing.T) {
+	limiter := newServiceLimiter("test", &serviceLimiterConfig{
+		debounce: 50 * time.Millisecond,
+		interval: defaultRateLimitInterval,
+		burst:    defaultRateLimitBurst,
+	})
+
+	ch := make(chan []interface{}, 10)
+	run := func(args []interface{}) { ch <- args }
+	for i := 0; i < 5; i++ {
+		limiter.trigger([]interface{}{i}, run)
+	}
+
+	select {
+	case args := <-ch:
+		assert.Equal(t, []interface{}{4}, args)
+	case <-time.After(time.Second):
+		t.Fatal("service not triggered")
+	}
+	select {
+	case args := <-ch:
+		t.Fatalf("unexpected trigger %v", args)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServiceLimiter_staleDebounceTimer(t *testing.T) {
+	limiter := newServiceLimiter("test", &serviceLimiterConfig{
+		debounce: time.Hour,
+		interval: defaultRateLimitInterval,
+		burst:    defaultRateLimitBurst,
+	})
+
+	ch := make(chan []interface{}, 10)
+	run := func(args []interface{}) { ch <- args }
+	limiter.trigger([]interface{}{0}, run)
+	limiter.mu.Lock()
+	staleGen := limiter.debounceGen
+	limiter.mu.Unlock()
+	limiter.trigger([]interface{}{1}, run)
+
+	// 旧的定时器的回调在 Stop 之前已经开始执行，它不能取走新的参数
+	limiter.fireDebounce(staleGen, run)
+	select {
+	case args := <-ch:
+		t.Fatalf("unexpected trigger %v", args)
+	default:
+	}
+
+	limiter.mu.Lock()
+	gen := limiter.debounceGen
+	limiter.mu.Unlock()
+	limiter.fireDebounce(gen, run)
+	select {
+	case args := <-ch:
+		assert.Equal(t, []interface{}{1}, args)
+	default:
+		t.Fatal("service not triggered")
+	}
+}
+
+func TestServiceStates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "service-trigger.json")
+	states := newServiceStates(file)
+	assert.True(t, states.isEnabled("a"))
+
+	changed, err := states.setEnabled("a", false)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = states.setEnabled("a", false)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, states.isEnabled("a"))
+
+	// 禁用状态保存在文件中
+	states = newServiceStates(file)
+	assert.False(t, states.isEnabled("a"))
+	_, err = states.setEnabled("a", true)
+	require.NoError(t, err)
+	assert.True(t, newServiceStates(file).isEnabled("a"))
+
+	fired := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	states.recordRun("a", fired, 0)
+	states.recordRun("a", fired.Add(time.Minute), 2)
+	status := &ServiceStatus{Name: "a"}
+	states.fillStatus(status)
+	assert.Equal(t, &ServiceStatus{
+		Name:         "a",
+		Enabled:      true,
+		LastFired:    fired.Add(time.Minute).Unix(),
+		LastExitCode: 2,
+		FireCount:    2,
+		FailureCount: 1,
+	}, status)
+}
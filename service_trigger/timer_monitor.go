@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const minTimerInterval = time.Second
+
+type schedule interface {
+	// next 返回 t 之后下一次触发的时间
+	next(t time.Time) time.Time
+}
+
+type intervalSchedule time.Duration
+
+func parseIntervalSchedule(str string) (schedule, error) {
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return nil, err
+	}
+	if d < minTimerInterval {
+		return nil, fmt.Errorf("interval %v is less than %v", d, minTimerInterval)
+	}
+	return intervalSchedule(d), nil
+}
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule 是 5 个字段的 cron 规则：分 时 日 月 周，
+// 每个字段支持 *、数字、范围 a-b、步长 */n 和 a-b/n，以及逗号分隔的列表。
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // 每一位表示对应的值是否匹配
+	domStar, dowStar              bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 和 7 都表示周日
+}
+
+func parseCronSchedule(str string) (schedule, error) {
+	fields := strings.Fields(str)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron expression %q", len(cronFields), str)
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		bits[i], err = parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(str string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(str, ",") {
+		rangeStr := part
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangeStr = part[:idx]
+			var err error
+			step, err = strconv.Atoi(part[idx+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", field.name, part)
+			}
+		}
+
+		begin, end := field.min, field.max
+		if rangeStr != "*" {
+			var err error
+			if idx := strings.Index(rangeStr, "-"); idx >= 0 {
+				begin, err = strconv.Atoi(rangeStr[:idx])
+				if err == nil {
+					end, err = strconv.Atoi(rangeStr[idx+1:])
+				}
+			} else {
+				begin, err = strconv.Atoi(rangeStr)
+				end = begin
+				if step != 1 {
+					// a/n 表示从 a 开始到最大值
+					end = field.max
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s field %q", field.name, part)
+			}
+		}
+		if begin < field.min || end > field.max || begin > end {
+			return 0, fmt.Errorf("%s field %q out of range [%d, %d]", field.name, part, field.min, field.max)
+		}
+
+		for i := begin; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func cronBitSet(bits uint64, value int) bool {
+	return bits&(1<<uint(value)) != 0
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := cronBitSet(s.dom, t.Day())
+	dowMatch := cronBitSet(s.dow, int(t.Weekday()))
+	// 与 cron 的规则相同，日和周都有限制时满足其中一个即可
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// 最多查找 5 年，避免 2 月 30 日这样的规则导致死循环
+	yearLimit := t.Year() + 5
+	for t.Year() <= yearLimit {
+		if !cronBitSet(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cronBitSet(s.hour, t.Hour()) {
+			// 时区的偏移不一定是整小时，不能使用 Truncate
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cronBitSet(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+type timerEntry struct {
+	service  *Service
+	schedule schedule
+}
+
+// TimerMonitor 按照 Timer 类型的规则定时执行服务
+type TimerMonitor struct {
+	entries []*timerEntry
+	now     func() time.Time
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newTimerMonitor() *TimerMonitor {
+	return &TimerMonitor{
+		now: time.Now,
+	}
+}
+
+func (tm *TimerMonitor) appendService(service *Service) {
+	s, err := service.getTimerSchedule()
+	if err != nil {
+		logger.Warningf("service %v: %v", service, err)
+		return
+	}
+	tm.entries = append(tm.entries, &timerEntry{
+		service:  service,
+		schedule: s,
+	})
+}
+
+func (tm *TimerMonitor) start(m *Manager) {
+	tm.quit = make(chan struct{})
+	for _, entry := range tm.entries {
+		tm.wg.Add(1)
+		go tm.loop(m, entry)
+	}
+}
+
+func (tm *TimerMonitor) loop(m *Manager, entry *timerEntry) {
+	defer tm.wg.Done()
+	for {
+		now := tm.now()
+		next := entry.schedule.next(now)
+		if next.IsZero() {
+			logger.Warningf("service %v will never be triggered", entry.service)
+			return
+		}
+		logger.Debugf("service %v will be triggered at %v", entry.service, next)
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+			logger.Debug("exec service", entry.service)
+			go m.execService(entry.service, []interface{}{next.Format(time.RFC3339)})
+		case <-tm.quit:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (tm *TimerMonitor) stop() {
+	if tm.quit == nil {
+		return
+	}
+	close(tm.quit)
+	tm.wg.Wait()
+	tm.quit = nil
+}
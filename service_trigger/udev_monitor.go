@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package service_trigger
+
+import (
+	"errors"
+
+	gudev "github.com/linuxdeepin/go-gir/gudev-1.0"
+)
+
+type udevEvent struct {
+	Action      string
+	Subsystem   string
+	SysfsPath   string
+	getAttr     func(name string) string
+	getProperty func(name string) string
+}
+
+type udevMatchRule struct {
+	subsystem  string
+	action     string
+	attributes map[string]string
+	properties map[string]string
+}
+
+func (rule *udevMatchRule) match(ev *udevEvent) bool {
+	if rule.subsystem != ev.Subsystem {
+		return false
+	}
+	if rule.action != "" && rule.action != ev.Action {
+		return false
+	}
+	for name, value := range rule.attributes {
+		if ev.getAttr(name) != value {
+			return false
+		}
+	}
+	for name, value := range rule.properties {
+		if ev.getProperty(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+var errGudevClientNil = errors.New("gudev client is nil")
+
+// udevSource 提供 uevent，测试时可以替换
+type udevSource interface {
+	start(subsystems []string, handler func(ev *udevEvent)) error
+	stop()
+}
+
+type gudevSource struct {
+	client *gudev.Client
+}
+
+func (s *gudevSource) start(subsystems []string, handler func(ev *udevEvent)) error {
+	s.client = gudev.NewClient(subsystems)
+	if s.client == nil {
+		return errGudevClientNil
+	}
+	s.client.Connect("uevent", func(client *gudev.Client, action string, device *gudev.Device) {
+		defer device.Unref()
+		handler(&udevEvent{
+			Action:      action,
+			Subsystem:   device.GetSubsystem(),
+			SysfsPath:   device.GetSysfsPath(),
+			getAttr:     device.GetSysfsAttr,
+			getProperty: device.GetProperty,
+		})
+	})
+	return nil
+}
+
+func (s *gudevSource) stop() {
+	if s.client != nil {
+		s.client.Unref()
+		s.client = nil
+	}
+}
+
+type udevEntry struct {
+	service *Service
+	rule    *udevMatchRule
+}
+
+// UdevMonitor 监听 Udev 类型规则中 subsystem 的 uevent，设备匹配时执行服务
+type UdevMonitor struct {
+	entries []*udevEntry
+	source  udevSource
+}
+
+func newUdevMonitor() *UdevMonitor {
+	return &UdevMonitor{
+		source: &gudevSource{},
+	}
+}
+
+func (um *UdevMonitor) appendService(service *Service) {
+	um.entries = append(um.entries, &udevEntry{
+		service: service,
+		rule:    service.getUdevMatchRule(),
+	})
+}
+
+func (um *UdevMonitor) getSubsystems() []string {
+	var subsystems []string
+	seen := make(map[string]struct{})
+	for _, entry := range um.entries {
+		if _, ok := seen[entry.rule.subsystem]; ok {
+			continue
+		}
+		seen[entry.rule.subsystem] = struct{}{}
+		subsystems = append(subsystems, entry.rule.subsystem)
+	}
+	return subsystems
+}
+
+func (um *UdevMonitor) start(m *Manager) error {
+	if len(um.entries) == 0 {
+		return nil
+	}
+	return um.source.start(um.getSubsystems(), func(ev *udevEvent) {
+		um.handleEvent(m, ev)
+	})
+}
+
+func (um *UdevMonitor) handleEvent(m *Manager, ev *udevEvent) {
+	logger.Debugf("uevent %s %s", ev.Action, ev.SysfsPath)
+	for _, entry := range um.entries {
+		if !entry.rule.match(ev) {
+			continue
+		}
+		logger.Debug("exec service", entry.service)
+		go m.execService(entry.service, []interface{}{ev.Action, ev.SysfsPath, ev.Subsystem})
+	}
+}
+
+func (um *UdevMonitor) stop() {
+	um.source.stop()
+}
@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+const cgroupV2Root = "/sys/fs/cgroup"
+
+// 为规则创建的 slice 和 scope 的名称前缀
+const ruleUnitPrefix = "ddescheduler_"
+
+// 移动进程失败后重试的间隔，连续失败时加倍，直到最大值
+const (
+	moveProcessRetryMinDelay = 10 * time.Second
+	moveProcessRetryMaxDelay = 10 * time.Minute
+)
+
+// 用户会话中的进程，比如 /user.slice/user-1000.slice/session-2.scope，
+// 由 user@UID.service 管理的进程属于用户的 systemd，不处理
+var sessionScopeRegexp = regexp.MustCompile(`^/user\.slice/(user-[0-9]+)\.slice/session-[^/]+\.scope$`)
+
+// 系统服务中的进程，包括服务自己创建的子 cgroup 中的，比如 /system.slice/system-getty.slice/getty@tty1.service
+var systemServiceRegexp = regexp.MustCompile(`^/system\.slice/(?:[^/]+\.slice/)*([^/]+\.service)(?:/|$)`)
+
+type systemdProperty struct {
+	Name  string
+	Value dbus.Variant
+}
+
+type systemdAuxUnit struct {
+	Name       string
+	Properties []systemdProperty
+}
+
+// systemdManager 是用到的 org.freedesktop.systemd1.Manager 的方法
+type systemdManager interface {
+	startTransientUnit(name, mode string, properties []systemdProperty) error
+	setUnitProperties(name string, runtime bool, properties []systemdProperty) error
+}
+
+type systemdObject struct {
+	obj dbus.BusObject
+}
+
+func newSystemdObject(conn *dbus.Conn) systemdObject {
+	return systemdObject{
+		obj: conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1"),
+	}
+}
+
+func (s systemdObject) startTransientUnit(name, mode string, properties []systemdProperty) error {
+	var jobPath dbus.ObjectPath
+	return s.obj.Call("org.freedesktop.systemd1.Manager.StartTransientUnit", 0,
+		name, mode, properties, []systemdAuxUnit{}).Store(&jobPath)
+}
+
+func (s systemdObject) setUnitProperties(name string, runtime bool, properties []systemdProperty) error {
+	return s.obj.Call("org.freedesktop.systemd1.Manager.SetUnitProperties", 0,
+		name, runtime, properties).Err
+}
+
+// 移动进程失败的记录，在 retryAt 之前不再重试
+type moveFailure struct {
+	count   int
+	retryAt time.Time
+}
+
+// cgroupManager 通过 systemd 设置规则的 cgroup 属性，不直接修改 cgroup 文件系统：
+// 匹配的进程放到规则的 slice 下新建的 scope 中，只影响这个进程，不影响同一个服务或者会话中的其他进程。
+type cgroupManager struct {
+	procDir string
+	systemd systemdManager
+	now     func() time.Time
+
+	mu         sync.Mutex
+	configured map[string]bool             // 已经设置过属性的 slice
+	slicePids  map[string]map[int]struct{} // slice => 移动到其中的进程
+	failures   map[int]*moveFailure        // 移动失败的进程
+}
+
+func newCgroupManager(procDir string, systemd systemdManager) *cgroupManager {
+	return &cgroupManager{
+		procDir:    procDir,
+		systemd:    systemd,
+		now:        time.Now,
+		configured: make(map[string]bool),
+		slicePids:  make(map[string]map[int]struct{}),
+		failures:   make(map[int]*moveFailure),
+	}
+}
+
+// 系统是否使用 cgroup v2（unified 模式）
+func isCgroupV2(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	return err == nil
+}
+
+// 获取进程在 cgroup v2 中的路径，比如 /user.slice/user-1000.slice/session-2.scope
+func (cm *cgroupManager) getProcessCgroup(pid int) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(cm.procDir, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 entry for process %d", pid)
+}
+
+// 获取规则在 parentSlice 下的 slice 名称，比如 user-1000-ddescheduler_foo.slice、system-ddescheduler_foo.slice。
+// slice 名称中的 - 表示层级，规则名称中的 - 需要转义。
+func getRuleSlice(parentSlice, ruleName string) string {
+	return parentSlice + "-" + ruleUnitPrefix + strings.Replace(ruleName, "-", `\x2d`, -1) + ".slice"
+}
+
+func getRuleScope(ruleName string, pid int) string {
+	return fmt.Sprintf("%s%s-%d.scope", ruleUnitPrefix, ruleName, pid)
+}
+
+// 转换 memoryHigh 为字节数，max 表示不限制
+func parseMemoryHigh(str string) (uint64, error) {
+	if str == "max" {
+		return math.MaxUint64, nil
+	}
+	if str == "" {
+		return 0, errors.New("empty memoryHigh")
+	}
+	num := str
+	var shift uint
+	switch str[len(str)-1] {
+	case 'K':
+		shift = 10
+	case 'M':
+		shift = 20
+	case 'G':
+		shift = 30
+	case 'T':
+		shift = 40
+	}
+	if shift != 0 {
+		num = str[:len(str)-1]
+	}
+	value, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("memoryHigh %s out of range", str)
+	}
+	return value << shift, nil
+}
+
+func getRuleUnitProperties(rule *processRule) ([]systemdProperty, error) {
+	var properties []systemdProperty
+	if rule.CPUWeight != 0 {
+		properties = append(properties, systemdProperty{"CPUWeight", dbus.MakeVariant(rule.CPUWeight)})
+	}
+	if rule.IOWeight != 0 {
+		properties = append(properties, systemdProperty{"IOWeight", dbus.MakeVariant(rule.IOWeight)})
+	}
+	if rule.MemoryHigh != "" {
+		memoryHigh, err := parseMemoryHigh(rule.MemoryHigh)
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, systemdProperty{"MemoryHigh", dbus.MakeVariant(memoryHigh)})
+	}
+	return properties, nil
+}
+
+// 设置 unit 的属性，只在运行时生效，每个 unit 只设置一次
+func (cm *cgroupManager) setUnitProperties(unit string, rule *processRule) error {
+	if cm.configured[unit] {
+		return nil
+	}
+	properties, err := getRuleUnitProperties(rule)
+	if err != nil {
+		return err
+	}
+	err = cm.systemd.setUnitProperties(unit, true, properties)
+	if err != nil {
+		return err
+	}
+	cm.configured[unit] = true
+	return nil
+}
+
+// 获取进程所在 cgroup 对应的父 slice，系统服务为 system，用户会话为 user-UID，其他的不处理
+func getParentSlice(cgroup string) string {
+	if systemServiceRegexp.MatchString(cgroup) {
+		return "system"
+	}
+	if match := sessionScopeRegexp.FindStringSubmatch(cgroup); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// applyRule 让进程使用规则的设置，系统服务和用户会话中的进程通过 systemd 移动到规则的 slice 下新建的 scope 中，
+// 其他的进程（比如 init.scope 中的、已经在规则的 slice 中的）不处理。
+// 移动失败后会等待一段时间再重试，等待期间直接返回 nil。
+func (cm *cgroupManager) applyRule(pid int, cgroup string, rule *processRule) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	parentSlice := getParentSlice(cgroup)
+	if parentSlice == "" {
+		return nil
+	}
+	now := cm.now()
+	failure := cm.failures[pid]
+	if failure != nil && now.Before(failure.retryAt) {
+		return nil
+	}
+
+	slice := getRuleSlice(parentSlice, rule.Name)
+	scope := getRuleScope(rule.Name, pid)
+	logger.Debugf("move process %d from %s to %s/%s", pid, cgroup, slice, scope)
+	err := cm.systemd.startTransientUnit(scope, "fail", []systemdProperty{
+		{"Description", dbus.MakeVariant("dde scheduler rule " + rule.Name)},
+		{"Slice", dbus.MakeVariant(slice)},
+		{"PIDs", dbus.MakeVariant([]uint32{uint32(pid)})},
+	})
+	if err != nil {
+		if failure == nil {
+			failure = &moveFailure{}
+			cm.failures[pid] = failure
+		}
+		delay := moveProcessRetryMinDelay << uint(failure.count)
+		if delay > moveProcessRetryMaxDelay || delay <= 0 {
+			delay = moveProcessRetryMaxDelay
+		}
+		failure.count++
+		failure.retryAt = now.Add(delay)
+		return err
+	}
+	delete(cm.failures, pid)
+
+	pids := cm.slicePids[slice]
+	if pids == nil {
+		pids = make(map[int]struct{})
+		cm.slicePids[slice] = pids
+	}
+	pids[pid] = struct{}{}
+	// slice 在 scope 启动时才会加载
+	return cm.setUnitProperties(slice, rule)
+}
+
+// prune 清理已经退出的进程的记录。slice 中的进程都退出后 systemd 会回收 slice，设置的属性也随之失效，
+// 所以之后再有进程移动到这个 slice 时需要重新设置属性。
+func (cm *cgroupManager) prune() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for slice, pids := range cm.slicePids {
+		for pid := range pids {
+			cgroup, err := cm.getProcessCgroup(pid)
+			if err != nil || !strings.Contains(cgroup, "/"+slice+"/") {
+				delete(pids, pid)
+			}
+		}
+		if len(pids) == 0 {
+			delete(cm.slicePids, slice)
+			delete(cm.configured, slice)
+		}
+	}
+
+	for pid := range cm.failures {
+		_, err := os.Stat(filepath.Join(cm.procDir, strconv.Itoa(pid)))
+		if err != nil {
+			delete(cm.failures, pid)
+		}
+	}
+}
@@ -6,32 +6,177 @@ package scheduler
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"sort"
 )
 
 type config struct {
 	filename           string
 	Processes          map[string]*priorityCfg `json:"processes"`
+	Rules              []*processRule          `json:"rules"`
 	Enabled            bool                    `json:"enabled"`
 	ProcMonitorEnabled bool                    `json:"procMonitorEnabled"`
 }
 
 type priorityCfg struct {
-	CPU int `json:"cpu"`
+	CPU *int `json:"cpu"` // nice 值，为空时不修改
+
+	// 以下设置只在 cgroup v2 下生效，通过 systemd 设置：系统服务和用户会话中匹配的进程
+	// 会被移动到为规则创建的 slice 中，不影响同一个服务中的其他进程
+	CPUWeight  uint64 `json:"cpuWeight"`  // cpu.weight，范围 1 ~ 10000，为 0 时不设置
+	IOWeight   uint64 `json:"ioWeight"`   // io.weight，范围 1 ~ 10000，为 0 时不设置
+	MemoryHigh string `json:"memoryHigh"` // memory.high，比如 512M 或 max，为空时不设置
+}
+
+// processRule 按照 exe 路径、命令行或 cgroup 路径匹配进程，所有设置了的条件都满足时才匹配
+type processRule struct {
+	Name    string `json:"name"`    // 规则名称，用于 cgroup slice 的名称
+	Exe     string `json:"exe"`     // 可执行文件的完整路径或者文件名
+	Cmdline string `json:"cmdline"` // 匹配命令行的正则表达式，参数之间用空格分隔
+	Cgroup  string `json:"cgroup"`  // 匹配 cgroup v2 路径的正则表达式，比如 ^/user\.slice/
+	priorityCfg
+
+	cmdlineRegexp *regexp.Regexp
+	cgroupRegexp  *regexp.Regexp
+}
+
+var ruleNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (p *priorityCfg) hasCgroupSettings() bool {
+	return p.CPUWeight != 0 || p.IOWeight != 0 || p.MemoryHigh != ""
+}
+
+func (p *priorityCfg) check() error {
+	if p.CPUWeight > 10000 {
+		return fmt.Errorf("cpuWeight %d out of range [1, 10000]", p.CPUWeight)
+	}
+	if p.IOWeight > 10000 {
+		return fmt.Errorf("ioWeight %d out of range [1, 10000]", p.IOWeight)
+	}
+	if p.MemoryHigh != "" {
+		_, err := parseMemoryHigh(p.MemoryHigh)
+		if err != nil {
+			return fmt.Errorf("invalid memoryHigh %q", p.MemoryHigh)
+		}
+	}
+	return nil
+}
+
+func (r *processRule) init() error {
+	if r.Exe == "" && r.Cmdline == "" && r.Cgroup == "" {
+		return fmt.Errorf("rule %q has no match condition", r.Name)
+	}
+	if r.hasCgroupSettings() && !ruleNameRegexp.MatchString(r.Name) {
+		return fmt.Errorf("rule name %q is invalid", r.Name)
+	}
+	err := r.priorityCfg.check()
+	if err != nil {
+		return fmt.Errorf("rule %q: %v", r.Name, err)
+	}
+
+	if r.Cmdline != "" {
+		r.cmdlineRegexp, err = regexp.Compile(r.Cmdline)
+		if err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+	if r.Cgroup != "" {
+		r.cgroupRegexp, err = regexp.Compile(r.Cgroup)
+		if err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// 进程的信息，cmdline 和 cgroup 只在规则需要时才读取
+type processInfo struct {
+	pid     int
+	exe     string
+	cmdline func() string
+	cgroup  func() string
+}
+
+func (r *processRule) match(info *processInfo) bool {
+	if r.Exe != "" && r.Exe != info.exe && r.Exe != filepath.Base(info.exe) {
+		return false
+	}
+	if r.cmdlineRegexp != nil && !r.cmdlineRegexp.MatchString(info.cmdline()) {
+		return false
+	}
+	if r.cgroupRegexp != nil && !r.cgroupRegexp.MatchString(info.cgroup()) {
+		return false
+	}
+	return true
 }
 
-func (c *config) getPriority(exe string) *priorityCfg {
-	if pCfg, ok := c.Processes[exe]; ok {
-		return pCfg
+// 初始化规则，processes 中的配置转换为只按 exe 匹配的规则，放在 rules 前面，无效的规则会被忽略
+func (c *config) init() {
+	rules := make([]*processRule, 0, len(c.Processes)+len(c.Rules))
+	for exe, pCfg := range c.Processes {
+		if pCfg == nil {
+			continue
+		}
+		rules = append(rules, &processRule{
+			Name:        ruleNameFromExe(exe),
+			Exe:         exe,
+			priorityCfg: *pCfg,
+		})
+	}
+	// processes 中完整路径优先于文件名
+	sort.Slice(rules, func(i, j int) bool {
+		iAbs := filepath.IsAbs(rules[i].Exe)
+		jAbs := filepath.IsAbs(rules[j].Exe)
+		if iAbs != jAbs {
+			return iAbs
+		}
+		return rules[i].Exe < rules[j].Exe
+	})
+	rules = append(rules, c.Rules...)
+
+	validRules := rules[:0]
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		err := rule.init()
+		if err != nil {
+			logger.Warning("ignore invalid rule:", err)
+			continue
+		}
+		validRules = append(validRules, rule)
 	}
-	name := filepath.Base(exe)
-	if pCfg, ok := c.Processes[name]; ok {
-		return pCfg
+	c.Rules = validRules
+}
+
+var ruleNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func ruleNameFromExe(exe string) string {
+	return ruleNameInvalidChars.ReplaceAllString(filepath.Base(exe), "_")
+}
+
+// getRule 返回第一个匹配进程的规则
+func (c *config) getRule(info *processInfo) *processRule {
+	for _, rule := range c.Rules {
+		if rule.match(info) {
+			return rule
+		}
 	}
 	return nil
 }
 
+func (c *config) hasCgroupSettings() bool {
+	for _, rule := range c.Rules {
+		if rule.hasCgroupSettings() {
+			return true
+		}
+	}
+	return false
+}
+
 func loadConfigAux(filename string) (*config, error) {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -42,6 +187,7 @@ func loadConfigAux(filename string) (*config, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.init()
 	cfg.filename = filename
 	return &cfg, nil
 }
@@ -8,14 +8,19 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/godbus/dbus"
 	"github.com/linuxdeepin/go-lib/procfs"
 )
 
 // 遍历所有进程, 设置优先级
-func updateProcessesPriority(cfg *config) error {
+func updateProcessesPriority(cfg *config, cgm *cgroupManager) error {
+	if cgm != nil {
+		cgm.prune()
+	}
 	fileInfos, err := readDir("/proc")
 	if err != nil {
 		return err
@@ -28,27 +33,68 @@ func updateProcessesPriority(cfg *config) error {
 			continue
 		}
 
-		setProcessPriority(cfg, pid)
+		setProcessPriority(cfg, cgm, pid)
 	}
 	return nil
 }
 
-// 设置进程优先级
-func setProcessPriority(cfg *config, pid int) {
+// 设置进程优先级，cgm 为 nil 时不使用 cgroup v2 的设置
+func setProcessPriority(cfg *config, cgm *cgroupManager, pid int) {
 	exe, err := getProcessExe(pid)
 	if err != nil {
 		// 有些无法获取 exe, 比如内核线程 kworker/2:1-events
 		return
 	}
-	pCfg := cfg.getPriority(exe)
-	if pCfg == nil {
+
+	var cgroup string
+	var cgroupLoaded bool
+	getCgroup := func() string {
+		if !cgroupLoaded {
+			cgroupLoaded = true
+			if cgm != nil {
+				cgroup, err = cgm.getProcessCgroup(pid)
+				if err != nil {
+					logger.Debug(err)
+				}
+			}
+		}
+		return cgroup
+	}
+	info := &processInfo{
+		pid: pid,
+		exe: exe,
+		cmdline: func() string {
+			cmdline, err := procfs.Process(pid).Cmdline()
+			if err != nil {
+				return ""
+			}
+			return strings.Join(cmdline, " ")
+		},
+		cgroup: getCgroup,
+	}
+	rule := cfg.getRule(info)
+	if rule == nil {
 		// 无配置
 		return
 	}
+
 	// 仅在有配置时设置优先级
-	err = setProcessCpuPriority(pid, pCfg.CPU)
-	if err != nil {
-		logger.Warningf("set priority for process %d (exe: %v) failed: %v", pid, exe, err)
+	if rule.CPU != nil {
+		err = setProcessCpuPriority(pid, *rule.CPU)
+		if err != nil {
+			logger.Warningf("set priority for process %d (exe: %v) failed: %v", pid, exe, err)
+		}
+	}
+
+	if cgm != nil && rule.hasCgroupSettings() {
+		cgroup := getCgroup()
+		if cgroup == "" {
+			return
+		}
+		err = cgm.applyRule(pid, cgroup, rule)
+		if err != nil {
+			logger.Warningf("apply rule %s for process %d (exe: %v) failed: %v", rule.Name, pid, exe, err)
+		}
 	}
 }
 
@@ -131,13 +177,28 @@ func start() error {
 		return nil
 	}
 
+	var cgm *cgroupManager
+	if cfg.hasCgroupSettings() {
+		if isCgroupV2(cgroupV2Root) {
+			sysBus, err := dbus.SystemBus()
+			if err != nil {
+				return err
+			}
+			cgm = newCgroupManager("/proc", newSystemdObject(sysBus))
+		} else {
+			logger.Info("cgroup v2 is not available, ignore cgroup settings")
+		}
+	}
+
 	var pm *procMonitor
-	if cfg.ProcMonitorEnabled {
+	// 使用 cgroup 设置时需要尽快把新启动的进程移动到规则的 slice 中，否则它创建的子进程都会留在原来的 cgroup 中，
+	// 所以也需要监控进程事件。
+	if cfg.ProcMonitorEnabled || cgm != nil {
 		pm = newProcMonitor(func() {
 			// 定时器回调函数
 			pids := pm.getAlivePids()
 			for _, pid := range pids {
-				setProcessPriority(cfg, int(pid))
+				setProcessPriority(cfg, cgm, int(pid))
 			}
 		})
 		go func() {
@@ -148,14 +209,14 @@ func start() error {
 		}()
 	}
 
-	err = updateProcessesPriority(cfg)
+	err = updateProcessesPriority(cfg, cgm)
 	if err != nil {
 		logger.Warning("updateProcessesPriority err:", err)
 	}
 	ticker := time.NewTicker(time.Second * updateAllIntervalSec)
 	go func() {
 		for range ticker.C {
-			err := updateProcessesPriority(cfg)
+			err := updateProcessesPriority(cfg, cgm)
 			if err != nil {
 				logger.Warning("updateProcessesPriority err:", err)
 			}
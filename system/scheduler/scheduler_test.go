@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `{
+  "enabled": true,
+  "processes": {
+    "/usr/bin/foo": {"cpu": 19},
+    "bar": {"cpu": 10, "cpuWeight": 50}
+  },
+  "rules": [
+    {"name": "indexer", "cmdline": "^python3 .*indexer\\.py", "ioWeight": 10, "memoryHigh": "512M"},
+    {"name": "user-apps", "exe": "baz", "cgroup": "^/user\\.slice/", "cpuWeight": 200}
+  ]
+}`
+
+func newTestProcessInfo(exe, cmdline, cgroup string) *processInfo {
+	return &processInfo{
+		exe:     exe,
+		cmdline: func() string { return cmdline },
+		cgroup:  func() string { return cgroup },
+	}
+}
+
+func TestConfig_getRule(t *testing.T) {
+	var cfg config
+	require.NoError(t, json.Unmarshal([]byte(testConfig), &cfg))
+	cfg.init()
+	assert.True(t, cfg.hasCgroupSettings())
+
+	rule := cfg.getRule(newTestProcessInfo("/usr/bin/foo", "foo", ""))
+	require.NotNil(t, rule)
+	assert.Equal(t, 19, *rule.CPU)
+	assert.False(t, rule.hasCgroupSettings())
+
+	rule = cfg.getRule(newTestProcessInfo("/opt/bar/bar", "bar", ""))
+	require.NotNil(t, rule)
+	assert.Equal(t, "bar", rule.Name)
+	assert.Equal(t, uint64(50), rule.CPUWeight)
+
+	rule = cfg.getRule(newTestProcessInfo("/usr/bin/python3.9", "python3 /opt/indexer.py -d", ""))
+	require.NotNil(t, rule)
+	assert.Equal(t, "indexer", rule.Name)
+	assert.Nil(t, rule.CPU)
+
+	rule = cfg.getRule(newTestProcessInfo("/usr/bin/baz", "baz", "/user.slice/user-1000.slice/session-2.scope"))
+	require.NotNil(t, rule)
+	assert.Equal(t, "user-apps", rule.Name)
+	assert.Nil(t, cfg.getRule(newTestProcessInfo("/usr/bin/baz", "baz", "/system.slice/baz.service")))
+	assert.Nil(t, cfg.getRule(newTestProcessInfo("/usr/bin/other", "other", "")))
+}
+
+func TestConfig_initInvalidRules(t *testing.T) {
+	// 无效的规则被忽略，不影响其他规则
+	var cfg config
+	require.NoError(t, json.Unmarshal([]byte(`{"rules": [
+		{"name": "a"},
+		{"name": "a b", "exe": "a", "cpuWeight": 10},
+		{"name": "a", "exe": "a", "cpuWeight": 10001},
+		{"name": "a", "exe": "a", "memoryHigh": "1X"},
+		{"name": "a", "exe": "a", "memoryHigh": "99999999999T"},
+		{"name": "a", "cmdline": "("},
+		null,
+		{"name": "ok", "exe": "a", "cpu": 5}
+	]}`), &cfg))
+	cfg.init()
+	require.Len(t, cfg.Rules, 1)
+	assert.Equal(t, "ok", cfg.Rules[0].Name)
+}
+
+func writeTestFile(t *testing.T, filename, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+}
+
+func TestLoadConfig_oldFormat(t *testing.T) {
+	// 旧的配置文件只有 processes 和 cpu，cpu 为 0 时也需要设置
+	filename := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, filename, `{
+  "enabled": true,
+  "procMonitorEnabled": false,
+  "processes": {
+    "/usr/bin/deepin-anything-tool": {"cpu": 19},
+    "dde-file-manager-daemon": {"cpu": 0}
+  }
+}`)
+	cfg, err := loadConfigAux(filename)
+	require.NoError(t, err)
+	assert.True(t, cfg.Enabled)
+	assert.False(t, cfg.hasCgroupSettings())
+
+	rule := cfg.getRule(newTestProcessInfo("/usr/bin/deepin-anything-tool", "", ""))
+	require.NotNil(t, rule)
+	require.NotNil(t, rule.CPU)
+	assert.Equal(t, 19, *rule.CPU)
+
+	rule = cfg.getRule(newTestProcessInfo("/usr/bin/dde-file-manager-daemon", "", ""))
+	require.NotNil(t, rule)
+	require.NotNil(t, rule.CPU)
+	assert.Equal(t, 0, *rule.CPU)
+}
+
+type fakeSystemdCall struct {
+	method     string
+	name       string
+	properties map[string]interface{}
+}
+
+type fakeSystemd struct {
+	calls    []fakeSystemdCall
+	startErr error
+}
+
+func (s *fakeSystemd) record(method, name string, properties []systemdProperty) {
+	props := make(map[string]interface{})
+	for _, p := range properties {
+		props[p.Name] = p.Value.Value()
+	}
+	s.calls = append(s.calls, fakeSystemdCall{method: method, name: name, properties: props})
+}
+
+func (s *fakeSystemd) startTransientUnit(name, mode string, properties []systemdProperty) error {
+	s.record("StartTransientUnit", name, properties)
+	return s.startErr
+}
+
+func (s *fakeSystemd) setUnitProperties(name string, runtime bool, properties []systemdProperty) error {
+	s.record("SetUnitProperties", name, properties)
+	return nil
+}
+
+func TestCgroupManager_applyRule(t *testing.T) {
+	root := t.TempDir()
+	assert.False(t, isCgroupV2(root))
+	writeTestFile(t, filepath.Join(root, "cgroup.controllers"), "cpuset cpu io memory pids")
+	assert.True(t, isCgroupV2(root))
+
+	procDir := t.TempDir()
+	writeTestFile(t, filepath.Join(procDir, "100/cgroup"), "0::/user.slice/user-1000.slice/session-2.scope\n")
+	systemd := &fakeSystemd{}
+	cm := newCgroupManager(procDir, systemd)
+	cgroup, err := cm.getProcessCgroup(100)
+	require.NoError(t, err)
+	assert.Equal(t, "/user.slice/user-1000.slice/session-2.scope", cgroup)
+
+	rule := &processRule{
+		Name: "foo-bar",
+		priorityCfg: priorityCfg{
+			CPUWeight:  50,
+			IOWeight:   20,
+			MemoryHigh: "1G",
+		},
+	}
+	ruleProps := map[string]interface{}{
+		"CPUWeight":  uint64(50),
+		"IOWeight":   uint64(20),
+		"MemoryHigh": uint64(1 << 30),
+	}
+
+	// 会话中的进程通过 systemd 移动到规则的 slice 中，slice 只设置一次
+	require.NoError(t, cm.applyRule(100, cgroup, rule))
+	require.NoError(t, cm.applyRule(101, cgroup, rule))
+	slice := `user-1000-ddescheduler_foo\x2dbar.slice`
+	assert.Equal(t, []fakeSystemdCall{
+		{"StartTransientUnit", "ddescheduler_foo-bar-100.scope", map[string]interface{}{
+			"Description": "dde scheduler rule foo-bar",
+			"Slice":       slice,
+			"PIDs":        []uint32{100},
+		}},
+		{"SetUnitProperties", slice, ruleProps},
+		{"StartTransientUnit", "ddescheduler_foo-bar-101.scope", map[string]interface{}{
+			"Description": "dde scheduler rule foo-bar",
+			"Slice":       slice,
+			"PIDs":        []uint32{101},
+		}},
+	}, systemd.calls)
+
+	// 系统服务中的进程也移动到规则的 slice 中，不影响服务中的其他进程
+	systemd.calls = nil
+	require.NoError(t, cm.applyRule(200, "/system.slice/system-getty.slice/getty@tty1.service", rule))
+	require.NoError(t, cm.applyRule(201, "/system.slice/docker.service/sub", rule))
+	systemSlice := `system-ddescheduler_foo\x2dbar.slice`
+	assert.Equal(t, []fakeSystemdCall{
+		{"StartTransientUnit", "ddescheduler_foo-bar-200.scope", map[string]interface{}{
+			"Description": "dde scheduler rule foo-bar",
+			"Slice":       systemSlice,
+			"PIDs":        []uint32{200},
+		}},
+		{"SetUnitProperties", systemSlice, ruleProps},
+		{"StartTransientUnit", "ddescheduler_foo-bar-201.scope", map[string]interface{}{
+			"Description": "dde scheduler rule foo-bar",
+			"Slice":       systemSlice,
+			"PIDs":        []uint32{201},
+		}},
+	}, systemd.calls)
+
+	// 不处理 init.scope、用户 systemd 管理的以及已经在规则 slice 中的进程
+	systemd.calls = nil
+	for _, cgroup := range []string{
+		"/init.scope",
+		"/user.slice/user-1000.slice/user@1000.service/app.slice/foo.service",
+		"/user.slice/user-1000.slice/" + slice + "/ddescheduler_foo-bar-100.scope",
+		"/system.slice/" + systemSlice + "/ddescheduler_foo-bar-200.scope",
+		"/system.slicex/foo.service",
+	} {
+		require.NoError(t, cm.applyRule(1, cgroup, rule))
+	}
+	assert.Empty(t, systemd.calls)
+}
+
+func TestCgroupManager_retryAndPrune(t *testing.T) {
+	procDir := t.TempDir()
+	slice := "user-1000-ddescheduler_foo.slice"
+	writeTestFile(t, filepath.Join(procDir, "100/cgroup"), "0::/user.slice/user-1000.slice/"+slice+"/ddescheduler_foo-100.scope\n")
+	writeTestFile(t, filepath.Join(procDir, "101/cgroup"), "0::/user.slice/user-1000.slice/session-2.scope\n")
+	systemd := &fakeSystemd{}
+	cm := newCgroupManager(procDir, systemd)
+	now := time.Now()
+	cm.now = func() time.Time { return now }
+	rule := &processRule{Name: "foo", priorityCfg: priorityCfg{CPUWeight: 50}}
+	session := "/user.slice/user-1000.slice/session-2.scope"
+
+	// 移动失败后在等待期间不再重试
+	systemd.startErr = errors.New("failed")
+	assert.Error(t, cm.applyRule(101, session, rule))
+	assert.NoError(t, cm.applyRule(101, session, rule))
+	assert.Len(t, systemd.calls, 1)
+	now = now.Add(moveProcessRetryMinDelay)
+	assert.Error(t, cm.applyRule(101, session, rule))
+	assert.Len(t, systemd.calls, 2)
+	// 连续失败时等待的时间加倍
+	now = now.Add(moveProcessRetryMinDelay)
+	assert.NoError(t, cm.applyRule(101, session, rule))
+	assert.Len(t, systemd.calls, 2)
+
+	systemd.startErr = nil
+	systemd.calls = nil
+	require.NoError(t, cm.applyRule(100, session, rule))
+	assert.Len(t, systemd.calls, 2)
+	assert.True(t, cm.configured[slice])
+
+	// 进程还在 slice 中时保留记录，退出后 slice 需要重新设置属性
+	cm.prune()
+	assert.True(t, cm.configured[slice])
+	assert.Contains(t, cm.failures, 101)
+	require.NoError(t, os.RemoveAll(filepath.Join(procDir, "100")))
+	require.NoError(t, os.RemoveAll(filepath.Join(procDir, "101")))
+	cm.prune()
+	assert.Empty(t, cm.configured)
+	assert.Empty(t, cm.slicePids)
+	assert.Empty(t, cm.failures)
+}
+
+func TestParseMemoryHigh(t *testing.T) {
+	for str, want := range map[string]uint64{
+		"max":  math.MaxUint64,
+		"4096": 4096,
+		"512K": 512 << 10,
+		"512M": 512 << 20,
+		"2G":   2 << 30,
+		"1T":   1 << 40,
+	} {
+		value, err := parseMemoryHigh(str)
+		require.NoError(t, err, str)
+		assert.Equal(t, want, value, str)
+	}
+	for _, str := range []string{"", "M", "1X", "-1", "99999999999T"} {
+		_, err := parseMemoryHigh(str)
+		assert.Error(t, err, str)
+	}
+}